@@ -14,44 +14,409 @@
 package cmd
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
-	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
 	"github.com/Keyfactor/keyfactor-go-client/v3/api"
-
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
+// defaultCertificateListFields are the fields shown by 'certificates list' in text and csv output.
+var defaultCertificateListFields = []string{
+	"Id",
+	"Thumbprint",
+	"IssuedCN",
+	"IssuerDN",
+	"NotAfter",
+	"CertStateString",
+}
+
+// defaultCertificateGetFields are the fields shown by 'certificates get' in text and csv output.
+var defaultCertificateGetFields = []string{
+	"Id",
+	"Thumbprint",
+	"SerialNumber",
+	"IssuedDN",
+	"IssuerDN",
+	"NotBefore",
+	"NotAfter",
+	"KeyTypeString",
+	"KeySizeInBits",
+	"TemplateName",
+	"CertificateAuthorityName",
+	"CertStateString",
+	"HasPrivateKey",
+	"SubjectAltNameElements",
+	"Locations",
+	"Metadata",
+}
+
 // certificatesCmd represents the certificates command
 var certificatesCmd = &cobra.Command{
 	Use:   "certificates",
 	Short: "Keyfactor Command certificate APIs and utilities.",
 	Long:  `A collections of APIs and utilities for interacting with Keyfactor certificates.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		expEnabled, _ := cmd.Flags().GetBool("exp")
-		isExperimental := true
+}
+
+var certificatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Search for certificates in Keyfactor Command.",
+	Long: `Search for certificates in Keyfactor Command using a Keyfactor Command query string and/or a certificate
+collection. By default every page of results is returned, use --page to return a single page. Use --fields to select
+the fields to output.`,
+	Example: `kfutil certificates list --query 'IssuedCN -contains "example.com"' --fields Id,Thumbprint,NotAfter
+kfutil certificates list --collection "Expiring Certs" --include-locations --format json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
 
-		_, expErr := isExperimentalFeatureEnabled(expEnabled, isExperimental)
-		if expErr != nil {
-			fmt.Println(fmt.Sprintf("WARNING this is an expEnabled feature, %s", expErr))
-			log.Fatalf("[ERROR]: %s", expErr)
+		query, _ := cmd.Flags().GetString("query")
+		collection, _ := cmd.Flags().GetString("collection")
+		includeMetadata, _ := cmd.Flags().GetBool("include-metadata")
+		includeLocations, _ := cmd.Flags().GetBool("include-locations")
+		includeRevoked, _ := cmd.Flags().GetBool("include-revoked")
+		includeExpired, _ := cmd.Flags().GetBool("include-expired")
+		page, _ := cmd.Flags().GetInt32("page")
+		pageSize, _ := cmd.Flags().GetInt32("page-size")
+		fields, _ := cmd.Flags().GetStringSlice("fields")
+
+		log.Debug().Str("query", query).
+			Str("collection", collection).
+			Int32("page", page).
+			Int32("pageSize", pageSize).
+			Strs("fields", fields).
+			Msg("list certificates")
+
+		sdkClient, cErr := initGenClient(false)
+		if cErr != nil {
+			return cErr
+		}
+
+		q := certificateQuery{
+			Query:            query,
+			IncludeMetadata:  includeMetadata,
+			IncludeLocations: includeLocations,
+			IncludeRevoked:   includeRevoked,
+			IncludeExpired:   includeExpired,
+			Page:             page,
+			PageSize:         pageSize,
+		}
+		if collection != "" {
+			collectionId, colErr := resolveCollectionId(sdkClient, collection)
+			if colErr != nil {
+				return colErr
+			}
+			q.CollectionId = collectionId
 		}
-		fmt.Println("NOT IMPLEMENTED: certificates called")
+
+		certs, err := queryCertificates(sdkClient, q)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to list certificates")
+			return err
+		}
+		out, fErr := formatCertificates(certs, fields, defaultCertificateListFields, outputFormat, false)
+		if fErr != nil {
+			return fErr
+		}
+		outputResult(out, outputFormat)
+		return nil
+	},
+}
+
+var certificatesGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get a certificate by ID, thumbprint or serial number.",
+	Long: `Get a certificate from Keyfactor Command by ID, thumbprint or serial number, including its metadata and
+store locations.`,
+	Example: `kfutil certificates get --id 1234
+kfutil certificates get --thumbprint 0123456789ABCDEF0123456789ABCDEF01234567 --format yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		selector, sErr := certificateSelectorFromFlags(cmd)
+		if sErr != nil {
+			return sErr
+		}
+		fields, _ := cmd.Flags().GetStringSlice("fields")
+
+		sdkClient, cErr := initGenClient(false)
+		if cErr != nil {
+			return cErr
+		}
+
+		cert, err := lookupCertificate(sdkClient, selector, true)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to get certificate")
+			return err
+		}
+		out, fErr := formatCertificates(
+			[]keyfactor.ModelsCertificateRetrievalResponse{*cert},
+			fields,
+			defaultCertificateGetFields,
+			outputFormat,
+			true,
+		)
+		if fErr != nil {
+			return fErr
+		}
+		outputResult(out, outputFormat)
+		return nil
 	},
 }
 
 func init() {
-	//RootCmd.AddCommand(certificatesCmd)
+	RootCmd.AddCommand(certificatesCmd)
+
+	certificatesCmd.AddCommand(certificatesListCmd)
+	certificatesListCmd.Flags().StringP("query", "q", "", "Keyfactor Command certificate query string.")
+	certificatesListCmd.Flags().String("collection", "", "Name or ID of a certificate collection to search.")
+	certificatesListCmd.Flags().Bool("include-metadata", false, "Include certificate metadata.")
+	certificatesListCmd.Flags().Bool("include-locations", false, "Include the certificate store locations of each certificate.")
+	certificatesListCmd.Flags().Bool("include-revoked", false, "Include revoked certificates.")
+	certificatesListCmd.Flags().Bool("include-expired", false, "Include expired certificates.")
+	certificatesListCmd.Flags().Int32("page", 0, "Return a single page of results. By default all pages are returned.")
+	certificatesListCmd.Flags().Int32("page-size", certificateQueryPageSize, "Number of certificates per page.")
+	certificatesListCmd.Flags().StringSlice(
+		"fields",
+		[]string{},
+		fmt.Sprintf(
+			"Certificate fields to output. Defaults to %s for text and csv, and to every field for json and yaml.",
+			strings.Join(defaultCertificateListFields, ","),
+		),
+	)
+
+	certificatesCmd.AddCommand(certificatesGetCmd)
+	addCertificateSelectorFlags(certificatesGetCmd)
+	certificatesGetCmd.Flags().StringSlice(
+		"fields",
+		[]string{},
+		"Certificate fields to output. Defaults to all commonly used fields for text and csv, and to every field for json and yaml.",
+	)
+}
+
+// addCertificateSelectorFlags registers the --id, --thumbprint and --serial flags used to select a single certificate.
+func addCertificateSelectorFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("id", 0, "Keyfactor Command certificate ID.")
+	cmd.Flags().String("thumbprint", "", "Certificate thumbprint.")
+	cmd.Flags().String("serial", "", "Certificate serial number.")
+	cmd.MarkFlagsMutuallyExclusive("id", "thumbprint", "serial")
+	cmd.MarkFlagsOneRequired("id", "thumbprint", "serial")
+}
 
-	// Here you will define your flags and configuration settings.
+func certificateSelectorFromFlags(cmd *cobra.Command) (certificateSelector, error) {
+	id, _ := cmd.Flags().GetInt("id")
+	thumbprint, _ := cmd.Flags().GetString("thumbprint")
+	serial, _ := cmd.Flags().GetString("serial")
+	selector := certificateSelector{Id: id, Thumbprint: thumbprint, Serial: serial}
+	if _, err := selector.query(); err != nil {
+		return selector, err
+	}
+	return selector, nil
+}
+
+// certificateFields converts a certificate to a map keyed by API field name.
+func certificateFields(cert keyfactor.ModelsCertificateRetrievalResponse) (map[string]interface{}, error) {
+	data, err := json.Marshal(cert)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if jErr := json.Unmarshal(data, &fields); jErr != nil {
+		return nil, jErr
+	}
+	return fields, nil
+}
+
+// certificateFieldNames returns the API names of the fields of a certificate.
+func certificateFieldNames() []string {
+	var names []string
+	t := reflect.TypeOf(keyfactor.ModelsCertificateRetrievalResponse{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// certificatesCmd.PersistentFlags().String("foo", "", "A help for foo")
+// selectCertificateFields returns only the requested fields, matched case-insensitively, keyed by their API name.
+func selectCertificateFields(all map[string]interface{}, fields []string) (map[string]interface{}, []string, error) {
+	valid := certificateFieldNames()
+	byLower := make(map[string]string)
+	for _, name := range valid {
+		byLower[strings.ToLower(name)] = name
+	}
+	selected := make(map[string]interface{})
+	var names []string
+	for _, f := range fields {
+		name, ok := byLower[strings.ToLower(strings.TrimSpace(f))]
+		if !ok {
+			return nil, nil, fmt.Errorf(
+				"unknown certificate field %q, valid fields are %s",
+				strings.TrimSpace(f),
+				strings.Join(valid, ", "),
+			)
+		}
+		selected[name] = all[name]
+		names = append(names, name)
+	}
+	return selected, names, nil
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// certificatesCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// certificateFieldString renders a certificate field for tabular output.
+func certificateFieldString(name string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		// %v would print large IDs in exponent notation
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return fmt.Sprintf("%t", v)
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				parts = append(parts, certificateFieldString(name, item))
+				continue
+			}
+			switch name {
+			case "SubjectAltNameElements":
+				parts = append(parts, fmt.Sprintf("%v", m["Value"]))
+			case "Locations":
+				parts = append(parts, fmt.Sprintf("%v:%v", m["StoreMachine"], m["StorePath"]))
+			default:
+				b, _ := json.Marshal(m)
+				parts = append(parts, string(b))
+			}
+		}
+		return strings.Join(parts, ";")
+	case map[string]interface{}:
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var parts []string
+		for _, k := range keys {
+			parts = append(parts, fmt.Sprintf("%s=%s", k, certificateFieldString(k, v[k])))
+		}
+		return strings.Join(parts, ";")
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// formatCertificates renders certificates as text, csv, json or yaml. Text output is a table, or a list of
+// field/value pairs when single is set. Without requested fields, text and csv show the default fields and json and
+// yaml every field of the certificates.
+func formatCertificates(
+	certs []keyfactor.ModelsCertificateRetrievalResponse,
+	fields []string,
+	defaultFields []string,
+	format string,
+	single bool,
+) (string, error) {
+	format = strings.ToLower(format)
+	structured := format == "json" || format == "yaml" || format == "yml"
+	if len(fields) == 0 && !structured {
+		fields = defaultFields
+	}
+	_, names, sErr := selectCertificateFields(map[string]interface{}{}, fields)
+	if sErr != nil {
+		return "", sErr
+	}
+	var rows []map[string]interface{}
+	for _, cert := range certs {
+		row, err := certificateFields(cert)
+		if err != nil {
+			return "", err
+		}
+		if len(fields) > 0 {
+			row, _, _ = selectCertificateFields(row, fields)
+		}
+		rows = append(rows, row)
+	}
+
+	var out interface{} = rows
+	if rows == nil {
+		out = []map[string]interface{}{}
+	}
+	if single && len(rows) == 1 {
+		out = rows[0]
+	}
+
+	var sb strings.Builder
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case "yaml", "yml":
+		b, err := yaml.Marshal(out)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\n"), nil
+	case "csv":
+		w := csv.NewWriter(&sb)
+		w.Write(names)
+		for _, row := range rows {
+			var record []string
+			for _, name := range names {
+				record = append(record, certificateFieldString(name, row[name]))
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		return strings.TrimRight(sb.String(), "\n"), w.Error()
+	default:
+		w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		if single && len(rows) == 1 {
+			for _, name := range names {
+				fmt.Fprintf(w, "%s:\t%s\n", name, certificateFieldString(name, rows[0][name]))
+			}
+		} else {
+			fmt.Fprintln(w, strings.Join(names, "\t"))
+			for _, row := range rows {
+				var record []string
+				for _, name := range names {
+					record = append(record, certificateFieldString(name, row[name]))
+				}
+				fmt.Fprintln(w, strings.Join(record, "\t"))
+			}
+		}
+		w.Flush()
+		return strings.TrimRight(sb.String(), "\n"), nil
+	}
 }
 
 func certToString(response *api.GetCertificateResponse) string {
@@ -0,0 +1,420 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"kfutil/pkg/certutil"
+)
+
+const (
+	downloadFormatPEM = "pem"
+	downloadFormatDER = "der"
+	downloadFormatP7B = "p7b"
+	downloadFormatPFX = "pfx"
+
+	chainOrderLeafFirst = "leaf-first"
+	chainOrderRootFirst = "root-first"
+)
+
+var downloadFormats = []string{downloadFormatPEM, downloadFormatDER, downloadFormatP7B, downloadFormatPFX}
+
+// downloadOptions describes which files 'certificates download' writes and how they are encoded.
+type downloadOptions struct {
+	Format    string
+	Chain     bool
+	RootFirst bool
+	Out       string
+	CertOut   string
+	KeyOut    string
+	ChainOut  string
+}
+
+// downloadFile is a single file to be written by 'certificates download'.
+type downloadFile struct {
+	Path        string
+	Description string
+	Data        []byte
+}
+
+// validate checks the options once withDefaultOut has been applied.
+func (o downloadOptions) validate() error {
+	switch o.Format {
+	case downloadFormatPEM, downloadFormatDER, downloadFormatP7B, downloadFormatPFX:
+	default:
+		return fmt.Errorf("invalid format %q, must be one of %s", o.Format, strings.Join(downloadFormats, ", "))
+	}
+	if o.KeyOut != "" && o.Format != downloadFormatPFX {
+		return fmt.Errorf("--key-out requires --format %s", downloadFormatPFX)
+	}
+	if o.Format == downloadFormatDER && o.Chain && o.Out != "" {
+		return fmt.Errorf("DER output holds a single certificate, use --format pem or p7b or --chain-out for the chain")
+	}
+	if o.Format == downloadFormatPFX && o.RootFirst && o.ChainOut == "" {
+		return fmt.Errorf(
+			"the PFX is written as returned by Keyfactor Command, --chain-order %s only applies to --chain-out",
+			chainOrderRootFirst,
+		)
+	}
+	return nil
+}
+
+// needsChain reports whether the issuing chain must be requested from Keyfactor Command.
+func (o downloadOptions) needsChain() bool {
+	return o.Chain || o.ChainOut != ""
+}
+
+// withDefaultOut names the output file after the certificate thumbprint when no output file was given.
+func (o downloadOptions) withDefaultOut(thumbprint string) downloadOptions {
+	if o.Out == "" && o.CertOut == "" && o.KeyOut == "" && o.ChainOut == "" {
+		o.Out = fmt.Sprintf("%s.%s", strings.ToUpper(thumbprint), o.Format)
+	}
+	return o
+}
+
+var certificatesDownloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Download a certificate, optionally with its chain and private key.",
+	Long: `Download a certificate from Keyfactor Command as PEM, DER, PKCS#7 (p7b) or PKCS#12 (pfx). Use --chain to include
+the issuing chain and --chain-order to control whether the leaf or the root comes first. PFX downloads recover the
+private key and are protected with a password read from --password-env, --password-file or an interactive prompt.
+The PFX is written as returned by Keyfactor Command, so --chain-order root-first requires --chain-out with PFX.
+The certificate, private key and chain can also be written to separate PEM files with --cert-out, --key-out and
+--chain-out. All files are written with 0600 permissions.`,
+	Example: `kfutil certificates download --id 1234 --chain --out web.pem
+kfutil certificates download --thumbprint 0123456789ABCDEF0123456789ABCDEF01234567 --format p7b --chain --chain-order root-first
+kfutil certificates download --id 1234 --format pfx --password-env PFX_PASSWORD --cert-out tls.crt --key-out tls.key --chain-out ca.crt`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		selector, sErr := certificateSelectorFromFlags(cmd)
+		if sErr != nil {
+			return sErr
+		}
+		format, _ := cmd.Flags().GetString("format")
+		chain, _ := cmd.Flags().GetBool("chain")
+		chainOrder, _ := cmd.Flags().GetString("chain-order")
+		out, _ := cmd.Flags().GetString("out")
+		certOut, _ := cmd.Flags().GetString("cert-out")
+		keyOut, _ := cmd.Flags().GetString("key-out")
+		chainOut, _ := cmd.Flags().GetString("chain-out")
+		passwordEnv, _ := cmd.Flags().GetString("password-env")
+		passwordFile, _ := cmd.Flags().GetString("password-file")
+
+		if chainOrder != chainOrderLeafFirst && chainOrder != chainOrderRootFirst {
+			return fmt.Errorf(
+				"invalid chain order %q, must be %s or %s",
+				chainOrder,
+				chainOrderLeafFirst,
+				chainOrderRootFirst,
+			)
+		}
+		opts := downloadOptions{
+			Format:    strings.ToLower(format),
+			Chain:     chain,
+			RootFirst: chainOrder == chainOrderRootFirst,
+			Out:       out,
+			CertOut:   certOut,
+			KeyOut:    keyOut,
+			ChainOut:  chainOut,
+		}
+		if opts.Format != downloadFormatPFX && (passwordEnv != "" || passwordFile != "") {
+			return fmt.Errorf("--password-env and --password-file require --format %s", downloadFormatPFX)
+		}
+
+		log.Debug().Str("selector", selector.String()).
+			Str("format", opts.Format).
+			Bool("chain", opts.Chain).
+			Str("chainOrder", chainOrder).
+			Msg("download certificate")
+
+		sdkClient, cErr := initGenClient(false)
+		if cErr != nil {
+			return cErr
+		}
+
+		cert, err := lookupCertificate(sdkClient, selector, false)
+		if err != nil {
+			return err
+		}
+		opts = opts.withDefaultOut(cert.GetThumbprint())
+		if vErr := opts.validate(); vErr != nil {
+			return vErr
+		}
+
+		var files []downloadFile
+		var warnings []string
+		if opts.Format == downloadFormatPFX {
+			password, pErr := downloadPfxPassword(passwordEnv, passwordFile)
+			if pErr != nil {
+				return pErr
+			}
+			pfx, rErr := recoverCertificatePfx(sdkClient, cert.GetId(), password, opts.needsChain())
+			if rErr != nil {
+				return rErr
+			}
+			files, warnings, err = planPfxDownload(opts, pfx, password)
+		} else {
+			certs, dErr := downloadCertificateChain(sdkClient, cert.GetId(), opts.needsChain())
+			if dErr != nil {
+				return dErr
+			}
+			files, warnings, err = planCertificateDownload(opts, certs, nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, w := range warnings {
+			fmt.Fprintln(os.Stderr, w)
+		}
+		for _, f := range files {
+			if wErr := writeSecureFile(f.Path, f.Data); wErr != nil {
+				return wErr
+			}
+			fmt.Printf("Wrote %s to %s\n", f.Description, f.Path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesDownloadCmd)
+	addCertificateSelectorFlags(certificatesDownloadCmd)
+	certificatesDownloadCmd.Flags().String(
+		"format",
+		downloadFormatPEM,
+		fmt.Sprintf("Certificate file format, one of %s.", strings.Join(downloadFormats, ", ")),
+	)
+	certificatesDownloadCmd.Flags().Bool("chain", false, "Include the issuing chain in the output file.")
+	certificatesDownloadCmd.Flags().String(
+		"chain-order",
+		chainOrderLeafFirst,
+		fmt.Sprintf("Order of the chain, %s or %s.", chainOrderLeafFirst, chainOrderRootFirst),
+	)
+	certificatesDownloadCmd.Flags().StringP(
+		"out",
+		"o",
+		"",
+		"Output file. Defaults to <thumbprint>.<format> unless --cert-out, --key-out or --chain-out is used.",
+	)
+	certificatesDownloadCmd.Flags().String("cert-out", "", "Write only the certificate to this file.")
+	certificatesDownloadCmd.Flags().String("key-out", "", "Write the PEM encoded private key to this file. Requires --format pfx.")
+	certificatesDownloadCmd.Flags().String("chain-out", "", "Write only the issuing chain to this file.")
+	certificatesDownloadCmd.Flags().String("password-env", "", "Environment variable holding the PFX password.")
+	certificatesDownloadCmd.Flags().String("password-file", "", "File holding the PFX password.")
+	certificatesDownloadCmd.MarkFlagsMutuallyExclusive("password-env", "password-file")
+}
+
+// downloadPfxPassword reads the PFX password from an environment variable or file, prompting for it otherwise.
+func downloadPfxPassword(passwordEnv string, passwordFile string) (string, error) {
+	if passwordEnv != "" || passwordFile != "" {
+		password, err := (&passwordSource{Env: passwordEnv, File: passwordFile}).resolve()
+		if err != nil {
+			return "", err
+		}
+		if password == "" {
+			return "", fmt.Errorf("PFX password must not be empty")
+		}
+		return password, nil
+	}
+	if noPrompt {
+		return "", fmt.Errorf("a PFX password is required, use --password-env or --password-file with --no-prompt")
+	}
+	password := promptForInteractivePassword("PFX password", "")
+	if password == "" {
+		return "", fmt.Errorf("PFX password must not be empty")
+	}
+	return password, nil
+}
+
+// downloadCertificateChain downloads a certificate, and optionally its chain, and returns it ordered leaf first.
+func downloadCertificateChain(sdkClient *keyfactor.APIClient, certId int32, includeChain bool) (
+	[]*x509.Certificate,
+	error,
+) {
+	log.Debug().Int32("certId", certId).Bool("includeChain", includeChain).
+		Msg(fmt.Sprintf("%s CertificateDownloadCertificateAsync", DebugFuncCall))
+	resp, httpResp, err := sdkClient.CertificateApi.CertificateDownloadCertificateAsync(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Rq(keyfactor.ModelsCertificateDownloadRequest{CertID: &certId, IncludeChain: &includeChain}).
+		Execute()
+	if err != nil {
+		return nil, returnHttpErr(httpResp, err)
+	}
+	if resp == nil || resp.GetContent() == "" {
+		return nil, fmt.Errorf("no certificate content returned for certificate ID %d", certId)
+	}
+	certs, pErr := certutil.ParseCertificates([]byte(resp.GetContent()))
+	if pErr != nil {
+		return nil, fmt.Errorf("unable to parse certificate ID %d: %s", certId, pErr)
+	}
+	return certutil.OrderChain(certs, false), nil
+}
+
+// recoverCertificatePfx recovers a certificate and its private key as a password protected PFX.
+func recoverCertificatePfx(sdkClient *keyfactor.APIClient, certId int32, password string, includeChain bool) (
+	[]byte,
+	error,
+) {
+	log.Debug().Int32("certId", certId).Bool("includeChain", includeChain).
+		Msg(fmt.Sprintf("%s CertificateRecoverCertificateAsync", DebugFuncCall))
+	resp, httpResp, err := sdkClient.CertificateApi.CertificateRecoverCertificateAsync(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		XCertificateformat("PFX").
+		Rq(keyfactor.ModelsCertificateRecoveryRequest{Password: password, CertID: &certId, IncludeChain: &includeChain}).
+		Execute()
+	if err != nil {
+		return nil, returnHttpErr(httpResp, err)
+	}
+	if resp == nil || resp.GetPFX() == "" {
+		return nil, fmt.Errorf("no PFX returned for certificate ID %d, the private key may not be recoverable", certId)
+	}
+	pfx, dErr := base64.StdEncoding.DecodeString(resp.GetPFX())
+	if dErr != nil {
+		return nil, fmt.Errorf("unable to decode PFX for certificate ID %d: %s", certId, dErr)
+	}
+	return pfx, nil
+}
+
+// planPfxDownload returns the files for a PFX download. The PFX itself is written as returned by Keyfactor Command,
+// it is only decoded when the certificate, key or chain are written separately.
+func planPfxDownload(opts downloadOptions, pfx []byte, password string) ([]downloadFile, []string, error) {
+	var files []downloadFile
+	if opts.Out != "" {
+		files = append(files, downloadFile{Path: opts.Out, Description: "PFX", Data: pfx})
+	}
+	if opts.CertOut == "" && opts.KeyOut == "" && opts.ChainOut == "" {
+		return files, nil, nil
+	}
+	key, certs, err := certutil.DecodePKCS12(pfx, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	split := opts
+	split.Out = ""
+	more, warnings, err := planCertificateDownload(split, certutil.OrderChain(certs, false), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(files, more...), warnings, nil
+}
+
+// planCertificateDownload encodes the leaf-first certificates, and private key if any, into the requested files.
+func planCertificateDownload(opts downloadOptions, certs []*x509.Certificate, key crypto.PrivateKey) (
+	[]downloadFile,
+	[]string,
+	error,
+) {
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no certificates to write")
+	}
+	leaf := certs[0]
+	issuers := certs[1:]
+	bundle := []*x509.Certificate{leaf}
+	if opts.Chain {
+		bundle = certs
+	}
+
+	var files []downloadFile
+	var warnings []string
+	if opts.Out != "" {
+		data, err := encodeCertificates(certutil.OrderChain(bundle, opts.RootFirst), opts.Format)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, downloadFile{Path: opts.Out, Description: "certificate", Data: data})
+	}
+	if opts.CertOut != "" {
+		certFormat := downloadFormatPEM
+		if opts.Format == downloadFormatDER {
+			certFormat = downloadFormatDER
+		}
+		data, _ := encodeCertificates([]*x509.Certificate{leaf}, certFormat)
+		files = append(files, downloadFile{Path: opts.CertOut, Description: "certificate", Data: data})
+	}
+	if opts.KeyOut != "" {
+		if key == nil {
+			return nil, nil, fmt.Errorf("no private key was returned for the certificate")
+		}
+		data, err := certutil.EncodePrivateKeyPEM(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to encode private key: %s", err)
+		}
+		files = append(files, downloadFile{Path: opts.KeyOut, Description: "private key", Data: data})
+	}
+	if opts.ChainOut != "" {
+		if len(issuers) == 0 {
+			warnings = append(warnings, "No issuing chain was returned, the chain file was not written.")
+		} else {
+			chainFormat := downloadFormatPEM
+			if opts.Format == downloadFormatP7B {
+				chainFormat = downloadFormatP7B
+			}
+			data, err := encodeCertificates(certutil.OrderChain(issuers, opts.RootFirst), chainFormat)
+			if err != nil {
+				return nil, nil, err
+			}
+			files = append(files, downloadFile{Path: opts.ChainOut, Description: "chain", Data: data})
+		}
+	}
+	return files, warnings, nil
+}
+
+func encodeCertificates(certs []*x509.Certificate, format string) ([]byte, error) {
+	switch format {
+	case downloadFormatDER:
+		return certs[0].Raw, nil
+	case downloadFormatP7B:
+		return certutil.EncodePKCS7(certs)
+	default:
+		return certutil.EncodePEM(certs), nil
+	}
+}
+
+// writeSecureFile writes data to a file readable only by the current user, tightening the permissions of an
+// existing file before it is overwritten.
+func writeSecureFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %s", path, err)
+	}
+	defer f.Close()
+	if cErr := f.Chmod(0600); cErr != nil {
+		return fmt.Errorf("unable to set permissions on %s: %s", path, cErr)
+	}
+	if _, wErr := f.Write(data); wErr != nil {
+		return fmt.Errorf("unable to write %s: %s", path, wErr)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"kfutil/pkg/certutil"
+)
+
+// testCertificateChain returns a leaf, intermediate and root certificate and the leaf's private key.
+func testCertificateChain(t *testing.T) ([]*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	var certs []*x509.Certificate
+	var parent *x509.Certificate
+	var parentKey, key *ecdsa.PrivateKey
+	for i, cn := range []string{"Test Root", "Test Intermediate", "test.example.com"} {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(i + 1)),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  i < 2,
+			BasicConstraintsValid: true,
+		}
+		signer, signerKey := tmpl, key
+		if parent != nil {
+			signer, signerKey = parent, parentKey
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+		assert.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+		certs = append([]*x509.Certificate{cert}, certs...)
+		parent, parentKey = cert, key
+	}
+	return certs, key
+}
+
+func Test_DownloadOptionsValidate(t *testing.T) {
+	assert.NoError(t, downloadOptions{Format: downloadFormatPEM, Chain: true, Out: "a.pem"}.validate())
+	assert.Error(t, downloadOptions{Format: "crt"}.validate())
+	assert.Error(t, downloadOptions{Format: downloadFormatPEM, KeyOut: "a.key"}.validate())
+	assert.Error(t, downloadOptions{Format: downloadFormatDER, Chain: true, Out: "a.der"}.validate())
+	assert.NoError(t, downloadOptions{Format: downloadFormatDER, Chain: true, ChainOut: "chain.pem"}.validate())
+
+	assert.Error(t, downloadOptions{Format: downloadFormatPFX, RootFirst: true, Out: "a.pfx"}.validate())
+	assert.NoError(t, downloadOptions{Format: downloadFormatPFX, RootFirst: true, ChainOut: "chain.pem"}.validate())
+
+	opts := downloadOptions{Format: downloadFormatP7B}.withDefaultOut("abcd")
+	assert.Equal(t, "ABCD.p7b", opts.Out)
+	assert.Error(t, downloadOptions{Format: downloadFormatDER, Chain: true}.withDefaultOut("abcd").validate())
+	opts = downloadOptions{Format: downloadFormatPEM, CertOut: "tls.crt"}.withDefaultOut("abcd")
+	assert.Empty(t, opts.Out)
+}
+
+func Test_PlanCertificateDownload(t *testing.T) {
+	chain, key := testCertificateChain(t)
+	leaf, root := chain[0], chain[2]
+
+	files, warnings, err := planCertificateDownload(
+		downloadOptions{Format: downloadFormatPEM, Chain: true, RootFirst: true, Out: "bundle.pem"},
+		chain,
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Len(t, files, 1)
+	certs, _ := certutil.ParseCertificates(files[0].Data)
+	assert.Len(t, certs, 3)
+	assert.Equal(t, root.Raw, certs[0].Raw)
+
+	files, _, err = planCertificateDownload(
+		downloadOptions{Format: downloadFormatP7B, Out: "leaf.p7b", ChainOut: "chain.p7b"},
+		chain,
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	certs, _ = certutil.ParsePKCS7(files[0].Data)
+	assert.Len(t, certs, 1)
+	certs, _ = certutil.ParsePKCS7(files[1].Data)
+	assert.Len(t, certs, 2)
+
+	files, _, err = planCertificateDownload(
+		downloadOptions{Format: downloadFormatPFX, CertOut: "tls.crt", KeyOut: "tls.key", ChainOut: "ca.crt"},
+		chain,
+		key,
+	)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	assert.Contains(t, string(files[1].Data), "BEGIN PRIVATE KEY")
+
+	_, warnings, err = planCertificateDownload(
+		downloadOptions{Format: downloadFormatDER, CertOut: "leaf.der", ChainOut: "chain.pem"},
+		[]*x509.Certificate{leaf},
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+
+	_, _, err = planCertificateDownload(
+		downloadOptions{Format: downloadFormatPFX, KeyOut: "tls.key"},
+		chain,
+		nil,
+	)
+	assert.Error(t, err)
+}
+
+func Test_WriteSecureFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+	assert.NoError(t, writeSecureFile(path, []byte("new")))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "new", string(data))
+}
@@ -0,0 +1,474 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"kfutil/pkg/certutil"
+)
+
+// Enrollment statuses reported by kfutil.
+const (
+	enrollmentIssued  = "Issued"
+	enrollmentPending = "Pending"
+)
+
+// enrollmentOptions holds the options shared by the enrollment subcommands.
+type enrollmentOptions struct {
+	Template string
+	CA       string
+	SANs     certutil.SubjectAltNames
+	Metadata map[string]string
+	Output   downloadOptions
+}
+
+// enrollmentResult is the outcome of an enrollment request.
+type enrollmentResult struct {
+	Status        string   `json:"status"`
+	Disposition   string   `json:"disposition,omitempty"`
+	Message       string   `json:"message,omitempty"`
+	RequestId     int32    `json:"request_id,omitempty"`
+	CertificateId int32    `json:"certificate_id,omitempty"`
+	Thumbprint    string   `json:"thumbprint,omitempty"`
+	SerialNumber  string   `json:"serial_number,omitempty"`
+	Files         []string `json:"files,omitempty"`
+}
+
+var certificatesEnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Enroll for certificates in Keyfactor Command.",
+	Long:  `Enroll for certificates using a certificate signing request (CSR) or a server generated PFX.`,
+}
+
+var certificatesEnrollCSRCmd = &cobra.Command{
+	Use:   "csr",
+	Short: "Enroll for a certificate using an existing CSR.",
+	Long: `Submit an existing PEM or DER encoded certificate signing request to Keyfactor Command and save the issued
+certificate and chain. SANs given as flags replace those in the CSR, otherwise the CSR's SANs are requested. If the
+request requires approval its request ID and status are reported instead.`,
+	Example: `kfutil certificates enroll csr --csr web.csr --template WebServer --ca "ca.example.com\\Issuing CA" --out web.pem --chain-out ca.pem`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		csrFile, _ := cmd.Flags().GetString("csr")
+		opts, oErr := enrollmentOptionsFromFlags(cmd)
+		if oErr != nil {
+			return oErr
+		}
+
+		data, rErr := os.ReadFile(csrFile)
+		if rErr != nil {
+			return fmt.Errorf("unable to read CSR %s: %s", csrFile, rErr)
+		}
+		csr, pErr := certutil.ParseCSR(data)
+		if pErr != nil {
+			return fmt.Errorf("%s: %s", csrFile, pErr)
+		}
+		if enrollmentSANs(opts.SANs) == nil {
+			opts.SANs = certutil.SubjectAltNames{
+				DNSNames:       csr.DNSNames,
+				IPAddresses:    csr.IPAddresses,
+				EmailAddresses: csr.EmailAddresses,
+				URIs:           csr.URIs,
+			}
+		}
+
+		sdkClient, cErr := initGenClient(false)
+		if cErr != nil {
+			return cErr
+		}
+		return enrollCSR(sdkClient, csr, opts)
+	},
+}
+
+var certificatesEnrollGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a private key and CSR locally and enroll for a certificate.",
+	Long: `Generate an RSA, ECDSA or Ed25519 private key and a certificate signing request locally, then submit the CSR to
+Keyfactor Command. The private key never leaves this host. It is written to --key-out with 0600 permissions before
+the request is submitted, so that it is kept if the request requires approval.`,
+	Example: `kfutil certificates enroll generate --cn www.example.com --dns www.example.com --dns example.com \
+  --key-type ecdsa --key-size 384 --template WebServer --key-out web.key --out web.pem --chain-out ca.pem`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		keyType, _ := cmd.Flags().GetString("key-type")
+		keySize, _ := cmd.Flags().GetInt("key-size")
+		keyOut, _ := cmd.Flags().GetString("key-out")
+		csrOut, _ := cmd.Flags().GetString("csr-out")
+		opts, oErr := enrollmentOptionsFromFlags(cmd)
+		if oErr != nil {
+			return oErr
+		}
+		subject := subjectFromFlags(cmd)
+		if _, sErr := os.Stat(keyOut); sErr == nil {
+			return fmt.Errorf("key file %s already exists", keyOut)
+		}
+
+		log.Debug().Str("keyType", keyType).Int("keySize", keySize).
+			Str("subject", subject.String()).
+			Msg("generating private key and CSR")
+		key, kErr := certutil.GenerateKey(keyType, keySize)
+		if kErr != nil {
+			return kErr
+		}
+
+		sdkClient, cErr := initGenClient(false)
+		if cErr != nil {
+			return cErr
+		}
+		keyPEM, eErr := certutil.EncodePrivateKeyPEM(key)
+		if eErr != nil {
+			return eErr
+		}
+		if wErr := writeSecureFile(keyOut, keyPEM); wErr != nil {
+			return wErr
+		}
+		fmt.Printf("Wrote private key to %s\n", keyOut)
+
+		csrPEM, csrErr := certutil.CreateCSR(key, subject, opts.SANs)
+		if csrErr != nil {
+			return csrErr
+		}
+		if csrOut != "" {
+			if wErr := writeSecureFile(csrOut, csrPEM); wErr != nil {
+				return wErr
+			}
+			fmt.Printf("Wrote CSR to %s\n", csrOut)
+		}
+		csr, pErr := certutil.ParseCSR(csrPEM)
+		if pErr != nil {
+			return pErr
+		}
+		return enrollCSR(sdkClient, csr, opts)
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesEnrollCmd)
+
+	certificatesEnrollCmd.AddCommand(certificatesEnrollCSRCmd)
+	certificatesEnrollCSRCmd.Flags().String("csr", "", "PEM or DER encoded certificate signing request file.")
+	certificatesEnrollCSRCmd.MarkFlagRequired("csr")
+	addEnrollmentFlags(certificatesEnrollCSRCmd)
+	addEnrollmentOutputFlags(certificatesEnrollCSRCmd)
+
+	certificatesEnrollCmd.AddCommand(certificatesEnrollGenerateCmd)
+	certificatesEnrollGenerateCmd.Flags().String(
+		"key-type",
+		certutil.KeyTypeRSA,
+		fmt.Sprintf("Private key type, one of %s.", strings.Join(certutil.KeyTypes, ", ")),
+	)
+	certificatesEnrollGenerateCmd.Flags().Int(
+		"key-size",
+		0,
+		"RSA key size in bits (default 2048) or ECDSA curve size, 256, 384 or 521 (default 256). Not used with Ed25519.",
+	)
+	certificatesEnrollGenerateCmd.Flags().String("key-out", "", "File to write the generated private key to.")
+	certificatesEnrollGenerateCmd.Flags().String("csr-out", "", "File to write the generated CSR to.")
+	certificatesEnrollGenerateCmd.MarkFlagRequired("key-out")
+	addSubjectFlags(certificatesEnrollGenerateCmd)
+	certificatesEnrollGenerateCmd.MarkFlagRequired("cn")
+	addEnrollmentFlags(certificatesEnrollGenerateCmd)
+	addEnrollmentOutputFlags(certificatesEnrollGenerateCmd)
+}
+
+// addEnrollmentFlags registers the template, CA, SAN and metadata flags shared by the enrollment subcommands.
+func addEnrollmentFlags(cmd *cobra.Command) {
+	cmd.Flags().String("template", "", "Short name of the certificate template to enroll with.")
+	cmd.Flags().String("ca", "", "Certificate authority to enroll with, as <host>\\<logical name>.")
+	cmd.Flags().StringSlice("dns", []string{}, "DNS subject alternative name. May be repeated.")
+	cmd.Flags().StringSlice("ip", []string{}, "IP address subject alternative name. May be repeated.")
+	cmd.Flags().StringSlice("email", []string{}, "Email subject alternative name. May be repeated.")
+	cmd.Flags().StringSlice("uri", []string{}, "URI subject alternative name. May be repeated.")
+	cmd.Flags().StringToString("metadata", map[string]string{}, "Certificate metadata as name=value pairs.")
+	cmd.MarkFlagRequired("template")
+}
+
+// addEnrollmentOutputFlags registers the flags controlling where an issued certificate and its chain are written.
+func addEnrollmentOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("out", "o", "", "File to write the issued certificate to. Defaults to <thumbprint>.pem.")
+	cmd.Flags().String("chain-out", "", "File to write the issuing chain to.")
+	cmd.Flags().Bool("chain", false, "Include the issuing chain in the certificate file.")
+	cmd.Flags().String(
+		"chain-order",
+		chainOrderLeafFirst,
+		fmt.Sprintf("Order of the chain, %s or %s.", chainOrderLeafFirst, chainOrderRootFirst),
+	)
+}
+
+// addSubjectFlags registers flags for the subject of a generated CSR.
+func addSubjectFlags(cmd *cobra.Command) {
+	cmd.Flags().String("cn", "", "Subject common name.")
+	cmd.Flags().StringSlice("org", []string{}, "Subject organization.")
+	cmd.Flags().StringSlice("org-unit", []string{}, "Subject organizational unit.")
+	cmd.Flags().StringSlice("locality", []string{}, "Subject locality.")
+	cmd.Flags().StringSlice("state", []string{}, "Subject state or province.")
+	cmd.Flags().StringSlice("country", []string{}, "Subject country code.")
+}
+
+func subjectFromFlags(cmd *cobra.Command) pkix.Name {
+	cn, _ := cmd.Flags().GetString("cn")
+	org, _ := cmd.Flags().GetStringSlice("org")
+	orgUnit, _ := cmd.Flags().GetStringSlice("org-unit")
+	locality, _ := cmd.Flags().GetStringSlice("locality")
+	state, _ := cmd.Flags().GetStringSlice("state")
+	country, _ := cmd.Flags().GetStringSlice("country")
+	return pkix.Name{
+		CommonName:         cn,
+		Organization:       org,
+		OrganizationalUnit: orgUnit,
+		Locality:           locality,
+		Province:           state,
+		Country:            country,
+	}
+}
+
+func enrollmentOptionsFromFlags(cmd *cobra.Command) (enrollmentOptions, error) {
+	template, _ := cmd.Flags().GetString("template")
+	ca, _ := cmd.Flags().GetString("ca")
+	dns, _ := cmd.Flags().GetStringSlice("dns")
+	ips, _ := cmd.Flags().GetStringSlice("ip")
+	emails, _ := cmd.Flags().GetStringSlice("email")
+	uris, _ := cmd.Flags().GetStringSlice("uri")
+	metadata, _ := cmd.Flags().GetStringToString("metadata")
+
+	opts := enrollmentOptions{Template: template, CA: ca, Metadata: metadata}
+	sans, sErr := certutil.ParseSubjectAltNames(dns, ips, emails, uris)
+	if sErr != nil {
+		return opts, sErr
+	}
+	opts.SANs = sans
+
+	if cmd.Flags().Lookup("chain-order") != nil {
+		out, _ := cmd.Flags().GetString("out")
+		chainOut, _ := cmd.Flags().GetString("chain-out")
+		chain, _ := cmd.Flags().GetBool("chain")
+		chainOrder, _ := cmd.Flags().GetString("chain-order")
+		if chainOrder != chainOrderLeafFirst && chainOrder != chainOrderRootFirst {
+			return opts, fmt.Errorf(
+				"invalid chain order %q, must be %s or %s",
+				chainOrder,
+				chainOrderLeafFirst,
+				chainOrderRootFirst,
+			)
+		}
+		opts.Output = downloadOptions{
+			Format:    downloadFormatPEM,
+			Chain:     chain,
+			RootFirst: chainOrder == chainOrderRootFirst,
+			Out:       out,
+			ChainOut:  chainOut,
+		}
+		if vErr := opts.Output.validate(); vErr != nil {
+			return opts, vErr
+		}
+	}
+	return opts, nil
+}
+
+// enrollmentSANs converts SANs to the map expected by the enrollment APIs, or nil if there are none.
+func enrollmentSANs(sans certutil.SubjectAltNames) *map[string][]string {
+	m := make(map[string][]string)
+	if len(sans.DNSNames) > 0 {
+		m["dns"] = sans.DNSNames
+	}
+	for _, ip := range sans.IPAddresses {
+		if ip.To4() != nil {
+			m["ip4"] = append(m["ip4"], ip.String())
+		} else {
+			m["ip6"] = append(m["ip6"], ip.String())
+		}
+	}
+	if len(sans.EmailAddresses) > 0 {
+		m["email"] = sans.EmailAddresses
+	}
+	for _, u := range sans.URIs {
+		m["uri"] = append(m["uri"], u.String())
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return &m
+}
+
+func enrollmentMetadata(metadata map[string]string) map[string]interface{} {
+	if len(metadata) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		m[k] = v
+	}
+	return m
+}
+
+// enrollCSR submits a CSR, writes the issued certificate and chain and prints the result.
+func enrollCSR(sdkClient *keyfactor.APIClient, csr *x509.CertificateRequest, opts enrollmentOptions) error {
+	includeChain := opts.Output.needsChain()
+	now := time.Now().UTC()
+	req := keyfactor.ModelsEnrollmentCSREnrollmentRequest{
+		CSR:          string(certutil.EncodeCSRPEM(csr)),
+		IncludeChain: &includeChain,
+		Metadata:     enrollmentMetadata(opts.Metadata),
+		Timestamp:    &now,
+		Template:     &opts.Template,
+		SANs:         enrollmentSANs(opts.SANs),
+	}
+	if opts.CA != "" {
+		req.CertificateAuthority = &opts.CA
+	}
+
+	log.Debug().Str("template", opts.Template).Str("ca", opts.CA).
+		Str("subject", csr.Subject.String()).
+		Msg(fmt.Sprintf("%s EnrollmentPostCSREnroll", DebugFuncCall))
+	resp, httpResp, err := sdkClient.EnrollmentApi.EnrollmentPostCSREnroll(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		XCertificateformat("PEM").
+		Request(req).
+		Execute()
+	if err != nil {
+		return returnHttpErr(httpResp, err)
+	}
+	if resp == nil || resp.CertificateInformation == nil {
+		return fmt.Errorf("invalid response returned from Keyfactor Command for CSR enrollment")
+	}
+
+	info := resp.CertificateInformation
+	result, rErr := newEnrollmentResult(
+		info.GetRequestDisposition(),
+		info.GetDispositionMessage(),
+		info.GetKeyfactorRequestId(),
+		info.GetKeyfactorID(),
+		info.GetThumbprint(),
+		info.GetSerialNumber(),
+		len(info.GetCertificates()) > 0,
+	)
+	if rErr != nil {
+		return rErr
+	}
+	if result.Status == enrollmentIssued {
+		var certs []*x509.Certificate
+		for _, c := range info.GetCertificates() {
+			parsed, pErr := certutil.ParseCertificates([]byte(c))
+			if pErr != nil {
+				return fmt.Errorf("unable to parse issued certificate: %s", pErr)
+			}
+			certs = append(certs, parsed...)
+		}
+		files, wErr := writeEnrolledCertificates(opts.Output, result.Thumbprint, certutil.OrderChain(certs, false))
+		result.Files = files
+		if wErr != nil {
+			printEnrollmentResult(result, outputFormat)
+			return wErr
+		}
+	}
+	printEnrollmentResult(result, outputFormat)
+	return nil
+}
+
+// newEnrollmentResult interprets an enrollment disposition. Requests that were denied or failed are returned as an
+// error, requests without a certificate that did not fail are reported as pending approval.
+func newEnrollmentResult(
+	disposition string,
+	message string,
+	requestId int32,
+	certId int32,
+	thumbprint string,
+	serial string,
+	issued bool,
+) (enrollmentResult, error) {
+	result := enrollmentResult{
+		Status:        enrollmentIssued,
+		Disposition:   disposition,
+		Message:       message,
+		RequestId:     requestId,
+		CertificateId: certId,
+		Thumbprint:    thumbprint,
+		SerialNumber:  serial,
+	}
+	if issued {
+		return result, nil
+	}
+	d := strings.ToUpper(disposition)
+	if strings.Contains(d, "DENIED") || strings.Contains(d, "FAIL") || strings.Contains(d, "ERROR") {
+		return result, fmt.Errorf("enrollment request %d was %s: %s", requestId, strings.ToLower(disposition), message)
+	}
+	result.Status = enrollmentPending
+	return result, nil
+}
+
+// writeEnrolledCertificates writes an issued certificate and chain, leaf first, to the requested PEM files.
+func writeEnrolledCertificates(output downloadOptions, thumbprint string, certs []*x509.Certificate) ([]string, error) {
+	files, warnings, err := planCertificateDownload(output.withDefaultOut(thumbprint), certs, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	var written []string
+	for _, f := range files {
+		if wErr := writeSecureFile(f.Path, f.Data); wErr != nil {
+			return written, wErr
+		}
+		written = append(written, f.Path)
+	}
+	return written, nil
+}
+
+func printEnrollmentResult(result enrollmentResult, format string) {
+	if format == "json" {
+		out, _ := json.MarshalIndent(result, "", "  ")
+		outputResult(string(out), format)
+		return
+	}
+	if result.Status == enrollmentPending {
+		fmt.Printf("Enrollment request %d is pending (%s)", result.RequestId, result.Disposition)
+		if result.Message != "" {
+			fmt.Printf(": %s", result.Message)
+		}
+		fmt.Println()
+		return
+	}
+	fmt.Printf("Issued certificate ID %d, thumbprint %s\n", result.CertificateId, result.Thumbprint)
+	for _, f := range result.Files {
+		fmt.Printf("Wrote %s\n", f)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// pfxDeployment describes the certificate stores a PFX enrollment is deployed to.
+type pfxDeployment struct {
+	Stores    []api.GetCertificateStoreResponse
+	Aliases   storeAliasPolicy
+	Overwrite bool
+}
+
+var certificatesEnrollPFXCmd = &cobra.Command{
+	Use:   "pfx",
+	Short: "Enroll for a server generated PFX and optionally deploy it to certificate stores.",
+	Long: `Enroll for a certificate and private key generated by Keyfactor Command. The PFX can be written to a file, split
+into certificate, key and chain files, and/or deployed to the certificate stores selected with --sid, --client,
+--store-type and --container, as with 'inventory add'. The alias is validated against each store's type before
+enrolling, and the private key is left out for the stores whose type doesn't allow one. Use --wait to wait for the
+deployment jobs to complete. If the request requires approval its request ID and status are reported and nothing is
+deployed.`,
+	Example: `kfutil certificates enroll pfx --cn www.example.com --dns www.example.com --template WebServer --out web.pfx --password-env PFX_PASSWORD
+kfutil certificates enroll pfx --cn www.example.com --template WebServer --store-type IIS --client web01 --alias web --overwrite --wait`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		opts, oErr := enrollmentOptionsFromFlags(cmd)
+		if oErr != nil {
+			return oErr
+		}
+		opts.Output.Format = downloadFormatPFX
+		opts.Output.CertOut, _ = cmd.Flags().GetString("cert-out")
+		opts.Output.KeyOut, _ = cmd.Flags().GetString("key-out")
+		if vErr := opts.Output.withDefaultOut("").validate(); vErr != nil {
+			return vErr
+		}
+		passwordEnv, _ := cmd.Flags().GetString("password-env")
+		passwordFile, _ := cmd.Flags().GetString("password-file")
+		storeIDs, _ := cmd.Flags().GetStringSlice("sid")
+		machineNames, _ := cmd.Flags().GetStringSlice("client")
+		storeTypes, _ := cmd.Flags().GetStringSlice("store-type")
+		containers, _ := cmd.Flags().GetStringSlice("container")
+		alias, _ := cmd.Flags().GetString("alias")
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		subject := subjectFromFlags(cmd)
+
+		deploy := len(storeIDs) > 0 || len(machineNames) > 0 || len(storeTypes) > 0 || len(containers) > 0
+		writeFiles := opts.Output.Out != "" || opts.Output.CertOut != "" || opts.Output.KeyOut != "" ||
+			opts.Output.ChainOut != "" || !deploy
+		if !deploy && (alias != "" || overwrite) {
+			return fmt.Errorf("--alias and --overwrite require a store selector: --sid, --client, --store-type or --container")
+		}
+
+		var deployment *pfxDeployment
+		if deploy {
+			kfClient, cErr := initClient(false)
+			if cErr != nil {
+				return cErr
+			}
+			stores, sErr := selectInventoryStores(kfClient, storeIDs, machineNames, storeTypes, containers, false)
+			if sErr != nil {
+				return fmt.Errorf("unable to list certificate stores: %s", sErr)
+			}
+			if len(stores) == 0 {
+				return fmt.Errorf("no certificate stores matched the given selectors")
+			}
+			// the private key is left out for the stores whose type doesn't allow one
+			aliases, vErr := validateInventoryAddOptions(kfClient, stores, alias, true, true)
+			if vErr != nil {
+				return vErr
+			}
+			deployment = &pfxDeployment{Stores: stores, Aliases: aliases, Overwrite: overwrite}
+		}
+
+		// The PFX password only protects files written locally, deploy-only enrollments use a random one.
+		var password string
+		var pErr error
+		if writeFiles {
+			password, pErr = downloadPfxPassword(passwordEnv, passwordFile)
+		} else {
+			password, pErr = generateRandomPassword(32)
+		}
+		if pErr != nil {
+			return pErr
+		}
+
+		sdkClient, cErr := initGenClient(false)
+		if cErr != nil {
+			return cErr
+		}
+		info, eErr := enrollPFX(sdkClient, subject.String(), password, opts)
+		if eErr != nil {
+			return eErr
+		}
+		result, rErr := newEnrollmentResult(
+			info.GetRequestDisposition(),
+			info.GetDispositionMessage(),
+			info.GetKeyfactorRequestId(),
+			info.GetKeyfactorId(),
+			info.GetThumbprint(),
+			info.GetSerialNumber(),
+			info.GetPkcs12Blob() != "",
+		)
+		if rErr != nil {
+			return rErr
+		}
+		if result.Status == enrollmentPending {
+			printEnrollmentResult(result, outputFormat)
+			if deployment != nil {
+				fmt.Println("The certificate was not deployed, add it to the stores with 'inventory add' once it is issued.")
+			}
+			return nil
+		}
+
+		if writeFiles {
+			pfx, dErr := base64.StdEncoding.DecodeString(info.GetPkcs12Blob())
+			if dErr != nil {
+				return fmt.Errorf("unable to decode PFX: %s", dErr)
+			}
+			files, warnings, fErr := planPfxDownload(opts.Output.withDefaultOut(result.Thumbprint), pfx, password)
+			if fErr != nil {
+				return fErr
+			}
+			for _, w := range warnings {
+				fmt.Println(w)
+			}
+			for _, f := range files {
+				if wErr := writeSecureFile(f.Path, f.Data); wErr != nil {
+					return wErr
+				}
+				result.Files = append(result.Files, f.Path)
+			}
+		}
+		printEnrollmentResult(result, outputFormat)
+
+		if deployment == nil {
+			return nil
+		}
+		return deployEnrolledPFX(int(result.CertificateId), result.Thumbprint, deployment, wait, timeout)
+	},
+}
+
+func init() {
+	certificatesEnrollCmd.AddCommand(certificatesEnrollPFXCmd)
+	addSubjectFlags(certificatesEnrollPFXCmd)
+	certificatesEnrollPFXCmd.MarkFlagRequired("cn")
+	addEnrollmentFlags(certificatesEnrollPFXCmd)
+	addEnrollmentOutputFlags(certificatesEnrollPFXCmd)
+	certificatesEnrollPFXCmd.Flags().Lookup("out").Usage = "File to write the PFX to. Defaults to <thumbprint>.pfx when not deploying to stores."
+	certificatesEnrollPFXCmd.Flags().String("cert-out", "", "Write the PEM encoded certificate to this file.")
+	certificatesEnrollPFXCmd.Flags().String("key-out", "", "Write the PEM encoded private key to this file.")
+	certificatesEnrollPFXCmd.Flags().String("password-env", "", "Environment variable holding the PFX password.")
+	certificatesEnrollPFXCmd.Flags().String("password-file", "", "File holding the PFX password.")
+	certificatesEnrollPFXCmd.MarkFlagsMutuallyExclusive("password-env", "password-file")
+
+	certificatesEnrollPFXCmd.Flags().StringSlice("sid", []string{}, "Deploy to the certificate store with this ID.")
+	certificatesEnrollPFXCmd.Flags().StringSlice("client", []string{}, "Deploy to the certificate stores on this client machine.")
+	certificatesEnrollPFXCmd.Flags().StringSlice("store-type", []string{}, "Deploy to the certificate stores of this store type.")
+	certificatesEnrollPFXCmd.Flags().StringSlice("container", []string{}, "Deploy to the certificate stores in this container.")
+	certificatesEnrollPFXCmd.Flags().String("alias", "", "Alias to deploy the certificate with. Defaults to the thumbprint.")
+	certificatesEnrollPFXCmd.Flags().Bool("overwrite", false, "Overwrite an existing entry with the same alias.")
+	addJobWaitFlags(certificatesEnrollPFXCmd)
+}
+
+// enrollPFX requests a server generated certificate and private key.
+func enrollPFX(sdkClient *keyfactor.APIClient, subject string, password string, opts enrollmentOptions) (
+	*keyfactor.ModelsPkcs12CertificateResponse,
+	error,
+) {
+	includeChain := opts.Output.needsChain()
+	now := time.Now().UTC()
+	req := keyfactor.ModelsEnrollmentPFXEnrollmentRequest{
+		Password:     &password,
+		Subject:      &subject,
+		IncludeChain: &includeChain,
+		Metadata:     enrollmentMetadata(opts.Metadata),
+		Timestamp:    &now,
+		Template:     &opts.Template,
+		SANs:         enrollmentSANs(opts.SANs),
+	}
+	if opts.CA != "" {
+		req.CertificateAuthority = &opts.CA
+	}
+
+	log.Debug().Str("template", opts.Template).Str("ca", opts.CA).Str("subject", subject).
+		Msg(fmt.Sprintf("%s EnrollmentPostPFXEnroll", DebugFuncCall))
+	resp, httpResp, err := sdkClient.EnrollmentApi.EnrollmentPostPFXEnroll(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		XCertificateformat("PFX").
+		Request(req).
+		Execute()
+	if err != nil {
+		return nil, returnHttpErr(httpResp, err)
+	}
+	if resp == nil || resp.CertificateInformation == nil {
+		return nil, fmt.Errorf("invalid response returned from Keyfactor Command for PFX enrollment")
+	}
+	return resp.CertificateInformation, nil
+}
+
+// deployEnrolledPFX schedules jobs adding a newly enrolled certificate, with its private key, to the selected stores.
+func deployEnrolledPFX(certId int, thumbprint string, deployment *pfxDeployment, wait bool, timeout time.Duration) error {
+	kfClient, cErr := initClient(false)
+	if cErr != nil {
+		return cErr
+	}
+	tracker, tErr := newInventoryJobTracker(wait)
+	if tErr != nil {
+		return tErr
+	}
+	// The password only protects the private key in transit to the orchestrator.
+	transitPassword, pErr := generateRandomPassword(32)
+	if pErr != nil {
+		return pErr
+	}
+
+	scheduleErrs := 0
+	for _, store := range deployment.Stores {
+		_, err := scheduleCertificateAdd(
+			kfClient,
+			tracker,
+			store,
+			certId,
+			thumbprint,
+			deployment.Aliases.aliasFor(store.Id, thumbprint),
+			deployment.Overwrite,
+			deployment.Aliases.includePrivateKeyFor(store.Id, true),
+			transitPassword,
+		)
+		if err != nil {
+			fmt.Printf("Error deploying certificate %d to store %s (%s:%s): %s\n", certId, store.Id, store.ClientMachine, store.StorePath, err)
+			log.Error().Err(err).Str("storeId", store.Id).Msg("unable to schedule certificate deployment")
+			scheduleErrs++
+			continue
+		}
+		fmt.Printf("Scheduled deployment of certificate %d to %s:%s\n", certId, store.ClientMachine, store.StorePath)
+	}
+	return finishInventoryJobs(tracker, timeout, scheduleErrs)
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"kfutil/pkg/certutil"
+)
+
+func Test_NewEnrollmentResult(t *testing.T) {
+	result, err := newEnrollmentResult("Issued", "", 10, 20, "AAAA", "01", true)
+	assert.NoError(t, err)
+	assert.Equal(t, enrollmentIssued, result.Status)
+	assert.Equal(t, int32(20), result.CertificateId)
+
+	result, err = newEnrollmentResult("External Validation", "Awaiting approval", 11, 0, "", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, enrollmentPending, result.Status)
+	assert.Equal(t, int32(11), result.RequestId)
+
+	_, err = newEnrollmentResult("Denied", "Not allowed", 12, 0, "", "", false)
+	assert.Error(t, err)
+	_, err = newEnrollmentResult("Failed", "CA unavailable", 13, 0, "", "", false)
+	assert.Error(t, err)
+}
+
+func Test_EnrollmentSANs(t *testing.T) {
+	assert.Nil(t, enrollmentSANs(certutil.SubjectAltNames{}))
+
+	sans, err := certutil.ParseSubjectAltNames(
+		[]string{"www.example.com"},
+		[]string{"10.0.0.1", "fe80::1"},
+		nil,
+		[]string{"https://example.com"},
+	)
+	assert.NoError(t, err)
+	m := enrollmentSANs(sans)
+	assert.NotNil(t, m)
+	assert.Equal(
+		t, map[string][]string{
+			"dns": {"www.example.com"},
+			"ip4": {"10.0.0.1"},
+			"ip6": {"fe80::1"},
+			"uri": {"https://example.com"},
+		}, *m,
+	)
+}
+
+func Test_EnrollmentOptionsFromFlags(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{Use: "enroll"}
+		addEnrollmentFlags(cmd)
+		addEnrollmentOutputFlags(cmd)
+		assert.NoError(t, cmd.ParseFlags(args))
+		return cmd
+	}
+
+	opts, err := enrollmentOptionsFromFlags(
+		newCmd("--template", "WebServer", "--chain", "--chain-order", chainOrderRootFirst, "--dns", "www.example.com"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "WebServer", opts.Template)
+	assert.Equal(t, downloadFormatPEM, opts.Output.Format)
+	assert.True(t, opts.Output.RootFirst)
+	assert.True(t, opts.Output.needsChain())
+
+	_, err = enrollmentOptionsFromFlags(newCmd("--chain-order", "random"))
+	assert.Error(t, err)
+
+	// a root-first chain can't be written into a PFX
+	opts, err = enrollmentOptionsFromFlags(newCmd("--chain", "--chain-order", chainOrderRootFirst))
+	assert.NoError(t, err)
+	opts.Output.Format = downloadFormatPFX
+	assert.Error(t, opts.Output.withDefaultOut("").validate())
+}
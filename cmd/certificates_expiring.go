@@ -0,0 +1,460 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	expiryFormatTable = "table"
+	expiryFormatCSV   = "csv"
+	expiryFormatJSON  = "json"
+	expiryFormatHTML  = "html"
+)
+
+// expiryNoGroup is the group of certificates without a value for the --group-by metadata field.
+const expiryNoGroup = "(none)"
+
+var expiryFormats = []string{expiryFormatTable, expiryFormatCSV, expiryFormatJSON, expiryFormatHTML}
+
+var expiryCSVHeader = []string{
+	"Group",
+	"CertificateId",
+	"Subject",
+	"Thumbprint",
+	"NotAfter",
+	"DaysRemaining",
+	"Template",
+	"StoreId",
+	"StoreType",
+	"ClientMachine",
+	"StorePath",
+	"Alias",
+	"Container",
+	"Orchestrator",
+}
+
+// expiryRow is an expiring certificate at one of its store locations. Certificates that are not in any store have a
+// single row without store details.
+type expiryRow struct {
+	CertificateId int32     `json:"certificate_id"`
+	Subject       string    `json:"subject"`
+	Thumbprint    string    `json:"thumbprint"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	Template      string    `json:"template,omitempty"`
+	StoreId       string    `json:"store_id,omitempty"`
+	StoreType     string    `json:"store_type,omitempty"`
+	ClientMachine string    `json:"client_machine,omitempty"`
+	StorePath     string    `json:"store_path,omitempty"`
+	Alias         string    `json:"alias,omitempty"`
+	Container     string    `json:"container,omitempty"`
+	Orchestrator  string    `json:"orchestrator,omitempty"`
+}
+
+// expiryGroup holds the rows of certificates sharing a value of the --group-by metadata field.
+type expiryGroup struct {
+	Name         string      `json:"group"`
+	Certificates int         `json:"certificates"`
+	Rows         []expiryRow `json:"locations"`
+}
+
+// expiryReport is the expiring certificates report, grouped and ordered by expiry.
+type expiryReport struct {
+	GeneratedAt  time.Time     `json:"generated_at"`
+	Within       string        `json:"within"`
+	GroupBy      string        `json:"group_by,omitempty"`
+	Certificates int           `json:"certificates"`
+	Groups       []expiryGroup `json:"groups"`
+}
+
+// expiryStoreIndex resolves certificate store locations to their store type, container and orchestrator.
+type expiryStoreIndex struct {
+	Stores     map[string]api.GetCertificateStoreResponse
+	StoreTypes map[int]string
+	Agents     map[string]string
+}
+
+var certificatesExpiringCmd = &cobra.Command{
+	Use:   "expiring",
+	Short: "Report certificates expiring within a period, with the stores and orchestrators they are deployed to.",
+	Long: `Report every certificate expiring within --within, optionally narrowed with --query. Each certificate is listed
+at every certificate store location it is deployed to, with the store's client machine, type, container and
+orchestrator. Use --group-by to group the report by a certificate metadata field, such as an owner or team. The report
+is written as a table, CSV, JSON or a self-contained HTML page.`,
+	Example: `kfutil certificates expiring --within 60d
+kfutil certificates expiring --within 60d --group-by Owner --format html --out expiring.html`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		within, _ := cmd.Flags().GetString("within")
+		query, _ := cmd.Flags().GetString("query")
+		groupBy, _ := cmd.Flags().GetString("group-by")
+		format, _ := cmd.Flags().GetString("format")
+		outFile, _ := cmd.Flags().GetString("out")
+
+		format = strings.ToLower(format)
+		if !slices.Contains(expiryFormats, format) {
+			return fmt.Errorf("invalid format %q, must be one of %s", format, strings.Join(expiryFormats, ", "))
+		}
+		now := time.Now()
+		fullQuery, qErr := expiringQuery(query, within, now)
+		if qErr != nil {
+			return qErr
+		}
+
+		sdkClient, sErr := initGenClient(false)
+		if sErr != nil {
+			return sErr
+		}
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			return cErr
+		}
+
+		log.Debug().Str("query", fullQuery).Msg("selecting expiring certificates")
+		certs, err := queryCertificates(
+			sdkClient,
+			certificateQuery{Query: fullQuery, IncludeMetadata: groupBy != "", IncludeLocations: true},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to query certificates: %s", err)
+		}
+		index, iErr := loadExpiryStoreIndex(kfClient)
+		if iErr != nil {
+			return iErr
+		}
+		report := buildExpiryReport(certs, index, groupBy, within, now)
+
+		var w io.Writer = os.Stdout
+		if outFile != "" {
+			f, fErr := os.Create(outFile)
+			if fErr != nil {
+				return fmt.Errorf("unable to write report to %s: %s", outFile, fErr)
+			}
+			defer f.Close()
+			w = f
+		}
+		if wErr := writeExpiryReport(w, report, format); wErr != nil {
+			return wErr
+		}
+		if outFile != "" {
+			fmt.Printf("%d expiring certificate(s) written to %s\n", report.Certificates, outFile)
+		}
+		return nil
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesExpiringCmd)
+	certificatesExpiringCmd.Flags().String(
+		"within",
+		"30d",
+		"Report certificates expiring within this period, e.g. 60d, 8w or 72h.",
+	)
+	certificatesExpiringCmd.Flags().StringP("query", "q", "", "Only report certificates matching this Keyfactor Command query.")
+	certificatesExpiringCmd.Flags().String("group-by", "", "Certificate metadata field to group the report by.")
+	certificatesExpiringCmd.Flags().String(
+		"format",
+		expiryFormatTable,
+		fmt.Sprintf("Report format, one of %s.", strings.Join(expiryFormats, ", ")),
+	)
+	certificatesExpiringCmd.Flags().StringP("out", "o", "", "File to write the report to. Defaults to stdout.")
+}
+
+// loadExpiryStoreIndex lists every certificate store, store type and orchestrator once, so locations can be
+// resolved without a request per certificate.
+func loadExpiryStoreIndex(kfClient *api.Client) (expiryStoreIndex, error) {
+	index := expiryStoreIndex{
+		Stores:     make(map[string]api.GetCertificateStoreResponse),
+		StoreTypes: make(map[int]string),
+		Agents:     make(map[string]string),
+	}
+	stores, err := selectInventoryStores(kfClient, nil, nil, nil, nil, true)
+	if err != nil {
+		return index, fmt.Errorf("unable to list certificate stores: %s", err)
+	}
+	for _, store := range stores {
+		index.Stores[strings.ToLower(store.Id)] = store
+	}
+	storeTypes, err := kfClient.ListCertificateStoreTypes()
+	if err != nil {
+		return index, fmt.Errorf("unable to list certificate store types: %s", err)
+	}
+	if storeTypes != nil {
+		for _, st := range *storeTypes {
+			index.StoreTypes[st.StoreType] = st.ShortName
+		}
+	}
+	agents, err := kfClient.GetAgentList()
+	if err != nil {
+		return index, fmt.Errorf("unable to list orchestrators: %s", err)
+	}
+	for _, agent := range agents {
+		index.Agents[strings.ToLower(agent.AgentId)] = agent.ClientMachine
+	}
+	return index, nil
+}
+
+// buildExpiryReport joins certificates with their store locations and groups them by a metadata field. Groups are
+// sorted by name, with certificates lacking the field last, and rows by expiry.
+func buildExpiryReport(
+	certs []keyfactor.ModelsCertificateRetrievalResponse,
+	index expiryStoreIndex,
+	groupBy string,
+	within string,
+	now time.Time,
+) expiryReport {
+	report := expiryReport{GeneratedAt: now.UTC(), Within: within, GroupBy: groupBy, Certificates: len(certs)}
+	groups := make(map[string]*expiryGroup)
+	for _, cert := range certs {
+		name := expiryGroupName(cert, groupBy)
+		group, ok := groups[name]
+		if !ok {
+			group = &expiryGroup{Name: name}
+			groups[name] = group
+		}
+		group.Certificates++
+
+		subject := nullableString(cert.IssuedCN)
+		if subject == "" {
+			subject = nullableString(cert.IssuedDN)
+		}
+		base := expiryRow{
+			CertificateId: cert.GetId(),
+			Subject:       subject,
+			Thumbprint:    cert.GetThumbprint(),
+			NotAfter:      cert.GetNotAfter().UTC(),
+			DaysRemaining: int(cert.GetNotAfter().Sub(now).Hours() / 24),
+			Template:      cert.GetTemplateName(),
+		}
+		added := false
+		for _, loc := range cert.Locations {
+			if loc.GetChainLevel() > 0 {
+				continue
+			}
+			row := base
+			row.StoreId = loc.GetCertStoreId()
+			row.ClientMachine = loc.GetStoreMachine()
+			row.StorePath = loc.GetStorePath()
+			row.Alias = loc.GetAlias()
+			row.StoreType = index.StoreTypes[int(loc.GetStoreType())]
+			if store, found := index.Stores[strings.ToLower(row.StoreId)]; found {
+				row.Container = store.ContainerName
+				row.Orchestrator = index.Agents[strings.ToLower(store.AgentId)]
+			}
+			group.Rows = append(group.Rows, row)
+			added = true
+		}
+		if !added {
+			group.Rows = append(group.Rows, base)
+		}
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(
+			group.Rows, func(i, j int) bool {
+				if !group.Rows[i].NotAfter.Equal(group.Rows[j].NotAfter) {
+					return group.Rows[i].NotAfter.Before(group.Rows[j].NotAfter)
+				}
+				return group.Rows[i].CertificateId < group.Rows[j].CertificateId
+			},
+		)
+		report.Groups = append(report.Groups, *group)
+	}
+	sort.Slice(
+		report.Groups, func(i, j int) bool {
+			a, b := report.Groups[i].Name, report.Groups[j].Name
+			if (a == expiryNoGroup) != (b == expiryNoGroup) {
+				return b == expiryNoGroup
+			}
+			return strings.ToLower(a) < strings.ToLower(b)
+		},
+	)
+	return report
+}
+
+// expiryGroupName returns the certificate's value of the metadata field, matched case-insensitively.
+func expiryGroupName(cert keyfactor.ModelsCertificateRetrievalResponse, groupBy string) string {
+	if groupBy == "" {
+		return ""
+	}
+	if cert.Metadata != nil {
+		for field, value := range *cert.Metadata {
+			if strings.EqualFold(field, groupBy) && value != "" {
+				return value
+			}
+		}
+	}
+	return expiryNoGroup
+}
+
+// writeExpiryReport writes the report in the given format.
+func writeExpiryReport(w io.Writer, report expiryReport, format string) error {
+	switch format {
+	case expiryFormatCSV:
+		return writeExpiryCSV(w, report)
+	case expiryFormatJSON:
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case expiryFormatHTML:
+		return expiryHTMLTemplate.Execute(w, report)
+	default:
+		return writeExpiryTable(w, report)
+	}
+}
+
+func writeExpiryTable(w io.Writer, report expiryReport) error {
+	if report.Certificates == 0 {
+		_, err := fmt.Fprintf(w, "No certificates expire within %s.\n", report.Within)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, group := range report.Groups {
+		if report.GroupBy != "" {
+			if i > 0 {
+				fmt.Fprintln(tw)
+			}
+			fmt.Fprintf(tw, "%s: %s (%d certificate(s))\n", report.GroupBy, group.Name, group.Certificates)
+		}
+		fmt.Fprintln(tw, "ID\tSUBJECT\tNOT AFTER\tDAYS\tSTORE TYPE\tCLIENT MACHINE\tSTORE PATH\tALIAS\tCONTAINER\tORCHESTRATOR")
+		for _, row := range group.Rows {
+			fmt.Fprintf(
+				tw,
+				"%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				row.CertificateId,
+				row.Subject,
+				row.NotAfter.Format(time.RFC3339),
+				row.DaysRemaining,
+				row.StoreType,
+				row.ClientMachine,
+				row.StorePath,
+				row.Alias,
+				row.Container,
+				row.Orchestrator,
+			)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeExpiryCSV(w io.Writer, report expiryReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write(expiryCSVHeader)
+	for _, group := range report.Groups {
+		for _, row := range group.Rows {
+			cw.Write(
+				[]string{
+					group.Name,
+					strconv.Itoa(int(row.CertificateId)),
+					row.Subject,
+					row.Thumbprint,
+					row.NotAfter.Format(time.RFC3339),
+					strconv.Itoa(row.DaysRemaining),
+					row.Template,
+					row.StoreId,
+					row.StoreType,
+					row.ClientMachine,
+					row.StorePath,
+					row.Alias,
+					row.Container,
+					row.Orchestrator,
+				},
+			)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// expiryHTMLTemplate renders the report as a single page with inline styles, so it can be mailed or archived as is.
+var expiryHTMLTemplate = template.Must(
+	template.New("expiring").Funcs(
+		template.FuncMap{
+			"urgency": func(days int) string {
+				switch {
+				case days <= 7:
+					return "critical"
+				case days <= 30:
+					return "warning"
+				}
+				return ""
+			},
+			"date": func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+		},
+	).Parse(
+		`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Certificates expiring within {{.Within}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+tr.critical td { background: #fbe3e3; }
+tr.warning td { background: #fdf5d9; }
+.summary { color: #555; }
+</style>
+</head>
+<body>
+<h1>Certificates expiring within {{.Within}}</h1>
+<p class="summary">{{.Certificates}} certificate(s), generated {{date .GeneratedAt}}.</p>
+{{- range .Groups}}
+{{- if $.GroupBy}}
+<h2>{{$.GroupBy}}: {{.Name}} ({{.Certificates}} certificate(s))</h2>
+{{- end}}
+<table>
+<tr><th>ID</th><th>Subject</th><th>Not After</th><th>Days</th><th>Template</th><th>Store Type</th><th>Client Machine</th><th>Store Path</th><th>Alias</th><th>Container</th><th>Orchestrator</th></tr>
+{{- range .Rows}}
+<tr class="{{urgency .DaysRemaining}}"><td>{{.CertificateId}}</td><td>{{.Subject}}</td><td>{{date .NotAfter}}</td><td>{{.DaysRemaining}}</td><td>{{.Template}}</td><td>{{.StoreType}}</td><td>{{.ClientMachine}}</td><td>{{.StorePath}}</td><td>{{.Alias}}</td><td>{{.Container}}</td><td>{{.Orchestrator}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`,
+	),
+)
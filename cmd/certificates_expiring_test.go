@@ -0,0 +1,120 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testExpiringCertificate(
+	id int32,
+	cn string,
+	notAfter time.Time,
+	metadata map[string]string,
+	storeIds ...string,
+) keyfactor.ModelsCertificateRetrievalResponse {
+	cert := keyfactor.ModelsCertificateRetrievalResponse{Id: &id, NotAfter: &notAfter, Metadata: &metadata}
+	cert.IssuedCN = *keyfactor.NewNullableString(&cn)
+	storeType := int32(5)
+	for _, storeId := range storeIds {
+		sid := storeId
+		path := "/certs/" + sid
+		cert.Locations = append(
+			cert.Locations,
+			keyfactor.ModelsCertificateRetrievalResponseCertificateStoreInventoryItemModel{
+				CertStoreId: &sid,
+				StorePath:   &path,
+				StoreType:   &storeType,
+			},
+		)
+	}
+	return cert
+}
+
+func Test_BuildExpiryReport(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	certs := []keyfactor.ModelsCertificateRetrievalResponse{
+		testExpiringCertificate(1, "late", now.Add(40*24*time.Hour), map[string]string{"owner": "Ops"}, "S1"),
+		testExpiringCertificate(2, "orphan", now.Add(10*24*time.Hour), map[string]string{}),
+		testExpiringCertificate(3, "soon", now.Add(5*24*time.Hour), map[string]string{"Owner": "Ops"}, "s1", "s2"),
+		testExpiringCertificate(4, "app", now.Add(20*24*time.Hour), map[string]string{"Owner": "Apps"}),
+	}
+	index := expiryStoreIndex{
+		Stores: map[string]api.GetCertificateStoreResponse{
+			"s1": {Id: "S1", ContainerName: "Web", AgentId: "A1"},
+		},
+		StoreTypes: map[int]string{5: "IIS"},
+		Agents:     map[string]string{"a1": "orch01"},
+	}
+
+	report := buildExpiryReport(certs, index, "Owner", "60d", now)
+	assert.Equal(t, 4, report.Certificates)
+	assert.Len(t, report.Groups, 3)
+	assert.Equal(t, "Apps", report.Groups[0].Name)
+	assert.Equal(t, "Ops", report.Groups[1].Name)
+	assert.Equal(t, expiryNoGroup, report.Groups[2].Name)
+
+	ops := report.Groups[1]
+	assert.Equal(t, 2, ops.Certificates)
+	assert.Len(t, ops.Rows, 3)
+	assert.Equal(t, int32(3), ops.Rows[0].CertificateId)
+	assert.Equal(t, 5, ops.Rows[0].DaysRemaining)
+	assert.Equal(t, "IIS", ops.Rows[0].StoreType)
+	assert.Equal(t, "Web", ops.Rows[0].Container)
+	assert.Equal(t, "orch01", ops.Rows[0].Orchestrator)
+	assert.Equal(t, "", ops.Rows[1].Orchestrator)
+	assert.Equal(t, int32(1), ops.Rows[2].CertificateId)
+	assert.Equal(t, "", report.Groups[2].Rows[0].StoreId)
+
+	ungrouped := buildExpiryReport(certs, index, "", "60d", now)
+	assert.Len(t, ungrouped.Groups, 1)
+	assert.Len(t, ungrouped.Groups[0].Rows, 5)
+}
+
+func Test_WriteExpiryReport(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	certs := []keyfactor.ModelsCertificateRetrievalResponse{
+		testExpiringCertificate(1, "<script>", now.Add(3*24*time.Hour), map[string]string{"Team": "A&B"}, "S1"),
+	}
+	report := buildExpiryReport(certs, expiryStoreIndex{}, "Team", "60d", now)
+
+	var out bytes.Buffer
+	assert.NoError(t, writeExpiryReport(&out, report, expiryFormatCSV))
+	records, err := csv.NewReader(&out).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, expiryCSVHeader, records[0])
+	assert.Equal(t, "A&B", records[1][0])
+
+	out.Reset()
+	assert.NoError(t, writeExpiryReport(&out, report, expiryFormatHTML))
+	html := out.String()
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>"))
+	assert.Contains(t, html, "&lt;script&gt;")
+	assert.Contains(t, html, `class="critical"`)
+	assert.NotContains(t, html, "<link")
+
+	out.Reset()
+	assert.NoError(t, writeExpiryReport(&out, expiryReport{Within: "30d"}, expiryFormatTable))
+	assert.Contains(t, out.String(), "No certificates expire within 30d")
+}
@@ -0,0 +1,574 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"kfutil/pkg/certutil"
+)
+
+// Statuses of a certificate import.
+const (
+	importStatusImported = "imported"
+	importStatusExists   = "exists"
+	importStatusFailed   = "failed"
+	importStatusDryRun   = "dry-run"
+)
+
+// importFileExtensions are the extensions of files read when walking a directory. Files named explicitly are read
+// whatever their extension.
+var importFileExtensions = map[string]bool{
+	".pem": true,
+	".crt": true,
+	".cer": true,
+	".der": true,
+	".p7b": true,
+	".p7c": true,
+	".pfx": true,
+	".p12": true,
+	".key": true,
+}
+
+// importCandidate is a certificate found in the import files, with its private key when one was found.
+type importCandidate struct {
+	Source        string              `json:"source"`
+	Subject       string              `json:"subject"`
+	Thumbprint    string              `json:"thumbprint"`
+	HasPrivateKey bool                `json:"has_private_key"`
+	Status        string              `json:"status"`
+	CertificateId int32               `json:"certificate_id,omitempty"`
+	Message       string              `json:"message,omitempty"`
+	Cert          *x509.Certificate   `json:"-"`
+	Chain         []*x509.Certificate `json:"-"`
+	Key           crypto.PrivateKey   `json:"-"`
+}
+
+var certificatesImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import existing certificates, and their private keys, from PEM, DER, PKCS#7 and PFX files.",
+	Long: `Import externally issued certificates into Keyfactor Command. Each --file may be a file or a directory, which is
+walked for .pem, .crt, .cer, .der, .p7b, .p7c, .pfx, .p12 and .key files. Private keys are taken from PFX files, or
+paired with their certificate from PEM or DER key files. Only leaf certificates are imported and deployed; the
+intermediate and root certificates of their chain are included with leaves that have a private key. Every certificate
+is looked up by thumbprint first and is not
+imported again if Command already has it. The --metadata fields are set on imported certificates and updated on the
+ones Command already has. Certificates can be deployed to the certificate stores selected with --sid, --client,
+--store-type and --container, as with 'inventory add'. --collection doesn't add certificates to a collection, it only
+reports the ones that aren't members of it after the import: collections are defined by queries, so certificates are
+only members of --collection when its query matches them, for example on the metadata set with --metadata.`,
+	Example: `kfutil certificates import -f ./legacy-certs --metadata Owner=ops --dry-run
+kfutil certificates import -f web.pfx --password-env PFX_PASSWORD --store-type IIS --client web01 --alias web --wait`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		paths, _ := cmd.Flags().GetStringSlice("file")
+		passwordEnv, _ := cmd.Flags().GetString("password-env")
+		passwordFile, _ := cmd.Flags().GetString("password-file")
+		metadata, _ := cmd.Flags().GetStringToString("metadata")
+		collection, _ := cmd.Flags().GetString("collection")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		storeIDs, _ := cmd.Flags().GetStringSlice("sid")
+		machineNames, _ := cmd.Flags().GetStringSlice("client")
+		storeTypes, _ := cmd.Flags().GetStringSlice("store-type")
+		containers, _ := cmd.Flags().GetStringSlice("container")
+		alias, _ := cmd.Flags().GetString("alias")
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		deploy := len(storeIDs) > 0 || len(machineNames) > 0 || len(storeTypes) > 0 || len(containers) > 0
+		if !deploy && (alias != "" || overwrite) {
+			return fmt.Errorf("--alias and --overwrite require a store selector: --sid, --client, --store-type or --container")
+		}
+
+		var password string
+		pfxPassword := func() (string, error) {
+			if password == "" {
+				var err error
+				password, err = downloadPfxPassword(passwordEnv, passwordFile)
+				if err != nil {
+					return "", err
+				}
+			}
+			return password, nil
+		}
+		candidates, warnings, err := loadImportCandidates(paths, pfxPassword)
+		for _, w := range warnings {
+			fmt.Println(w)
+		}
+		if err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return fmt.Errorf("no certificates found in %s", strings.Join(paths, ", "))
+		}
+		if deploy && alias != "" && len(candidates) > 1 {
+			return fmt.Errorf("--alias can only be used when importing a single certificate")
+		}
+
+		sdkClient, sErr := initGenClient(false)
+		if sErr != nil {
+			return sErr
+		}
+		var collectionId int32
+		if collection != "" {
+			collectionId, err = resolveCollectionId(sdkClient, collection)
+			if err != nil {
+				return err
+			}
+		}
+
+		var thumbprints []string
+		for _, c := range candidates {
+			thumbprints = append(thumbprints, c.Thumbprint)
+		}
+		existing, lErr := getCertificatesByThumbprint(sdkClient, thumbprints, 0, false)
+		if lErr != nil {
+			return fmt.Errorf("unable to look up existing certificates: %s", lErr)
+		}
+		for _, c := range candidates {
+			if found, ok := existing[c.Thumbprint]; ok {
+				c.Status = importStatusExists
+				c.CertificateId = found.GetId()
+			}
+		}
+
+		var kfClient *api.Client
+		var deployment *pfxDeployment
+		if deploy {
+			var cErr error
+			kfClient, cErr = initClient(false)
+			if cErr != nil {
+				return cErr
+			}
+			stores, stErr := selectInventoryStores(kfClient, storeIDs, machineNames, storeTypes, containers, false)
+			if stErr != nil {
+				return fmt.Errorf("unable to list certificate stores: %s", stErr)
+			}
+			if len(stores) == 0 {
+				return fmt.Errorf("no certificate stores matched the given selectors")
+			}
+			aliases, vErr := validateInventoryAddOptions(kfClient, stores, alias, allImportKeys(candidates), false)
+			if vErr != nil {
+				return vErr
+			}
+			deployment = &pfxDeployment{Stores: stores, Aliases: aliases, Overwrite: overwrite}
+		}
+
+		if dryRun {
+			for _, c := range candidates {
+				if c.Status == "" {
+					c.Status = importStatusDryRun
+				}
+			}
+			return printImportResults(candidates, outputFormat)
+		}
+
+		failed := 0
+		for _, c := range candidates {
+			if c.Status == importStatusExists {
+				if len(metadata) == 0 {
+					continue
+				}
+				if mErr := setCertificateMetadata(sdkClient, c.CertificateId, metadata); mErr != nil {
+					c.Status = importStatusFailed
+					c.Message = fmt.Sprintf("unable to set metadata: %s", mErr)
+					failed++
+					continue
+				}
+				c.Message = "metadata updated"
+				continue
+			}
+			if iErr := importCertificate(sdkClient, c, metadata); iErr != nil {
+				c.Status = importStatusFailed
+				c.Message = iErr.Error()
+				failed++
+				continue
+			}
+			c.Status = importStatusImported
+		}
+
+		imported, rErr := getCertificatesByThumbprint(sdkClient, thumbprints, 0, false)
+		if rErr != nil {
+			return fmt.Errorf("unable to look up imported certificates: %s", rErr)
+		}
+		for _, c := range candidates {
+			if found, ok := imported[c.Thumbprint]; ok {
+				c.CertificateId = found.GetId()
+			}
+		}
+		if collectionId > 0 {
+			members, mErr := getCertificatesByThumbprint(sdkClient, thumbprints, collectionId, false)
+			if mErr != nil {
+				return fmt.Errorf("unable to check collection membership: %s", mErr)
+			}
+			for _, c := range candidates {
+				if _, ok := members[c.Thumbprint]; !ok && c.Status != importStatusFailed {
+					c.Message = strings.TrimSpace(fmt.Sprintf("%s not in collection %s", c.Message, collection))
+				}
+			}
+		}
+		if pErr := printImportResults(candidates, outputFormat); pErr != nil {
+			return pErr
+		}
+
+		var deployErr error
+		if deployment != nil {
+			deployErr = deployImportedCertificates(kfClient, candidates, deployment, wait, timeout)
+		}
+		if failed > 0 {
+			if deployErr != nil {
+				return fmt.Errorf("%d certificate(s) could not be imported; %s", failed, deployErr)
+			}
+			return fmt.Errorf("%d certificate(s) could not be imported", failed)
+		}
+		return deployErr
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesImportCmd)
+	certificatesImportCmd.Flags().StringSliceP("file", "f", []string{}, "Certificate file or directory to import. May be repeated.")
+	certificatesImportCmd.MarkFlagRequired("file")
+	certificatesImportCmd.Flags().String("password-env", "", "Environment variable holding the password of the PFX files.")
+	certificatesImportCmd.Flags().String("password-file", "", "File holding the password of the PFX files.")
+	certificatesImportCmd.MarkFlagsMutuallyExclusive("password-env", "password-file")
+	certificatesImportCmd.Flags().StringToString("metadata", map[string]string{}, "Metadata to set on imported certificates, and to update on the ones Command already has, as Field=Value.")
+	certificatesImportCmd.Flags().String("collection", "", "Name or ID of a collection to check the imported certificates against. Certificates aren't added to it, the ones its query doesn't match are only reported.")
+	certificatesImportCmd.Flags().Bool("dry-run", false, "Show what would be imported without changing anything.")
+
+	certificatesImportCmd.Flags().StringSlice("sid", []string{}, "Deploy to the certificate store with this ID.")
+	certificatesImportCmd.Flags().StringSlice("client", []string{}, "Deploy to the certificate stores on this client machine.")
+	certificatesImportCmd.Flags().StringSlice("store-type", []string{}, "Deploy to the certificate stores of this store type.")
+	certificatesImportCmd.Flags().StringSlice("container", []string{}, "Deploy to the certificate stores in this container.")
+	certificatesImportCmd.Flags().String("alias", "", "Alias to deploy the certificate with. Defaults to the thumbprint.")
+	certificatesImportCmd.Flags().Bool("overwrite", false, "Overwrite an existing entry with the same alias.")
+	addJobWaitFlags(certificatesImportCmd)
+}
+
+// importFiles expands directories into the certificate and key files they contain, in lexical order.
+func importFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(
+			path, func(p string, d fs.DirEntry, wErr error) error {
+				if wErr != nil {
+					return wErr
+				}
+				if !d.IsDir() && importFileExtensions[strings.ToLower(filepath.Ext(p))] {
+					files = append(files, p)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// loadImportCandidates reads every certificate and private key in the given files and directories. A candidate is
+// returned for each leaf certificate, with the issuers found in the same PFX file, or in any of the other files, as
+// its chain; certificates that are part of a chain aren't imported on their own. Keys in PFX files belong to the PFX's
+// leaf certificate, other keys are paired with the certificate whose public key they match. Certificates found more
+// than once are only returned once, preferring the copy with a private key. The PFX password is only requested when a
+// PFX file is found.
+func loadImportCandidates(paths []string, pfxPassword func() (string, error)) ([]*importCandidate, []string, error) {
+	files, err := importFiles(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	var candidates []*importCandidate
+	var keys []crypto.PrivateKey
+	// certificates of PEM, DER and PKCS#7 files are pooled, so a leaf is matched with a chain in a separate file
+	var pool []*x509.Certificate
+	sources := make(map[string]string)
+	for _, file := range files {
+		data, rErr := os.ReadFile(file)
+		if rErr != nil {
+			return nil, nil, rErr
+		}
+		// only a leading BOM is dropped, the same bytes can occur anywhere in DER and PFX data
+		data = bytes.TrimPrefix(data, []byte(bom))
+
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext == ".pfx" || ext == ".p12" {
+			password, pErr := pfxPassword()
+			if pErr != nil {
+				return nil, nil, pErr
+			}
+			key, certs, dErr := certutil.DecodePKCS12(data, password)
+			if dErr != nil {
+				warnings = append(warnings, fmt.Sprintf("Skipping %s: %s", file, dErr))
+				continue
+			}
+			for _, chain := range certutil.SplitChains(certs) {
+				c := newImportCandidate(file, chain[0])
+				c.Chain = chain[1:]
+				if key != nil && certutil.KeyMatchesCertificate(key, chain[0]) {
+					c.Key = key
+				}
+				candidates = append(candidates, c)
+			}
+			continue
+		}
+
+		certs, cErr := certutil.ParseCertificates(data)
+		key, kErr := certutil.ParsePrivateKey(data)
+		if kErr == nil {
+			keys = append(keys, key)
+		}
+		if cErr != nil {
+			if kErr != nil {
+				warnings = append(warnings, fmt.Sprintf("Skipping %s: no certificate or private key found", file))
+			}
+			continue
+		}
+		for _, cert := range certs {
+			thumbprint := certutil.Thumbprint(cert)
+			if _, ok := sources[thumbprint]; !ok {
+				sources[thumbprint] = file
+				pool = append(pool, cert)
+			}
+		}
+	}
+	for _, chain := range certutil.SplitChains(pool) {
+		c := newImportCandidate(sources[certutil.Thumbprint(chain[0])], chain[0])
+		c.Chain = chain[1:]
+		candidates = append(candidates, c)
+	}
+
+	for _, c := range candidates {
+		if c.Key != nil {
+			continue
+		}
+		for _, key := range keys {
+			if certutil.KeyMatchesCertificate(key, c.Cert) {
+				c.Key = key
+				break
+			}
+		}
+	}
+
+	// only leaves are imported, the certificates of their chains are included in the PFX uploaded with a private key
+	inChain := make(map[string]bool)
+	for _, c := range candidates {
+		for _, cert := range c.Chain {
+			inChain[certutil.Thumbprint(cert)] = true
+		}
+	}
+	var unique []*importCandidate
+	byThumbprint := make(map[string]*importCandidate)
+	for _, c := range candidates {
+		c.HasPrivateKey = c.Key != nil
+		if inChain[c.Thumbprint] {
+			continue
+		}
+		if prev, ok := byThumbprint[c.Thumbprint]; ok {
+			if c.HasPrivateKey && !prev.HasPrivateKey {
+				*prev = *c
+			}
+			continue
+		}
+		byThumbprint[c.Thumbprint] = c
+		unique = append(unique, c)
+	}
+	return unique, warnings, nil
+}
+
+func newImportCandidate(source string, cert *x509.Certificate) *importCandidate {
+	return &importCandidate{
+		Source:     source,
+		Subject:    cert.Subject.String(),
+		Thumbprint: certutil.Thumbprint(cert),
+		Cert:       cert,
+	}
+}
+
+// allImportKeys reports whether every certificate to be imported has a private key, so it can be deployed with it.
+func allImportKeys(candidates []*importCandidate) bool {
+	for _, c := range candidates {
+		if !c.HasPrivateKey {
+			return false
+		}
+	}
+	return true
+}
+
+// importCertificate uploads a certificate to Command. Certificates with a private key are uploaded as a PFX protected
+// by a random password.
+func importCertificate(sdkClient *keyfactor.APIClient, c *importCandidate, metadata map[string]string) error {
+	req := keyfactor.ModelsCertificateImportRequestModel{Certificate: base64.StdEncoding.EncodeToString(c.Cert.Raw)}
+	if len(metadata) > 0 {
+		// without ImportMetadata Command ignores the metadata of the request
+		req.Metadata = &metadata
+		req.ImportMetadata = boolToPointer(true)
+	}
+	if c.Key != nil {
+		password, pErr := generateRandomPassword(32)
+		if pErr != nil {
+			return pErr
+		}
+		pfx, eErr := certutil.EncodePKCS12(c.Key, c.Cert, c.Chain, password)
+		if eErr != nil {
+			return eErr
+		}
+		req.Certificate = base64.StdEncoding.EncodeToString(pfx)
+		req.Password = &password
+	}
+
+	log.Debug().Str("thumbprint", c.Thumbprint).Bool("privateKey", c.Key != nil).
+		Msg(fmt.Sprintf("%s CertificatePostImportCertificate", DebugFuncCall))
+	_, httpResp, err := sdkClient.CertificateApi.CertificatePostImportCertificate(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Req(req).
+		Execute()
+	if err != nil {
+		return returnHttpErr(httpResp, err)
+	}
+	return nil
+}
+
+// deployImportedCertificates schedules jobs adding every imported or already present certificate to the selected
+// stores, with its private key when one was imported.
+func deployImportedCertificates(
+	kfClient *api.Client,
+	candidates []*importCandidate,
+	deployment *pfxDeployment,
+	wait bool,
+	timeout time.Duration,
+) error {
+	tracker, tErr := newInventoryJobTracker(wait)
+	if tErr != nil {
+		return tErr
+	}
+	transitPassword, pErr := generateRandomPassword(32)
+	if pErr != nil {
+		return pErr
+	}
+
+	scheduleErrs := 0
+	for _, c := range candidates {
+		if c.CertificateId == 0 {
+			continue
+		}
+		password := ""
+		if c.HasPrivateKey {
+			password = transitPassword
+		}
+		for _, store := range deployment.Stores {
+			_, err := scheduleCertificateAdd(
+				kfClient,
+				tracker,
+				store,
+				int(c.CertificateId),
+				c.Thumbprint,
+				deployment.Aliases.aliasFor(store.Id, c.Thumbprint),
+				deployment.Overwrite,
+				c.HasPrivateKey,
+				password,
+			)
+			if err != nil {
+				fmt.Printf(
+					"Error deploying certificate %d to store %s (%s:%s): %s\n",
+					c.CertificateId,
+					store.Id,
+					store.ClientMachine,
+					store.StorePath,
+					err,
+				)
+				log.Error().Err(err).Str("storeId", store.Id).Msg("unable to schedule certificate deployment")
+				scheduleErrs++
+				continue
+			}
+			fmt.Printf("Scheduled deployment of certificate %d to %s:%s\n", c.CertificateId, store.ClientMachine, store.StorePath)
+		}
+	}
+	return finishInventoryJobs(tracker, timeout, scheduleErrs)
+}
+
+// printImportResults writes the outcome of each certificate as a table, or as JSON when the json output format is
+// selected.
+func printImportResults(candidates []*importCandidate, format string) error {
+	sorted := make([]*importCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Source < sorted[j].Source })
+
+	if format == "json" {
+		out, err := json.MarshalIndent(sorted, "", "  ")
+		if err != nil {
+			return err
+		}
+		outputResult(string(out), format)
+		return nil
+	}
+
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tID\tTHUMBPRINT\tKEY\tSUBJECT\tSOURCE\tMESSAGE")
+	for _, c := range sorted {
+		counts[c.Status]++
+		id := ""
+		if c.CertificateId > 0 {
+			id = fmt.Sprintf("%d", c.CertificateId)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n", c.Status, id, c.Thumbprint, c.HasPrivateKey, c.Subject, c.Source, c.Message)
+	}
+	w.Flush()
+	var summary []string
+	for _, status := range []string{importStatusImported, importStatusDryRun, importStatusExists, importStatusFailed} {
+		if counts[status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	fmt.Printf("\n%d certificate(s): %s\n", len(candidates), strings.Join(summary, ", "))
+	return nil
+}
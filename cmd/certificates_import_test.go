@@ -0,0 +1,122 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"kfutil/pkg/certutil"
+)
+
+func Test_LoadImportCandidates(t *testing.T) {
+	certs, key := testCertificateChain(t)
+	dir := t.TempDir()
+	keyPEM, err := certutil.EncodePrivateKeyPEM(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "leaf.pem"), certutil.EncodePEM(certs), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "leaf.key"), keyPEM, 0600))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "nested"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "root.der"), certs[2].Raw, 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a certificate"), 0600))
+
+	prompted := false
+	noPassword := func() (string, error) {
+		prompted = true
+		return "", nil
+	}
+	candidates, warnings, err := loadImportCandidates([]string{dir}, noPassword)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.False(t, prompted)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, certutil.Thumbprint(certs[0]), candidates[0].Thumbprint)
+	assert.True(t, candidates[0].HasPrivateKey)
+	assert.Equal(t, certs[1:], candidates[0].Chain)
+
+	// a leaf without its key is still imported with the chain found next to it
+	assert.NoError(t, os.Remove(filepath.Join(dir, "leaf.key")))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "leaf.pem"), certutil.EncodePEM(certs[:2]), 0600))
+	candidates, _, err = loadImportCandidates([]string{dir}, noPassword)
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 1)
+	assert.False(t, candidates[0].HasPrivateKey)
+	assert.Equal(t, certs[1:], candidates[0].Chain)
+
+	pfx, err := certutil.EncodePKCS12(key, certs[0], certs[1:], "secret")
+	assert.NoError(t, err)
+	pfxDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(pfxDir, "a-leaf.crt"), certutil.EncodePEM(certs[:1]), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(pfxDir, "b-leaf.pfx"), pfx, 0600))
+	candidates, _, err = loadImportCandidates(
+		[]string{pfxDir}, func() (string, error) {
+			return "secret", nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 1)
+	assert.True(t, candidates[0].HasPrivateKey)
+	assert.Equal(t, filepath.Join(pfxDir, "b-leaf.pfx"), candidates[0].Source)
+	assert.Len(t, candidates[0].Chain, 2)
+
+	candidates, warnings, err = loadImportCandidates(
+		[]string{filepath.Join(pfxDir, "b-leaf.pfx")}, func() (string, error) {
+			return "wrong", nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, candidates)
+	assert.Len(t, warnings, 1)
+
+	_, _, err = loadImportCandidates([]string{filepath.Join(dir, "missing.pem")}, noPassword)
+	assert.Error(t, err)
+}
+
+func Test_LoadImportCandidatesBinaryBOM(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	// the serial number holds the bytes of a UTF-8 BOM, which must survive in a DER file
+	tmpl := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes([]byte{0x01, 0xEF, 0xBB, 0xBF, 0x02}),
+		Subject:      pkix.Name{CommonName: "bom.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bom.der"), der, 0600))
+	// a leading BOM is still dropped from text files
+	pemData := append([]byte(bom), certutil.EncodePEM([]*x509.Certificate{cert})...)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bom.pem"), pemData, 0600))
+
+	for _, name := range []string{"bom.der", "bom.pem"} {
+		candidates, warnings, err := loadImportCandidates([]string{filepath.Join(dir, name)}, nil)
+		assert.NoError(t, err, name)
+		assert.Empty(t, warnings, name)
+		assert.Len(t, candidates, 1, name)
+	}
+}
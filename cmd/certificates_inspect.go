@@ -0,0 +1,436 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"kfutil/pkg/certutil"
+)
+
+// File formats recognized by 'certificates inspect'.
+const (
+	inspectFormatPEM    = "PEM"
+	inspectFormatDER    = "DER"
+	inspectFormatPKCS7  = "PKCS#7"
+	inspectFormatPKCS12 = "PKCS#12"
+	inspectFormatJKS    = "JKS"
+)
+
+// inspectEntry is a set of certificates read from a file, such as a keystore entry, in file order.
+type inspectEntry struct {
+	Name          string
+	PrivateKey    bool
+	Certificates  []*x509.Certificate
+	privateKeyFor func(cert *x509.Certificate) bool
+}
+
+type inspectReport struct {
+	File    string                `json:"file"`
+	Format  string                `json:"format"`
+	Entries []inspectedEntryGroup `json:"entries"`
+}
+
+type inspectedEntryGroup struct {
+	Name          string                 `json:"name,omitempty"`
+	ChainProblems []string               `json:"chain_problems,omitempty"`
+	Certificates  []inspectedCertificate `json:"certificates"`
+}
+
+type inspectedCertificate struct {
+	Position           int                   `json:"position"`
+	Subject            string                `json:"subject"`
+	Issuer             string                `json:"issuer"`
+	SerialNumber       string                `json:"serial_number"`
+	Thumbprint         string                `json:"thumbprint"`
+	SHA256Fingerprint  string                `json:"sha256_fingerprint"`
+	NotBefore          time.Time             `json:"not_before"`
+	NotAfter           time.Time             `json:"not_after"`
+	DaysRemaining      int                   `json:"days_remaining"`
+	Expired            bool                  `json:"expired"`
+	KeyType            string                `json:"key_type"`
+	SignatureAlgorithm string                `json:"signature_algorithm"`
+	HasPrivateKey      bool                  `json:"has_private_key"`
+	IsCA               bool                  `json:"is_ca"`
+	DNSNames           []string              `json:"dns_names,omitempty"`
+	IPAddresses        []string              `json:"ip_addresses,omitempty"`
+	EmailAddresses     []string              `json:"email_addresses,omitempty"`
+	URIs               []string              `json:"uris,omitempty"`
+	KeyUsage           []string              `json:"key_usage,omitempty"`
+	ExtKeyUsage        []string              `json:"ext_key_usage,omitempty"`
+	Extensions         []inspectedExtension  `json:"extensions,omitempty"`
+	Command            *inspectedCommandInfo `json:"command,omitempty"`
+}
+
+type inspectedExtension struct {
+	Name     string `json:"name"`
+	OID      string `json:"oid"`
+	Critical bool   `json:"critical"`
+}
+
+// inspectedCommandInfo is what Keyfactor Command knows about an inspected certificate.
+type inspectedCommandInfo struct {
+	Found         bool     `json:"found"`
+	CertificateId int32    `json:"certificate_id,omitempty"`
+	Collections   []string `json:"collections,omitempty"`
+	Locations     []string `json:"locations,omitempty"`
+}
+
+var certificatesInspectCmd = &cobra.Command{
+	Use:   "inspect <file>",
+	Short: "Inspect a local certificate file and optionally find its certificates in Keyfactor Command.",
+	Long: `Inspect the certificates in a PEM, DER, PKCS#7, PKCS#12 or JKS file without contacting Keyfactor Command. The
+subject, SANs, validity, key type, usages, extensions and thumbprint of every certificate are shown, and the order of
+each chain is checked: every certificate should be issued by the one following it. PKCS#12 files need their password,
+JKS files are read without one but their integrity is only verified when it is given. With --lookup each certificate
+is matched in Command by thumbprint to show its certificate ID and certificate store locations. Add --collections to
+also show the collections each certificate belongs to, which queries Command once per collection.`,
+	Example: `kfutil certificates inspect server.pem
+kfutil certificates inspect keystore.jks --password-env STORE_PASS --lookup --format json
+kfutil certificates inspect server.pem --lookup --collections`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		passwordEnv, _ := cmd.Flags().GetString("password-env")
+		passwordFile, _ := cmd.Flags().GetString("password-file")
+		lookup, _ := cmd.Flags().GetBool("lookup")
+		withCollections, _ := cmd.Flags().GetBool("collections")
+		if withCollections && !lookup {
+			return fmt.Errorf("--collections requires --lookup")
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		password := func(required bool) (string, error) {
+			if passwordEnv != "" || passwordFile != "" {
+				return (&passwordSource{Env: passwordEnv, File: passwordFile}).resolve()
+			}
+			if !required || noPrompt {
+				return "", nil
+			}
+			return promptForInteractivePassword("Password", ""), nil
+		}
+		format, entries, lErr := loadInspectEntries(data, password)
+		if lErr != nil {
+			return fmt.Errorf("unable to read %s: %s", args[0], lErr)
+		}
+		report := buildInspectReport(args[0], format, entries, time.Now())
+
+		if lookup {
+			sdkClient, sErr := initGenClient(false)
+			if sErr != nil {
+				return sErr
+			}
+			if cErr := lookupInspectedCertificates(sdkClient, &report, withCollections); cErr != nil {
+				return cErr
+			}
+		}
+
+		if outputFormat == "json" {
+			out, jErr := json.MarshalIndent(report, "", "  ")
+			if jErr != nil {
+				return jErr
+			}
+			outputResult(string(out), outputFormat)
+			return nil
+		}
+		printInspectReport(os.Stdout, report)
+		return nil
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesInspectCmd)
+	certificatesInspectCmd.Flags().String("password-env", "", "Environment variable holding the PKCS#12 or JKS password.")
+	certificatesInspectCmd.Flags().String("password-file", "", "File holding the PKCS#12 or JKS password.")
+	certificatesInspectCmd.MarkFlagsMutuallyExclusive("password-env", "password-file")
+	certificatesInspectCmd.Flags().Bool("lookup", false, "Look up each certificate in Keyfactor Command by thumbprint.")
+	certificatesInspectCmd.Flags().Bool(
+		"collections",
+		false,
+		"With --lookup, also show the collections each certificate belongs to. Queries Command once per collection.",
+	)
+}
+
+// loadInspectEntries detects the format of a certificate file and returns its certificates. The password function is
+// called with required set for PKCS#12 files, and without it for JKS files, whose password is optional.
+func loadInspectEntries(data []byte, password func(required bool) (string, error)) (string, []inspectEntry, error) {
+	if certutil.IsJKS(data) {
+		pw, err := password(false)
+		if err != nil {
+			return "", nil, err
+		}
+		jks, jErr := certutil.ParseJKS(data, pw)
+		if jErr != nil {
+			return "", nil, jErr
+		}
+		var entries []inspectEntry
+		for _, e := range jks {
+			entries = append(entries, inspectEntry{Name: e.Alias, PrivateKey: e.PrivateKey, Certificates: e.Certificates})
+		}
+		return inspectFormatJKS, entries, nil
+	}
+
+	if certs, err := certutil.ParseCertificates(data); err == nil {
+		format := inspectFormatDER
+		entry := inspectEntry{Certificates: certs}
+		if bytes.Contains(data, []byte("-----BEGIN")) {
+			format = inspectFormatPEM
+			if key, kErr := certutil.ParsePrivateKey(data); kErr == nil {
+				entry.privateKeyFor = func(cert *x509.Certificate) bool {
+					return certutil.KeyMatchesCertificate(key, cert)
+				}
+			}
+		} else if certutil.IsPKCS7(data) {
+			format = inspectFormatPKCS7
+		}
+		return format, []inspectEntry{entry}, nil
+	}
+
+	pw, err := password(true)
+	if err != nil {
+		return "", nil, err
+	}
+	key, certs, pErr := certutil.DecodePKCS12(data, pw)
+	if pErr != nil {
+		return "", nil, fmt.Errorf("not a PEM, DER, PKCS#7 or JKS file, and %s", pErr)
+	}
+	entry := inspectEntry{Certificates: certs}
+	if key != nil {
+		entry.privateKeyFor = func(cert *x509.Certificate) bool {
+			return certutil.KeyMatchesCertificate(key, cert)
+		}
+	}
+	return inspectFormatPKCS12, []inspectEntry{entry}, nil
+}
+
+func buildInspectReport(file string, format string, entries []inspectEntry, now time.Time) inspectReport {
+	report := inspectReport{File: file, Format: format}
+	for _, entry := range entries {
+		group := inspectedEntryGroup{Name: entry.Name, ChainProblems: certutil.ChainOrderProblems(entry.Certificates)}
+		for i, cert := range entry.Certificates {
+			hasKey := entry.privateKeyFor != nil && entry.privateKeyFor(cert)
+			if entry.PrivateKey && i == 0 {
+				hasKey = true
+			}
+			group.Certificates = append(group.Certificates, inspectCertificate(cert, i+1, hasKey, now))
+		}
+		report.Entries = append(report.Entries, group)
+	}
+	return report
+}
+
+func inspectCertificate(cert *x509.Certificate, position int, hasKey bool, now time.Time) inspectedCertificate {
+	sha := sha256.Sum256(cert.Raw)
+	info := inspectedCertificate{
+		Position:           position,
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       strings.ToUpper(cert.SerialNumber.Text(16)),
+		Thumbprint:         certutil.Thumbprint(cert),
+		SHA256Fingerprint:  strings.ToUpper(hex.EncodeToString(sha[:])),
+		NotBefore:          cert.NotBefore.UTC(),
+		NotAfter:           cert.NotAfter.UTC(),
+		DaysRemaining:      int(cert.NotAfter.Sub(now).Hours() / 24),
+		Expired:            now.After(cert.NotAfter),
+		KeyType:            certutil.KeyDescription(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		HasPrivateKey:      hasKey,
+		IsCA:               cert.IsCA,
+		DNSNames:           cert.DNSNames,
+		EmailAddresses:     cert.EmailAddresses,
+		KeyUsage:           certutil.KeyUsageNames(cert.KeyUsage),
+		ExtKeyUsage:        certutil.ExtKeyUsageNames(cert),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	for _, ext := range cert.Extensions {
+		info.Extensions = append(
+			info.Extensions,
+			inspectedExtension{Name: certutil.ExtensionName(ext.Id.String()), OID: ext.Id.String(), Critical: ext.Critical},
+		)
+	}
+	return info
+}
+
+// lookupInspectedCertificates finds the inspected certificates in Command by thumbprint, with their locations, and
+// when withCollections is set checks which collections each belongs to, one query per collection.
+func lookupInspectedCertificates(sdkClient *keyfactor.APIClient, report *inspectReport, withCollections bool) error {
+	var thumbprints []string
+	for _, entry := range report.Entries {
+		for _, cert := range entry.Certificates {
+			thumbprints = append(thumbprints, cert.Thumbprint)
+		}
+	}
+	found, err := getCertificatesByThumbprint(sdkClient, thumbprints, 0, true)
+	if err != nil {
+		return fmt.Errorf("unable to look up certificates: %s", err)
+	}
+
+	collections := make(map[string][]string)
+	if withCollections && len(found) > 0 {
+		var foundThumbprints []string
+		for thumbprint := range found {
+			foundThumbprints = append(foundThumbprints, thumbprint)
+		}
+		all, cErr := listCertificateCollections(sdkClient, "")
+		if cErr != nil {
+			return fmt.Errorf("unable to list certificate collections: %s", cErr)
+		}
+		for _, c := range all {
+			members, mErr := getCertificatesByThumbprint(sdkClient, foundThumbprints, c.GetId(), false)
+			if mErr != nil {
+				log.Warn().Err(mErr).Str("collection", c.GetName()).Msg("unable to query collection")
+				continue
+			}
+			for thumbprint := range members {
+				collections[thumbprint] = append(collections[thumbprint], c.GetName())
+			}
+		}
+	}
+
+	for i := range report.Entries {
+		for j := range report.Entries[i].Certificates {
+			cert := &report.Entries[i].Certificates[j]
+			match, ok := found[cert.Thumbprint]
+			if !ok {
+				cert.Command = &inspectedCommandInfo{}
+				continue
+			}
+			info := &inspectedCommandInfo{
+				Found:         true,
+				CertificateId: match.GetId(),
+				Collections:   collections[cert.Thumbprint],
+			}
+			for _, loc := range match.Locations {
+				location := fmt.Sprintf("%s:%s", loc.GetStoreMachine(), loc.GetStorePath())
+				if loc.GetAlias() != "" {
+					location = fmt.Sprintf("%s (%s)", location, loc.GetAlias())
+				}
+				info.Locations = append(info.Locations, location)
+			}
+			cert.Command = info
+		}
+	}
+	return nil
+}
+
+func printInspectReport(w io.Writer, report inspectReport) {
+	fmt.Fprintf(w, "File: %s (%s)\n", report.File, report.Format)
+	for _, entry := range report.Entries {
+		fmt.Fprintln(w)
+		if entry.Name != "" {
+			fmt.Fprintf(w, "Entry: %s\n", entry.Name)
+		}
+		if len(entry.Certificates) > 1 {
+			if len(entry.ChainProblems) == 0 {
+				fmt.Fprintln(w, "Chain order: OK")
+			} else {
+				fmt.Fprintln(w, "Chain order: INVALID")
+				for _, p := range entry.ChainProblems {
+					fmt.Fprintf(w, "  - %s\n", p)
+				}
+			}
+		}
+		for _, cert := range entry.Certificates {
+			fmt.Fprintf(w, "\n[%d] %s\n", cert.Position, cert.Subject)
+			field := func(name string, value string) {
+				if value != "" {
+					fmt.Fprintf(w, "    %-20s %s\n", name+":", value)
+				}
+			}
+			validity := fmt.Sprintf("%s to %s", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+			if cert.Expired {
+				validity += " (EXPIRED)"
+			} else {
+				validity += fmt.Sprintf(" (%d days remaining)", cert.DaysRemaining)
+			}
+			key := cert.KeyType
+			if cert.HasPrivateKey {
+				key += ", private key present"
+			}
+			var sans []string
+			for _, v := range cert.DNSNames {
+				sans = append(sans, "DNS:"+v)
+			}
+			for _, v := range cert.IPAddresses {
+				sans = append(sans, "IP:"+v)
+			}
+			for _, v := range cert.EmailAddresses {
+				sans = append(sans, "Email:"+v)
+			}
+			for _, v := range cert.URIs {
+				sans = append(sans, "URI:"+v)
+			}
+			var extensions []string
+			for _, ext := range cert.Extensions {
+				name := ext.Name
+				if ext.Critical {
+					name += " (critical)"
+				}
+				extensions = append(extensions, name)
+			}
+
+			field("Issuer", cert.Issuer)
+			field("Serial number", cert.SerialNumber)
+			field("Thumbprint", cert.Thumbprint)
+			field("SHA-256", cert.SHA256Fingerprint)
+			field("Validity", validity)
+			field("Key", key)
+			field("Signature", cert.SignatureAlgorithm)
+			field("SANs", strings.Join(sans, ", "))
+			field("Key usage", strings.Join(cert.KeyUsage, ", "))
+			field("Extended key usage", strings.Join(cert.ExtKeyUsage, ", "))
+			if cert.IsCA {
+				field("CA", "yes")
+			}
+			field("Extensions", strings.Join(extensions, ", "))
+			if cert.Command != nil {
+				if !cert.Command.Found {
+					field("Command", "not found")
+					continue
+				}
+				field("Command ID", fmt.Sprintf("%d", cert.Command.CertificateId))
+				field("Collections", strings.Join(cert.Command.Collections, ", "))
+				field("Locations", strings.Join(cert.Command.Locations, ", "))
+			}
+		}
+	}
+}
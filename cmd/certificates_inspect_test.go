@@ -0,0 +1,114 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"kfutil/pkg/certutil"
+)
+
+func Test_LoadInspectEntries(t *testing.T) {
+	certs, key := testCertificateChain(t)
+	noPassword := func(bool) (string, error) { return "", nil }
+
+	keyPEM, err := certutil.EncodePrivateKeyPEM(key)
+	assert.NoError(t, err)
+	format, entries, err := loadInspectEntries(append(certutil.EncodePEM(certs), keyPEM...), noPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, inspectFormatPEM, format)
+	report := buildInspectReport("chain.pem", format, entries, time.Now())
+	assert.Len(t, report.Entries, 1)
+	assert.Empty(t, report.Entries[0].ChainProblems)
+	assert.Len(t, report.Entries[0].Certificates, 3)
+	assert.True(t, report.Entries[0].Certificates[0].HasPrivateKey)
+	assert.False(t, report.Entries[0].Certificates[1].HasPrivateKey)
+	assert.Equal(t, certutil.Thumbprint(certs[0]), report.Entries[0].Certificates[0].Thumbprint)
+	assert.Equal(t, "ECDSA P-256", report.Entries[0].Certificates[0].KeyType)
+
+	format, _, err = loadInspectEntries(certs[0].Raw, noPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, inspectFormatDER, format)
+
+	p7b, err := certutil.EncodePKCS7([]*x509.Certificate{certs[2], certs[0], certs[1]})
+	assert.NoError(t, err)
+	format, entries, err = loadInspectEntries(p7b, noPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, inspectFormatPKCS7, format)
+	report = buildInspectReport("chain.p7b", format, entries, time.Now())
+	assert.Len(t, report.Entries[0].ChainProblems, 1)
+
+	pfx, err := certutil.EncodePKCS12(key, certs[0], certs[1:], "secret")
+	assert.NoError(t, err)
+	var required bool
+	format, entries, err = loadInspectEntries(
+		pfx, func(r bool) (string, error) {
+			required = r
+			return "secret", nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.True(t, required)
+	assert.Equal(t, inspectFormatPKCS12, format)
+	report = buildInspectReport("cert.pfx", format, entries, time.Now())
+	assert.Len(t, report.Entries[0].Certificates, 3)
+	assert.True(t, report.Entries[0].Certificates[0].HasPrivateKey)
+
+	_, _, err = loadInspectEntries(pfx, noPassword)
+	assert.Error(t, err)
+	_, _, err = loadInspectEntries([]byte("not a certificate"), noPassword)
+	assert.Error(t, err)
+
+	var out bytes.Buffer
+	printInspectReport(&out, report)
+	assert.Contains(t, out.String(), "Chain order: OK")
+	assert.Contains(t, out.String(), "private key present")
+}
+
+func Test_LoadInspectEntriesModernPFX(t *testing.T) {
+	// written by OpenSSL 3 with its defaults, AES-256-CBC and a SHA-256 MAC
+	data, err := os.ReadFile(filepath.Join("..", "pkg", "certutil", "testdata", "modern.pfx"))
+	assert.NoError(t, err)
+	format, entries, err := loadInspectEntries(data, func(bool) (string, error) { return "changeit", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, inspectFormatPKCS12, format)
+	report := buildInspectReport("modern.pfx", format, entries, time.Now())
+	assert.Empty(t, report.Entries[0].ChainProblems)
+	assert.Len(t, report.Entries[0].Certificates, 2)
+	assert.True(t, report.Entries[0].Certificates[0].HasPrivateKey)
+	assert.Contains(t, report.Entries[0].Certificates[0].Subject, "modern.example.com")
+}
+
+func Test_InspectCertificateExpired(t *testing.T) {
+	certs, _ := testCertificateChain(t)
+	leaf := certs[0]
+
+	// less than a day past expiry still counts as expired
+	info := inspectCertificate(leaf, 0, false, leaf.NotAfter.Add(2*time.Hour))
+	assert.Equal(t, 0, info.DaysRemaining)
+	assert.True(t, info.Expired)
+	var out bytes.Buffer
+	printInspectReport(&out, inspectReport{Entries: []inspectedEntryGroup{{Certificates: []inspectedCertificate{info}}}})
+	assert.Contains(t, out.String(), "(EXPIRED)")
+
+	info = inspectCertificate(leaf, 0, false, leaf.NotAfter.Add(-2*time.Hour))
+	assert.False(t, info.Expired)
+}
@@ -0,0 +1,358 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	certificateQueryPageSize = 100
+	certIdQueryChunk         = 50
+)
+
+// Lookup fields supported by the legacy client's ListCertificates.
+const (
+	certLookupSubject    = "subject"
+	certLookupThumbprint = "thumbprint"
+	certLookupId         = "id"
+	certLookupCollection = "collection"
+)
+
+// certificateQuery holds the parameters of a certificate search.
+type certificateQuery struct {
+	Query            string
+	CollectionId     int32
+	IncludeMetadata  bool
+	IncludeLocations bool
+	IncludeRevoked   bool
+	IncludeExpired   bool
+	// Page and PageSize select a single page of results. When Page is 0 every page is returned.
+	Page     int32
+	PageSize int32
+}
+
+// certificateSelector identifies a single certificate by ID, thumbprint or serial number.
+type certificateSelector struct {
+	Id         int
+	Thumbprint string
+	Serial     string
+}
+
+func (s certificateSelector) query() (string, error) {
+	switch {
+	case s.Id > 0:
+		return fmt.Sprintf("CertId -eq %d", s.Id), nil
+	case s.Thumbprint != "":
+		return fmt.Sprintf("Thumbprint -eq \"%s\"", strings.ToUpper(strings.ReplaceAll(s.Thumbprint, ":", ""))), nil
+	case s.Serial != "":
+		return fmt.Sprintf("SerialNumber -eq \"%s\"", strings.ToUpper(strings.ReplaceAll(s.Serial, ":", ""))), nil
+	default:
+		return "", fmt.Errorf("a certificate ID, thumbprint or serial number must be specified")
+	}
+}
+
+func (s certificateSelector) String() string {
+	switch {
+	case s.Id > 0:
+		return fmt.Sprintf("ID %d", s.Id)
+	case s.Thumbprint != "":
+		return fmt.Sprintf("thumbprint %s", s.Thumbprint)
+	default:
+		return fmt.Sprintf("serial number %s", s.Serial)
+	}
+}
+
+// queryCertificates returns the certificates matching the query. Unless a page is requested every page is fetched.
+func queryCertificates(sdkClient *keyfactor.APIClient, q certificateQuery) (
+	[]keyfactor.ModelsCertificateRetrievalResponse,
+	error,
+) {
+	pageSize := q.PageSize
+	if pageSize <= 0 {
+		pageSize = certificateQueryPageSize
+	}
+	page := q.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	var results []keyfactor.ModelsCertificateRetrievalResponse
+	for ; ; page++ {
+		req := sdkClient.CertificateApi.CertificateQueryCertificates(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			IncludeMetadata(q.IncludeMetadata).
+			IncludeLocations(q.IncludeLocations).
+			PqIncludeRevoked(q.IncludeRevoked).
+			PqIncludeExpired(q.IncludeExpired).
+			PqPageReturned(page).
+			PqReturnLimit(pageSize)
+		if q.Query != "" {
+			req = req.PqQueryString(q.Query)
+		}
+		if q.CollectionId != 0 {
+			req = req.CollectionId(q.CollectionId)
+		}
+		log.Debug().Str("query", q.Query).Int32("page", page).
+			Msg(fmt.Sprintf("%s CertificateQueryCertificates", DebugFuncCall))
+		certs, httpResp, err := req.Execute()
+		if err != nil {
+			return nil, returnHttpErr(httpResp, err)
+		}
+		results = append(results, certs...)
+		if q.Page > 0 || int32(len(certs)) < pageSize {
+			return results, nil
+		}
+	}
+}
+
+// lookupCertificate returns the single certificate identified by the selector.
+func lookupCertificate(sdkClient *keyfactor.APIClient, selector certificateSelector, includeDetails bool) (
+	*keyfactor.ModelsCertificateRetrievalResponse,
+	error,
+) {
+	query, qErr := selector.query()
+	if qErr != nil {
+		return nil, qErr
+	}
+	certs, err := queryCertificates(
+		sdkClient, certificateQuery{
+			Query:            query,
+			IncludeMetadata:  includeDetails,
+			IncludeLocations: includeDetails,
+			IncludeRevoked:   true,
+			IncludeExpired:   true,
+			Page:             1,
+			PageSize:         2,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up certificate by %s: %s", selector, err)
+	}
+	switch len(certs) {
+	case 0:
+		return nil, fmt.Errorf("no certificate found with %s", selector)
+	case 1:
+		return &certs[0], nil
+	default:
+		return nil, fmt.Errorf("more than one certificate found with %s, use the certificate ID instead", selector)
+	}
+}
+
+// resolveCollectionId returns the ID of a certificate collection given its ID or name.
+func resolveCollectionId(sdkClient *keyfactor.APIClient, collection string) (int32, error) {
+	if id, err := strconv.Atoi(collection); err == nil {
+		return int32(id), nil
+	}
+	collections, err := listCertificateCollections(sdkClient, fmt.Sprintf("Name -eq \"%s\"", collection))
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range collections {
+		if c.GetName() == collection {
+			return c.GetId(), nil
+		}
+	}
+	return 0, fmt.Errorf("certificate collection %q not found", collection)
+}
+
+// listCertificateCollections returns every certificate collection matching the query, or all collections when the
+// query is empty.
+func listCertificateCollections(sdkClient *keyfactor.APIClient, query string) ([]keyfactor.ModelsCertificateQuery, error) {
+	var results []keyfactor.ModelsCertificateQuery
+	for page := int32(1); ; page++ {
+		req := sdkClient.CertificateCollectionApi.CertificateCollectionGetCollections(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			PqPageReturned(page).
+			PqReturnLimit(certificateQueryPageSize)
+		if query != "" {
+			req = req.PqQueryString(query)
+		}
+		collections, httpResp, err := req.Execute()
+		if err != nil {
+			return nil, returnHttpErr(httpResp, err)
+		}
+		results = append(results, collections...)
+		if len(collections) < int(certificateQueryPageSize) {
+			return results, nil
+		}
+	}
+}
+
+// getCertificatesById looks up the given certificate IDs, OR-ing IDs together in chunks.
+func getCertificatesById(sdkClient *keyfactor.APIClient, ids map[int]bool, includeLocations bool) (
+	map[int]keyfactor.ModelsCertificateRetrievalResponse,
+	error,
+) {
+	var sorted []int
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	certs := make(map[int]keyfactor.ModelsCertificateRetrievalResponse)
+	for start := 0; start < len(sorted); start += certIdQueryChunk {
+		end := start + certIdQueryChunk
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		var clauses []string
+		for _, id := range sorted[start:end] {
+			clauses = append(clauses, fmt.Sprintf("CertId -eq %d", id))
+		}
+		results, err := queryCertificates(
+			sdkClient, certificateQuery{
+				Query:            strings.Join(clauses, " OR "),
+				IncludeLocations: includeLocations,
+				IncludeRevoked:   true,
+				IncludeExpired:   true,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range results {
+			certs[int(cert.GetId())] = cert
+		}
+	}
+	return certs, nil
+}
+
+// getCertificatesByThumbprint looks up certificates by thumbprint, in chunks, and returns those found keyed by
+// upper-case thumbprint. When collectionId is set only certificates in that collection are returned.
+func getCertificatesByThumbprint(
+	sdkClient *keyfactor.APIClient,
+	thumbprints []string,
+	collectionId int32,
+	includeLocations bool,
+) (
+	map[string]keyfactor.ModelsCertificateRetrievalResponse,
+	error,
+) {
+	certs := make(map[string]keyfactor.ModelsCertificateRetrievalResponse)
+	for start := 0; start < len(thumbprints); start += certIdQueryChunk {
+		end := start + certIdQueryChunk
+		if end > len(thumbprints) {
+			end = len(thumbprints)
+		}
+		var clauses []string
+		for _, thumbprint := range thumbprints[start:end] {
+			clauses = append(clauses, fmt.Sprintf("Thumbprint -eq \"%s\"", strings.ToUpper(thumbprint)))
+		}
+		results, err := queryCertificates(
+			sdkClient, certificateQuery{
+				Query:            strings.Join(clauses, " OR "),
+				CollectionId:     collectionId,
+				IncludeLocations: includeLocations,
+				IncludeRevoked:   true,
+				IncludeExpired:   true,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range results {
+			certs[strings.ToUpper(cert.GetThumbprint())] = cert
+		}
+	}
+	return certs, nil
+}
+
+// getCertificateByThumbprint looks up a certificate, with its metadata and locations, using the legacy client.
+func getCertificateByThumbprint(kfClient *api.Client, thumbprint string) (*api.GetCertificateResponse, error) {
+	return getCertificateContext(kfClient, 0, thumbprint)
+}
+
+// getCertificateContext looks up a certificate by ID or thumbprint, with its metadata and locations, using the
+// legacy client.
+func getCertificateContext(kfClient *api.Client, id int, thumbprint string) (*api.GetCertificateResponse, error) {
+	return kfClient.GetCertificateContext(
+		&api.GetCertificateContextArgs{
+			IncludeMetadata:  boolToPointer(true),
+			IncludeLocations: boolToPointer(true),
+			CollectionId:     nil,
+			Thumbprint:       thumbprint,
+			Id:               id,
+		},
+	)
+}
+
+// listCertificatesBy lists certificates by a single lookup field using the legacy client.
+func listCertificatesBy(kfClient *api.Client, field string, value string) ([]api.GetCertificateResponse, error) {
+	log.Debug().Str(field, value).Msg(fmt.Sprintf("%s ListCertificates", DebugFuncCall))
+	certs, err := kfClient.ListCertificates(map[string]string{field: value})
+	if err != nil {
+		return nil, err
+	}
+	if certs == nil {
+		return nil, fmt.Errorf(
+			"invalid response returned from Keyfactor Command when listing certificates by %s '%s'",
+			field,
+			value,
+		)
+	}
+	return certs, nil
+}
+
+// findCertificates returns the certificates matching any of the given subjects, thumbprints or IDs. Lookups that
+// fail are reported and skipped. Certificates matched by more than one lookup are only returned once.
+func findCertificates(kfClient *api.Client, subjects, thumbprints, ids []string) []api.GetCertificateResponse {
+	var found []api.GetCertificateResponse
+	seen := make(map[int]bool)
+	lookups := []struct {
+		field  string
+		label  string
+		values []string
+	}{
+		{certLookupSubject, "subject", subjects},
+		{certLookupThumbprint, "thumbprint", thumbprints},
+		{certLookupId, "ID", ids},
+	}
+	for _, lookup := range lookups {
+		for _, value := range lookup.values {
+			certs, err := listCertificatesBy(kfClient, lookup.field, value)
+			if err != nil {
+				fmt.Printf("Unable to find certificate with %s: %s\n", lookup.label, value)
+				log.Error().Err(err).Str(lookup.field, value).Msg("certificate lookup failed")
+				continue
+			}
+			for _, cert := range certs {
+				if seen[cert.Id] {
+					continue
+				}
+				seen[cert.Id] = true
+				found = append(found, cert)
+			}
+		}
+	}
+	return found
+}
+
+func nullableString(v keyfactor.NullableString) string {
+	if p := v.Get(); p != nil {
+		return *p
+	}
+	return ""
+}
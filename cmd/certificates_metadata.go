@@ -0,0 +1,571 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// Keyfactor Command metadata field data types.
+const (
+	metadataTypeString         = 1
+	metadataTypeInteger        = 2
+	metadataTypeDate           = 3
+	metadataTypeBoolean        = 4
+	metadataTypeMultipleChoice = 5
+	metadataTypeBigText        = 6
+	metadataTypeEmail          = 7
+)
+
+// metadataEnrollmentRequired is the Enrollment setting of metadata fields that must have a value.
+const metadataEnrollmentRequired = 1
+
+const defaultMetadataParallelism = 4
+
+// Statuses of a metadata update.
+const (
+	metadataStatusUpdated   = "updated"
+	metadataStatusUnchanged = "unchanged"
+	metadataStatusFailed    = "failed"
+	metadataStatusDryRun    = "dry-run"
+)
+
+var metadataResultsHeader = []string{"Line", "Key", "CertificateId", "Thumbprint", "Status", "Changes", "Message"}
+
+// metadataChange is a single metadata field changed on a certificate.
+type metadataChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// metadataUpdate is a row of a metadata CSV and the outcome of applying it.
+type metadataUpdate struct {
+	Line          int
+	Selector      certificateSelector
+	Values        map[string]string
+	CertificateId int32
+	Thumbprint    string
+	Subject       string
+	Changes       []metadataChange
+	Status        string
+	Message       string
+}
+
+var certificatesMetadataCmd = &cobra.Command{
+	Use:   "metadata",
+	Short: "Manage certificate metadata.",
+	Long:  `Manage the metadata of certificates in Keyfactor Command.`,
+}
+
+var certificatesMetadataSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set certificate metadata in bulk from a CSV file.",
+	Long: `Set certificate metadata from a CSV file with a Thumbprint, CertificateId or SerialNumber column identifying each
+certificate and one column per metadata field. Values are validated against the instance's metadata field definitions
+before anything is changed: integers, dates, booleans, emails, multiple choice options and validation expressions are
+checked and normalized. Empty cells leave a field unchanged unless --clear-empty is given, in which case required
+fields may not be empty. Only fields that differ from the certificate's current metadata are updated. Rows that
+identify the same certificate fail, merge them into one row. Use --dry-run to see the changes without applying them.
+The outcome of every row is written to a results CSV.`,
+	Example: `kfutil certificates metadata set --file cmdb-owners.csv --dry-run
+kfutil certificates metadata set --file cmdb-owners.csv --parallel 8 --results owners-results.csv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		clearEmpty, _ := cmd.Flags().GetBool("clear-empty")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		resultsFile, _ := cmd.Flags().GetString("results")
+		if parallel < 1 {
+			return fmt.Errorf("--parallel must be at least 1")
+		}
+		if resultsFile == "" {
+			resultsFile = fmt.Sprintf("metadata-results-%s.csv", getCurrentTime("unix"))
+		}
+
+		sdkClient, sErr := initGenClient(false)
+		if sErr != nil {
+			return sErr
+		}
+		fields, fErr := listMetadataFields(sdkClient)
+		if fErr != nil {
+			return fmt.Errorf("unable to get metadata fields: %s", fErr)
+		}
+		updates, lErr := loadMetadataCSV(file, fields, clearEmpty)
+		if lErr != nil {
+			return lErr
+		}
+		if rErr := resolveMetadataUpdates(sdkClient, updates); rErr != nil {
+			return rErr
+		}
+		printMetadataDiff(updates)
+
+		if dryRun {
+			for _, u := range updates {
+				if u.Status == "" {
+					u.Status = metadataStatusDryRun
+				}
+			}
+		} else {
+			applyMetadataUpdates(sdkClient, updates, parallel)
+		}
+		if wErr := writeMetadataResults(resultsFile, updates); wErr != nil {
+			return wErr
+		}
+
+		counts := make(map[string]int)
+		for _, u := range updates {
+			counts[u.Status]++
+		}
+		fmt.Printf(
+			"\n%d row(s): %d updated, %d to update, %d unchanged, %d failed. Results written to %s\n",
+			len(updates),
+			counts[metadataStatusUpdated],
+			counts[metadataStatusDryRun],
+			counts[metadataStatusUnchanged],
+			counts[metadataStatusFailed],
+			resultsFile,
+		)
+		if counts[metadataStatusFailed] > 0 {
+			return fmt.Errorf("%d metadata update(s) failed, see %s", counts[metadataStatusFailed], resultsFile)
+		}
+		return nil
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesMetadataCmd)
+	certificatesMetadataCmd.AddCommand(certificatesMetadataSetCmd)
+	certificatesMetadataSetCmd.Flags().StringP("file", "f", "", "CSV file of certificates and metadata values.")
+	certificatesMetadataSetCmd.MarkFlagRequired("file")
+	certificatesMetadataSetCmd.Flags().Bool("clear-empty", false, "Clear metadata fields whose cell is empty.")
+	certificatesMetadataSetCmd.Flags().Bool("dry-run", false, "Show the metadata changes without applying them.")
+	certificatesMetadataSetCmd.Flags().Int("parallel", defaultMetadataParallelism, "Number of certificates to update concurrently.")
+	certificatesMetadataSetCmd.Flags().String(
+		"results",
+		"",
+		"Results CSV file. Defaults to metadata-results-<timestamp>.csv.",
+	)
+}
+
+// loadMetadataCSV reads and validates a metadata CSV. Every invalid cell is reported, and nothing is returned, when
+// any row is invalid.
+func loadMetadataCSV(path string, fields []keyfactor.ModelsMetadataFieldTypeModel, clearEmpty bool) (
+	[]*metadataUpdate,
+	error,
+) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", path, err)
+	}
+	records, cErr := csv.NewReader(strings.NewReader(stripAllBOMs(string(data)))).ReadAll()
+	if cErr != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, cErr)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	byName := make(map[string]keyfactor.ModelsMetadataFieldTypeModel)
+	for _, f := range fields {
+		byName[strings.ToLower(f.GetName())] = f
+	}
+	keyColumn, keyType := -1, ""
+	fieldColumns := make(map[int]keyfactor.ModelsMetadataFieldTypeModel)
+	var unknown []string
+	for i, name := range records[0] {
+		name = strings.TrimSpace(name)
+		switch strings.ToLower(name) {
+		case "certificateid", "certid", "id":
+			keyColumn, keyType = i, "id"
+		case "thumbprint":
+			keyColumn, keyType = i, "thumbprint"
+		case "serialnumber", "serial":
+			keyColumn, keyType = i, "serial"
+		default:
+			f, ok := byName[strings.ToLower(name)]
+			if !ok {
+				unknown = append(unknown, name)
+				continue
+			}
+			fieldColumns[i] = f
+		}
+	}
+	if keyColumn < 0 {
+		return nil, fmt.Errorf("%s must have a Thumbprint, CertificateId or SerialNumber column", path)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%s has columns that are not metadata fields: %s", path, strings.Join(unknown, ", "))
+	}
+	if len(fieldColumns) == 0 {
+		return nil, fmt.Errorf("%s has no metadata field columns", path)
+	}
+
+	var updates []*metadataUpdate
+	var problems []string
+	for n, record := range records[1:] {
+		line := n + 2
+		cell := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		u := &metadataUpdate{Line: line, Values: make(map[string]string)}
+		key := cell(keyColumn)
+		switch {
+		case key == "":
+			problems = append(problems, fmt.Sprintf("line %d: no %s", line, keyType))
+			continue
+		case keyType == "id":
+			id, aErr := strconv.Atoi(key)
+			if aErr != nil || id <= 0 {
+				problems = append(problems, fmt.Sprintf("line %d: invalid certificate ID %q", line, key))
+				continue
+			}
+			u.Selector.Id = id
+		case keyType == "thumbprint":
+			u.Selector.Thumbprint = strings.ToUpper(strings.ReplaceAll(key, ":", ""))
+		default:
+			u.Selector.Serial = strings.ToUpper(strings.ReplaceAll(key, ":", ""))
+		}
+
+		valid := true
+		for i, f := range fieldColumns {
+			value := cell(i)
+			if value == "" && !clearEmpty {
+				continue
+			}
+			normalized, vErr := validateMetadataValue(f, value)
+			if vErr != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %s", line, vErr))
+				valid = false
+				continue
+			}
+			u.Values[f.GetName()] = normalized
+		}
+		if valid {
+			updates = append(updates, u)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s has %d invalid value(s):\n  %s", path, len(problems), strings.Join(problems, "\n  "))
+	}
+	return updates, nil
+}
+
+// validateMetadataValue checks a value against a metadata field definition and returns it in the form Command
+// stores it. An empty value clears the field, which required fields do not allow.
+func validateMetadataValue(field keyfactor.ModelsMetadataFieldTypeModel, value string) (string, error) {
+	name := field.GetName()
+	if value == "" {
+		if field.GetEnrollment() == metadataEnrollmentRequired {
+			return "", fmt.Errorf("%s is required and cannot be cleared", name)
+		}
+		return "", nil
+	}
+
+	switch field.GetDataType() {
+	case metadataTypeInteger:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("%s must be an integer, got %q", name, value)
+		}
+	case metadataTypeDate:
+		var parsed time.Time
+		var err error
+		for _, layout := range []string{"2006-01-02", time.RFC3339, "1/2/2006"} {
+			if parsed, err = time.Parse(layout, value); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s must be a date such as 2024-12-31, got %q", name, value)
+		}
+		value = parsed.Format("2006-01-02")
+	case metadataTypeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false, got %q", name, value)
+		}
+		value = "False"
+		if b {
+			value = "True"
+		}
+	case metadataTypeMultipleChoice:
+		var options []string
+		for _, o := range strings.Split(field.GetOptions(), ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				options = append(options, o)
+			}
+		}
+		matched := ""
+		for _, o := range options {
+			if strings.EqualFold(o, value) {
+				matched = o
+			}
+		}
+		if matched == "" {
+			return "", fmt.Errorf("%s must be one of %s, got %q", name, strings.Join(options, ", "), value)
+		}
+		value = matched
+	case metadataTypeEmail:
+		for _, addr := range strings.Split(value, ",") {
+			if _, err := mail.ParseAddress(strings.TrimSpace(addr)); err != nil {
+				return "", fmt.Errorf("%s must be an email address, got %q", name, value)
+			}
+		}
+	}
+
+	if expr := field.GetValidation(); expr != "" &&
+		(field.GetDataType() == metadataTypeString || field.GetDataType() == metadataTypeEmail) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			log.Warn().Str("field", name).Str("validation", expr).Msg("unable to compile metadata validation expression")
+		} else if !re.MatchString(value) {
+			msg := field.GetMessage()
+			if msg == "" {
+				msg = fmt.Sprintf("does not match %s", expr)
+			}
+			return "", fmt.Errorf("%s value %q %s", name, value, msg)
+		}
+	}
+	return value, nil
+}
+
+// resolveMetadataUpdates looks up the certificate of every row, with its metadata, and computes the changes to
+// make. Rows whose certificate cannot be found, whose serial number matches more than one certificate, or whose
+// certificate is also the target of another row, fail.
+func resolveMetadataUpdates(sdkClient *keyfactor.APIClient, updates []*metadataUpdate) error {
+	for start := 0; start < len(updates); start += certIdQueryChunk {
+		end := start + certIdQueryChunk
+		if end > len(updates) {
+			end = len(updates)
+		}
+		var clauses []string
+		for _, u := range updates[start:end] {
+			q, _ := u.Selector.query()
+			clauses = append(clauses, q)
+		}
+		results, err := queryCertificates(
+			sdkClient, certificateQuery{
+				Query:           strings.Join(clauses, " OR "),
+				IncludeMetadata: true,
+				IncludeRevoked:  true,
+				IncludeExpired:  true,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to look up certificates: %s", err)
+		}
+		for _, u := range updates[start:end] {
+			var matches []keyfactor.ModelsCertificateRetrievalResponse
+			for _, cert := range results {
+				if metadataSelectorMatches(u.Selector, cert) {
+					matches = append(matches, cert)
+				}
+			}
+			switch len(matches) {
+			case 0:
+				u.Status = metadataStatusFailed
+				u.Message = "certificate not found"
+			case 1:
+				cert := matches[0]
+				u.CertificateId = cert.GetId()
+				u.Thumbprint = cert.GetThumbprint()
+				u.Subject = nullableString(cert.IssuedDN)
+				current := map[string]string{}
+				if cert.Metadata != nil {
+					current = *cert.Metadata
+				}
+				u.Changes = diffMetadata(current, u.Values)
+				if len(u.Changes) == 0 {
+					u.Status = metadataStatusUnchanged
+				}
+			default:
+				u.Status = metadataStatusFailed
+				u.Message = fmt.Sprintf("%d certificates match, use the thumbprint or certificate ID", len(matches))
+			}
+		}
+	}
+	failDuplicateMetadataTargets(updates)
+	return nil
+}
+
+// failDuplicateMetadataTargets fails the rows that resolve to the same certificate, as updates are applied
+// concurrently and would overwrite each other.
+func failDuplicateMetadataTargets(updates []*metadataUpdate) {
+	lines := make(map[int32][]string)
+	for _, u := range updates {
+		if u.CertificateId > 0 {
+			lines[u.CertificateId] = append(lines[u.CertificateId], strconv.Itoa(u.Line))
+		}
+	}
+	for _, u := range updates {
+		if u.CertificateId > 0 && len(lines[u.CertificateId]) > 1 {
+			u.Status = metadataStatusFailed
+			u.Changes = nil
+			u.Message = fmt.Sprintf(
+				"lines %s update the same certificate, merge them into one row",
+				strings.Join(lines[u.CertificateId], ", "),
+			)
+		}
+	}
+}
+
+func metadataSelectorMatches(s certificateSelector, cert keyfactor.ModelsCertificateRetrievalResponse) bool {
+	switch {
+	case s.Id > 0:
+		return int(cert.GetId()) == s.Id
+	case s.Thumbprint != "":
+		return strings.EqualFold(cert.GetThumbprint(), s.Thumbprint)
+	default:
+		return strings.EqualFold(cert.GetSerialNumber(), s.Serial)
+	}
+}
+
+// diffMetadata returns the fields whose new value differs from the current metadata, in field name order.
+func diffMetadata(current map[string]string, values map[string]string) []metadataChange {
+	var changes []metadataChange
+	for field, value := range values {
+		old := current[field]
+		if old != value {
+			changes = append(changes, metadataChange{Field: field, Old: old, New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func printMetadataDiff(updates []*metadataUpdate) {
+	for _, u := range updates {
+		if u.Status == metadataStatusFailed {
+			fmt.Printf("! line %d %s: %s\n", u.Line, u.Selector, u.Message)
+			continue
+		}
+		if len(u.Changes) == 0 {
+			continue
+		}
+		fmt.Printf("~ certificate %d (%s)\n", u.CertificateId, u.Subject)
+		for _, c := range u.Changes {
+			fmt.Printf("    %s: %q -> %q\n", c.Field, c.Old, c.New)
+		}
+	}
+}
+
+// applyMetadataUpdates updates the changed fields of every certificate, using the given number of workers.
+func applyMetadataUpdates(sdkClient *keyfactor.APIClient, updates []*metadataUpdate, parallel int) {
+	work := make(chan *metadataUpdate)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range work {
+				if err := updateCertificateMetadata(sdkClient, u); err != nil {
+					u.Status = metadataStatusFailed
+					u.Message = err.Error()
+					continue
+				}
+				u.Status = metadataStatusUpdated
+			}
+		}()
+	}
+	for _, u := range updates {
+		if u.Status == "" {
+			work <- u
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+func updateCertificateMetadata(sdkClient *keyfactor.APIClient, u *metadataUpdate) error {
+	metadata := make(map[string]string)
+	for _, c := range u.Changes {
+		metadata[c.Field] = c.New
+	}
+	return setCertificateMetadata(sdkClient, u.CertificateId, metadata)
+}
+
+// setCertificateMetadata sets the given metadata fields of a certificate, leaving its other fields as they are.
+func setCertificateMetadata(sdkClient *keyfactor.APIClient, certId int32, metadata map[string]string) error {
+	log.Debug().Int32("certId", certId).Interface("metadata", metadata).
+		Msg(fmt.Sprintf("%s CertificateUpdateMetadata", DebugFuncCall))
+	httpResp, err := sdkClient.CertificateApi.CertificateUpdateMetadata(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		MetadataUpdate(keyfactor.ModelsMetadataUpdateRequest{Id: &certId, Metadata: metadata}).
+		Execute()
+	if err != nil {
+		return returnHttpErr(httpResp, err)
+	}
+	return nil
+}
+
+func writeMetadataResults(path string, updates []*metadataUpdate) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to write results to %s: %s", path, err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(metadataResultsHeader)
+	for _, u := range updates {
+		var changes []string
+		for _, c := range u.Changes {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New))
+		}
+		id := ""
+		if u.CertificateId > 0 {
+			id = strconv.Itoa(int(u.CertificateId))
+		}
+		w.Write(
+			[]string{
+				strconv.Itoa(u.Line),
+				u.Selector.String(),
+				id,
+				u.Thumbprint,
+				u.Status,
+				strings.Join(changes, "; "),
+				u.Message,
+			},
+		)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMetadataField(name string, dataType int32, enrollment int32, options string, validation string) keyfactor.ModelsMetadataFieldTypeModel {
+	return keyfactor.ModelsMetadataFieldTypeModel{
+		Name:       &name,
+		DataType:   &dataType,
+		Enrollment: &enrollment,
+		Options:    &options,
+		Validation: &validation,
+	}
+}
+
+func testMetadataFields() []keyfactor.ModelsMetadataFieldTypeModel {
+	return []keyfactor.ModelsMetadataFieldTypeModel{
+		testMetadataField("Owner", metadataTypeString, metadataEnrollmentRequired, "", ""),
+		testMetadataField("Team", metadataTypeMultipleChoice, 0, "Ops, Apps,Security", ""),
+		testMetadataField("Expires", metadataTypeDate, 0, "", ""),
+		testMetadataField("Critical", metadataTypeBoolean, 0, "", ""),
+		testMetadataField("Contact", metadataTypeEmail, 0, "", ""),
+		testMetadataField("Cost", metadataTypeInteger, 0, "", ""),
+		testMetadataField("Ticket", metadataTypeString, 0, "", "^CHG[0-9]+$"),
+	}
+}
+
+func Test_ValidateMetadataValue(t *testing.T) {
+	fields := testMetadataFields()
+	valid := []struct {
+		field    int
+		value    string
+		expected string
+	}{
+		{1, "apps", "Apps"},
+		{2, "2024-12-31", "2024-12-31"},
+		{2, "2024-12-31T10:00:00Z", "2024-12-31"},
+		{3, "1", "True"},
+		{3, "false", "False"},
+		{4, "ops@example.com", "ops@example.com"},
+		{5, "42", "42"},
+		{6, "CHG123", "CHG123"},
+		{5, "", ""},
+	}
+	for _, c := range valid {
+		value, err := validateMetadataValue(fields[c.field], c.value)
+		assert.NoError(t, err, c.value)
+		assert.Equal(t, c.expected, value)
+	}
+
+	for field, value := range map[int]string{0: "", 1: "Finance", 2: "next week", 3: "yes", 4: "ops", 5: "4.5", 6: "INC1"} {
+		_, err := validateMetadataValue(fields[field], value)
+		assert.Error(t, err, value)
+	}
+}
+
+func Test_LoadMetadataCSV(t *testing.T) {
+	dir := t.TempDir()
+	fields := testMetadataFields()
+
+	valid := filepath.Join(dir, "valid.csv")
+	assert.NoError(
+		t,
+		os.WriteFile(valid, []byte("\ufeffThumbprint,owner,Team\naa:bb,alice,ops\nCCDD,,Apps\n"), 0600),
+	)
+	updates, err := loadMetadataCSV(valid, fields, false)
+	assert.NoError(t, err)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, "AABB", updates[0].Selector.Thumbprint)
+	assert.Equal(t, map[string]string{"Owner": "alice", "Team": "Ops"}, updates[0].Values)
+	assert.Equal(t, map[string]string{"Team": "Apps"}, updates[1].Values)
+
+	_, err = loadMetadataCSV(valid, fields, true)
+	assert.ErrorContains(t, err, "Owner is required")
+
+	invalid := filepath.Join(dir, "invalid.csv")
+	assert.NoError(t, os.WriteFile(invalid, []byte("Id,Team,Cost\nx,Ops,1\n5,HR,1\n6,Ops,abc\n"), 0600))
+	_, err = loadMetadataCSV(invalid, fields, false)
+	assert.ErrorContains(t, err, "3 invalid value(s)")
+
+	unknown := filepath.Join(dir, "unknown.csv")
+	assert.NoError(t, os.WriteFile(unknown, []byte("SerialNumber,Department\n01,IT\n"), 0600))
+	_, err = loadMetadataCSV(unknown, fields, false)
+	assert.ErrorContains(t, err, "Department")
+
+	noKey := filepath.Join(dir, "nokey.csv")
+	assert.NoError(t, os.WriteFile(noKey, []byte("Owner\nalice\n"), 0600))
+	_, err = loadMetadataCSV(noKey, fields, false)
+	assert.Error(t, err)
+}
+
+func Test_DiffMetadata(t *testing.T) {
+	changes := diffMetadata(
+		map[string]string{"Owner": "alice", "Team": "Ops"},
+		map[string]string{"Owner": "bob", "Team": "Ops", "Cost": "5"},
+	)
+	assert.Equal(
+		t, []metadataChange{
+			{Field: "Cost", Old: "", New: "5"},
+			{Field: "Owner", Old: "alice", New: "bob"},
+		}, changes,
+	)
+	assert.Empty(t, diffMetadata(map[string]string{"Owner": "alice"}, map[string]string{"Owner": "alice"}))
+}
+
+func Test_FailDuplicateMetadataTargets(t *testing.T) {
+	updates := []*metadataUpdate{
+		{Line: 2, CertificateId: 10, Changes: []metadataChange{{Field: "Owner", New: "alice"}}},
+		{Line: 3, CertificateId: 11, Changes: []metadataChange{{Field: "Owner", New: "bob"}}},
+		{Line: 4, CertificateId: 10, Status: metadataStatusUnchanged},
+		{Line: 5, Status: metadataStatusFailed, Message: "certificate not found"},
+	}
+	failDuplicateMetadataTargets(updates)
+
+	assert.Equal(t, metadataStatusFailed, updates[0].Status)
+	assert.Empty(t, updates[0].Changes)
+	assert.Equal(t, "lines 2, 4 update the same certificate, merge them into one row", updates[0].Message)
+	assert.Equal(t, metadataStatusFailed, updates[2].Status)
+	assert.Equal(t, "", updates[1].Status)
+	assert.Equal(t, "certificate not found", updates[3].Message)
+}
@@ -0,0 +1,553 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const keyfactorQueryTimeFormat = "2006-01-02T15:04:05"
+
+// Actions recorded in a renewal campaign report.
+const (
+	renewalActionRenew  = "renew"
+	renewalActionAdd    = "add"
+	renewalActionRemove = "remove"
+)
+
+// Statuses of a renewal campaign report row, in addition to the orchestrator job statuses.
+const (
+	renewalStatusFailed    = "Failed"
+	renewalStatusScheduled = "Scheduled"
+	renewalStatusDryRun    = "DryRun"
+)
+
+var renewalReportHeader = []string{
+	"OldCertificateId",
+	"OldThumbprint",
+	"Subject",
+	"NotAfter",
+	"NewCertificateId",
+	"NewThumbprint",
+	"Action",
+	"StoreId",
+	"ClientMachine",
+	"StorePath",
+	"Alias",
+	"JobId",
+	"Status",
+	"Message",
+}
+
+// renewalTarget is a certificate selected for renewal and the outcome of renewing it.
+type renewalTarget struct {
+	Old        *api.GetCertificateResponse
+	Result     enrollmentResult
+	Err        error
+	ReportRows []*renewalReportRow
+}
+
+// renewalReportRow is a single action of a renewal campaign.
+type renewalReportRow struct {
+	Action        string
+	StoreId       string
+	ClientMachine string
+	StorePath     string
+	Alias         string
+	JobId         string
+	Status        string
+	Message       string
+}
+
+// renewalDeployment is an add, and optional removal, planned for a location of a renewed certificate.
+type renewalDeployment struct {
+	Location          api.CertificateLocations
+	Alias             string
+	IncludePrivateKey bool
+	RemoveOld         bool
+}
+
+var certificatesRenewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Renew certificates and redeploy them to every store location of the original.",
+	Long: `Renew every certificate expiring within --expiring-within and/or matching --query. Each certificate is reissued
+with the template, subject and SANs of the original, then added to every certificate store location the original is
+deployed to, using the same alias with overwrite. Stores whose type does not allow custom aliases receive the new
+certificate under its own thumbprint, use --remove-old to remove the original from those stores. A campaign report
+with the outcome of each renewal and orchestrator job is written as CSV. Use --wait to include job results.`,
+	Example: `kfutil certificates renew --expiring-within 30d --dry-run
+kfutil certificates renew --expiring-within 2w --query 'TemplateShortName -eq "WebServer"' --remove-old --wait --force`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		within, _ := cmd.Flags().GetString("expiring-within")
+		query, _ := cmd.Flags().GetString("query")
+		removeOld, _ := cmd.Flags().GetBool("remove-old")
+		reportFile, _ := cmd.Flags().GetString("report")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		fullQuery, qErr := expiringQuery(query, within, time.Now())
+		if qErr != nil {
+			return qErr
+		}
+		if reportFile == "" {
+			reportFile = fmt.Sprintf("renew-report-%s.csv", getCurrentTime("unix"))
+		}
+
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			return cErr
+		}
+		sdkClient, sErr := initGenClient(false)
+		if sErr != nil {
+			return sErr
+		}
+
+		log.Debug().Str("query", fullQuery).Msg("selecting certificates to renew")
+		certs, err := queryCertificates(sdkClient, certificateQuery{Query: fullQuery})
+		if err != nil {
+			return fmt.Errorf("unable to query certificates: %s", err)
+		}
+		if len(certs) == 0 {
+			fmt.Println("No certificates matched, nothing to renew.")
+			return nil
+		}
+
+		var targets []*renewalTarget
+		for _, c := range certs {
+			old, lErr := getCertificateContext(kfClient, int(c.GetId()), "")
+			if lErr != nil || old == nil {
+				fmt.Printf("Unable to look up certificate %d: %v\n", c.GetId(), lErr)
+				continue
+			}
+			targets = append(targets, &renewalTarget{Old: old})
+		}
+		storeTypes := make(map[int]*api.CertificateStoreType)
+		printRenewalPlan(targets)
+
+		if dryRun {
+			for _, t := range targets {
+				t.ReportRows = append(t.ReportRows, &renewalReportRow{Action: renewalActionRenew, Status: renewalStatusDryRun})
+				for _, d := range planRenewalDeployments(kfClient, storeTypes, t.Old, removeOld) {
+					t.ReportRows = append(t.ReportRows, d.reportRows(renewalStatusDryRun)...)
+				}
+			}
+			fmt.Printf("Dry run: %d certificate(s) would be renewed.\n", len(targets))
+			return writeRenewalReport(reportFile, targets, nil)
+		}
+		if !force {
+			if noPrompt {
+				return fmt.Errorf("use --force to renew certificates without confirmation")
+			}
+			if !promptForInteractiveYesNo(fmt.Sprintf("Renew and redeploy %d certificate(s)?", len(targets))) {
+				fmt.Println("Aborting")
+				return nil
+			}
+		}
+
+		tracker, tErr := newInventoryJobTracker(wait)
+		if tErr != nil {
+			return tErr
+		}
+		transitPassword, pErr := generateRandomPassword(32)
+		if pErr != nil {
+			return pErr
+		}
+
+		failed := 0
+		for _, t := range targets {
+			renewCertificate(sdkClient, t)
+			if t.Err != nil {
+				failed++
+				fmt.Printf("Unable to renew certificate %d (%s): %s\n", t.Old.Id, t.Old.IssuedDN, t.Err)
+				continue
+			}
+			if t.Result.Status == enrollmentPending {
+				fmt.Printf(
+					"Renewal of certificate %d is pending approval as request %d, it was not redeployed.\n",
+					t.Old.Id,
+					t.Result.RequestId,
+				)
+				continue
+			}
+			fmt.Printf(
+				"Renewed certificate %d as %d (%s)\n",
+				t.Old.Id,
+				t.Result.CertificateId,
+				t.Result.Thumbprint,
+			)
+			for _, d := range planRenewalDeployments(kfClient, storeTypes, t.Old, removeOld) {
+				t.ReportRows = append(t.ReportRows, d.schedule(kfClient, tracker, t, transitPassword)...)
+			}
+		}
+
+		if tracker != nil && len(tracker.jobs) > 0 {
+			printJobSummary(tracker.wait(timeout), outputFormat)
+		}
+		if wErr := writeRenewalReport(reportFile, targets, tracker); wErr != nil {
+			return wErr
+		}
+		fmt.Printf("Campaign report written to %s\n", reportFile)
+
+		jobFailures := 0
+		for _, t := range targets {
+			for _, row := range t.ReportRows {
+				if row.Action == renewalActionRenew {
+					continue
+				}
+				if row.Status == renewalStatusFailed || row.Status == jobStatusFailure ||
+					row.Status == jobStatusTimedOut {
+					jobFailures++
+				}
+			}
+		}
+		if failed > 0 || jobFailures > 0 {
+			return fmt.Errorf(
+				"%d certificate(s) could not be renewed and %d deployment(s) failed, see %s",
+				failed,
+				jobFailures,
+				reportFile,
+			)
+		}
+		return nil
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesRenewCmd)
+	certificatesRenewCmd.Flags().String(
+		"expiring-within",
+		"",
+		"Renew certificates expiring within this period, e.g. 30d, 2w or 72h.",
+	)
+	certificatesRenewCmd.Flags().StringP("query", "q", "", "Renew certificates matching this Keyfactor Command query.")
+	certificatesRenewCmd.MarkFlagsOneRequired("expiring-within", "query")
+	certificatesRenewCmd.Flags().Bool(
+		"remove-old",
+		false,
+		"Remove the original certificate from stores where the new one is not added under the same alias.",
+	)
+	certificatesRenewCmd.Flags().String("report", "", "Campaign report CSV file. Defaults to renew-report-<timestamp>.csv.")
+	certificatesRenewCmd.Flags().Bool("dry-run", false, "Show what would be renewed and deployed without changing anything.")
+	certificatesRenewCmd.Flags().Bool("force", false, "Renew without asking for confirmation.")
+	addJobWaitFlags(certificatesRenewCmd)
+}
+
+// expiringQuery combines a user query with a NotAfter window ending the given period after now.
+func expiringQuery(query string, within string, now time.Time) (string, error) {
+	var clauses []string
+	if query != "" {
+		clauses = append(clauses, fmt.Sprintf("(%s)", query))
+	}
+	if within != "" {
+		d, err := parseDayDuration(within)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(
+			clauses,
+			fmt.Sprintf("NotAfter -ge \"%s\"", now.UTC().Format(keyfactorQueryTimeFormat)),
+			fmt.Sprintf("NotAfter -le \"%s\"", now.Add(d).UTC().Format(keyfactorQueryTimeFormat)),
+		)
+	}
+	if len(clauses) == 0 {
+		return "", fmt.Errorf("--expiring-within or --query is required")
+	}
+	return strings.Join(clauses, " AND "), nil
+}
+
+func printRenewalPlan(targets []*renewalTarget) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSUBJECT\tNOT AFTER\tTEMPLATE\tCA\tLOCATIONS")
+	for _, t := range targets {
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%s\t%s\t%s\t%d\n",
+			t.Old.Id,
+			t.Old.IssuedDN,
+			t.Old.NotAfter,
+			t.Old.TemplateName,
+			t.Old.CertificateAuthorityName,
+			len(leafLocations(t.Old.Locations)),
+		)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// leafLocations returns the locations where the certificate is deployed as the end entity certificate.
+func leafLocations(locations []api.CertificateLocations) []api.CertificateLocations {
+	var leaves []api.CertificateLocations
+	for _, loc := range locations {
+		if loc.ChainLevel == 0 {
+			leaves = append(leaves, loc)
+		}
+	}
+	return leaves
+}
+
+// renewCertificate reissues a certificate with the template and certificate authority of the original.
+func renewCertificate(sdkClient *keyfactor.APIClient, t *renewalTarget) {
+	certId := int32(t.Old.Id)
+	now := time.Now().UTC()
+	req := keyfactor.ModelsEnrollmentRenewalRequest{CertificateId: &certId, Timestamp: &now}
+	if t.Old.TemplateName != "" {
+		req.Template = &t.Old.TemplateName
+	}
+	if t.Old.CertificateAuthorityName != "" {
+		req.CertificateAuthority = &t.Old.CertificateAuthorityName
+	}
+
+	log.Debug().Int32("certId", certId).Msg(fmt.Sprintf("%s EnrollmentRenew", DebugFuncCall))
+	resp, httpResp, err := sdkClient.EnrollmentApi.EnrollmentRenew(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Request(req).
+		Execute()
+	row := &renewalReportRow{Action: renewalActionRenew}
+	t.ReportRows = append(t.ReportRows, row)
+	if err != nil {
+		t.Err = returnHttpErr(httpResp, err)
+	} else if resp == nil {
+		t.Err = fmt.Errorf("invalid response returned from Keyfactor Command for renewal")
+	} else {
+		t.Result, t.Err = newEnrollmentResult(
+			resp.GetRequestDisposition(),
+			resp.GetDispositionMessage(),
+			resp.GetKeyfactorRequestId(),
+			resp.GetKeyfactorId(),
+			resp.GetThumbprint(),
+			resp.GetSerialNumber(),
+			resp.GetKeyfactorId() > 0,
+		)
+	}
+	if t.Err != nil {
+		row.Status = renewalStatusFailed
+		row.Message = t.Err.Error()
+		return
+	}
+	row.Status = t.Result.Status
+	row.Message = t.Result.Message
+}
+
+// planRenewalDeployments returns the deployment for each leaf location of the original certificate. The alias and
+// private key options follow the location's store type, as for 'inventory add'.
+func planRenewalDeployments(
+	kfClient *api.Client,
+	storeTypes map[int]*api.CertificateStoreType,
+	old *api.GetCertificateResponse,
+	removeOld bool,
+) []renewalDeployment {
+	var deployments []renewalDeployment
+	for _, loc := range leafLocations(old.Locations) {
+		sType, ok := storeTypes[loc.StoreType]
+		if !ok {
+			var err error
+			sType, err = kfClient.GetCertificateStoreTypeById(loc.StoreType)
+			if err != nil {
+				log.Error().Err(err).Int("storeType", loc.StoreType).Msg("unable to get store type")
+				sType = &api.CertificateStoreType{}
+			}
+			storeTypes[loc.StoreType] = sType
+		}
+		deployments = append(deployments, newRenewalDeployment(loc, sType, removeOld))
+	}
+	return deployments
+}
+
+func newRenewalDeployment(loc api.CertificateLocations, sType *api.CertificateStoreType, removeOld bool) renewalDeployment {
+	d := renewalDeployment{
+		Location:          loc,
+		Alias:             loc.Alias,
+		IncludePrivateKey: sType.PrivateKeyAllowed != storeTypeSettingForbidden,
+	}
+	if sType.CustomAliasAllowed == storeTypeSettingForbidden {
+		// The store names entries itself, so the new certificate does not replace the original.
+		d.Alias = ""
+		d.RemoveOld = removeOld
+	}
+	return d
+}
+
+func (d renewalDeployment) store() api.GetCertificateStoreResponse {
+	return api.GetCertificateStoreResponse{
+		Id:            d.Location.CertStoreId,
+		ClientMachine: d.Location.StoreMachine,
+		StorePath:     d.Location.StorePath,
+	}
+}
+
+func (d renewalDeployment) reportRows(status string) []*renewalReportRow {
+	rows := []*renewalReportRow{
+		{
+			Action:        renewalActionAdd,
+			StoreId:       d.Location.CertStoreId,
+			ClientMachine: d.Location.StoreMachine,
+			StorePath:     d.Location.StorePath,
+			Alias:         d.Alias,
+			Status:        status,
+		},
+	}
+	if d.RemoveOld {
+		rows = append(
+			rows, &renewalReportRow{
+				Action:        renewalActionRemove,
+				StoreId:       d.Location.CertStoreId,
+				ClientMachine: d.Location.StoreMachine,
+				StorePath:     d.Location.StorePath,
+				Alias:         d.Location.Alias,
+				Status:        status,
+			},
+		)
+	}
+	return rows
+}
+
+// schedule adds the renewed certificate to the location and, when planned, removes the original.
+func (d renewalDeployment) schedule(
+	kfClient *api.Client,
+	tracker *jobTracker,
+	t *renewalTarget,
+	transitPassword string,
+) []*renewalReportRow {
+	rows := d.reportRows(renewalStatusScheduled)
+	password := ""
+	if d.IncludePrivateKey {
+		password = transitPassword
+	}
+	jobIds, err := scheduleCertificateAdd(
+		kfClient,
+		tracker,
+		d.store(),
+		int(t.Result.CertificateId),
+		t.Result.Thumbprint,
+		d.Alias,
+		true,
+		d.IncludePrivateKey,
+		password,
+	)
+	recordScheduledJob(rows[0], jobIds, err)
+	if !d.RemoveOld {
+		return rows
+	}
+	if err != nil {
+		rows[1].Status = renewalStatusFailed
+		rows[1].Message = "not removed as the renewed certificate could not be added"
+		return rows
+	}
+	jobIds, err = scheduleCertificateRemove(kfClient, tracker, d.store(), t.Old.Id, t.Old.Thumbprint, d.Location.Alias)
+	recordScheduledJob(rows[1], jobIds, err)
+	return rows
+}
+
+func recordScheduledJob(row *renewalReportRow, jobIds []string, err error) {
+	if err != nil {
+		row.Status = renewalStatusFailed
+		row.Message = err.Error()
+		return
+	}
+	row.JobId = strings.Join(jobIds, ";")
+}
+
+// jobStatusRank orders job statuses from best to worst, so a report row of several jobs shows the worst of them.
+var jobStatusRank = map[string]int{
+	jobStatusSuccess:  0,
+	jobStatusWarning:  1,
+	jobStatusPending:  2,
+	jobStatusTimedOut: 3,
+	jobStatusFailure:  4,
+}
+
+// worstTrackedJob returns the tracked job with the worst status among the given job IDs, or nil when none of them is
+// tracked.
+func worstTrackedJob(tracker *jobTracker, jobIds []string) *trackedJob {
+	var worst *trackedJob
+	for _, id := range jobIds {
+		job, ok := tracker.byId[strings.ToLower(id)]
+		if !ok {
+			continue
+		}
+		if worst == nil || jobStatusRank[job.Status] > jobStatusRank[worst.Status] {
+			worst = job
+		}
+	}
+	return worst
+}
+
+// writeRenewalReport writes the campaign report, taking job results from the tracker when jobs were tracked.
+func writeRenewalReport(path string, targets []*renewalTarget, tracker *jobTracker) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to write report to %s: %s", path, err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(renewalReportHeader)
+	for _, t := range targets {
+		for _, row := range t.ReportRows {
+			if tracker != nil && row.JobId != "" {
+				if job := worstTrackedJob(tracker, strings.Split(row.JobId, ";")); job != nil {
+					row.Status = job.Status
+					row.Message = job.Message
+				}
+			}
+			newId := ""
+			if t.Result.CertificateId > 0 {
+				newId = strconv.Itoa(int(t.Result.CertificateId))
+			}
+			w.Write(
+				[]string{
+					strconv.Itoa(t.Old.Id),
+					t.Old.Thumbprint,
+					t.Old.IssuedDN,
+					t.Old.NotAfter,
+					newId,
+					t.Result.Thumbprint,
+					row.Action,
+					row.StoreId,
+					row.ClientMachine,
+					row.StorePath,
+					row.Alias,
+					row.JobId,
+					row.Status,
+					row.Message,
+				},
+			)
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
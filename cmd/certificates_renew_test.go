@@ -0,0 +1,112 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseDayDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"72h": 72 * time.Hour,
+	}
+	for input, expected := range cases {
+		d, err := parseDayDuration(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, d, input)
+	}
+	for _, input := range []string{"", "d", "-5d", "soon"} {
+		_, err := parseDayDuration(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func Test_ExpiringQuery(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	q, err := expiringQuery(`IssuerDN -contains "Test"`, "30d", now)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		`(IssuerDN -contains "Test") AND NotAfter -ge "2024-05-01T12:00:00" AND NotAfter -le "2024-05-31T12:00:00"`,
+		q,
+	)
+
+	q, err = expiringQuery(`CN -eq "a"`, "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, `(CN -eq "a")`, q)
+
+	_, err = expiringQuery("", "", now)
+	assert.Error(t, err)
+	_, err = expiringQuery("", "month", now)
+	assert.Error(t, err)
+}
+
+func Test_NewRenewalDeployment(t *testing.T) {
+	loc := api.CertificateLocations{CertStoreId: "s1", Alias: "web"}
+
+	d := newRenewalDeployment(
+		loc,
+		&api.CertificateStoreType{PrivateKeyAllowed: "Required", CustomAliasAllowed: "Required"},
+		true,
+	)
+	assert.Equal(t, "web", d.Alias)
+	assert.True(t, d.IncludePrivateKey)
+	assert.False(t, d.RemoveOld)
+	assert.Len(t, d.reportRows(renewalStatusDryRun), 1)
+
+	d = newRenewalDeployment(
+		loc,
+		&api.CertificateStoreType{PrivateKeyAllowed: "Forbidden", CustomAliasAllowed: "Forbidden"},
+		true,
+	)
+	assert.Equal(t, "", d.Alias)
+	assert.False(t, d.IncludePrivateKey)
+	assert.True(t, d.RemoveOld)
+	rows := d.reportRows(renewalStatusDryRun)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, renewalActionRemove, rows[1].Action)
+	assert.Equal(t, "web", rows[1].Alias)
+
+	assert.Len(t, leafLocations([]api.CertificateLocations{loc, {ChainLevel: 1}}), 1)
+}
+
+func Test_WriteRenewalReportWorstJob(t *testing.T) {
+	tracker := newJobTracker(nil)
+	tracker.track([]string{"A", "B"}, "s1", "host", "/path", "add")
+	tracker.byId["a"].Status = jobStatusSuccess
+	tracker.byId["b"].Status = jobStatusFailure
+	tracker.byId["b"].Message = "access denied"
+
+	row := &renewalReportRow{Action: "Add", StoreId: "s1", JobId: "A;B", Status: renewalStatusScheduled}
+	targets := []*renewalTarget{{Old: &api.GetCertificateResponse{Id: 1}, ReportRows: []*renewalReportRow{row}}}
+	path := filepath.Join(t.TempDir(), "report.csv")
+	assert.NoError(t, writeRenewalReport(path, targets, tracker))
+	assert.Equal(t, jobStatusFailure, row.Status)
+	assert.Equal(t, "access denied", row.Message)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "A;B,Failure,access denied")
+
+	assert.Nil(t, worstTrackedJob(tracker, []string{"C"}))
+}
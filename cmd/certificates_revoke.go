@@ -0,0 +1,621 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultRevocationComment = "Revoked by kfutil"
+	certStateRevoked         = 2
+)
+
+// Statuses of a revocation target in the results file.
+const (
+	revocationRevoked = "revoked"
+	revocationPending = "pending"
+	revocationFailed  = "failed"
+	revocationSkipped = "skipped"
+	revocationDryRun  = "dry-run"
+)
+
+// revocationReasons maps the names accepted by --reason and the CSV Reason column to Keyfactor Command reason codes.
+var revocationReasons = map[string]int32{
+	"unspecified":            0,
+	"key-compromise":         1,
+	"ca-compromise":          2,
+	"affiliation-changed":    3,
+	"superseded":             4,
+	"cessation-of-operation": 5,
+	"certificate-hold":       6,
+	"remove-from-hold":       999,
+}
+
+var revocationResultsHeader = []string{
+	"CertificateId",
+	"Thumbprint",
+	"Subject",
+	"Reason",
+	"Comment",
+	"Status",
+	"Message",
+	"RemovalJobs",
+}
+
+// revocationTarget is a certificate to revoke along with the outcome of its revocation.
+type revocationTarget struct {
+	CertificateId int
+	Thumbprint    string
+	Subject       string
+	Reason        int32
+	Comment       string
+	Locations     []api.CertificateLocations
+	Status        string
+	Message       string
+	RemovalJobs   int
+}
+
+var certificatesRevokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke one or more certificates.",
+	Long: `Revoke a single certificate by ID or thumbprint, every certificate listed in a CSV file, or every certificate
+matching a Keyfactor Command query. The CSV file must have a CertificateId or Thumbprint column and may have Reason
+and Comment columns that override --reason and --comment per row. Reasons may be given as codes or as one of
+unspecified, key-compromise, ca-compromise, affiliation-changed, superseded, cessation-of-operation,
+certificate-hold or remove-from-hold. A summary is shown for confirmation before anything is revoked, and the
+outcome of each certificate is written to a results CSV. Use --remove-from-stores to also schedule the removal of
+revoked certificates from every certificate store location they are deployed to.`,
+	Example: `kfutil certificates revoke --id 1234 --reason key-compromise --comment "Key leaked"
+kfutil certificates revoke --file revoke.csv --effective-date 2024-07-01 --dry-run
+kfutil certificates revoke --query 'IssuerDN -contains "Old CA"' --reason cessation-of-operation --remove-from-stores --wait`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := false
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		certId, _ := cmd.Flags().GetInt("id")
+		thumbprint, _ := cmd.Flags().GetString("thumbprint")
+		csvFile, _ := cmd.Flags().GetString("file")
+		query, _ := cmd.Flags().GetString("query")
+		reasonFlag, _ := cmd.Flags().GetString("reason")
+		comment, _ := cmd.Flags().GetString("comment")
+		effectiveDateFlag, _ := cmd.Flags().GetString("effective-date")
+		removeFromStores, _ := cmd.Flags().GetBool("remove-from-stores")
+		resultsFile, _ := cmd.Flags().GetString("results")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		reason, rErr := parseRevocationReason(reasonFlag)
+		if rErr != nil {
+			return rErr
+		}
+		effectiveDate, dErr := parseEffectiveDate(effectiveDateFlag)
+		if dErr != nil {
+			return dErr
+		}
+		if resultsFile == "" {
+			resultsFile = fmt.Sprintf("revoke-results-%s.csv", getCurrentTime("unix"))
+		}
+
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			return cErr
+		}
+		sdkClient, sErr := initGenClient(false)
+		if sErr != nil {
+			return sErr
+		}
+
+		var targets []*revocationTarget
+		switch {
+		case csvFile != "":
+			var lErr error
+			targets, lErr = loadRevocationCSV(csvFile, reason, comment)
+			if lErr != nil {
+				return lErr
+			}
+		case query != "":
+			certs, qErr := queryCertificates(sdkClient, certificateQuery{Query: query})
+			if qErr != nil {
+				return fmt.Errorf("unable to query certificates: %s", qErr)
+			}
+			for _, c := range certs {
+				targets = append(
+					targets, &revocationTarget{
+						CertificateId: int(c.GetId()),
+						Thumbprint:    c.GetThumbprint(),
+						Subject:       nullableString(c.IssuedDN),
+						Reason:        reason,
+						Comment:       comment,
+					},
+				)
+			}
+		default:
+			targets = []*revocationTarget{{CertificateId: certId, Thumbprint: thumbprint, Reason: reason, Comment: comment}}
+		}
+		if len(targets) == 0 {
+			fmt.Println("No certificates matched, nothing to revoke.")
+			return nil
+		}
+
+		targets = resolveRevocationTargets(kfClient, targets, removeFromStores)
+		printRevocationSummary(targets, effectiveDate, removeFromStores)
+		pending := pendingRevocationTargets(targets)
+
+		if dryRun {
+			for _, t := range pending {
+				t.Status = revocationDryRun
+			}
+			fmt.Printf("Dry run: %d certificate(s) would be revoked.\n", len(pending))
+			return writeRevocationResults(resultsFile, targets)
+		}
+		if len(pending) == 0 {
+			fmt.Println("Nothing to revoke.")
+			return writeRevocationResults(resultsFile, targets)
+		}
+		if !force {
+			if noPrompt {
+				return fmt.Errorf("use --force to revoke certificates without confirmation")
+			}
+			if !promptForInteractiveYesNo(fmt.Sprintf("Revoke %d certificate(s)?", len(pending))) {
+				fmt.Println("Aborting")
+				return nil
+			}
+		}
+
+		revokeCertificates(sdkClient, pending, effectiveDate)
+
+		var tracker *jobTracker
+		scheduleErrs := 0
+		if removeFromStores {
+			var tErr error
+			tracker, tErr = newInventoryJobTracker(wait)
+			if tErr != nil {
+				return tErr
+			}
+			scheduleErrs = removeRevokedFromStores(kfClient, tracker, pending)
+		}
+
+		if wErr := writeRevocationResults(resultsFile, targets); wErr != nil {
+			return wErr
+		}
+		counts := make(map[string]int)
+		for _, t := range targets {
+			counts[t.Status]++
+		}
+		fmt.Printf(
+			"Revoked %d, pending approval %d, failed %d, skipped %d. Results written to %s\n",
+			counts[revocationRevoked],
+			counts[revocationPending],
+			counts[revocationFailed],
+			counts[revocationSkipped],
+			resultsFile,
+		)
+
+		var jobErr error
+		if removeFromStores {
+			jobErr = finishInventoryJobs(tracker, timeout, scheduleErrs)
+		}
+		if counts[revocationFailed] > 0 {
+			return fmt.Errorf("%d certificate(s) could not be revoked", counts[revocationFailed])
+		}
+		return jobErr
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certificatesRevokeCmd)
+	certificatesRevokeCmd.Flags().Int("id", 0, "Keyfactor Command ID of the certificate to revoke.")
+	certificatesRevokeCmd.Flags().String("thumbprint", "", "Thumbprint of the certificate to revoke.")
+	certificatesRevokeCmd.Flags().String("file", "", "CSV file of certificates to revoke.")
+	certificatesRevokeCmd.Flags().StringP("query", "q", "", "Revoke every certificate matching this Keyfactor Command query.")
+	certificatesRevokeCmd.MarkFlagsMutuallyExclusive("id", "thumbprint", "file", "query")
+	certificatesRevokeCmd.MarkFlagsOneRequired("id", "thumbprint", "file", "query")
+	certificatesRevokeCmd.Flags().String("reason", "unspecified", "Revocation reason name or code.")
+	certificatesRevokeCmd.Flags().String("comment", defaultRevocationComment, "Revocation comment.")
+	certificatesRevokeCmd.Flags().String(
+		"effective-date",
+		"",
+		"Date the revocation takes effect, as YYYY-MM-DD or RFC3339. Defaults to now.",
+	)
+	certificatesRevokeCmd.Flags().Bool(
+		"remove-from-stores",
+		false,
+		"Remove revoked certificates from every certificate store location they are deployed to.",
+	)
+	certificatesRevokeCmd.Flags().String("results", "", "Results CSV file. Defaults to revoke-results-<timestamp>.csv.")
+	certificatesRevokeCmd.Flags().Bool("dry-run", false, "Show what would be revoked without revoking anything.")
+	certificatesRevokeCmd.Flags().Bool("force", false, "Revoke without asking for confirmation.")
+	addJobWaitFlags(certificatesRevokeCmd)
+}
+
+// parseRevocationReason accepts a reason code or name.
+func parseRevocationReason(reason string) (int32, error) {
+	r := strings.ToLower(strings.TrimSpace(reason))
+	if r == "" {
+		return 0, nil
+	}
+	if code, err := strconv.Atoi(r); err == nil {
+		for _, c := range revocationReasons {
+			if int(c) == code {
+				return c, nil
+			}
+		}
+		return 0, fmt.Errorf("invalid revocation reason code %d", code)
+	}
+	r = strings.NewReplacer(" ", "-", "_", "-").Replace(r)
+	if code, ok := revocationReasons[r]; ok {
+		return code, nil
+	}
+	var names []string
+	for name := range revocationReasons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("invalid revocation reason %q, must be a code or one of %s", reason, strings.Join(names, ", "))
+}
+
+func revocationReasonName(code int32) string {
+	for name, c := range revocationReasons {
+		if c == code {
+			return name
+		}
+	}
+	return strconv.Itoa(int(code))
+}
+
+// parseEffectiveDate parses a date or RFC3339 timestamp, returning the current time when empty.
+func parseEffectiveDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now().UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid effective date %q, use YYYY-MM-DD or RFC3339", value)
+	}
+	return t.UTC(), nil
+}
+
+// loadRevocationCSV reads the certificates to revoke from a CSV file. Column names are matched case-insensitively.
+func loadRevocationCSV(path string, defaultReason int32, defaultComment string) ([]*revocationTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", path, err)
+	}
+	records, cErr := csv.NewReader(strings.NewReader(stripAllBOMs(string(data)))).ReadAll()
+	if cErr != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, cErr)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "certificateid", "certid", "id":
+			columns["id"] = i
+		case "thumbprint":
+			columns["thumbprint"] = i
+		case "reason":
+			columns["reason"] = i
+		case "comment":
+			columns["comment"] = i
+		}
+	}
+	_, hasId := columns["id"]
+	_, hasThumbprint := columns["thumbprint"]
+	if !hasId && !hasThumbprint {
+		return nil, fmt.Errorf("%s must have a CertificateId or Thumbprint column", path)
+	}
+	get := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var targets []*revocationTarget
+	var problems []string
+	for n, record := range records[1:] {
+		line := n + 2
+		target := &revocationTarget{
+			Thumbprint: get(record, "thumbprint"),
+			Reason:     defaultReason,
+			Comment:    defaultComment,
+		}
+		if id := get(record, "id"); id != "" {
+			v, aErr := strconv.Atoi(id)
+			if aErr != nil {
+				problems = append(problems, fmt.Sprintf("line %d: invalid certificate ID %q", line, id))
+				continue
+			}
+			target.CertificateId = v
+		}
+		if target.CertificateId == 0 && target.Thumbprint == "" {
+			problems = append(problems, fmt.Sprintf("line %d: no certificate ID or thumbprint", line))
+			continue
+		}
+		if r := get(record, "reason"); r != "" {
+			code, pErr := parseRevocationReason(r)
+			if pErr != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %s", line, pErr))
+				continue
+			}
+			target.Reason = code
+		}
+		if c := get(record, "comment"); c != "" {
+			target.Comment = c
+		}
+		targets = append(targets, target)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s has %d invalid row(s):\n  %s", path, len(problems), strings.Join(problems, "\n  "))
+	}
+	return targets, nil
+}
+
+// resolveRevocationTargets looks up each target's ID, subject, state and, when needed, store locations. Targets that
+// cannot be found are marked failed, already revoked certificates are skipped and duplicates are dropped.
+func resolveRevocationTargets(
+	kfClient *api.Client,
+	targets []*revocationTarget,
+	withLocations bool,
+) []*revocationTarget {
+	seen := make(map[int]bool)
+	var resolved []*revocationTarget
+	for _, t := range targets {
+		if t.Subject == "" || withLocations {
+			cert, err := getCertificateContext(kfClient, t.CertificateId, t.Thumbprint)
+			if err != nil || cert == nil || cert.Id == 0 {
+				t.Status = revocationFailed
+				t.Message = "certificate not found"
+				if err != nil {
+					t.Message = fmt.Sprintf("certificate not found: %s", err)
+				}
+				resolved = append(resolved, t)
+				continue
+			}
+			t.CertificateId = cert.Id
+			t.Thumbprint = cert.Thumbprint
+			t.Subject = cert.IssuedDN
+			t.Locations = cert.Locations
+			if cert.CertState == certStateRevoked {
+				t.Status = revocationSkipped
+				t.Message = "already revoked"
+			}
+		}
+		if seen[t.CertificateId] {
+			continue
+		}
+		seen[t.CertificateId] = true
+		resolved = append(resolved, t)
+	}
+	return resolved
+}
+
+// pendingRevocationTargets returns the targets that have not been resolved to a final status.
+func pendingRevocationTargets(targets []*revocationTarget) []*revocationTarget {
+	var pending []*revocationTarget
+	for _, t := range targets {
+		if t.Status == "" {
+			pending = append(pending, t)
+		}
+	}
+	return pending
+}
+
+func printRevocationSummary(targets []*revocationTarget, effectiveDate time.Time, removeFromStores bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTHUMBPRINT\tSUBJECT\tREASON\tCOMMENT\tLOCATIONS\tNOTE")
+	byReason := make(map[int32]int)
+	count := 0
+	for _, t := range targets {
+		if t.Status == "" {
+			byReason[t.Reason]++
+			count++
+		}
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			t.CertificateId,
+			t.Thumbprint,
+			t.Subject,
+			revocationReasonName(t.Reason),
+			t.Comment,
+			len(t.Locations),
+			t.Message,
+		)
+	}
+	w.Flush()
+
+	var reasons []string
+	for code, n := range byReason {
+		reasons = append(reasons, fmt.Sprintf("%d %s", n, revocationReasonName(code)))
+	}
+	sort.Strings(reasons)
+	fmt.Printf(
+		"\n%d certificate(s) to revoke effective %s (%s).\n",
+		count,
+		effectiveDate.Format(time.RFC3339),
+		strings.Join(reasons, ", "),
+	)
+	if removeFromStores {
+		fmt.Println("Revoked certificates will be removed from every certificate store location listed.")
+	}
+}
+
+// groupRevocationTargets groups targets by reason and comment, as each revocation request takes a single reason and
+// comment. Groups are returned in the order they first appear.
+func groupRevocationTargets(targets []*revocationTarget) [][]*revocationTarget {
+	index := make(map[string]int)
+	var groups [][]*revocationTarget
+	for _, t := range targets {
+		key := fmt.Sprintf("%d\x00%s", t.Reason, t.Comment)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], t)
+	}
+	return groups
+}
+
+// revokeCertificates revokes the targets, recording the outcome of each on the target.
+func revokeCertificates(sdkClient *keyfactor.APIClient, targets []*revocationTarget, effectiveDate time.Time) {
+	for _, group := range groupRevocationTargets(targets) {
+		var ids []int32
+		for _, t := range group {
+			ids = append(ids, int32(t.CertificateId))
+		}
+		reason := group[0].Reason
+		comment := group[0].Comment
+		log.Debug().Ints32("ids", ids).Int32("reason", reason).
+			Msg(fmt.Sprintf("%s CertificateRevoke", DebugFuncCall))
+		resp, httpResp, err := sdkClient.CertificateApi.CertificateRevoke(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Request(
+				keyfactor.ModelsRevokeCertificateRequest{
+					CertificateIds: ids,
+					Reason:         &reason,
+					Comment:        &comment,
+					EffectiveDate:  &effectiveDate,
+				},
+			).
+			Execute()
+		if err != nil {
+			err = returnHttpErr(httpResp, err)
+		}
+		applyRevocationResponse(group, resp, err)
+	}
+}
+
+// applyRevocationResponse records the outcome of a revocation request on each target in the request.
+func applyRevocationResponse(
+	targets []*revocationTarget,
+	resp *keyfactor.ModelsRevocationRevocationResponse,
+	err error,
+) {
+	revoked := make(map[int]bool)
+	suspended := make(map[int]string)
+	if resp != nil {
+		for _, id := range resp.RevokedIds {
+			revoked[int(id)] = true
+		}
+		for _, s := range resp.SuspendedCerts {
+			suspended[int(s.GetCertId())] = s.GetMessage()
+		}
+	}
+	for _, t := range targets {
+		message, isSuspended := suspended[t.CertificateId]
+		switch {
+		case err != nil:
+			t.Status = revocationFailed
+			t.Message = err.Error()
+		case revoked[t.CertificateId]:
+			t.Status = revocationRevoked
+		case isSuspended:
+			t.Status = revocationPending
+			t.Message = message
+		default:
+			t.Status = revocationFailed
+			t.Message = "not revoked by Keyfactor Command"
+		}
+	}
+}
+
+// removeRevokedFromStores schedules the removal of each revoked certificate from its store locations and returns the
+// number of jobs that could not be scheduled.
+func removeRevokedFromStores(kfClient *api.Client, tracker *jobTracker, targets []*revocationTarget) int {
+	scheduleErrs := 0
+	for _, t := range targets {
+		if t.Status != revocationRevoked {
+			continue
+		}
+		for _, loc := range t.Locations {
+			store := api.GetCertificateStoreResponse{
+				Id:            loc.CertStoreId,
+				ClientMachine: loc.StoreMachine,
+				StorePath:     loc.StorePath,
+			}
+			if _, err := scheduleCertificateRemove(kfClient, tracker, store, t.CertificateId, t.Thumbprint, loc.Alias); err != nil {
+				fmt.Printf(
+					"Error removing certificate %d from %s:%s: %s\n",
+					t.CertificateId,
+					loc.StoreMachine,
+					loc.StorePath,
+					err,
+				)
+				log.Error().Err(err).Str("storeId", loc.CertStoreId).Msg("unable to schedule certificate removal")
+				scheduleErrs++
+				continue
+			}
+			t.RemovalJobs++
+		}
+	}
+	return scheduleErrs
+}
+
+func writeRevocationResults(path string, targets []*revocationTarget) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to write results to %s: %s", path, err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(revocationResultsHeader)
+	for _, t := range targets {
+		w.Write(
+			[]string{
+				strconv.Itoa(t.CertificateId),
+				t.Thumbprint,
+				t.Subject,
+				revocationReasonName(t.Reason),
+				t.Comment,
+				t.Status,
+				t.Message,
+				strconv.Itoa(t.RemovalJobs),
+			},
+		)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseRevocationReason(t *testing.T) {
+	cases := map[string]int32{
+		"":                       0,
+		"1":                      1,
+		"Key Compromise":         1,
+		"cessation_of_operation": 5,
+		"999":                    999,
+	}
+	for input, expected := range cases {
+		code, err := parseRevocationReason(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, code, input)
+	}
+	_, err := parseRevocationReason("7")
+	assert.Error(t, err)
+	_, err = parseRevocationReason("lost")
+	assert.Error(t, err)
+}
+
+func Test_LoadRevocationCSV(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.csv")
+	assert.NoError(
+		t, os.WriteFile(
+			valid,
+			[]byte("\ufeffCertificateId,Thumbprint,Reason,Comment\n12,,key-compromise,Key leaked\n,AAAA,,\n"),
+			0600,
+		),
+	)
+	targets, err := loadRevocationCSV(valid, 4, "default")
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+	assert.Equal(t, 12, targets[0].CertificateId)
+	assert.Equal(t, int32(1), targets[0].Reason)
+	assert.Equal(t, "Key leaked", targets[0].Comment)
+	assert.Equal(t, "AAAA", targets[1].Thumbprint)
+	assert.Equal(t, int32(4), targets[1].Reason)
+	assert.Equal(t, "default", targets[1].Comment)
+
+	invalid := filepath.Join(dir, "invalid.csv")
+	assert.NoError(t, os.WriteFile(invalid, []byte("id,reason\nabc,\n,\n5,lost\n"), 0600))
+	_, err = loadRevocationCSV(invalid, 0, "")
+	assert.ErrorContains(t, err, "3 invalid row(s)")
+
+	noKey := filepath.Join(dir, "nokey.csv")
+	assert.NoError(t, os.WriteFile(noKey, []byte("Subject\nCN=test\n"), 0600))
+	_, err = loadRevocationCSV(noKey, 0, "")
+	assert.Error(t, err)
+}
+
+func Test_GroupRevocationTargets(t *testing.T) {
+	targets := []*revocationTarget{
+		{CertificateId: 1, Reason: 1, Comment: "a"},
+		{CertificateId: 2, Reason: 0, Comment: "a"},
+		{CertificateId: 3, Reason: 1, Comment: "a"},
+		{CertificateId: 4, Reason: 1, Comment: "b"},
+	}
+	groups := groupRevocationTargets(targets)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, []*revocationTarget{targets[0], targets[2]}, groups[0])
+	assert.Equal(t, []*revocationTarget{targets[1]}, groups[1])
+	assert.Equal(t, []*revocationTarget{targets[3]}, groups[2])
+}
+
+func Test_ApplyRevocationResponse(t *testing.T) {
+	targets := []*revocationTarget{{CertificateId: 1}, {CertificateId: 2}, {CertificateId: 3}}
+	certId := int32(2)
+	message := "Awaiting approval"
+	applyRevocationResponse(
+		targets, &keyfactor.ModelsRevocationRevocationResponse{
+			RevokedIds:     []int32{1},
+			SuspendedCerts: []keyfactor.ModelsRevocationSuspendedRevocationResponse{{CertId: &certId, Message: &message}},
+		}, nil,
+	)
+	assert.Equal(t, revocationRevoked, targets[0].Status)
+	assert.Equal(t, revocationPending, targets[1].Status)
+	assert.Equal(t, message, targets[1].Message)
+	assert.Equal(t, revocationFailed, targets[2].Status)
+
+	applyRevocationResponse(targets, nil, errors.New("forbidden"))
+	for _, target := range targets {
+		assert.Equal(t, revocationFailed, target.Status)
+		assert.Equal(t, "forbidden", target.Message)
+	}
+}
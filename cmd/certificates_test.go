@@ -0,0 +1,101 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCertificate() keyfactor.ModelsCertificateRetrievalResponse {
+	cert := keyfactor.ModelsCertificateRetrievalResponse{}
+	cert.SetId(42)
+	cert.SetThumbprint("ABCDEF")
+	cert.SetIssuedCN("www.example.com")
+	cert.SubjectAltNameElements = []keyfactor.ModelsCertificateRetrievalResponseSubjectAlternativeNameModel{
+		{Value: stringToPointer("www.example.com")},
+		{Value: stringToPointer("example.com")},
+	}
+	return cert
+}
+
+func Test_CertificateSelectorQuery(t *testing.T) {
+	q, err := certificateSelector{Id: 7}.query()
+	assert.NoError(t, err)
+	assert.Equal(t, "CertId -eq 7", q)
+
+	q, err = certificateSelector{Thumbprint: "ab:cd"}.query()
+	assert.NoError(t, err)
+	assert.Equal(t, `Thumbprint -eq "ABCD"`, q)
+
+	q, err = certificateSelector{Serial: "01ff"}.query()
+	assert.NoError(t, err)
+	assert.Equal(t, `SerialNumber -eq "01FF"`, q)
+
+	_, err = certificateSelector{}.query()
+	assert.Error(t, err)
+}
+
+func Test_FormatCertificates(t *testing.T) {
+	certs := []keyfactor.ModelsCertificateRetrievalResponse{testCertificate()}
+	fields := []string{"id", "Thumbprint", "SubjectAltNameElements"}
+
+	out, err := formatCertificates(certs, fields, nil, "json", false)
+	assert.NoError(t, err)
+	var rows []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(out), &rows))
+	assert.Len(t, rows, 1)
+	assert.Equal(t, float64(42), rows[0]["Id"])
+	assert.NotContains(t, rows[0], "IssuedCN")
+
+	out, err = formatCertificates(certs, fields, nil, "csv", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Id,Thumbprint,SubjectAltNameElements\n42,ABCDEF,www.example.com;example.com", out)
+
+	out, err = formatCertificates(certs, fields, nil, "text", true)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "Id:"))
+
+	out, err = formatCertificates(certs, []string{"Id"}, nil, "yaml", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Id: 42", out)
+
+	out, err = formatCertificates(nil, []string{"Id"}, nil, "json", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", out)
+
+	// defaults only apply to text and csv, json has every field
+	out, err = formatCertificates(certs, nil, []string{"Id"}, "csv", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Id\n42", out)
+	out, err = formatCertificates(certs, nil, []string{"Id"}, "json", false)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(out), &rows))
+	assert.Contains(t, rows[0], "IssuedCN")
+
+	_, err = formatCertificates(certs, []string{"Id", "Bogus"}, nil, "csv", false)
+	assert.ErrorContains(t, err, `unknown certificate field "Bogus", valid fields are `)
+
+	large := testCertificate()
+	large.SetId(1234567)
+	out, err = formatCertificates([]keyfactor.ModelsCertificateRetrievalResponse{large}, []string{"Id"}, nil, "csv", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Id\n1234567", out)
+	assert.Equal(t, "12345678901;0.5", certificateFieldString("Ids", []interface{}{float64(12345678901), 0.5}))
+}
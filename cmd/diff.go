@@ -0,0 +1,327 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// Drift statuses of an object.
+const (
+	driftOnlyLeft  = "only_in_left"
+	driftOnlyRight = "only_in_right"
+	driftChanged   = "changed"
+)
+
+const (
+	driftLiveSource    = "live"
+	driftProfilePrefix = "profile:"
+)
+
+// driftIgnoredFields hold IDs that refer to other objects of the same instance, so they differ between instances
+// even when the configuration is the same. Alerts refer to their collections and templates by name instead.
+var driftIgnoredFields = map[string]bool{
+	"NetworkId":   true,
+	"AgentPoolId": true,
+}
+
+// driftEntity holds the exported objects of one kind keyed by natural key.
+type driftEntity struct {
+	Kind    string
+	Label   string
+	Objects map[string]interface{}
+}
+
+type driftFieldDiff struct {
+	Field string      `json:"field"`
+	Left  interface{} `json:"left"`
+	Right interface{} `json:"right"`
+}
+
+type driftItem struct {
+	Kind   string           `json:"kind"`
+	Name   string           `json:"name"`
+	Status string           `json:"status"`
+	Diffs  []driftFieldDiff `json:"diffs,omitempty"`
+
+	label string
+}
+
+type driftSummary struct {
+	OnlyLeft  int `json:"only_in_left"`
+	OnlyRight int `json:"only_in_right"`
+	Changed   int `json:"changed"`
+	Identical int `json:"identical"`
+}
+
+type driftReport struct {
+	Left    string       `json:"left"`
+	Right   string       `json:"right"`
+	Drift   []driftItem  `json:"drift"`
+	Summary driftSummary `json:"summary"`
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <left> <right>",
+	Short: "Compare the configuration of Keyfactor instances and exports.",
+	Long: `Compare two exports, an export and a live instance, or two live instances, and report configuration drift.
+Each side is the path of a file or directory written by 'kfutil export', 'live' for the instance of the current
+credentials, or 'profile:<name>' for the instance of a profile in the config file, which can't be combined with
+--auth-provider-type. Collections, metadata fields, all alert kinds, SSL networks, workflow definitions, built-in and
+custom reports, security roles, store types, containers, PAM providers, certificate stores, certificate authorities and
+template settings are compared. Objects are matched by name or display name, stores by client machine, store path and
+store type, CAs by host and logical name, and IDs that only make sense on their own instance are ignored. Use
+--exit-code to fail when the two sides differ.
+
+Secrets of exports written with 'kfutil export --encrypt-secrets' are decrypted before they are compared, like
+'kfutil import' does, with the age identities of --identity or the passphrase of the KFUTIL_EXPORT_PASSPHRASE
+environment variable, which is asked for when it isn't set.`,
+	Example: `kfutil diff staging.json prod.json
+kfutil diff export.json live
+kfutil diff ./kf-config-staging ./kf-config-prod --identity key.txt
+kfutil diff ./kf-config profile:prod
+kfutil diff profile:staging profile:prod --format json --exit-code`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := true
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		exitCode, _ := cmd.Flags().GetBool("exit-code")
+		identityFiles, _ := cmd.Flags().GetStringArray("identity")
+		identities, iErr := readAgeIdentities(identityFiles)
+		if iErr != nil {
+			return iErr
+		}
+		// every encrypted value has its own nonce, so secrets are only comparable once decrypted
+		keys := &exportSecretKeys{Identities: identities, Passphrase: exportPassphrase}
+
+		left, lErr := loadDriftSource(args[0], keys)
+		if lErr != nil {
+			return fmt.Errorf("unable to load %s: %s", args[0], lErr)
+		}
+		right, rErr := loadDriftSource(args[1], keys)
+		if rErr != nil {
+			return fmt.Errorf("unable to load %s: %s", args[1], rErr)
+		}
+
+		report := driftReport{Left: args[0], Right: args[1]}
+		report.Drift, report.Summary = compareExports(left, right)
+
+		if outputFormat == "json" {
+			out, jErr := json.MarshalIndent(report, "", "  ")
+			if jErr != nil {
+				return jErr
+			}
+			outputResult(string(out), outputFormat)
+		} else {
+			printDriftReport(os.Stdout, report)
+		}
+
+		if exitCode && len(report.Drift) > 0 {
+			return fmt.Errorf("%s and %s differ", args[0], args[1])
+		}
+		return nil
+	},
+}
+
+// loadDriftSource reads an export file or directory, decrypting its secrets with keys, or exports every entity from a
+// live instance.
+func loadDriftSource(source string, keys *exportSecretKeys) (outJson, error) {
+	var out outJson
+	if source != driftLiveSource && !strings.HasPrefix(source, driftProfilePrefix) {
+		return readExport(source, keys)
+	}
+
+	if name := strings.TrimPrefix(source, driftProfilePrefix); name != source {
+		if providerType != "" {
+			// the provider type flag would replace the auth settings of the profile
+			return out, fmt.Errorf("%s can't be used with --auth-provider-type", source)
+		}
+		// the clients are built from the global profile flag
+		defaultProfile := profile
+		profile = name
+		defer func() { profile = defaultProfile }()
+	}
+	log.Debug().Str("source", source).Msg("exporting live instance")
+	kfClient, clientErr := initGenClient(false)
+	if clientErr != nil {
+		return out, clientErr
+	}
+	oldkfClient, oldClientErr := initClient(false)
+	if oldClientErr != nil {
+		return out, oldClientErr
+	}
+	if eErr := exportEntities(&out, func(string) bool { return true }, kfClient, oldkfClient); eErr != nil {
+		return out, eErr
+	}
+	return out, nil
+}
+
+func newDriftEntity(kind string, label string) *driftEntity {
+	return &driftEntity{Kind: kind, Label: label, Objects: make(map[string]interface{})}
+}
+
+// add keys an object by name. Names should be unique, but every object is kept when they are not.
+func (e *driftEntity) add(name string, obj interface{}) {
+	key := name
+	for n := 2; e.Objects[key] != nil; n++ {
+		key = fmt.Sprintf("%s #%d", name, n)
+	}
+	e.Objects[key] = obj
+}
+
+// driftEntities returns the objects of an export by kind, keyed by name or display name.
+func driftEntities(out outJson) []driftEntity {
+	var entities []driftEntity
+	for _, kind := range exportKinds {
+		entity := newDriftEntity(kind.Kind, kind.Label)
+		for _, o := range kind.objects(out) {
+			entity.add(o.Key, o.Object)
+		}
+		entities = append(entities, *entity)
+	}
+	return entities
+}
+
+// compareExports matches the objects of two exports by kind and natural key and returns the objects that differ.
+func compareExports(left outJson, right outJson) ([]driftItem, driftSummary) {
+	var drift []driftItem
+	var summary driftSummary
+	rightEntities := driftEntities(right)
+	for i, entity := range driftEntities(left) {
+		other := rightEntities[i].Objects
+		names := make(map[string]bool)
+		for name := range entity.Objects {
+			names[name] = true
+		}
+		for name := range other {
+			names[name] = true
+		}
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+
+		for _, name := range sorted {
+			item := driftItem{Kind: entity.Kind, Name: name, label: entity.Label}
+			l, inLeft := entity.Objects[name]
+			r, inRight := other[name]
+			switch {
+			case !inRight:
+				item.Status = driftOnlyLeft
+				summary.OnlyLeft++
+			case !inLeft:
+				item.Status = driftOnlyRight
+				summary.OnlyRight++
+			default:
+				item.Diffs = diffDriftObjects(l, r)
+				if len(item.Diffs) == 0 {
+					summary.Identical++
+					continue
+				}
+				item.Status = driftChanged
+				summary.Changed++
+			}
+			drift = append(drift, item)
+		}
+	}
+	return drift, summary
+}
+
+// diffDriftObjects lists the fields whose values differ between two objects of the same kind.
+func diffDriftObjects(left interface{}, right interface{}) []driftFieldDiff {
+	l, r := importStateOf(left), importStateOf(right)
+	fields := make(map[string]bool)
+	for field := range l {
+		fields[field] = true
+	}
+	for field := range r {
+		fields[field] = true
+	}
+	sorted := make([]string, 0, len(fields))
+	for field := range fields {
+		if !importIgnoredFields[field] && !driftIgnoredFields[field] {
+			sorted = append(sorted, field)
+		}
+	}
+	sort.Strings(sorted)
+
+	var diffs []driftFieldDiff
+	for _, field := range sorted {
+		if !importFieldValuesMatch(field, l[field], r[field]) || !importFieldValuesMatch(field, r[field], l[field]) {
+			diffs = append(diffs, driftFieldDiff{Field: field, Left: l[field], Right: r[field]})
+		}
+	}
+	return diffs
+}
+
+func printDriftReport(w io.Writer, report driftReport) {
+	fmt.Fprintf(w, "Comparing %s with %s\n\n", report.Left, report.Right)
+	for _, item := range report.Drift {
+		switch item.Status {
+		case driftOnlyLeft:
+			fmt.Fprintf(w, "- %s %q (only in %s)\n", item.label, item.Name, report.Left)
+		case driftOnlyRight:
+			fmt.Fprintf(w, "+ %s %q (only in %s)\n", item.label, item.Name, report.Right)
+		default:
+			fmt.Fprintf(w, "~ %s %q\n", item.label, item.Name)
+			for _, d := range item.Diffs {
+				l, _ := json.Marshal(d.Left)
+				r, _ := json.Marshal(d.Right)
+				fmt.Fprintf(w, "    %s:\n      %s: %s\n      %s: %s\n", d.Field, report.Left, l, report.Right, r)
+			}
+		}
+	}
+	s := report.Summary
+	if len(report.Drift) == 0 {
+		fmt.Fprintf(w, "No differences, %d identical objects\n", s.Identical)
+		return
+	}
+	fmt.Fprintf(
+		w,
+		"\n%d differences: %d only in %s, %d only in %s, %d changed, %d identical objects\n",
+		len(report.Drift),
+		s.OnlyLeft,
+		report.Left,
+		s.OnlyRight,
+		report.Right,
+		s.Changed,
+		s.Identical,
+	)
+}
+
+func init() {
+	RootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().Bool("exit-code", false, "exit with an error when the two sides differ")
+	diffCmd.Flags().StringArray(
+		"identity",
+		nil,
+		"age identity file to decrypt the secrets of an encrypted export with, may be repeated",
+	)
+}
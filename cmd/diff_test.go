@@ -0,0 +1,132 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CompareExports(t *testing.T) {
+	query := "CN -contains \"example\""
+	other := "CN -contains \"test\""
+	left := outJson{
+		Collections: []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest{
+			{Name: "Web", Query: &query},
+			{Name: "Legacy", Query: &query},
+		},
+		ExpirationAlerts: []exportExpirationAlert{{DisplayName: "30 days", ExpirationWarningDays: 30, CollectionName: "Web"}},
+		CustomReports:    []keyfactor.ModelsCustomReportCreationRequest{{DisplayName: "Weekly", CustomURL: "https://a"}},
+	}
+	right := outJson{
+		Collections: []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest{
+			{Name: "Web", Query: &other},
+		},
+		ExpirationAlerts: []exportExpirationAlert{{DisplayName: "30 days", ExpirationWarningDays: 30, CollectionName: "Web"}},
+		CustomReports: []keyfactor.ModelsCustomReportCreationRequest{
+			{DisplayName: "Weekly", CustomURL: "https://a"},
+			{DisplayName: "Daily", CustomURL: "https://b"},
+		},
+	}
+
+	drift, summary := compareExports(left, right)
+	assert.Equal(t, driftSummary{OnlyLeft: 1, OnlyRight: 1, Changed: 1, Identical: 2}, summary)
+	assert.Len(t, drift, 3)
+	assert.Equal(t, "Legacy", drift[0].Name)
+	assert.Equal(t, driftOnlyLeft, drift[0].Status)
+	assert.Equal(t, "Web", drift[1].Name)
+	assert.Equal(t, []driftFieldDiff{{Field: "Query", Left: query, Right: other}}, drift[1].Diffs)
+	assert.Equal(t, "custom_report", drift[2].Kind)
+	assert.Equal(t, driftOnlyRight, drift[2].Status)
+
+	_, summary = compareExports(left, left)
+	assert.Equal(t, driftSummary{Identical: 4}, summary)
+
+	var out bytes.Buffer
+	printDriftReport(&out, driftReport{Left: "staging.json", Right: "prod.json", Drift: drift, Summary: summary})
+	assert.Contains(t, out.String(), `- collection "Legacy" (only in staging.json)`)
+	assert.Contains(t, out.String(), `+ custom report "Daily" (only in prod.json)`)
+	assert.Contains(t, out.String(), `~ collection "Web"`)
+}
+
+func Test_LoadDriftSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.json")
+	data, err := json.Marshal(
+		outJson{MetadataFields: []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest{{Name: "Owner"}}},
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+
+	out, err := loadDriftSource(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Owner", out.MetadataFields[0].Name)
+
+	_, err = loadDriftSource(filepath.Join(t.TempDir(), "missing.json"), nil)
+	assert.Error(t, err)
+
+	defaultProviderType := providerType
+	providerType = "azid"
+	defer func() { providerType = defaultProviderType }()
+	_, err = loadDriftSource("profile:prod", nil)
+	assert.EqualError(t, err, "profile:prod can't be used with --auth-provider-type")
+}
+
+func Test_CompareEncryptedExports(t *testing.T) {
+	logN := exportScryptLogN
+	exportScryptLogN = 10
+	defer func() { exportScryptLogN = logN }()
+
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"staging.json", "prod.json"} {
+		out := outJson{
+			SchemaVersion: exportSchemaVersion,
+			ExpirationAlerts: []exportExpirationAlert{
+				{DisplayName: "Soon", Recipients: []string{"ops@example.com", "pki@example.com"}},
+			},
+		}
+		enc, err := newExportEncryption(nil, "correct horse")
+		assert.NoError(t, err)
+		assert.NoError(t, encryptSecrets(&out, enc))
+		data, err := json.Marshal(out)
+		assert.NoError(t, err)
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, data, 0600))
+		paths = append(paths, path)
+	}
+
+	// the same secrets are encrypted to different values
+	left, err := loadDriftSource(paths[0], nil)
+	assert.NoError(t, err)
+	right, err := loadDriftSource(paths[1], nil)
+	assert.NoError(t, err)
+	drift, _ := compareExports(left, right)
+	assert.Len(t, drift, 1)
+
+	keys := &exportSecretKeys{Passphrase: func() (string, error) { return "correct horse", nil }}
+	left, err = loadDriftSource(paths[0], keys)
+	assert.NoError(t, err)
+	right, err = loadDriftSource(paths[1], keys)
+	assert.NoError(t, err)
+	drift, summary := compareExports(left, right)
+	assert.Empty(t, drift)
+	assert.Equal(t, driftSummary{Identical: 1}, summary)
+}
@@ -17,8 +17,10 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 
 	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
@@ -28,6 +30,7 @@ import (
 )
 
 var exportPath string
+var exportDir string
 var fCollections bool
 var fMetadata bool
 var fExpirationAlerts bool
@@ -38,6 +41,12 @@ var fNetworks bool
 var fWorkflowDefinitions bool
 var fReports bool
 var fSecurityRoles bool
+var fStoreTypes bool
+var fContainers bool
+var fPamProviders bool
+var fStores bool
+var fTemplates bool
+var fCAs bool
 var fAll bool
 
 type exportModelsReport struct {
@@ -54,7 +63,7 @@ type exportModelsReport struct {
 	RemoveDuplicates        *bool                              `json:"RemoveDuplicates,omitempty"`
 	UsesCollection          *bool                              `json:"UsesCollection,omitempty"`
 	ReportParameter         []keyfactor.ModelsReportParameters `json:"ReportParameter,omitempty"`
-	Schedules               []keyfactor.ModelsReportSchedule   `json:"Schedules,omitempty"`
+	Schedules               []exportReportSchedule             `json:"Schedules,omitempty"`
 	AcceptedScheduleFormats []string                           `json:"AcceptedScheduleFormats,omitempty"`
 }
 
@@ -72,17 +81,25 @@ type exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest struct {
 }
 
 type outJson struct {
-	Collections         []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest `json:"Collections"`
-	MetadataFields      []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest                  `json:"MetadataFields"`
-	ExpirationAlerts    []keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertCreationRequest           `json:"ExpirationAlerts"`
-	IssuedCertAlerts    []keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest                   `json:"IssuedCertAlerts"`
-	DeniedCertAlerts    []keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertCreationRequest                   `json:"DeniedCertAlerts"`
-	PendingCertAlerts   []keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertCreationRequest                 `json:"PendingCertAlerts"`
-	Networks            []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest                                  `json:"Networks"`
-	WorkflowDefinitions []exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest                             `json:"WorkflowDefinitions"`
-	BuiltInReports      []exportModelsReport                                                                   `json:"BuiltInReports"`
-	CustomReports       []keyfactor.ModelsCustomReportCreationRequest                                          `json:"CustomReports"`
-	SecurityRoles       []api.CreateSecurityRoleArg                                                            `json:"SecurityRoles"`
+	SchemaVersion          int                                                                                    `json:"schemaVersion"`
+	Encryption             *exportEncryption                                                                      `json:"encryption,omitempty"`
+	Collections            []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest `json:"Collections"`
+	MetadataFields         []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest                  `json:"MetadataFields"`
+	ExpirationAlerts       []exportExpirationAlert                                                                `json:"ExpirationAlerts"`
+	IssuedCertAlerts       []exportTemplateAlert                                                                  `json:"IssuedCertAlerts"`
+	DeniedCertAlerts       []exportTemplateAlert                                                                  `json:"DeniedCertAlerts"`
+	PendingCertAlerts      []exportTemplateAlert                                                                  `json:"PendingCertAlerts"`
+	Networks               []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest                                  `json:"Networks"`
+	WorkflowDefinitions    []exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest                             `json:"WorkflowDefinitions"`
+	BuiltInReports         []exportModelsReport                                                                   `json:"BuiltInReports"`
+	CustomReports          []keyfactor.ModelsCustomReportCreationRequest                                          `json:"CustomReports"`
+	SecurityRoles          []exportSecurityRole                                                                   `json:"SecurityRoles"`
+	StoreTypes             []api.CertificateStoreType                                                             `json:"StoreTypes"`
+	Containers             []exportCertificateStoreContainer                                                      `json:"Containers"`
+	PamProviders           []exportPamProvider                                                                    `json:"PamProviders"`
+	Stores                 []exportCertificateStore                                                               `json:"Stores"`
+	Templates              []exportTemplate                                                                       `json:"Templates"`
+	CertificateAuthorities []exportCertificateAuthority                                                           `json:"CertificateAuthorities"`
 }
 
 func exportToJSON(out outJson, exportPath string) error {
@@ -109,7 +126,40 @@ func exportToJSON(out outJson, exportPath string) error {
 var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Keyfactor instance export utilities.",
-	Long:  `A collection of APIs and utilities for exporting Keyfactor instance data.`,
+	Long: `A collection of APIs and utilities for exporting Keyfactor instance data.
+
+Certificate stores refer to their store type, container, orchestrator and PAM providers by name, so they can be
+imported into another instance. The same goes for the orchestrators and PAM providers of certificate authorities and
+the metadata fields of certificate templates. Secret values of stores, PAM providers and certificate authorities are
+never exported, they are replaced by placeholders.
+
+Use --file to write a single JSON file, or --dir to write one file per object in a folder per entity, which is easier
+to keep in version control and review. Files are named after the name of their object and written in YAML, or in
+JSON with --format json. Every file starts with the schemaVersion of the export format, and objects deleted since an
+earlier export into the same directory are removed from it.
+
+Use --include and --exclude to export only some objects of the selected entities. Each takes [<kind>=]<pattern> and
+may be repeated, where the kind is an entity flag such as collections or a folder of a directory export such as
+custom-reports, and the filter applies to every kind when it is left out. Patterns match whole names and are globs,
+or regular expressions when enclosed in slashes, and a leading ! turns a filter around. Files of objects left out by
+the filters are kept in a directory export. An entity flag also takes an optional pattern of its own, --collections
+'PKI-*' is short for --collections --include 'collections=PKI-*', and the pattern of --reports applies to built-in
+and custom reports. Filters match names only, objects can't be selected by tag or other fields.
+
+Use --encrypt-secrets to encrypt the secret fields in place, so the rest of the export stays readable and diffable:
+alert recipients and event handler parameters, workflow step parameters, report schedule recipients and custom report
+URLs. The values are encrypted for the age recipients of --recipient, or with the passphrase of the
+KFUTIL_EXPORT_PASSPHRASE environment variable, which is asked for when it isn't set and no recipient is given. Keys
+made by age-keygen can be used. The placeholders of store, PAM provider and CA secrets stay as they are, use
+'import --prompt-secrets' to enter their values.`,
+	Example: `kfutil export --file export.json --all
+kfutil export --dir ./kf-config --format yaml --all
+kfutil export --dir ./kf-config --collections --metadata --templates
+kfutil export --dir ./kf-config --collections --reports --include 'collections=PKI-*' --exclude 'custom-reports=Legacy*'
+kfutil export --dir ./kf-config --collections 'PKI-*' --reports '!Legacy*'
+kfutil export --file export.json --all --include 'custom-reports=!/^(Legacy|Old) /'
+kfutil export --dir ./kf-config --all --encrypt-secrets --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p`,
+	Args: exportEntityArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Debug().Msgf("%s: exportCmd", DebugFuncEnter)
 		isExperimental := true
@@ -124,21 +174,62 @@ var exportCmd = &cobra.Command{
 
 		// initialize each entry as an empty list in the event it is not requested by the flags
 		out := outJson{
-			Collections:         []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest{},
-			MetadataFields:      []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest{},
-			ExpirationAlerts:    []keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertCreationRequest{},
-			IssuedCertAlerts:    []keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest{},
-			DeniedCertAlerts:    []keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertCreationRequest{},
-			PendingCertAlerts:   []keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertCreationRequest{},
-			Networks:            []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest{},
-			WorkflowDefinitions: []exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest{},
-			BuiltInReports:      []exportModelsReport{},
-			CustomReports:       []keyfactor.ModelsCustomReportCreationRequest{},
-			SecurityRoles:       []api.CreateSecurityRoleArg{},
+			SchemaVersion:          exportSchemaVersion,
+			Collections:            []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest{},
+			MetadataFields:         []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest{},
+			ExpirationAlerts:       []exportExpirationAlert{},
+			IssuedCertAlerts:       []exportTemplateAlert{},
+			DeniedCertAlerts:       []exportTemplateAlert{},
+			PendingCertAlerts:      []exportTemplateAlert{},
+			Networks:               []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest{},
+			WorkflowDefinitions:    []exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest{},
+			BuiltInReports:         []exportModelsReport{},
+			CustomReports:          []keyfactor.ModelsCustomReportCreationRequest{},
+			SecurityRoles:          []exportSecurityRole{},
+			StoreTypes:             []api.CertificateStoreType{},
+			Containers:             []exportCertificateStoreContainer{},
+			PamProviders:           []exportPamProvider{},
+			Stores:                 []exportCertificateStore{},
+			Templates:              []exportTemplate{},
+			CertificateAuthorities: []exportCertificateAuthority{},
 		}
 
 		exportPath := cmd.Flag("file").Value.String()
 		log.Debug().Str("exportPath", exportPath).Msg("exportPath")
+		exportDir := cmd.Flag("dir").Value.String()
+		log.Debug().Str("exportDir", exportDir).Msg("exportDir")
+		dirFormat := exportDirFormatYAML
+		switch outputFormat {
+		case exportDirFormatYAML, "text", "":
+		case exportDirFormatJSON:
+			dirFormat = exportDirFormatJSON
+		default:
+			return fmt.Errorf("invalid --format value %q for an export, must be yaml or json", outputFormat)
+		}
+
+		filters, fErr := exportFiltersOf(cmd)
+		if fErr != nil {
+			return fErr
+		}
+		var encryption *exportEncryption
+		encrypt, _ := cmd.Flags().GetBool("encrypt-secrets")
+		recipients, _ := cmd.Flags().GetStringArray("recipient")
+		if len(recipients) > 0 && !encrypt {
+			return fmt.Errorf("--recipient requires --encrypt-secrets")
+		}
+		if encrypt {
+			passphrase := ""
+			if len(recipients) == 0 {
+				var pErr error
+				if passphrase, pErr = exportPassphrase(); pErr != nil {
+					return pErr
+				}
+			}
+			var eErr error
+			if encryption, eErr = newExportEncryption(recipients, passphrase); eErr != nil {
+				return eErr
+			}
+		}
 
 		log.Debug().Msgf("%s: initGenClient", DebugFuncCall)
 		kfClient, clientErr := initGenClient(false)
@@ -153,80 +244,29 @@ var exportCmd = &cobra.Command{
 			return oldClientErr
 		}
 
-		if cmd.Flag("all").Value.String() == "true" {
-			log.Debug().Msgf("%s: getCollections", DebugFuncCall)
-			out.Collections = getCollections(kfClient)
-
-			log.Debug().Msgf("%s: getMetadata", DebugFuncCall)
-			out.MetadataFields = getMetadata(kfClient)
-
-			log.Debug().Msgf("%s: getExpirationAlerts", DebugFuncCall)
-			out.ExpirationAlerts = getExpirationAlerts(kfClient)
-
-			log.Debug().Msgf("%s: getIssuedAlerts", DebugFuncCall)
-			out.IssuedCertAlerts = getIssuedAlerts(kfClient)
-
-			log.Debug().Msgf("%s: getDeniedAlerts", DebugFuncCall)
-			out.DeniedCertAlerts = getDeniedAlerts(kfClient)
-
-			log.Debug().Msgf("%s: getPendingAlerts", DebugFuncCall)
-			out.PendingCertAlerts = getPendingAlerts(kfClient)
-
-			log.Debug().Msgf("%s: getSslNetworks", DebugFuncCall)
-			out.Networks = getSslNetworks(kfClient)
-
-			log.Debug().Msgf("%s: getWorkflowDefinitions", DebugFuncCall)
-			out.WorkflowDefinitions = getWorkflowDefinitions(kfClient)
-
-			log.Debug().Msgf("%s: getReports", DebugFuncCall)
-			out.BuiltInReports, out.CustomReports = getReports(kfClient)
-
-			log.Debug().Msgf("%s: getRoles", DebugFuncCall)
-			out.SecurityRoles = getRoles(oldkfClient)
-		} else {
-			if cmd.Flag("collections").Value.String() == "true" {
-				log.Debug().Msgf("%s: getCollections", DebugFuncCall)
-				out.Collections = getCollections(kfClient)
-			}
-			if cmd.Flag("metadata").Value.String() == "true" {
-				log.Debug().Msgf("%s: getMetadata", DebugFuncCall)
-				out.MetadataFields = getMetadata(kfClient)
-			}
-			if cmd.Flag("expiration-alerts").Value.String() == "true" {
-				log.Debug().Msgf("%s: getExpirationAlerts", DebugFuncCall)
-				out.ExpirationAlerts = getExpirationAlerts(kfClient)
-			}
-			if cmd.Flag("issued-alerts").Value.String() == "true" {
-				log.Debug().Msgf("%s: getIssuedAlerts", DebugFuncCall)
-				out.IssuedCertAlerts = getIssuedAlerts(kfClient)
-			}
-			if cmd.Flag("denied-alerts").Value.String() == "true" {
-				log.Debug().Msgf("%s: getDeniedAlerts", DebugFuncCall)
-				out.DeniedCertAlerts = getDeniedAlerts(kfClient)
-			}
-			if cmd.Flag("pending-alerts").Value.String() == "true" {
-				log.Debug().Msgf("%s: getPendingAlerts", DebugFuncCall)
-				out.PendingCertAlerts = getPendingAlerts(kfClient)
-			}
-			if cmd.Flag("networks").Value.String() == "true" {
-				log.Debug().Msgf("%s: getSslNetworks", DebugFuncCall)
-				out.Networks = getSslNetworks(kfClient)
-			}
-			if cmd.Flag("workflow-definitions").Value.String() == "true" {
-				log.Debug().Msgf("%s: getWorkflowDefinitions", DebugFuncCall)
-				out.WorkflowDefinitions = getWorkflowDefinitions(kfClient)
-			}
-			if cmd.Flag("reports").Value.String() == "true" {
-				log.Debug().Msgf("%s: getReports", DebugFuncCall)
-				out.BuiltInReports, out.CustomReports = getReports(kfClient)
+		selected := func(flag string) bool {
+			return cmd.Flag("all").Value.String() == "true" || cmd.Flag(flag).Value.String() == "true"
+		}
+		if eErr := exportEntities(&out, selected, kfClient, oldkfClient); eErr != nil {
+			// the entities that could be read are still exported
+			fmt.Printf("%s Error! %s%s\n", ColorRed, eErr, ColorWhite)
+		}
+		filterExport(&out, filters)
+		if encryption != nil {
+			if eErr := encryptSecrets(&out, encryption); eErr != nil {
+				return fmt.Errorf("unable to encrypt secrets: %s", eErr)
 			}
-			if cmd.Flag("security-roles").Value.String() == "true" {
-				log.Debug().Msgf("%s: getRoles", DebugFuncCall)
-				out.SecurityRoles = getRoles(oldkfClient)
+		}
+
+		if exportDir != "" {
+			log.Debug().Msgf("%s: exportToDir", DebugFuncCall)
+			if dErr := exportToDir(out, exportDir, dirFormat, selected, filters); dErr != nil {
+				return fmt.Errorf("error writing export to %s: %s", exportDir, dErr)
 			}
+		} else {
+			log.Debug().Msgf("%s: exportToJSON", DebugFuncCall)
+			exportToJSON(out, exportPath)
 		}
-		log.Debug().Msgf("%s: exportToJSON", DebugFuncCall)
-		exportToJSON(out, exportPath)
 
 		log.Debug().Msgf("%s: exportCmd", DebugFuncExit)
 		log.Info().Msg("Export complete")
@@ -234,34 +274,120 @@ var exportCmd = &cobra.Command{
 	},
 }
 
-func getCollections(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest {
+// exportEntities fills the export with the entities selected by the export flags.
+// exportEntities reads the selected entities of an instance into an export. Entities that can't be read are left
+// empty, and their errors are returned together.
+func exportEntities(
+	out *outJson,
+	selected func(flag string) bool,
+	kfClient *keyfactor.APIClient,
+	oldkfClient *api.Client,
+) error {
+	var errs []error
+	record := func(err error) {
+		if err != nil {
+			log.Error().Err(err).Send()
+			errs = append(errs, err)
+		}
+	}
+	var err error
+	if selected("collections") {
+		log.Debug().Msgf("%s: getCollections", DebugFuncCall)
+		out.Collections, err = getCollections(kfClient)
+		record(err)
+	}
+	if selected("metadata") {
+		log.Debug().Msgf("%s: getMetadata", DebugFuncCall)
+		out.MetadataFields, err = getMetadata(kfClient)
+		record(err)
+	}
+	if selected("expiration-alerts") {
+		log.Debug().Msgf("%s: getExpirationAlerts", DebugFuncCall)
+		out.ExpirationAlerts, err = getExpirationAlerts(kfClient)
+		record(err)
+	}
+	if selected("issued-alerts") {
+		log.Debug().Msgf("%s: getIssuedAlerts", DebugFuncCall)
+		out.IssuedCertAlerts, err = getIssuedAlerts(kfClient)
+		record(err)
+	}
+	if selected("denied-alerts") {
+		log.Debug().Msgf("%s: getDeniedAlerts", DebugFuncCall)
+		out.DeniedCertAlerts, err = getDeniedAlerts(kfClient)
+		record(err)
+	}
+	if selected("pending-alerts") {
+		log.Debug().Msgf("%s: getPendingAlerts", DebugFuncCall)
+		out.PendingCertAlerts, err = getPendingAlerts(kfClient)
+		record(err)
+	}
+	if selected("networks") {
+		log.Debug().Msgf("%s: getSslNetworks", DebugFuncCall)
+		out.Networks, err = getSslNetworks(kfClient)
+		record(err)
+	}
+	if selected("workflow-definitions") {
+		log.Debug().Msgf("%s: getWorkflowDefinitions", DebugFuncCall)
+		out.WorkflowDefinitions, err = getWorkflowDefinitions(kfClient)
+		record(err)
+	}
+	if selected("reports") {
+		log.Debug().Msgf("%s: getReports", DebugFuncCall)
+		out.BuiltInReports, out.CustomReports, err = getReports(kfClient)
+		record(err)
+	}
+	if selected("security-roles") {
+		log.Debug().Msgf("%s: getRoles", DebugFuncCall)
+		out.SecurityRoles, err = getRoles(kfClient, oldkfClient)
+		record(err)
+	}
+	if selected("store-types") {
+		log.Debug().Msgf("%s: getStoreTypes", DebugFuncCall)
+		out.StoreTypes, err = getStoreTypes(oldkfClient)
+		record(err)
+	}
+	if selected("containers") {
+		log.Debug().Msgf("%s: getContainers", DebugFuncCall)
+		out.Containers, err = getContainers(oldkfClient)
+		record(err)
+	}
+	if selected("pam-providers") {
+		log.Debug().Msgf("%s: getPamProviders", DebugFuncCall)
+		out.PamProviders, err = getPamProviders(kfClient)
+		record(err)
+	}
+	if selected("stores") {
+		log.Debug().Msgf("%s: getStores", DebugFuncCall)
+		out.Stores, err = getStores(kfClient, oldkfClient)
+		record(err)
+	}
+	if selected("templates") {
+		log.Debug().Msgf("%s: getTemplates", DebugFuncCall)
+		out.Templates, err = getTemplates(kfClient)
+		record(err)
+	}
+	if selected("cas") {
+		log.Debug().Msgf("%s: getCertificateAuthorities", DebugFuncCall)
+		out.CertificateAuthorities, err = getCertificateAuthorities(kfClient, oldkfClient)
+		record(err)
+	}
+	return errors.Join(errs...)
+}
+
+func getCollections(kfClient *keyfactor.APIClient) ([]keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest, error) {
 	log.Debug().Msgf("%s: getCollections", DebugFuncEnter)
 
 	log.Debug().Msgf("%s: CertificateCollectionGetCollections", DebugFuncCall)
-	collections, _, reqErr := kfClient.CertificateCollectionApi.CertificateCollectionGetCollections(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
-
+	collections, httpResp, reqErr := kfClient.CertificateCollectionApi.CertificateCollectionGetCollections(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 	if reqErr != nil {
-		log.Error().Err(reqErr).Send()
-		fmt.Printf("%s Error! Unable to get collections %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get collections: %s", returnHttpErr(httpResp, reqErr))
 	}
 	var lCollectionReq []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest
 	for _, collection := range collections {
 		log.Debug().Msgf("Marshalling collection %s", *collection.Name)
-		cJson, jmErr := json.Marshal(collection)
-		if jmErr != nil {
-			if collection.Name != nil && collection.Id != nil {
-				log.Error().Err(jmErr).Msgf("Error marshalling collection %s(%d)", *collection.Name, *collection.Id)
-			}
-			fmt.Printf("Error: %s\n", jmErr)
-			continue
-		}
-
-		log.Debug().Msgf("Unmarshalling collection %s", *collection.Name)
 		var collectionReq keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest
-		jErr := json.Unmarshal(cJson, &collectionReq)
-		if jErr != nil {
-			log.Error().Err(jErr).Send()
-			fmt.Printf("Error: %s\n", jErr)
+		if jErr := convertViaJSON(collection, &collectionReq); jErr != nil {
+			return nil, fmt.Errorf("unable to read collection %s: %s", collection.GetName(), jErr)
 		}
 		collectionReq.Query = collection.Content
 		collectionReq.Id = nil
@@ -270,18 +396,25 @@ func getCollections(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModel
 		lCollectionReq = append(lCollectionReq, collectionReq)
 	}
 	log.Debug().Msgf("%s: getCollections", DebugFuncExit)
-	return lCollectionReq
+	return lCollectionReq, nil
 }
 
-func getMetadata(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest {
+// listMetadataFields returns the certificate metadata field definitions of the instance.
+func listMetadataFields(kfClient *keyfactor.APIClient) ([]keyfactor.ModelsMetadataFieldTypeModel, error) {
+	log.Debug().Msgf("%s: MetadataFieldGetAllMetadataFields", DebugFuncCall)
+	metadata, httpResp, reqErr := kfClient.MetadataFieldApi.MetadataFieldGetAllMetadataFields(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+	if reqErr != nil {
+		return nil, returnHttpErr(httpResp, reqErr)
+	}
+	return metadata, nil
+}
+
+func getMetadata(kfClient *keyfactor.APIClient) ([]keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest, error) {
 	log.Debug().Msgf("%s: getMetadata", DebugFuncEnter)
 
-	log.Debug().Msgf("%s: MetadataFieldGetAllMetadataFields", DebugFuncCall)
-	metadata, _, reqErr := kfClient.MetadataFieldApi.MetadataFieldGetAllMetadataFields(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+	metadata, reqErr := listMetadataFields(kfClient)
 	if reqErr != nil {
-		log.Error().Err(reqErr).Send()
-		fmt.Printf("%s Error! Unable to get metadata %s%s\n", ColorRed, reqErr, ColorWhite)
-		return nil
+		return nil, fmt.Errorf("unable to get metadata: %s", reqErr)
 	}
 
 	var lMetadataReq []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest
@@ -292,310 +425,453 @@ func getMetadata(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsMe
 		} else if metadataItem.Id != nil {
 			mName = fmt.Sprintf("%d", *metadataItem.Id)
 		}
-		log.Debug().Str("mName", mName).Msg("Marshalling metadata")
-		mJson, jmErr := json.Marshal(metadataItem)
-		if jmErr != nil {
-			log.Error().Err(jmErr).Send()
-			fmt.Printf("Error: %s\n", jmErr)
-			continue
-		}
-
-		log.Debug().Msgf("Unmarshalling metadata '%s'", mName)
+		log.Debug().Str("mName", mName).Msg("Converting metadata")
 		var metadataReq keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest
-		jErr := json.Unmarshal(mJson, &metadataReq)
-		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send()
-			continue
+		if jErr := convertViaJSON(metadataItem, &metadataReq); jErr != nil {
+			return nil, fmt.Errorf("unable to read metadata field %s: %s", mName, jErr)
 		}
 		metadataItem.Id = nil
 
 		log.Debug().Msgf("Appending metadata '%s'", mName)
 		lMetadataReq = append(lMetadataReq, metadataReq)
 	}
-	return lMetadataReq
+	return lMetadataReq, nil
 }
 
-func getExpirationAlerts(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertCreationRequest {
-
-	alerts, _, reqErr := kfClient.ExpirationAlertApi.ExpirationAlertGetExpirationAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+func getExpirationAlerts(kfClient *keyfactor.APIClient) ([]exportExpirationAlert, error) {
+	alerts, httpResp, reqErr := kfClient.ExpirationAlertApi.ExpirationAlertGetExpirationAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 	if reqErr != nil {
-		fmt.Printf("%s Error! Unable to get expiration alerts %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get expiration alerts: %s", returnHttpErr(httpResp, reqErr))
 	}
-	var lAlertReq []keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertCreationRequest
+	var lAlertReq []exportExpirationAlert
 	for _, alert := range alerts {
-		mJson, _ := json.Marshal(alert)
-		var alertReq keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertCreationRequest
-		jErr := json.Unmarshal(mJson, &alertReq)
+		alertReq, jErr := exportExpirationAlertOf(alert)
 		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			log.Error().Err(jErr).Send()
-			return nil // todo: maybe return the error instead?
+			return nil, fmt.Errorf("unable to read expiration alert %s: %s", alert.GetDisplayName(), jErr)
 		}
 		lAlertReq = append(lAlertReq, alertReq)
 	}
-	return lAlertReq
+	return lAlertReq, nil
 }
 
-func getIssuedAlerts(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest {
-
-	alerts, _, reqErr := kfClient.IssuedAlertApi.IssuedAlertGetIssuedAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+func getIssuedAlerts(kfClient *keyfactor.APIClient) ([]exportTemplateAlert, error) {
+	alerts, httpResp, reqErr := kfClient.IssuedAlertApi.IssuedAlertGetIssuedAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 	if reqErr != nil {
-		fmt.Printf("%s Error! Unable to get issued cert alerts %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get issued cert alerts: %s", returnHttpErr(httpResp, reqErr))
 	}
-	var lAlertReq []keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest
+	var lAlertReq []exportTemplateAlert
 	for _, alert := range alerts {
-		mJson, _ := json.Marshal(alert)
-		var alertReq keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest
-		jErr := json.Unmarshal(mJson, &alertReq)
+		alertReq, jErr := exportTemplateAlertOf(alert)
 		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send()
-			return nil // todo: maybe return the error instead?
+			return nil, fmt.Errorf("unable to read issued cert alert %s: %s", alert.GetDisplayName(), jErr)
 		}
-		alertReq.TemplateId = nil
 		lAlertReq = append(lAlertReq, alertReq)
 	}
-	return lAlertReq
+	return lAlertReq, nil
 }
 
-func getDeniedAlerts(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertCreationRequest {
-
-	alerts, _, reqErr := kfClient.DeniedAlertApi.DeniedAlertGetDeniedAlerts(
+func getDeniedAlerts(kfClient *keyfactor.APIClient) ([]exportTemplateAlert, error) {
+	alerts, httpResp, reqErr := kfClient.DeniedAlertApi.DeniedAlertGetDeniedAlerts(
 		context.Background(),
 	).XKeyfactorRequestedWith(
 		XKeyfactorRequestedWith,
 	).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 	if reqErr != nil {
-		fmt.Printf("%s Error! Unable to get denied cert alerts %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get denied cert alerts: %s", returnHttpErr(httpResp, reqErr))
 	}
-	var lAlertReq []keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertCreationRequest
+	var lAlertReq []exportTemplateAlert
 	for _, alert := range alerts {
-		mJson, _ := json.Marshal(alert)
-		var alertReq keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertCreationRequest
-		jErr := json.Unmarshal(mJson, &alertReq)
+		alertReq, jErr := exportTemplateAlertOf(alert)
 		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send()
-			return nil // todo: maybe return the error instead?
+			return nil, fmt.Errorf("unable to read denied cert alert %s: %s", alert.GetDisplayName(), jErr)
 		}
-		alertReq.TemplateId = nil
 		lAlertReq = append(lAlertReq, alertReq)
 	}
-	return lAlertReq
+	return lAlertReq, nil
 }
 
-func getPendingAlerts(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertCreationRequest {
-
-	alerts, _, reqErr := kfClient.PendingAlertApi.PendingAlertGetPendingAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+func getPendingAlerts(kfClient *keyfactor.APIClient) ([]exportTemplateAlert, error) {
+	alerts, httpResp, reqErr := kfClient.PendingAlertApi.PendingAlertGetPendingAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 	if reqErr != nil {
-		fmt.Printf("%s Error! Unable to get pending cert alerts %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get pending cert alerts: %s", returnHttpErr(httpResp, reqErr))
 	}
-	var lAlertReq []keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertCreationRequest
+	var lAlertReq []exportTemplateAlert
 	for _, alert := range alerts {
-		mJson, _ := json.Marshal(alert)
-		var alertReq keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertCreationRequest
-		jErr := json.Unmarshal(mJson, &alertReq)
+		alertReq, jErr := exportTemplateAlertOf(alert)
 		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send()
+			return nil, fmt.Errorf("unable to read pending cert alert %s: %s", alert.GetDisplayName(), jErr)
 		}
-		alertReq.TemplateId = nil
 		lAlertReq = append(lAlertReq, alertReq)
 	}
-	return lAlertReq
+	return lAlertReq, nil
 }
 
-func getSslNetworks(kfClient *keyfactor.APIClient) []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest {
+func getSslNetworks(kfClient *keyfactor.APIClient) ([]keyfactor.KeyfactorApiModelsSslCreateNetworkRequest, error) {
 
-	networks, _, reqErr := kfClient.SslApi.
+	networks, httpResp, reqErr := kfClient.SslApi.
 		SslGetNetworks(context.Background()).
 		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
 		XKeyfactorApiVersion(XKeyfactorApiVersion).
 		Execute()
 	if reqErr != nil {
-		fmt.Printf("%s Error! Unable to get SSL networks %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get SSL networks: %s", returnHttpErr(httpResp, reqErr))
 	}
 	var lNetworkReq []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest
 	for _, network := range networks {
-		mJson, _ := json.Marshal(network)
 		var networkReq keyfactor.KeyfactorApiModelsSslCreateNetworkRequest
-		jErr := json.Unmarshal(mJson, &networkReq)
-		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send()
-			continue
+		if jErr := convertViaJSON(network, &networkReq); jErr != nil {
+			return nil, fmt.Errorf("unable to read SSL network %s: %s", network.GetName(), jErr)
 		}
 		lNetworkReq = append(lNetworkReq, networkReq)
 	}
-	return lNetworkReq
+	return lNetworkReq, nil
 }
 
-func getWorkflowDefinitions(kfClient *keyfactor.APIClient) []exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest {
+func getWorkflowDefinitions(kfClient *keyfactor.APIClient) ([]exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest, error) {
 
-	workflowDefs, _, reqErr := kfClient.WorkflowDefinitionApi.
+	workflowDefs, httpResp, reqErr := kfClient.WorkflowDefinitionApi.
 		WorkflowDefinitionQuery(context.Background()).
 		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
 		XKeyfactorApiVersion(XKeyfactorApiVersion).
 		Execute()
 	if reqErr != nil {
-		fmt.Printf("%s Error! Unable to get workflow definitions %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get workflow definitions: %s", returnHttpErr(httpResp, reqErr))
 	}
 	var lWorkflowReq []exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest
 	for _, workflowDef := range workflowDefs {
-		mJson, mErr := json.Marshal(workflowDef)
-		if mErr != nil {
-			fmt.Printf("Error: %s\n", mErr)
-			//log.Fatalf("Error: %s", mErr)
-			log.Error().Err(mErr).Send() //todo: better error message?
-			continue
-		}
 		var workflowReq exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest
-		jErr := json.Unmarshal(mJson, &workflowReq)
-		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send() //todo: better error message?
-			continue
+		if jErr := convertViaJSON(workflowDef, &workflowReq); jErr != nil {
+			return nil, fmt.Errorf("unable to read workflow definition %s: %s", workflowDef.GetDisplayName(), jErr)
 		}
 		if workflowDef.Key != nil {
 			key, convErr := strconv.ParseInt(*workflowDef.Key, 10, 64)
 			if convErr != nil {
-				fmt.Printf("Error: %s\n", convErr)
-				//log.Fatalf("Error: %s", convErr)
-				log.Error().Err(convErr).Send() //todo: better error message?
-				continue
+				return nil, fmt.Errorf(
+					"workflow definition %s has an invalid template key %q",
+					workflowDef.GetDisplayName(),
+					*workflowDef.Key,
+				)
 			}
-			key32 := int32(key)
-			template, _, tErr := kfClient.TemplateApi.
-				TemplateGetTemplate(context.Background(), key32).
+			template, tResp, tErr := kfClient.TemplateApi.
+				TemplateGetTemplate(context.Background(), int32(key)).
 				XKeyfactorRequestedWith(XKeyfactorRequestedWith).
 				XKeyfactorApiVersion(XKeyfactorApiVersion).
 				Execute()
 			if tErr != nil {
-				log.Error().Err(tErr).Send() //todo: better error message?
-				continue
+				return nil, fmt.Errorf(
+					"unable to get the template of workflow definition %s: %s",
+					workflowDef.GetDisplayName(),
+					returnHttpErr(tResp, tErr),
+				)
 			}
 			workflowReq.KeyName = template.TemplateName
 		}
 		workflowReq.Key = nil
 		lWorkflowReq = append(lWorkflowReq, workflowReq)
 	}
-	return lWorkflowReq
+	return lWorkflowReq, nil
 }
 
-func getReports(kfClient *keyfactor.APIClient) ([]exportModelsReport, []keyfactor.ModelsCustomReportCreationRequest) {
+func getReports(kfClient *keyfactor.APIClient) ([]exportModelsReport, []keyfactor.ModelsCustomReportCreationRequest, error) {
 
 	//Gets all built-in reports
-	bReports, _, bErr := kfClient.ReportsApi.ReportsQueryReports(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+	bReports, bResp, bErr := kfClient.ReportsApi.ReportsQueryReports(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 	if bErr != nil {
-		fmt.Printf("%s Error! Unable to get built-in reports %s%s\n", ColorRed, bErr, ColorWhite)
+		return nil, nil, fmt.Errorf("unable to get built-in reports: %s", returnHttpErr(bResp, bErr))
+	}
+	collections, colErr := listCollectionNames(kfClient)
+	if colErr != nil {
+		return nil, nil, fmt.Errorf("unable to get collections of report schedules: %s", colErr)
 	}
 	var lbReportsReq []exportModelsReport
 	for _, bReport := range bReports {
-		mJson, mErr := json.Marshal(bReport)
-		if mErr != nil {
-			fmt.Printf("Error: %s\n", mErr)
-			//log.Fatalf("Error: %s", mErr)
-			log.Error().Err(mErr).Send() //todo: better error message?
-			continue
-		}
-		var newbReport exportModelsReport
-		jErr := json.Unmarshal(mJson, &newbReport)
+		newbReport, jErr := exportReportOf(bReport, collections)
 		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send() //todo: better error message?
-			continue
+			return nil, nil, fmt.Errorf("unable to read built-in report %s: %s", bReport.GetDisplayName(), jErr)
 		}
-		newbReport.ID = nil
 		lbReportsReq = append(lbReportsReq, newbReport)
 	}
 	//Gets all custom reports
-	cReports, _, cErr := kfClient.ReportsApi.ReportsQueryCustomReports(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+	cReports, cResp, cErr := kfClient.ReportsApi.ReportsQueryCustomReports(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 	if cErr != nil {
-		fmt.Printf("%s Error! Unable to get custom reports %s%s\n", ColorRed, cErr, ColorWhite)
+		return nil, nil, fmt.Errorf("unable to get custom reports: %s", returnHttpErr(cResp, cErr))
 	}
 	var lcReportReq []keyfactor.ModelsCustomReportCreationRequest
 	for _, cReport := range cReports {
-		mJson, _ := json.Marshal(cReport)
 		var cReportReq keyfactor.ModelsCustomReportCreationRequest
-		jErr := json.Unmarshal(mJson, &cReportReq)
-		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send() //todo: better error message?
-			continue
+		if jErr := convertViaJSON(cReport, &cReportReq); jErr != nil {
+			return nil, nil, fmt.Errorf("unable to read custom report %s: %s", cReport.GetDisplayName(), jErr)
 		}
 		lcReportReq = append(lcReportReq, cReportReq)
 	}
-	return lbReportsReq, lcReportReq
+	return lbReportsReq, lcReportReq, nil
 }
 
-func getRoles(kfClient *api.Client) []api.CreateSecurityRoleArg {
-	roles, reqErr := kfClient.GetSecurityRoles()
+func getRoles(kfClient *keyfactor.APIClient, oldkfClient *api.Client) ([]exportSecurityRole, error) {
+	roles, reqErr := oldkfClient.GetSecurityRoles()
 	if reqErr != nil {
-		fmt.Printf("%s Error! Unable to get security roles %s%s\n", ColorRed, reqErr, ColorWhite)
+		return nil, fmt.Errorf("unable to get security roles: %s", reqErr)
 	}
-	var lRoleReq []api.CreateSecurityRoleArg
+	var lRoleReq []exportSecurityRole
 	for _, role := range roles {
-		mJson, _ := json.Marshal(role)
-		var cRoleReq api.CreateSecurityRoleArg
-		jErr := json.Unmarshal(mJson, &cRoleReq)
+		identities, iErr := listRoleIdentityNames(kfClient, role.Id)
+		if iErr != nil {
+			return nil, fmt.Errorf("unable to get the identities of security role %s: %s", role.Name, iErr)
+		}
+		cRoleReq, jErr := exportSecurityRoleOf(role, identities)
 		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send() //todo: better error message?
-			continue
+			return nil, fmt.Errorf("unable to read security role %s: %s", role.Name, jErr)
 		}
 		lRoleReq = append(lRoleReq, cRoleReq)
 	}
-	return lRoleReq
+	return lRoleReq, nil
+}
+
+// exportStoreTypeOf clears the IDs of a store type and its property and entry parameter definitions.
+func exportStoreTypeOf(storeType api.CertificateStoreType) api.CertificateStoreType {
+	storeType.StoreType = 0
+	if storeType.Properties != nil {
+		properties := slices.Clone(*storeType.Properties)
+		for i := range properties {
+			properties[i].StoreTypeID = 0
+		}
+		storeType.Properties = &properties
+	}
+	if storeType.EntryParameters != nil {
+		params := slices.Clone(*storeType.EntryParameters)
+		for i := range params {
+			params[i].StoreTypeId = 0
+		}
+		storeType.EntryParameters = &params
+	}
+	return storeType
+}
+
+func getStoreTypes(kfClient *api.Client) ([]api.CertificateStoreType, error) {
+	storeTypes, reqErr := kfClient.ListCertificateStoreTypes()
+	if reqErr != nil {
+		return nil, fmt.Errorf("unable to get certificate store types: %s", reqErr)
+	}
+	var lStoreTypes []api.CertificateStoreType
+	for _, storeType := range *storeTypes {
+		lStoreTypes = append(lStoreTypes, exportStoreTypeOf(storeType))
+	}
+	return lStoreTypes, nil
+}
+
+func getContainers(kfClient *api.Client) ([]exportCertificateStoreContainer, error) {
+	storeTypes, tErr := listStoreTypeNames(kfClient)
+	if tErr != nil {
+		return nil, fmt.Errorf("unable to get certificate store types: %s", tErr)
+	}
+	containers, reqErr := kfClient.GetStoreContainers()
+	if reqErr != nil {
+		return nil, fmt.Errorf("unable to get certificate store containers: %s", reqErr)
+	}
+	var lContainers []exportCertificateStoreContainer
+	for _, container := range *containers {
+		lContainers = append(
+			lContainers, exportCertificateStoreContainer{
+				Name:               container.Name,
+				StoreType:          storeTypes[container.CertStoreType],
+				OverwriteSchedules: container.OverwriteSchedules,
+				Schedule:           container.Schedule,
+			},
+		)
+	}
+	return lContainers, nil
+}
+
+func getPamProviders(kfClient *keyfactor.APIClient) ([]exportPamProvider, error) {
+	providers, reqErr := listPamProviders(kfClient)
+	if reqErr != nil {
+		return nil, fmt.Errorf("unable to get PAM providers: %s", reqErr)
+	}
+	var lProviders []exportPamProvider
+	for _, provider := range providers {
+		lProviders = append(lProviders, exportPamProviderOf(provider))
+	}
+	return lProviders, nil
+}
+
+// listCertificateStores returns every certificate store with its password settings, which are only returned when a
+// single store is requested.
+func listCertificateStores(kfClient *api.Client) ([]api.GetCertificateStoreResponse, error) {
+	stores, err := kfClient.ListCertificateStores(nil)
+	if err != nil {
+		return nil, err
+	}
+	var lStores []api.GetCertificateStoreResponse
+	for _, store := range *stores {
+		fullStore, sErr := kfClient.GetCertificateStoreByID(store.Id)
+		if sErr != nil {
+			return nil, sErr
+		}
+		lStores = append(lStores, *fullStore)
+	}
+	return lStores, nil
+}
+
+func getStores(kfClient *keyfactor.APIClient, oldkfClient *api.Client) ([]exportCertificateStore, error) {
+	refs, refErr := loadStoreReferences(kfClient, oldkfClient)
+	if refErr != nil {
+		return nil, fmt.Errorf("unable to get certificate stores: %s", refErr)
+	}
+	stores, reqErr := listCertificateStores(oldkfClient)
+	if reqErr != nil {
+		return nil, fmt.Errorf("unable to get certificate stores: %s", reqErr)
+	}
+	var lStores []exportCertificateStore
+	for _, store := range stores {
+		lStores = append(lStores, exportCertificateStoreOf(store, refs))
+	}
+	return lStores, nil
+}
+
+// listTemplates returns every certificate template with its metadata fields, defaults and policy, which are only
+// returned when a single template is requested.
+func listTemplates(kfClient *keyfactor.APIClient) ([]keyfactor.ModelsTemplateRetrievalResponse, error) {
+	templates, err := listTemplateSummaries(kfClient)
+	if err != nil {
+		return nil, err
+	}
+	var lTemplates []keyfactor.ModelsTemplateRetrievalResponse
+	for _, template := range templates {
+		fullTemplate, tResp, tErr := kfClient.TemplateApi.TemplateGetTemplate(context.Background(), template.GetId()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if tErr != nil {
+			return nil, returnHttpErr(tResp, tErr)
+		}
+		lTemplates = append(lTemplates, *fullTemplate)
+	}
+	return lTemplates, nil
+}
+
+// listMetadataFieldNames returns the names of the metadata fields of the instance by ID.
+func listMetadataFieldNames(kfClient *keyfactor.APIClient) (map[int32]string, error) {
+	fields, err := listMetadataFields(kfClient)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int32]string)
+	for _, field := range fields {
+		names[field.GetId()] = field.GetName()
+	}
+	return names, nil
+}
+
+func getTemplates(kfClient *keyfactor.APIClient) ([]exportTemplate, error) {
+	metadataNames, mErr := listMetadataFieldNames(kfClient)
+	if mErr != nil {
+		return nil, fmt.Errorf("unable to get metadata: %s", mErr)
+	}
+	templates, reqErr := listTemplates(kfClient)
+	if reqErr != nil {
+		return nil, fmt.Errorf("unable to get certificate templates: %s", reqErr)
+	}
+	var lTemplates []exportTemplate
+	for _, template := range templates {
+		lTemplates = append(lTemplates, exportTemplateOf(template, metadataNames))
+	}
+	return lTemplates, nil
+}
+
+func listCertificateAuthorities(
+	kfClient *keyfactor.APIClient,
+) ([]keyfactor.ModelsCertificateAuthoritiesCertificateAuthorityResponse, error) {
+	cas, httpResp, reqErr := kfClient.CertificateAuthorityApi.CertificateAuthorityGetCas(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Execute()
+	if reqErr != nil {
+		return nil, returnHttpErr(httpResp, reqErr)
+	}
+	return cas, nil
+}
+
+func getCertificateAuthorities(kfClient *keyfactor.APIClient, oldkfClient *api.Client) ([]exportCertificateAuthority, error) {
+	refs, refErr := loadStoreReferences(kfClient, oldkfClient)
+	if refErr != nil {
+		return nil, fmt.Errorf("unable to get certificate authorities: %s", refErr)
+	}
+	cas, reqErr := listCertificateAuthorities(kfClient)
+	if reqErr != nil {
+		return nil, fmt.Errorf("unable to get certificate authorities: %s", reqErr)
+	}
+	var lCAs []exportCertificateAuthority
+	for _, ca := range cas {
+		lCAs = append(lCAs, exportCertificateAuthorityOf(ca, refs))
+	}
+	return lCAs, nil
 }
 
 func init() {
 	RootCmd.AddCommand(exportCmd)
 
 	exportCmd.Flags().StringVarP(&exportPath, "file", "f", "", "path to JSON output file with exported data")
-	exportCmd.MarkFlagRequired("file")
+	exportCmd.Flags().StringVar(&exportDir, "dir", "", "path to a directory to write one file per exported object to")
+	exportCmd.MarkFlagsOneRequired("file", "dir")
+	exportCmd.MarkFlagsMutuallyExclusive("file", "dir")
 
 	exportCmd.Flags().BoolVarP(&fAll, "all", "a", false, "export all exportable data to JSON file")
 	exportCmd.Flags().Lookup("all").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fCollections, "collections", "c", false, "export collections to JSON file")
-	exportCmd.Flags().Lookup("collections").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fMetadata, "metadata", "m", false, "export metadata to JSON file")
-	exportCmd.Flags().Lookup("metadata").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(
+	addExportEntityFlag(exportCmd, &fCollections, "collections", "c", "export collections to JSON file")
+	addExportEntityFlag(exportCmd, &fMetadata, "metadata", "m", "export metadata to JSON file")
+	addExportEntityFlag(
+		exportCmd,
 		&fExpirationAlerts,
 		"expiration-alerts",
 		"e",
-		false,
 		"export expiration cert alerts to JSON file",
 	)
-	exportCmd.Flags().Lookup("expiration-alerts").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fIssuedAlerts, "issued-alerts", "i", false, "export issued cert alerts to JSON file")
-	exportCmd.Flags().Lookup("issued-alerts").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fDeniedAlerts, "denied-alerts", "d", false, "export denied cert alerts to JSON file")
-	exportCmd.Flags().Lookup("denied-alerts").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fPendingAlerts, "pending-alerts", "p", false, "export pending cert alerts to JSON file")
-	exportCmd.Flags().Lookup("pending-alerts").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fNetworks, "networks", "n", false, "export SSL networks to JSON file")
-	exportCmd.Flags().Lookup("networks").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(
+	addExportEntityFlag(exportCmd, &fIssuedAlerts, "issued-alerts", "i", "export issued cert alerts to JSON file")
+	addExportEntityFlag(exportCmd, &fDeniedAlerts, "denied-alerts", "d", "export denied cert alerts to JSON file")
+	addExportEntityFlag(exportCmd, &fPendingAlerts, "pending-alerts", "p", "export pending cert alerts to JSON file")
+	addExportEntityFlag(exportCmd, &fNetworks, "networks", "n", "export SSL networks to JSON file")
+	addExportEntityFlag(
+		exportCmd,
 		&fWorkflowDefinitions,
 		"workflow-definitions",
 		"w",
-		false,
 		"export workflow definitions to JSON file",
 	)
-	exportCmd.Flags().Lookup("workflow-definitions").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fReports, "reports", "r", false, "export reports to JSON file")
-	exportCmd.Flags().Lookup("reports").NoOptDefVal = "true"
-	exportCmd.Flags().BoolVarP(&fSecurityRoles, "security-roles", "s", false, "export security roles to JSON file")
-	exportCmd.Flags().Lookup("security-roles").NoOptDefVal = "true"
+	addExportEntityFlag(exportCmd, &fReports, "reports", "r", "export reports to JSON file")
+	addExportEntityFlag(exportCmd, &fSecurityRoles, "security-roles", "s", "export security roles to JSON file")
+	addExportEntityFlag(exportCmd, &fStoreTypes, "store-types", "", "export certificate store types to JSON file")
+	addExportEntityFlag(exportCmd, &fContainers, "containers", "", "export certificate store containers to JSON file")
+	addExportEntityFlag(
+		exportCmd,
+		&fPamProviders,
+		"pam-providers",
+		"",
+		"export PAM providers to JSON file, with secret values as placeholders",
+	)
+	addExportEntityFlag(
+		exportCmd,
+		&fStores,
+		"stores",
+		"",
+		"export certificate stores to JSON file, with secret values as placeholders",
+	)
+	addExportEntityFlag(exportCmd, &fTemplates, "templates", "", "export certificate template settings to JSON file")
+	addExportEntityFlag(
+		exportCmd,
+		&fCAs,
+		"cas",
+		"",
+		"export certificate authorities to JSON file, with secret values as placeholders",
+	)
+	addExportFilterFlags(exportCmd, "export")
+	exportCmd.Flags().Bool(
+		"encrypt-secrets",
+		false,
+		"encrypt secrets and recipients with a passphrase, or for the age recipients of --recipient",
+	)
+	exportCmd.Flags().StringArray(
+		"recipient",
+		nil,
+		"age recipient (age1...) that can decrypt the secrets of an encrypted export, may be repeated",
+	)
 }
@@ -0,0 +1,578 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// exportSchemaVersion is the version of the export format written by this kfutil. Version 1 is the single JSON file
+// written before exports carried a version, version 2 added the directory format, version 3 refers to the
+// collections and templates of alerts by name and version 4 holds the identities of security roles by account name.
+const exportSchemaVersion = 4
+
+const (
+	exportDirFormatYAML = "yaml"
+	exportDirFormatJSON = "json"
+)
+
+var exportFileNameInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// exportKind describes one kind of exported object: the export flag selecting it, the folder holding its objects in
+// a directory export and how its objects are keyed.
+type exportKind struct {
+	Flag string
+	Dir  string
+	// Field is the key of the objects of this kind in a single file export.
+	Field string
+	Kind  string
+	Label string
+	// objects returns the objects of this kind in an export with their natural keys, in export order.
+	objects func(out outJson) []exportKeyedObject
+	// keyOf returns the natural key of an object of this kind in its JSON form.
+	keyOf func(obj interface{}) (string, error)
+	// add decodes an object from JSON and appends it to an export.
+	add func(out *outJson, data []byte) error
+	// filter removes the objects of this kind whose natural key isn't kept from an export.
+	filter func(out *outJson, keep func(key string) bool)
+}
+
+type exportKeyedObject struct {
+	Key    string
+	Object interface{}
+}
+
+// exportDocument is the header and body of one object file in a directory export.
+type exportDocument struct {
+	SchemaVersion int    `json:"schemaVersion" yaml:"schemaVersion"`
+	Kind          string `json:"kind" yaml:"kind"`
+	// Encryption is set on the files of objects with encrypted secrets.
+	Encryption *exportEncryption `json:"encryption,omitempty" yaml:"encryption,omitempty"`
+	Spec       json.RawMessage   `json:"spec" yaml:"-"`
+}
+
+func newExportKind[T any](
+	flag string,
+	dir string,
+	field string,
+	kind string,
+	label string,
+	list func(out *outJson) *[]T,
+	key func(obj T) string,
+) exportKind {
+	return exportKind{
+		Flag:  flag,
+		Dir:   dir,
+		Field: field,
+		Kind:  kind,
+		Label: label,
+		objects: func(out outJson) []exportKeyedObject {
+			var objects []exportKeyedObject
+			for _, obj := range *list(&out) {
+				objects = append(objects, exportKeyedObject{Key: key(obj), Object: obj})
+			}
+			return objects
+		},
+		keyOf: func(obj interface{}) (string, error) {
+			var t T
+			if err := convertViaJSON(obj, &t); err != nil {
+				return "", err
+			}
+			return key(t), nil
+		},
+		add: func(out *outJson, data []byte) error {
+			var obj T
+			if err := json.Unmarshal(data, &obj); err != nil {
+				return err
+			}
+			objects := list(out)
+			*objects = append(*objects, obj)
+			return nil
+		},
+		filter: func(out *outJson, keep func(key string) bool) {
+			objects := list(out)
+			kept := make([]T, 0, len(*objects))
+			for _, obj := range *objects {
+				if keep(key(obj)) {
+					kept = append(kept, obj)
+				}
+			}
+			*objects = kept
+		},
+	}
+}
+
+// exportKinds lists every exported kind of object in export order.
+var exportKinds = []exportKind{
+	newExportKind(
+		"collections", "collections", "Collections", "collection", "collection",
+		func(out *outJson) *[]keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest {
+			return &out.Collections
+		},
+		func(o keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest) string {
+			return o.Name
+		},
+	),
+	newExportKind(
+		"metadata", "metadata-fields", "MetadataFields", "metadata_field", "metadata field",
+		func(out *outJson) *[]keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest {
+			return &out.MetadataFields
+		},
+		func(o keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest) string { return o.Name },
+	),
+	newExportKind(
+		"expiration-alerts", "expiration-alerts", "ExpirationAlerts", "expiration_alert", "expiration alert",
+		func(out *outJson) *[]exportExpirationAlert {
+			return &out.ExpirationAlerts
+		},
+		func(o exportExpirationAlert) string {
+			return o.DisplayName
+		},
+	),
+	newExportKind(
+		"issued-alerts", "issued-alerts", "IssuedCertAlerts", "issued_alert", "issued cert alert",
+		func(out *outJson) *[]exportTemplateAlert {
+			return &out.IssuedCertAlerts
+		},
+		func(o exportTemplateAlert) string {
+			return o.DisplayName
+		},
+	),
+	newExportKind(
+		"denied-alerts", "denied-alerts", "DeniedCertAlerts", "denied_alert", "denied cert alert",
+		func(out *outJson) *[]exportTemplateAlert {
+			return &out.DeniedCertAlerts
+		},
+		func(o exportTemplateAlert) string {
+			return o.DisplayName
+		},
+	),
+	newExportKind(
+		"pending-alerts", "pending-alerts", "PendingCertAlerts", "pending_alert", "pending cert alert",
+		func(out *outJson) *[]exportTemplateAlert {
+			return &out.PendingCertAlerts
+		},
+		func(o exportTemplateAlert) string {
+			return o.DisplayName
+		},
+	),
+	newExportKind(
+		"networks", "networks", "Networks", "ssl_network", "SSL network",
+		func(out *outJson) *[]keyfactor.KeyfactorApiModelsSslCreateNetworkRequest { return &out.Networks },
+		func(o keyfactor.KeyfactorApiModelsSslCreateNetworkRequest) string { return o.Name },
+	),
+	newExportKind(
+		"workflow-definitions", "workflow-definitions", "WorkflowDefinitions", "workflow_definition", "workflow definition",
+		func(out *outJson) *[]exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest {
+			return &out.WorkflowDefinitions
+		},
+		func(o exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest) string {
+			return stringValue(o.DisplayName)
+		},
+	),
+	newExportKind(
+		"reports", "built-in-reports", "BuiltInReports", "built_in_report", "built-in report",
+		func(out *outJson) *[]exportModelsReport { return &out.BuiltInReports },
+		func(o exportModelsReport) string { return stringValue(o.DisplayName) },
+	),
+	newExportKind(
+		"reports", "custom-reports", "CustomReports", "custom_report", "custom report",
+		func(out *outJson) *[]keyfactor.ModelsCustomReportCreationRequest { return &out.CustomReports },
+		func(o keyfactor.ModelsCustomReportCreationRequest) string { return o.DisplayName },
+	),
+	newExportKind(
+		"security-roles", "security-roles", "SecurityRoles", "security_role", "security role",
+		func(out *outJson) *[]exportSecurityRole { return &out.SecurityRoles },
+		func(o exportSecurityRole) string { return o.Name },
+	),
+	newExportKind(
+		"store-types", "store-types", "StoreTypes", "store_type", "certificate store type",
+		func(out *outJson) *[]api.CertificateStoreType { return &out.StoreTypes },
+		func(o api.CertificateStoreType) string { return o.ShortName },
+	),
+	newExportKind(
+		"containers", "containers", "Containers", "container", "certificate store container",
+		func(out *outJson) *[]exportCertificateStoreContainer { return &out.Containers },
+		func(o exportCertificateStoreContainer) string { return o.Name },
+	),
+	newExportKind(
+		"pam-providers", "pam-providers", "PamProviders", "pam_provider", "PAM provider",
+		func(out *outJson) *[]exportPamProvider { return &out.PamProviders },
+		func(o exportPamProvider) string { return o.Name },
+	),
+	newExportKind(
+		"stores", "stores", "Stores", "store", "certificate store",
+		func(out *outJson) *[]exportCertificateStore { return &out.Stores },
+		storeKey,
+	),
+	newExportKind(
+		"cas", "certificate-authorities", "CertificateAuthorities", "ca", "certificate authority",
+		func(out *outJson) *[]exportCertificateAuthority { return &out.CertificateAuthorities },
+		func(o exportCertificateAuthority) string { return caKey(o.HostName, o.LogicalName) },
+	),
+	newExportKind(
+		"templates", "templates", "Templates", "template", "certificate template",
+		func(out *outJson) *[]exportTemplate { return &out.Templates },
+		func(o exportTemplate) string { return o.TemplateName },
+	),
+}
+
+// checkExportSchemaVersion refuses exports written by a newer kfutil.
+func checkExportSchemaVersion(version int, source string) error {
+	switch {
+	case version > exportSchemaVersion:
+		return fmt.Errorf(
+			"%s has schema version %d, this kfutil reads up to version %d, please upgrade kfutil",
+			source,
+			version,
+			exportSchemaVersion,
+		)
+	case version < 0:
+		return fmt.Errorf("%s has an invalid schema version %d", source, version)
+	}
+	return nil
+}
+
+// exportFileNames returns a file name for each key that is unique within its folder, also on case-insensitive file
+// systems. Keys are named in sorted order so the same objects always get the same names.
+func exportFileNames(keys []string, ext string) []string {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return keys[order[a]] < keys[order[b]] })
+
+	names := make([]string, len(keys))
+	taken := make(map[string]bool)
+	for _, i := range order {
+		base := strings.Trim(exportFileNameInvalid.ReplaceAllString(keys[i], "_"), "._")
+		if base == "" {
+			base = "unnamed"
+		}
+		name := base
+		for n := 2; taken[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		taken[strings.ToLower(name)] = true
+		names[i] = name + "." + ext
+	}
+	return names
+}
+
+// yamlNodeOf converts JSON to a YAML node that keeps the field order of the JSON, written in block style.
+func yamlNodeOf(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var restyle func(n *yaml.Node)
+	restyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, c := range n.Content {
+			restyle(c)
+		}
+	}
+	restyle(&doc)
+	return doc.Content[0], nil
+}
+
+// encodeExportDocument writes one exported object with its schema version header, and the wrapped key of its secrets
+// when they are encrypted.
+func encodeExportDocument(kind string, obj interface{}, format string, encryption *exportEncryption) ([]byte, error) {
+	spec, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	doc := exportDocument{SchemaVersion: exportSchemaVersion, Kind: kind, Spec: spec}
+	if encryption != nil && hasEncryptedSecrets(obj) {
+		doc.Encryption = encryption
+	}
+	if format == exportDirFormatJSON {
+		out, mErr := json.MarshalIndent(doc, "", "    ")
+		return append(out, '\n'), mErr
+	}
+
+	specNode, nErr := yamlNodeOf(spec)
+	if nErr != nil {
+		return nil, nErr
+	}
+	var header yaml.Node
+	if hErr := header.Encode(doc); hErr != nil {
+		return nil, hErr
+	}
+	header.Content = append(header.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "spec"}, specNode)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if eErr := enc.Encode(&header); eErr != nil {
+		return nil, eErr
+	}
+	if cErr := enc.Close(); cErr != nil {
+		return nil, cErr
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeExportDocument reads one object file of a directory export, in YAML or JSON, and returns its spec as JSON.
+func decodeExportDocument(data []byte, source string) (exportDocument, error) {
+	var raw struct {
+		SchemaVersion int               `yaml:"schemaVersion"`
+		Kind          string            `yaml:"kind"`
+		Encryption    *exportEncryption `yaml:"encryption"`
+		Spec          interface{}       `yaml:"spec"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return exportDocument{}, fmt.Errorf("unable to read %s: %s", source, err)
+	}
+	if raw.SchemaVersion == 0 {
+		return exportDocument{}, fmt.Errorf("%s has no schemaVersion", source)
+	}
+	if err := checkExportSchemaVersion(raw.SchemaVersion, source); err != nil {
+		return exportDocument{}, err
+	}
+	if obj, ok := raw.Spec.(map[string]interface{}); ok {
+		migrateExportObject(raw.Kind, raw.SchemaVersion, obj)
+	}
+	spec, err := json.Marshal(raw.Spec)
+	if err != nil {
+		return exportDocument{}, fmt.Errorf("unable to read %s: %s", source, err)
+	}
+	return exportDocument{SchemaVersion: raw.SchemaVersion, Kind: raw.Kind, Encryption: raw.Encryption, Spec: spec}, nil
+}
+
+func isExportFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// exportToDir writes every object of the selected kinds to its own file in the folder of its kind. Files left in
+// those folders by an earlier export are removed, so deleted objects disappear from the directory, unless their
+// object is left out by the filters.
+func exportToDir(
+	out outJson,
+	dir string,
+	format string,
+	selected func(flag string) bool,
+	filters exportFilters,
+) error {
+	count := 0
+	for _, kind := range exportKinds {
+		if !selected(kind.Flag) {
+			continue
+		}
+		kindDir := filepath.Join(dir, kind.Dir)
+		entries, rErr := os.ReadDir(kindDir)
+		if rErr != nil && !os.IsNotExist(rErr) {
+			return rErr
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !isExportFile(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(kindDir, entry.Name())
+			// objects left out by the filters were not exported, so their files are kept
+			if filters.filters(kind) {
+				if key, kErr := exportFileKey(kind, path); kErr == nil && !filters.keep(kind, key) {
+					continue
+				}
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+
+		objects := kind.objects(out)
+		if len(objects) == 0 {
+			continue
+		}
+		// exports describe the instance's configuration and may hold encrypted secrets, so they are kept private
+		if err := os.MkdirAll(kindDir, 0700); err != nil {
+			return err
+		}
+		keys := make([]string, len(objects))
+		for i, obj := range objects {
+			keys[i] = obj.Key
+		}
+		for i, name := range exportFileNames(keys, format) {
+			data, eErr := encodeExportDocument(kind.Kind, objects[i].Object, format, out.Encryption)
+			if eErr != nil {
+				return fmt.Errorf("unable to encode %s %q: %s", kind.Label, objects[i].Key, eErr)
+			}
+			if err := writeSecureFile(filepath.Join(kindDir, name), data); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	fmt.Printf("%d objects successfully written to %s\n", count, dir)
+	return nil
+}
+
+// importFromDir reads a directory export. Folders of unknown kinds are ignored, files are read in name order.
+// Encrypted secrets are decrypted when keys are given.
+func importFromDir(dir string, keys *exportSecretKeys) (outJson, error) {
+	var out outJson
+	info, err := os.Stat(dir)
+	if err != nil {
+		return out, err
+	}
+	if !info.IsDir() {
+		return out, fmt.Errorf("%s is not a directory", dir)
+	}
+	for _, kind := range exportKinds {
+		kindDir := filepath.Join(dir, kind.Dir)
+		entries, rErr := os.ReadDir(kindDir)
+		if os.IsNotExist(rErr) {
+			continue
+		} else if rErr != nil {
+			return out, rErr
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !isExportFile(entry.Name()) {
+				log.Debug().Str("file", entry.Name()).Str("dir", kindDir).Msg("ignoring non-export file")
+				continue
+			}
+			path := filepath.Join(kindDir, entry.Name())
+			data, fErr := os.ReadFile(path)
+			if fErr != nil {
+				return out, fErr
+			}
+			doc, dErr := decodeExportDocument(data, path)
+			if dErr != nil {
+				return out, dErr
+			}
+			if doc.Kind != kind.Kind {
+				return out, fmt.Errorf("%s holds a %q, expected a %q", path, doc.Kind, kind.Kind)
+			}
+			spec, sErr := decryptExportObject(keys, doc.Encryption, kind, doc.Spec)
+			if sErr != nil {
+				return out, fmt.Errorf("unable to read %s: %s", path, sErr)
+			}
+			if aErr := kind.add(&out, spec); aErr != nil {
+				return out, fmt.Errorf("unable to read %s: %s", path, aErr)
+			}
+		}
+	}
+	out.SchemaVersion = exportSchemaVersion
+	return out, nil
+}
+
+// readExport reads an export from a single JSON file or from a directory. Encrypted secrets are decrypted when keys
+// are given, and left encrypted otherwise.
+func readExport(path string, keys *exportSecretKeys) (outJson, error) {
+	var out outJson
+	info, err := os.Stat(path)
+	if err != nil {
+		return out, err
+	}
+	if info.IsDir() {
+		return importFromDir(path, keys)
+	}
+	data, rErr := os.ReadFile(path)
+	if rErr != nil {
+		return out, rErr
+	}
+
+	// objects are migrated in their raw form, before fields that changed are lost to decoding
+	var raw map[string]interface{}
+	if jErr := json.Unmarshal(data, &raw); jErr != nil {
+		return out, jErr
+	}
+	version := 1
+	if v, ok := raw["schemaVersion"].(float64); ok {
+		version = int(v)
+	}
+	if vErr := checkExportSchemaVersion(version, path); vErr != nil {
+		return out, vErr
+	}
+	var encryption *exportEncryption
+	if raw["encryption"] != nil && keys != nil {
+		if eErr := convertViaJSON(raw["encryption"], &encryption); eErr != nil {
+			return out, fmt.Errorf("unable to read the encryption of %s: %s", path, eErr)
+		}
+		delete(raw, "encryption")
+	}
+	for _, kind := range exportKinds {
+		objects, _ := raw[kind.Field].([]interface{})
+		for _, obj := range objects {
+			if m, ok := obj.(map[string]interface{}); ok {
+				migrateExportObject(kind.Kind, version, m)
+			}
+			if encryption != nil {
+				if dErr := keys.decrypt(encryption, kind, obj); dErr != nil {
+					return out, fmt.Errorf("unable to read %s: %s", path, dErr)
+				}
+			}
+		}
+	}
+	if cErr := convertViaJSON(raw, &out); cErr != nil {
+		return out, cErr
+	}
+	out.SchemaVersion = exportSchemaVersion
+	return out, nil
+}
+
+// migrateExportObject brings the JSON fields of an exported object of an older schema version up to date.
+func migrateExportObject(kind string, version int, obj map[string]interface{}) {
+	if version < 3 {
+		// alerts held the collection or template they apply to as returned by the alert API, with an ID of the
+		// source instance. Report schedules only held the ID of their collection, which is dropped.
+		switch kind {
+		case "expiration_alert":
+			if query, ok := obj["CertificateQuery"].(map[string]interface{}); ok && query["Name"] != nil {
+				obj["CollectionName"] = query["Name"]
+			}
+			delete(obj, "CertificateQuery")
+			delete(obj, "CertificateQueryId")
+		case "issued_alert", "denied_alert", "pending_alert":
+			if template, ok := obj["Template"].(map[string]interface{}); ok && template["DisplayName"] != nil {
+				obj["TemplateDisplayName"] = template["DisplayName"]
+			}
+			delete(obj, "Template")
+			delete(obj, "TemplateId")
+		}
+	}
+	if version < 4 && kind == "security_role" {
+		// roles held their identities as returned by the role API, with the IDs and SIDs of the source instance
+		identities, _ := obj["Identities"].([]interface{})
+		var names []interface{}
+		for _, identity := range identities {
+			if m, ok := identity.(map[string]interface{}); ok && m["AccountName"] != nil {
+				names = append(names, m["AccountName"])
+			}
+		}
+		if len(names) > 0 {
+			obj["Identities"] = names
+		} else {
+			delete(obj, "Identities")
+		}
+	}
+}
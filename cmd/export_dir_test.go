@@ -0,0 +1,132 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExportFileNames(t *testing.T) {
+	names := exportFileNames([]string{"b/c (K8S)", "Owner", "owner", "", "Owner"}, "yaml")
+	assert.Equal(t, []string{"b_c_K8S.yaml", "Owner.yaml", "owner_3.yaml", "unnamed.yaml", "Owner_2.yaml"}, names)
+}
+
+func Test_ExportDirRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	description, hint := "true", "Team owning the certificate"
+	out := outJson{
+		MetadataFields: []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest{
+			{Name: "Owner", Description: description, Hint: &hint},
+			{Name: "Environment", Description: "2024-01-01"},
+		},
+		Stores: []exportCertificateStore{{StoreType: "K8SSecret", ClientMachine: "cluster1", StorePath: "ns/secret"}},
+	}
+	all := func(string) bool { return true }
+
+	assert.NoError(t, exportToDir(out, dir, exportDirFormatYAML, all, nil))
+	data, err := os.ReadFile(filepath.Join(dir, "metadata-fields", "Owner.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"schemaVersion: 4\nkind: metadata_field\nspec:\n  DataType: 0\n  Description: \"true\"\n"+
+			"  Hint: Team owning the certificate\n  Name: Owner\n",
+		string(data),
+	)
+	assert.FileExists(t, filepath.Join(dir, "stores", "cluster1_ns_secret_K8SSecret.yaml"))
+	assert.NoDirExists(t, filepath.Join(dir, "collections"))
+	info, err := os.Stat(filepath.Join(dir, "metadata-fields"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(dir, "metadata-fields", "Owner.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	read, err := readExport(dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, exportSchemaVersion, read.SchemaVersion)
+	// files are read in name order
+	assert.Equal(t, importStateOf(out.MetadataFields[1]), importStateOf(read.MetadataFields[0]))
+	assert.Equal(t, importStateOf(out.MetadataFields[0]), importStateOf(read.MetadataFields[1]))
+	assert.Equal(t, out.Stores, read.Stores)
+
+	// a later export removes deleted objects, and JSON files are read the same way
+	out.MetadataFields = out.MetadataFields[:1]
+	selected := func(flag string) bool { return flag == "metadata" }
+	assert.NoError(t, exportToDir(out, dir, exportDirFormatJSON, selected, nil))
+	assert.NoFileExists(t, filepath.Join(dir, "metadata-fields", "Environment.yaml"))
+	read, err = readExport(dir, nil)
+	assert.NoError(t, err)
+	assert.Len(t, read.MetadataFields, 1)
+	assert.Equal(t, "true", read.MetadataFields[0].Description)
+	assert.Len(t, read.Stores, 1)
+}
+
+func Test_ExportSchemaVersion(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "collections"), 0755))
+	path := filepath.Join(dir, "collections", "All.yaml")
+
+	assert.NoError(t, os.WriteFile(path, []byte("schemaVersion: 5\nkind: collection\nspec:\n  Name: All\n"), 0600))
+	_, err := readExport(dir, nil)
+	assert.EqualError(t, err, path+" has schema version 5, this kfutil reads up to version 4, please upgrade kfutil")
+
+	assert.NoError(t, os.WriteFile(path, []byte("kind: collection\nspec:\n  Name: All\n"), 0600))
+	_, err = readExport(dir, nil)
+	assert.EqualError(t, err, path+" has no schemaVersion")
+
+	assert.NoError(t, os.WriteFile(path, []byte("schemaVersion: 3\nkind: store\nspec: {}\n"), 0600))
+	_, err = readExport(dir, nil)
+	assert.EqualError(t, err, path+` holds a "store", expected a "collection"`)
+
+	// single files written before exports carried a version are migrated
+	file := filepath.Join(t.TempDir(), "export.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"Collections": [{"Name": "All"}]}`), 0600))
+	out, err := readExport(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, exportSchemaVersion, out.SchemaVersion)
+	assert.Equal(t, "All", out.Collections[0].Name)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"schemaVersion": 9}`), 0600))
+	_, err = readExport(file, nil)
+	assert.EqualError(t, err, file+" has schema version 9, this kfutil reads up to version 4, please upgrade kfutil")
+}
+
+func Test_ExportMigrateReferences(t *testing.T) {
+	// version 2 exports held the collection and template objects of alerts, with the IDs of the exporting instance
+	file := filepath.Join(t.TempDir(), "export.json")
+	v2 := `{
+  "schemaVersion": 2,
+  "ExpirationAlerts": [{"DisplayName": "Soon", "CertificateQuery": {"Id": 4, "Name": "PKI-Web"}}],
+  "IssuedCertAlerts": [{"DisplayName": "Issued", "TemplateId": 7, "Template": {"Id": 7, "DisplayName": "Web Server"}}]
+}`
+	assert.NoError(t, os.WriteFile(file, []byte(v2), 0600))
+	out, err := readExport(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "PKI-Web", out.ExpirationAlerts[0].CollectionName)
+	assert.Equal(t, "Web Server", out.IssuedCertAlerts[0].TemplateDisplayName)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "denied-alerts"), 0755))
+	denied := "schemaVersion: 2\nkind: denied_alert\nspec:\n  DisplayName: Denied\n  Template:\n    DisplayName: Web Server\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "denied-alerts", "Denied.yaml"), []byte(denied), 0600))
+	out, err = readExport(dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Web Server", out.DeniedCertAlerts[0].TemplateDisplayName)
+}
@@ -0,0 +1,297 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// exportFilterKindName matches the kind prefix of a filter, so that a misspelled kind is reported rather than taken
+// as part of the pattern.
+var exportFilterKindName = regexp.MustCompile(`^[a-z-]+$`)
+
+// exportFilter keeps or drops the objects of one kind by natural key. Filters without a kind apply to every kind.
+type exportFilter struct {
+	Kind    string
+	Pattern string
+	Exclude bool
+	re      *regexp.Regexp
+}
+
+// exportFilters are the --include and --exclude filters of an export or import. An object is kept when it matches
+// one of the include filters of its kind, or its kind has none, and matches none of the exclude filters.
+type exportFilters []exportFilter
+
+// addExportFilterFlags adds the --include and --exclude flags to an export or import command.
+func addExportFilterFlags(cmd *cobra.Command, verb string) {
+	cmd.Flags().StringArray(
+		"include",
+		nil,
+		fmt.Sprintf("only %s objects whose name matches [<kind>=]<glob or /regex/>, may be repeated", verb),
+	)
+	cmd.Flags().StringArray(
+		"exclude",
+		nil,
+		fmt.Sprintf("don't %s objects whose name matches [<kind>=]<glob or /regex/>, may be repeated", verb),
+	)
+}
+
+// exportEntityFlagSeq numbers the times entity flags are set, so the flag given right before an argument is known.
+var exportEntityFlagSeq int
+
+// exportEntityFlag is the value of an entity flag such as --collections. It is a switch that takes an optional name
+// pattern, either as --collections=PKI-* or as the argument following the flag, as in --collections 'PKI-*'.
+type exportEntityFlag struct {
+	value    *bool
+	flags    *pflag.FlagSet
+	patterns []string
+	// at holds, for each time the flag was set without a pattern, the number of arguments parsed before it and the
+	// order it was set in.
+	at [][2]int
+}
+
+// addExportEntityFlag adds an entity flag to an export or import command.
+func addExportEntityFlag(cmd *cobra.Command, value *bool, name string, shorthand string, usage string) {
+	flag := &exportEntityFlag{value: value, flags: cmd.Flags()}
+	cmd.Flags().VarPF(flag, name, shorthand, usage+", takes an optional name pattern").
+		NoOptDefVal = "true"
+}
+
+func (f *exportEntityFlag) String() string {
+	if f.value == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*f.value)
+}
+
+func (f *exportEntityFlag) Set(value string) error {
+	exportEntityFlagSeq++
+	if b, err := strconv.ParseBool(value); err == nil {
+		*f.value = b
+		f.at = append(f.at, [2]int{len(f.flags.Args()), exportEntityFlagSeq})
+		return nil
+	}
+	*f.value = true
+	f.patterns = append(f.patterns, value)
+	return nil
+}
+
+// Type is bool, so the flag is a switch in the usage and can be read with GetBool.
+func (f *exportEntityFlag) Type() string {
+	return "bool"
+}
+
+// exportEntityArgs takes each positional argument as the pattern of the entity flag given right before it, as in
+// --collections 'PKI-*', and rejects the arguments that don't follow an entity flag.
+func exportEntityArgs(cmd *cobra.Command, args []string) error {
+	for i, arg := range args {
+		var owner *exportEntityFlag
+		seq := 0
+		cmd.Flags().VisitAll(
+			func(flag *pflag.Flag) {
+				entity, ok := flag.Value.(*exportEntityFlag)
+				if !ok {
+					return
+				}
+				for _, at := range entity.at {
+					if at[0] == i && at[1] > seq {
+						owner, seq = entity, at[1]
+					}
+				}
+			},
+		)
+		if owner == nil {
+			return fmt.Errorf(
+				"unexpected argument %q, give a pattern right after an entity flag or use --include <kind>=<pattern>",
+				arg,
+			)
+		}
+		owner.patterns = append(owner.patterns, arg)
+	}
+	return nil
+}
+
+// exportFiltersOf returns the filters given by the --include and --exclude flags of a command and the patterns of its
+// entity flags.
+func exportFiltersOf(cmd *cobra.Command) (exportFilters, error) {
+	includes, _ := cmd.Flags().GetStringArray("include")
+	excludes, _ := cmd.Flags().GetStringArray("exclude")
+	cmd.Flags().VisitAll(
+		func(flag *pflag.Flag) {
+			if entity, ok := flag.Value.(*exportEntityFlag); ok {
+				for _, pattern := range entity.patterns {
+					includes = append(includes, flag.Name+"="+pattern)
+				}
+			}
+		},
+	)
+	return parseExportFilters(includes, excludes)
+}
+
+// parseExportFilters parses the values of the --include and --exclude flags.
+func parseExportFilters(includes []string, excludes []string) (exportFilters, error) {
+	var filters exportFilters
+	for _, value := range includes {
+		filter, err := parseExportFilter(value, false)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	for _, value := range excludes {
+		filter, err := parseExportFilter(value, true)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// parseExportFilter parses a filter of the form [<kind>=][!]<pattern>. The kind is an entity flag such as
+// collections, or the folder of a kind in a directory export such as custom-reports. A leading ! turns the filter
+// around, and the pattern is a glob, or a regular expression when it is enclosed in slashes.
+func parseExportFilter(value string, exclude bool) (exportFilter, error) {
+	filter := exportFilter{Pattern: value, Exclude: exclude}
+	if kind, pattern, found := strings.Cut(value, "="); found && exportFilterKindName.MatchString(kind) {
+		if !isExportFilterKind(kind) {
+			return filter, fmt.Errorf("unknown kind %q in filter %q", kind, value)
+		}
+		filter.Kind, filter.Pattern = kind, pattern
+	}
+	if strings.HasPrefix(filter.Pattern, "!") {
+		filter.Pattern = filter.Pattern[1:]
+		filter.Exclude = !filter.Exclude
+	}
+	if filter.Pattern == "" {
+		return filter, fmt.Errorf("empty pattern in filter %q", value)
+	}
+
+	expr := exportGlobExpr(filter.Pattern)
+	if len(filter.Pattern) > 1 && strings.HasPrefix(filter.Pattern, "/") && strings.HasSuffix(filter.Pattern, "/") {
+		expr = filter.Pattern[1 : len(filter.Pattern)-1]
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return filter, fmt.Errorf("invalid pattern in filter %q: %s", value, err)
+	}
+	filter.re = re
+	return filter, nil
+}
+
+// exportGlobExpr converts a glob, where * matches any text and ? any single character, to a regular expression
+// matching whole names.
+func exportGlobExpr(glob string) string {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
+
+func isExportFilterKind(name string) bool {
+	for _, kind := range exportKinds {
+		if name == kind.Flag || name == kind.Dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (f exportFilter) appliesTo(kind exportKind) bool {
+	return f.Kind == "" || f.Kind == kind.Flag || f.Kind == kind.Dir
+}
+
+// filters reports whether any of the filters applies to the kind.
+func (filters exportFilters) filters(kind exportKind) bool {
+	for _, filter := range filters {
+		if filter.appliesTo(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// keep reports whether the object of the kind with the given natural key passes the filters.
+func (filters exportFilters) keep(kind exportKind, key string) bool {
+	included, hasInclude := false, false
+	for _, filter := range filters {
+		if !filter.appliesTo(kind) {
+			continue
+		}
+		matched := filter.re.MatchString(key)
+		if filter.Exclude {
+			if matched {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		included = included || matched
+	}
+	return !hasInclude || included
+}
+
+// filterExport removes the objects that don't pass the filters from an export.
+func filterExport(out *outJson, filters exportFilters) {
+	for _, kind := range exportKinds {
+		if !filters.filters(kind) {
+			continue
+		}
+		kind.filter(
+			out, func(key string) bool {
+				if filters.keep(kind, key) {
+					return true
+				}
+				log.Debug().Str("kind", kind.Kind).Str("name", key).Msg("filtered out")
+				return false
+			},
+		)
+	}
+}
+
+// exportFileKey returns the natural key of the object held by a file of a directory export.
+func exportFileKey(kind exportKind, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	doc, dErr := decodeExportDocument(data, path)
+	if dErr != nil {
+		return "", dErr
+	}
+	var out outJson
+	if err := kind.add(&out, doc.Spec); err != nil {
+		return "", err
+	}
+	return kind.objects(out)[0].Key, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseExportFilters(t *testing.T) {
+	filters, err := parseExportFilters([]string{"collections=PKI-*", "custom-reports=!Legacy?"}, []string{"/(?i)test/"})
+	assert.NoError(t, err)
+	assert.Len(t, filters, 3)
+	assert.Equal(t, "collections", filters[0].Kind)
+	assert.True(t, filters[0].re.MatchString("PKI-Web"))
+	assert.False(t, filters[0].re.MatchString("Old PKI-Web"))
+	assert.True(t, filters[1].Exclude)
+	assert.Equal(t, "Legacy?", filters[1].Pattern)
+	assert.Equal(t, "", filters[2].Kind)
+	assert.True(t, filters[2].Exclude)
+
+	// an = in a name isn't taken for a kind
+	filters, err = parseExportFilters([]string{"CN=Web*"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", filters[0].Kind)
+	assert.Equal(t, "CN=Web*", filters[0].Pattern)
+
+	_, err = parseExportFilters([]string{"colections=PKI-*"}, nil)
+	assert.EqualError(t, err, `unknown kind "colections" in filter "colections=PKI-*"`)
+	_, err = parseExportFilters(nil, []string{"collections=!"})
+	assert.EqualError(t, err, `empty pattern in filter "collections=!"`)
+	_, err = parseExportFilters([]string{"/(/"}, nil)
+	assert.ErrorContains(t, err, `invalid pattern in filter "/(/"`)
+}
+
+func Test_ExportEntityArgs(t *testing.T) {
+	newCmd := func() (*cobra.Command, *bool, *bool) {
+		var collections, reports bool
+		cmd := &cobra.Command{Use: "export"}
+		addExportEntityFlag(cmd, &collections, "collections", "c", "export collections")
+		addExportEntityFlag(cmd, &reports, "reports", "r", "export reports")
+		addExportFilterFlags(cmd, "export")
+		return cmd, &collections, &reports
+	}
+
+	cmd, collections, reports := newCmd()
+	assert.NoError(
+		t,
+		cmd.ParseFlags([]string{"--collections", "PKI-*", "Web*", "-r", "!Legacy*"}),
+	)
+	assert.EqualError(
+		t,
+		exportEntityArgs(cmd, cmd.Flags().Args()),
+		`unexpected argument "Web*", give a pattern right after an entity flag or use --include <kind>=<pattern>`,
+	)
+
+	cmd, collections, reports = newCmd()
+	assert.NoError(t, cmd.ParseFlags([]string{"--collections", "PKI-*", "-r", "!Legacy*", "--include", "Web*"}))
+	assert.NoError(t, exportEntityArgs(cmd, cmd.Flags().Args()))
+	assert.True(t, *collections)
+	assert.True(t, *reports)
+	filters, err := exportFiltersOf(cmd)
+	assert.NoError(t, err)
+	assert.Len(t, filters, 3)
+	assert.Equal(t, "", filters[0].Kind)
+	assert.Equal(t, "collections", filters[1].Kind)
+	assert.Equal(t, "PKI-*", filters[1].Pattern)
+	assert.Equal(t, "reports", filters[2].Kind)
+	assert.True(t, filters[2].Exclude)
+
+	// a pattern given with = and a switch followed by a flag
+	cmd, collections, reports = newCmd()
+	assert.NoError(t, cmd.ParseFlags([]string{"--collections=PKI-*", "--reports", "--include", "Web*"}))
+	assert.NoError(t, exportEntityArgs(cmd, cmd.Flags().Args()))
+	assert.True(t, *reports)
+	filters, err = exportFiltersOf(cmd)
+	assert.NoError(t, err)
+	assert.Len(t, filters, 2)
+	assert.Equal(t, "collections", filters[1].Kind)
+
+	// an argument that doesn't follow an entity flag
+	cmd, _, _ = newCmd()
+	assert.NoError(t, cmd.ParseFlags([]string{"--include", "Web*", "PKI-*"}))
+	assert.Error(t, exportEntityArgs(cmd, cmd.Flags().Args()))
+	assert.Error(t, importCmd.Args(importCmd, []string{"PKI-*"}))
+}
+
+func Test_FilterExport(t *testing.T) {
+	out := outJson{
+		Collections: []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest{
+			{Name: "PKI-Web"}, {Name: "PKI-Test"}, {Name: "Other"},
+		},
+		MetadataFields: []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest{{Name: "Owner"}},
+		CustomReports: []keyfactor.ModelsCustomReportCreationRequest{
+			{DisplayName: "Weekly"}, {DisplayName: "Legacy 1"},
+		},
+	}
+	filters, err := parseExportFilters(
+		[]string{"collections=PKI-*", "reports=!Legacy*"},
+		[]string{"/(?i)test/"},
+	)
+	assert.NoError(t, err)
+
+	filterExport(&out, filters)
+	assert.Len(t, out.Collections, 1)
+	assert.Equal(t, "PKI-Web", out.Collections[0].Name)
+	assert.Len(t, out.MetadataFields, 1)
+	assert.Len(t, out.CustomReports, 1)
+	assert.Equal(t, "Weekly", out.CustomReports[0].DisplayName)
+	assert.NotNil(t, out.Networks)
+	assert.Empty(t, out.Networks)
+}
+
+func Test_ExportDirFiltered(t *testing.T) {
+	dir := t.TempDir()
+	out := outJson{
+		Collections: []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest{
+			{Name: "PKI-Web"}, {Name: "Other"},
+		},
+	}
+	selected := func(flag string) bool { return flag == "collections" }
+	assert.NoError(t, exportToDir(out, dir, exportDirFormatYAML, selected, nil))
+
+	// a filtered export only replaces the files of the objects it covers
+	filters, err := parseExportFilters([]string{"collections=PKI-*"}, nil)
+	assert.NoError(t, err)
+	out.Collections = out.Collections[:0]
+	filterExport(&out, filters)
+	assert.NoError(t, exportToDir(out, dir, exportDirFormatYAML, selected, filters))
+	assert.NoFileExists(t, filepath.Join(dir, "collections", "PKI-Web.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "collections", "Other.yaml"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "collections", "PKI-Old.yaml"), []byte("broken"), 0600))
+	assert.NoError(t, exportToDir(out, dir, exportDirFormatYAML, selected, filters))
+	assert.NoFileExists(t, filepath.Join(dir, "collections", "PKI-Old.yaml"))
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+)
+
+// exportSecurityRole is a security role with the account names of the identities it is assigned to, such as an AD
+// group DOMAIN\group or the client ID of an OAuth client.
+type exportSecurityRole struct {
+	Name        string    `json:"Name"`
+	Description string    `json:"Description"`
+	Enabled     *bool     `json:"Enabled,omitempty"`
+	Private     *bool     `json:"Private,omitempty"`
+	Permissions *[]string `json:"Permissions,omitempty"`
+	Identities  []string  `json:"Identities,omitempty"`
+}
+
+// exportSecurityIdentity is a security identity created by an import because a role is assigned to it.
+type exportSecurityIdentity struct {
+	AccountName string `json:"AccountName"`
+}
+
+// exportSecurityRoleOf returns a role of an instance in the shape of an exported role, with the given identities.
+func exportSecurityRoleOf(role api.GetSecurityRolesResponse, identities []string) (exportSecurityRole, error) {
+	var exported exportSecurityRole
+	// the identities returned with a role are models of the source instance, the assignments are listed separately
+	role.Identities = nil
+	if err := convertViaJSON(role, &exported); err != nil {
+		return exported, err
+	}
+	exported.Identities = identities
+	return exported, nil
+}
+
+// listRoleIdentityNames returns the sorted account names of the identities a security role is assigned to.
+func listRoleIdentityNames(kfClient *keyfactor.APIClient, roleId int) ([]string, error) {
+	identities, httpResp, reqErr := kfClient.SecurityRolesApi.SecurityRolesGetIdentitiesWithRole(
+		context.Background(),
+		int32(roleId),
+	).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Execute()
+	if reqErr != nil {
+		return nil, returnHttpErr(httpResp, reqErr)
+	}
+	var names []string
+	for _, identity := range identities {
+		names = append(names, identity.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// listSecurityIdentityIds returns the IDs of the security identities of an instance by account name. Account names
+// are matched case-insensitively, like Windows account names.
+func listSecurityIdentityIds(kfClient *api.Client) (map[string]int, error) {
+	identities, err := kfClient.GetSecurityIdentities()
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int)
+	for _, identity := range identities {
+		ids[strings.ToLower(identity.AccountName)] = identity.Id
+	}
+	return ids, nil
+}
+
+// readIdentityMap reads the CSV file given to --map-identities. Each record holds the account name of an identity on
+// the source instance and the account name to use on the target instead, such as CORP\PKI Admins,LAB\PKI Admins. An
+// empty target drops the identity from the imported roles. Lines starting with # are comments.
+func readIdentityMap(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	mapping := make(map[string]string)
+	for {
+		record, rErr := r.Read()
+		if rErr == io.EOF {
+			break
+		} else if rErr != nil {
+			return nil, fmt.Errorf("unable to read identity map %s: %s", path, rErr)
+		}
+		source := strings.ToLower(strings.TrimSpace(record[0]))
+		if source == "" {
+			return nil, fmt.Errorf("identity map %s has an empty source account name", path)
+		}
+		if _, ok := mapping[source]; ok {
+			return nil, fmt.Errorf("identity map %s maps %q more than once", path, record[0])
+		}
+		mapping[source] = strings.TrimSpace(record[1])
+	}
+	return mapping, nil
+}
+
+// mapRoleIdentities translates the identities of exported roles with an identity map. Identities that aren't in the
+// map are kept as they are.
+func mapRoleIdentities(roles []exportSecurityRole, mapping map[string]string) []exportSecurityRole {
+	mapped := make([]exportSecurityRole, 0, len(roles))
+	for _, role := range roles {
+		var identities []string
+		for _, identity := range role.Identities {
+			target, ok := mapping[strings.ToLower(identity)]
+			if !ok {
+				identities = append(identities, identity)
+			} else if target != "" {
+				identities = append(identities, target)
+			}
+		}
+		sort.Strings(identities)
+		role.Identities = identities
+		mapped = append(mapped, role)
+	}
+	return mapped
+}
+
+// securityIdentityImportEntity creates the identities that the imported roles are assigned to and that don't exist on
+// the target yet.
+func securityIdentityImportEntity(roles []exportSecurityRole, kfClient *api.Client) importEntity {
+	entity := importEntity{Kind: "security_identity", Label: "security identity", NoRename: true}
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		for _, identity := range role.Identities {
+			if seen[strings.ToLower(identity)] {
+				continue
+			}
+			seen[strings.ToLower(identity)] = true
+			entity.Objects = append(
+				entity.Objects,
+				importObject{Name: identity, Body: exportSecurityIdentity{AccountName: identity}},
+			)
+		}
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		identities, err := kfClient.GetSecurityIdentities()
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, identity := range identities {
+			// keyed by the exported spelling of the name, which may differ in case
+			key := identity.AccountName
+			for _, obj := range entity.Objects {
+				if strings.EqualFold(obj.Name, key) {
+					key = obj.Name
+				}
+			}
+			state := importStateOf(exportSecurityIdentity{AccountName: key})
+			existing[key] = importExisting{Object: &identity, State: state}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		identity := obj.Body.(exportSecurityIdentity)
+		_, err := kfClient.CreateSecurityIdentity(&api.CreateSecurityIdentityArg{AccountName: identity.AccountName})
+		return err
+	}
+	return entity
+}
+
+// assignRoleIdentities makes a security role assigned to exactly the identities with the given account names.
+func assignRoleIdentities(kfClient *keyfactor.APIClient, oldkfClient *api.Client, roleId int, names []string) error {
+	ids, err := listSecurityIdentityIds(oldkfClient)
+	if err != nil {
+		return err
+	}
+	req := keyfactor.KeyfactorApiModelsSecurityRolesRoleIdentitiesRequest{Ids: []int32{}}
+	for _, name := range names {
+		id, ok := ids[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("security identity %q doesn't exist on the target", name)
+		}
+		req.Ids = append(req.Ids, int32(id))
+	}
+	_, httpResp, reqErr := kfClient.SecurityRolesApi.SecurityRolesUpdateIdentitiesWithRole(
+		context.Background(),
+		int32(roleId),
+	).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		Identities(req).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Execute()
+	if reqErr != nil {
+		return returnHttpErr(httpResp, reqErr)
+	}
+	return nil
+}
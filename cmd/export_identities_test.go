@@ -0,0 +1,77 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReadIdentityMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.csv")
+	content := "# source,target\nCORP\\PKI Admins, LAB\\PKI Admins\ncorp\\auditors,\n\"CORP\\Ops, EU\",LAB\\Ops\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	mapping, err := readIdentityMap(path)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string]string{"corp\\pki admins": "LAB\\PKI Admins", "corp\\auditors": "", "corp\\ops, eu": "LAB\\Ops"},
+		mapping,
+	)
+
+	assert.NoError(t, os.WriteFile(path, []byte("CORP\\Admins,LAB\\Admins\ncorp\\admins,LAB\\Other\n"), 0600))
+	_, err = readIdentityMap(path)
+	assert.EqualError(t, err, "identity map "+path+` maps "corp\\admins" more than once`)
+
+	assert.NoError(t, os.WriteFile(path, []byte("CORP\\Admins\n"), 0600))
+	_, err = readIdentityMap(path)
+	assert.ErrorContains(t, err, "unable to read identity map "+path)
+}
+
+func Test_MapRoleIdentities(t *testing.T) {
+	roles := []exportSecurityRole{
+		{Name: "Admins", Identities: []string{"CORP\\PKI Admins", "kfutil-client"}},
+		{Name: "Auditors", Identities: []string{"CORP\\Auditors"}},
+	}
+	mapping := map[string]string{"corp\\pki admins": "LAB\\PKI Admins", "corp\\auditors": ""}
+
+	mapped := mapRoleIdentities(roles, mapping)
+	assert.Equal(t, []string{"LAB\\PKI Admins", "kfutil-client"}, mapped[0].Identities)
+	assert.Nil(t, mapped[1].Identities)
+	assert.Equal(t, "CORP\\PKI Admins", roles[0].Identities[0])
+
+	entity := securityIdentityImportEntity(
+		[]exportSecurityRole{{Identities: []string{"LAB\\Ops", "client"}}, {Identities: []string{"lab\\ops"}}},
+		nil,
+	)
+	assert.Len(t, entity.Objects, 2)
+	assert.Equal(t, "LAB\\Ops", entity.Objects[0].Name)
+}
+
+func Test_ExportMigrateRoleIdentities(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "export.json")
+	content := `{"schemaVersion": 3, "SecurityRoles": [
+		{"Name": "Admins", "Identities": [{"Id": 4, "AccountName": "CORP\\PKI Admins", "SID": "S-1-5-21-1"}]},
+		{"Name": "Empty", "Identities": []}
+	]}`
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+	out, err := readExport(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CORP\\PKI Admins"}, out.SecurityRoles[0].Identities)
+	assert.Nil(t, out.SecurityRoles[1].Identities)
+}
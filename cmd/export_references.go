@@ -0,0 +1,820 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+)
+
+// exportSecretPlaceholder replaces secret values, which are never exported.
+const exportSecretPlaceholder = "<secret>"
+
+// pamParamDataTypeSecret is the data type of PAM provider type parameters that hold secrets.
+const pamParamDataTypeSecret = 2
+
+// exportPamProvider is a PAM provider with its provider level parameters keyed by name.
+type exportPamProvider struct {
+	Name         string            `json:"Name"`
+	ProviderType string            `json:"ProviderType"`
+	Area         *int32            `json:"Area,omitempty"`
+	Remote       bool              `json:"Remote"`
+	Parameters   map[string]string `json:"Parameters,omitempty"`
+}
+
+// exportStoreSecret is a certificate store secret. It either refers to a PAM provider by name, or holds the
+// placeholder of a value that was not exported.
+type exportStoreSecret struct {
+	Value       string            `json:"Value,omitempty"`
+	PamProvider string            `json:"PamProvider,omitempty"`
+	Parameters  map[string]string `json:"Parameters,omitempty"`
+}
+
+// exportCertificateStore is a certificate store that refers to its store type, container, orchestrator and PAM
+// providers by name, so it can be created on another instance.
+type exportCertificateStore struct {
+	StoreType         string                 `json:"StoreType"`
+	ClientMachine     string                 `json:"ClientMachine"`
+	StorePath         string                 `json:"StorePath"`
+	ContainerName     string                 `json:"ContainerName,omitempty"`
+	Agent             string                 `json:"Agent,omitempty"`
+	Approved          bool                   `json:"Approved"`
+	CreateIfMissing   bool                   `json:"CreateIfMissing"`
+	Properties        map[string]interface{} `json:"Properties,omitempty"`
+	InventorySchedule *api.InventorySchedule `json:"InventorySchedule,omitempty"`
+	Password          *exportStoreSecret     `json:"Password,omitempty"`
+}
+
+// exportCertificateStoreContainer is a certificate store container that refers to its store type by short name.
+type exportCertificateStoreContainer struct {
+	Name               string `json:"Name"`
+	StoreType          string `json:"StoreType"`
+	OverwriteSchedules bool   `json:"OverwriteSchedules"`
+	Schedule           string `json:"Schedule,omitempty"`
+}
+
+// storeReferences holds the names of the objects that certificate stores refer to by ID on one instance.
+type storeReferences struct {
+	StoreTypes   map[int]string
+	Containers   map[int]string
+	Agents       map[string]string
+	PamProviders map[int]string
+}
+
+// referenceID returns the ID of the object with the given name.
+func referenceID[K comparable](names map[K]string, name string) (K, bool) {
+	for id, n := range names {
+		if n == name {
+			return id, true
+		}
+	}
+	var none K
+	return none, false
+}
+
+// storeKey is the natural key of a certificate store, which has no name of its own.
+func storeKey(store exportCertificateStore) string {
+	return fmt.Sprintf("%s/%s (%s)", store.ClientMachine, store.StorePath, store.StoreType)
+}
+
+func listStoreTypeNames(kfClient *api.Client) (map[int]string, error) {
+	storeTypes, err := kfClient.ListCertificateStoreTypes()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string)
+	for _, storeType := range *storeTypes {
+		names[storeType.StoreType] = storeType.ShortName
+	}
+	return names, nil
+}
+
+func listPamProviders(kfClient *keyfactor.APIClient) ([]keyfactor.CSSCMSDataModelModelsProvider, error) {
+	providers, httpResp, reqErr := kfClient.PAMProviderApi.PAMProviderGetPamProviders(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Execute()
+	if reqErr != nil {
+		return nil, returnHttpErr(httpResp, reqErr)
+	}
+	return providers, nil
+}
+
+// loadStoreReferences looks up the names of the store types, containers, orchestrators and PAM providers of an
+// instance.
+func loadStoreReferences(kfClient *keyfactor.APIClient, oldkfClient *api.Client) (storeReferences, error) {
+	var refs storeReferences
+	var err error
+	if refs.StoreTypes, err = listStoreTypeNames(oldkfClient); err != nil {
+		return refs, fmt.Errorf("unable to list certificate store types: %s", err)
+	}
+
+	containers, cErr := oldkfClient.GetStoreContainers()
+	if cErr != nil {
+		return refs, fmt.Errorf("unable to list certificate store containers: %s", cErr)
+	}
+	refs.Containers = make(map[int]string)
+	for _, container := range *containers {
+		if container.Id != nil {
+			refs.Containers[*container.Id] = container.Name
+		}
+	}
+
+	agents, aErr := oldkfClient.GetAgentList()
+	if aErr != nil {
+		return refs, fmt.Errorf("unable to list orchestrators: %s", aErr)
+	}
+	refs.Agents = make(map[string]string)
+	for _, agent := range agents {
+		refs.Agents[agent.AgentId] = agent.ClientMachine
+	}
+
+	providers, pErr := listPamProviders(kfClient)
+	if pErr != nil {
+		return refs, fmt.Errorf("unable to list PAM providers: %s", pErr)
+	}
+	refs.PamProviders = make(map[int]string)
+	for _, provider := range providers {
+		refs.PamProviders[int(provider.GetId())] = provider.Name
+	}
+	return refs, nil
+}
+
+// exportPamProviderOf returns the provider level parameters of a PAM provider, with secret values replaced by
+// placeholders. Instance level parameters belong to the stores that use the provider.
+func exportPamProviderOf(provider keyfactor.CSSCMSDataModelModelsProvider) exportPamProvider {
+	out := exportPamProvider{
+		Name:         provider.Name,
+		ProviderType: provider.ProviderType.GetName(),
+		Area:         provider.Area,
+		Parameters:   make(map[string]string),
+	}
+	if remote, ok := provider.AdditionalProperties["Remote"].(bool); ok {
+		out.Remote = remote
+	}
+	for _, value := range provider.ProviderTypeParamValues {
+		param := value.ProviderTypeParam
+		if param == nil || param.GetInstanceLevel() {
+			continue
+		}
+		if param.GetDataType() == pamParamDataTypeSecret {
+			out.Parameters[param.GetName()] = exportSecretPlaceholder
+			continue
+		}
+		out.Parameters[param.GetName()] = value.GetValue()
+	}
+	return out
+}
+
+// pamProviderTypeParams returns the parameter definitions of a PAM provider type, which the API returns as
+// Parameters rather than ProviderTypeParams.
+func pamProviderTypeParams(providerType keyfactor.CSSCMSDataModelModelsProviderType) []keyfactor.CSSCMSDataModelModelsProviderTypeParam {
+	if len(providerType.ProviderTypeParams) > 0 {
+		return providerType.ProviderTypeParams
+	}
+	var params []keyfactor.CSSCMSDataModelModelsProviderTypeParam
+	if parameters, ok := providerType.AdditionalProperties["Parameters"]; ok {
+		_ = convertViaJSON(parameters, &params)
+	}
+	return params
+}
+
+// pamProviderRequest builds the PAM provider to create from an exported one, using the provider type definition of
+// the target. Parameters whose secret values were not exported are left out.
+func pamProviderRequest(
+	provider exportPamProvider,
+	providerType keyfactor.CSSCMSDataModelModelsProviderType,
+) (keyfactor.CSSCMSDataModelModelsProvider, error) {
+	req := keyfactor.CSSCMSDataModelModelsProvider{
+		Name:                 provider.Name,
+		Area:                 provider.Area,
+		ProviderType:         keyfactor.CSSCMSDataModelModelsProviderType{Id: providerType.Id},
+		AdditionalProperties: map[string]interface{}{"Remote": provider.Remote},
+	}
+	params := pamProviderTypeParams(providerType)
+	for name, value := range provider.Parameters {
+		if value == exportSecretPlaceholder {
+			continue
+		}
+		var param *keyfactor.CSSCMSDataModelModelsProviderTypeParam
+		for i := range params {
+			if params[i].GetName() == name {
+				param = &params[i]
+				break
+			}
+		}
+		if param == nil {
+			return req, fmt.Errorf("PAM provider type %q has no parameter %q", providerType.GetName(), name)
+		}
+		v := value
+		req.ProviderTypeParamValues = append(
+			req.ProviderTypeParamValues,
+			keyfactor.CSSCMSDataModelModelsPamProviderTypeParamValue{
+				Value: &v,
+				ProviderTypeParam: &keyfactor.CSSCMSDataModelModelsProviderTypeParam{
+					Id:            param.Id,
+					Name:          param.Name,
+					InstanceLevel: param.InstanceLevel,
+				},
+			},
+		)
+	}
+	return req, nil
+}
+
+// exportPropertySecret converts a secret store property, as returned by the API, to its exported form.
+func exportPropertySecret(secret map[string]interface{}, pamProviders map[int]string) exportStoreSecret {
+	if managed, _ := secret["IsManaged"].(bool); !managed {
+		if importValueEmpty(secret["Value"]) {
+			return exportStoreSecret{}
+		}
+		return exportStoreSecret{Value: exportSecretPlaceholder}
+	}
+	providerId, _ := secret["ProviderId"].(float64)
+	out := exportStoreSecret{PamProvider: pamProviders[int(providerId)], Parameters: make(map[string]string)}
+	values, _ := secret["ProviderTypeParameterValues"].([]interface{})
+	for _, v := range values {
+		value, _ := v.(map[string]interface{})
+		param, _ := value["ProviderTypeParam"].(map[string]interface{})
+		name, _ := param["Name"].(string)
+		s, _ := value["Value"].(string)
+		out.Parameters[name] = s
+	}
+	return out
+}
+
+// exportCertificateStoreOf converts a certificate store to its exported form, replacing the IDs it refers to by
+// names and secret values by placeholders.
+func exportCertificateStoreOf(store api.GetCertificateStoreResponse, refs storeReferences) exportCertificateStore {
+	out := exportCertificateStore{
+		StoreType:       refs.StoreTypes[store.CertStoreType],
+		ClientMachine:   store.ClientMachine,
+		StorePath:       store.StorePath,
+		ContainerName:   store.ContainerName,
+		Agent:           refs.Agents[store.AgentId],
+		Approved:        store.Approved,
+		CreateIfMissing: store.CreateIfMissing,
+	}
+	if out.ContainerName == "" {
+		out.ContainerName = refs.Containers[store.ContainerId]
+	}
+	properties := store.Properties
+	if properties == nil {
+		properties = unmarshalPropertiesString(store.PropertiesString)
+	}
+	if len(properties) > 0 {
+		out.Properties = make(map[string]interface{})
+	}
+	for name, value := range properties {
+		// secret properties are the only ones with object values
+		if secret, isSecret := value.(map[string]interface{}); isSecret {
+			out.Properties[name] = exportPropertySecret(secret, refs.PamProviders)
+			continue
+		}
+		out.Properties[name] = value
+	}
+	if !importValueEmpty(importStateOf(store.InventorySchedule)) {
+		schedule := store.InventorySchedule
+		out.InventorySchedule = &schedule
+	}
+	switch password := store.Password; {
+	case password.IsManaged:
+		out.Password = &exportStoreSecret{PamProvider: refs.PamProviders[password.ProviderId]}
+		if password.Parameters != nil {
+			out.Password.Parameters = *password.Parameters
+		}
+	case password.Value != nil && *password.Value != "":
+		out.Password = &exportStoreSecret{Value: exportSecretPlaceholder}
+	}
+	return out
+}
+
+// importPropertySecret converts an exported secret store property to the format the API accepts. A placeholder keeps
+// the current value of the target, if any, and leaves the secret empty otherwise.
+func importPropertySecret(
+	secret exportStoreSecret,
+	current interface{},
+	pamProviders map[int]string,
+) (map[string]interface{}, error) {
+	if secret.PamProvider != "" {
+		providerId, ok := referenceID(pamProviders, secret.PamProvider)
+		if !ok {
+			return nil, fmt.Errorf("PAM provider %q doesn't exist on the target", secret.PamProvider)
+		}
+		return map[string]interface{}{
+			"Value": map[string]interface{}{"Provider": providerId, "Parameters": secret.Parameters},
+		}, nil
+	}
+	if cur, ok := current.(map[string]interface{}); ok && secret.Value == exportSecretPlaceholder {
+		if managed, _ := cur["IsManaged"].(bool); managed {
+			return map[string]interface{}{"Value": reformatPamSecretForPost(cur)}, nil
+		}
+		return map[string]interface{}{"Value": map[string]interface{}{"SecretValue": cur["Value"]}}, nil
+	}
+	var value interface{}
+	if secret.Value != "" && secret.Value != exportSecretPlaceholder {
+		value = secret.Value
+	}
+	return map[string]interface{}{"Value": map[string]interface{}{"SecretValue": value}}, nil
+}
+
+// certificateStoreRequest builds the request to create an exported certificate store on the target, resolving the
+// names it refers to. current holds the properties of the store on the target when it is updated.
+func certificateStoreRequest(
+	store exportCertificateStore,
+	refs storeReferences,
+	current map[string]interface{},
+) (api.CreateStoreFctArgs, error) {
+	req := api.CreateStoreFctArgs{
+		ClientMachine:   store.ClientMachine,
+		StorePath:       store.StorePath,
+		Approved:        &store.Approved,
+		CreateIfMissing: &store.CreateIfMissing,
+		Properties:      make(map[string]interface{}),
+	}
+	var ok bool
+	if req.CertStoreType, ok = referenceID(refs.StoreTypes, store.StoreType); !ok {
+		return req, fmt.Errorf("certificate store type %q doesn't exist on the target", store.StoreType)
+	}
+	if store.Agent != "" {
+		if req.AgentId, ok = referenceID(refs.Agents, store.Agent); !ok {
+			return req, fmt.Errorf("orchestrator %q isn't registered on the target", store.Agent)
+		}
+		assigned := true
+		req.AgentAssigned = &assigned
+	}
+	if store.ContainerName != "" {
+		containerId, found := referenceID(refs.Containers, store.ContainerName)
+		if !found {
+			return req, fmt.Errorf("certificate store container %q doesn't exist on the target", store.ContainerName)
+		}
+		req.ContainerId = &containerId
+	}
+	for name, value := range store.Properties {
+		if _, isSecret := value.(map[string]interface{}); !isSecret {
+			req.Properties[name] = value
+			continue
+		}
+		var secret exportStoreSecret
+		if err := convertViaJSON(value, &secret); err != nil {
+			return req, fmt.Errorf("invalid secret property %q: %s", name, err)
+		}
+		prop, err := importPropertySecret(secret, current[name], refs.PamProviders)
+		if err != nil {
+			return req, err
+		}
+		req.Properties[name] = prop
+	}
+	req.InventorySchedule = store.InventorySchedule
+	if password := store.Password; password != nil {
+		switch {
+		case password.PamProvider != "":
+			providerId, found := referenceID(refs.PamProviders, password.PamProvider)
+			if !found {
+				return req, fmt.Errorf("PAM provider %q doesn't exist on the target", password.PamProvider)
+			}
+			parameters := password.Parameters
+			req.Password = &api.StorePasswordConfig{Provider: &providerId, Parameters: &parameters, IsManaged: true}
+		case password.Value != exportSecretPlaceholder:
+			value := password.Value
+			req.Password = &api.StorePasswordConfig{Value: &value}
+		}
+	}
+	return req, nil
+}
+
+// exportTemplateMetadataField is the template specific setting of a metadata field, which it refers to by name.
+type exportTemplateMetadataField struct {
+	MetadataField string  `json:"MetadataField"`
+	DefaultValue  *string `json:"DefaultValue,omitempty"`
+	Validation    *string `json:"Validation,omitempty"`
+	Enrollment    *int32  `json:"Enrollment,omitempty"`
+	Message       *string `json:"Message,omitempty"`
+}
+
+// exportTemplate holds the settings of a certificate template that can be updated. Templates themselves come from
+// the CAs, so they are never created by an import.
+type exportTemplate struct {
+	TemplateName           string                                                              `json:"TemplateName"`
+	CommonName             *string                                                             `json:"CommonName,omitempty"`
+	KeySize                *string                                                             `json:"KeySize,omitempty"`
+	KeyType                *string                                                             `json:"KeyType,omitempty"`
+	FriendlyName           *string                                                             `json:"FriendlyName,omitempty"`
+	KeyRetention           *int32                                                              `json:"KeyRetention,omitempty"`
+	KeyRetentionDays       *int32                                                              `json:"KeyRetentionDays,omitempty"`
+	KeyArchival            *bool                                                               `json:"KeyArchival,omitempty"`
+	EnrollmentFields       []keyfactor.ModelsTemplateUpdateRequestTemplateEnrollmentFieldModel `json:"EnrollmentFields,omitempty"`
+	MetadataFields         []exportTemplateMetadataField                                       `json:"MetadataFields,omitempty"`
+	AllowedEnrollmentTypes *int32                                                              `json:"AllowedEnrollmentTypes,omitempty"`
+	TemplateRegexes        []keyfactor.ModelsTemplateUpdateRequestTemplateRegexModel           `json:"TemplateRegexes,omitempty"`
+	TemplateDefaults       []keyfactor.ModelsTemplateUpdateRequestTemplateDefaultModel         `json:"TemplateDefaults,omitempty"`
+	TemplatePolicy         *keyfactor.ModelsTemplateUpdateRequestTemplatePolicyModel           `json:"TemplatePolicy,omitempty"`
+	UseAllowedRequesters   *bool                                                               `json:"UseAllowedRequesters,omitempty"`
+	AllowedRequesters      []string                                                            `json:"AllowedRequesters,omitempty"`
+	RequiresApproval       *bool                                                               `json:"RequiresApproval,omitempty"`
+	KeyUsage               *int32                                                              `json:"KeyUsage,omitempty"`
+}
+
+// exportCertificateAuthority is a certificate authority that refers to its orchestrator by client machine and to
+// the PAM providers of its secrets by name.
+type exportCertificateAuthority struct {
+	LogicalName             *string                                               `json:"LogicalName,omitempty"`
+	HostName                *string                                               `json:"HostName,omitempty"`
+	Delegate                *bool                                                 `json:"Delegate,omitempty"`
+	DelegateEnrollment      *bool                                                 `json:"DelegateEnrollment,omitempty"`
+	ForestRoot              *string                                               `json:"ForestRoot,omitempty"`
+	ConfigurationTenant     *string                                               `json:"ConfigurationTenant,omitempty"`
+	Remote                  *bool                                                 `json:"Remote,omitempty"`
+	Agent                   *string                                               `json:"Agent,omitempty"`
+	Standalone              *bool                                                 `json:"Standalone,omitempty"`
+	MonitorThresholds       *bool                                                 `json:"MonitorThresholds,omitempty"`
+	IssuanceMax             *int32                                                `json:"IssuanceMax,omitempty"`
+	IssuanceMin             *int32                                                `json:"IssuanceMin,omitempty"`
+	FailureMax              *int32                                                `json:"FailureMax,omitempty"`
+	RFCEnforcement          *bool                                                 `json:"RFCEnforcement,omitempty"`
+	Properties              *string                                               `json:"Properties,omitempty"`
+	AllowedEnrollmentTypes  *int32                                                `json:"AllowedEnrollmentTypes,omitempty"`
+	KeyRetention            *int32                                                `json:"KeyRetention,omitempty"`
+	KeyRetentionDays        *int32                                                `json:"KeyRetentionDays,omitempty"`
+	ExplicitCredentials     *bool                                                 `json:"ExplicitCredentials,omitempty"`
+	SubscriberTerms         *bool                                                 `json:"SubscriberTerms,omitempty"`
+	ExplicitUser            *string                                               `json:"ExplicitUser,omitempty"`
+	ExplicitPassword        *exportStoreSecret                                    `json:"ExplicitPassword,omitempty"`
+	UseAllowedRequesters    *bool                                                 `json:"UseAllowedRequesters,omitempty"`
+	AllowedRequesters       []string                                              `json:"AllowedRequesters,omitempty"`
+	FullScan                *keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule `json:"FullScan,omitempty"`
+	IncrementalScan         *keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule `json:"IncrementalScan,omitempty"`
+	ThresholdCheck          *keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule `json:"ThresholdCheck,omitempty"`
+	AuthCertificate         *exportStoreSecret                                    `json:"AuthCertificate,omitempty"`
+	AuthCertificatePassword *exportStoreSecret                                    `json:"AuthCertificatePassword,omitempty"`
+	CAType                  *int32                                                `json:"CAType,omitempty"`
+	EnforceUniqueDN         *bool                                                 `json:"EnforceUniqueDN,omitempty"`
+}
+
+// caKey is the natural key of a certificate authority, in the <host>\<logical name> form used for enrollment.
+func caKey(host *string, logicalName *string) string {
+	return fmt.Sprintf("%s\\%s", stringValue(host), stringValue(logicalName))
+}
+
+// exportTemplateOf converts a certificate template to its exported form, referring to metadata fields by name.
+func exportTemplateOf(template keyfactor.ModelsTemplateRetrievalResponse, metadataNames map[int32]string) exportTemplate {
+	var out exportTemplate
+	_ = convertViaJSON(template, &out)
+	out.TemplateName = template.GetTemplateName()
+	for i := range out.EnrollmentFields {
+		out.EnrollmentFields[i].Id = nil
+		out.EnrollmentFields[i].AdditionalProperties = nil
+	}
+	for i := range out.TemplateRegexes {
+		out.TemplateRegexes[i].TemplateId = nil
+		out.TemplateRegexes[i].AdditionalProperties = nil
+	}
+	for i := range out.TemplateDefaults {
+		out.TemplateDefaults[i].AdditionalProperties = nil
+	}
+	if out.TemplatePolicy != nil {
+		out.TemplatePolicy.TemplateId = nil
+		out.TemplatePolicy.AdditionalProperties = nil
+	}
+	out.MetadataFields = nil
+	for _, field := range template.MetadataFields {
+		out.MetadataFields = append(
+			out.MetadataFields, exportTemplateMetadataField{
+				MetadataField: metadataNames[field.GetMetadataId()],
+				DefaultValue:  field.DefaultValue,
+				Validation:    field.Validation,
+				Enrollment:    field.Enrollment,
+				Message:       field.Message,
+			},
+		)
+	}
+	return out
+}
+
+// templateUpdateRequest builds the request to make an existing template match an exported one. metadataNames holds
+// the metadata fields of the target.
+func templateUpdateRequest(
+	template exportTemplate,
+	current keyfactor.ModelsTemplateRetrievalResponse,
+	metadataNames map[int32]string,
+) (keyfactor.ModelsTemplateUpdateRequest, error) {
+	var req keyfactor.ModelsTemplateUpdateRequest
+	if err := convertViaJSON(template, &req); err != nil {
+		return req, err
+	}
+	// the names are not part of the request, and would be sent as additional properties
+	req.AdditionalProperties = nil
+	req.Id = current.Id
+	for i, field := range req.EnrollmentFields {
+		for _, c := range current.EnrollmentFields {
+			if c.GetName() == field.GetName() {
+				req.EnrollmentFields[i].Id = c.Id
+			}
+		}
+	}
+	for i := range req.TemplateRegexes {
+		req.TemplateRegexes[i].TemplateId = current.Id
+	}
+	if req.TemplatePolicy != nil {
+		req.TemplatePolicy.TemplateId = current.Id
+	}
+	req.MetadataFields = nil
+	for _, field := range template.MetadataFields {
+		metadataId, ok := referenceID(metadataNames, field.MetadataField)
+		if !ok {
+			return req, fmt.Errorf("metadata field %q doesn't exist on the target", field.MetadataField)
+		}
+		reqField := keyfactor.ModelsTemplateUpdateRequestTemplateMetadataFieldModel{
+			MetadataId:   &metadataId,
+			DefaultValue: field.DefaultValue,
+			Validation:   field.Validation,
+			Enrollment:   field.Enrollment,
+			Message:      field.Message,
+		}
+		for _, c := range current.MetadataFields {
+			if c.GetMetadataId() == metadataId {
+				reqField.Id = c.Id
+			}
+		}
+		req.MetadataFields = append(req.MetadataFields, reqField)
+	}
+	return req, nil
+}
+
+// exportAPISecret converts a secret of the API to its exported form.
+func exportAPISecret(secret *keyfactor.ModelsKeyfactorAPISecret, pamProviders map[int]string) *exportStoreSecret {
+	switch {
+	case secret == nil:
+		return nil
+	case secret.Provider != nil:
+		out := &exportStoreSecret{PamProvider: pamProviders[int(*secret.Provider)]}
+		if secret.Parameters != nil {
+			out.Parameters = *secret.Parameters
+		}
+		return out
+	case secret.GetSecretValue() != "":
+		return &exportStoreSecret{Value: exportSecretPlaceholder}
+	}
+	return nil
+}
+
+// importAPISecret converts an exported secret to the format of the API. Placeholders are left out, so existing
+// secrets are kept.
+func importAPISecret(secret *exportStoreSecret, pamProviders map[int]string) (*keyfactor.ModelsKeyfactorAPISecret, error) {
+	switch {
+	case secret == nil || secret.Value == exportSecretPlaceholder:
+		return nil, nil
+	case secret.PamProvider != "":
+		providerId, ok := referenceID(pamProviders, secret.PamProvider)
+		if !ok {
+			return nil, fmt.Errorf("PAM provider %q doesn't exist on the target", secret.PamProvider)
+		}
+		id := int32(providerId)
+		parameters := secret.Parameters
+		return &keyfactor.ModelsKeyfactorAPISecret{Provider: &id, Parameters: &parameters}, nil
+	}
+	value := secret.Value
+	return &keyfactor.ModelsKeyfactorAPISecret{SecretValue: &value}, nil
+}
+
+// exportCertificateAuthorityOf converts a certificate authority to its exported form. The authentication certificate
+// is a secret, only whether one is set is exported.
+func exportCertificateAuthorityOf(
+	ca keyfactor.ModelsCertificateAuthoritiesCertificateAuthorityResponse,
+	refs storeReferences,
+) exportCertificateAuthority {
+	var out exportCertificateAuthority
+	_ = convertViaJSON(ca, &out)
+	if ca.Agent != nil {
+		agent := refs.Agents[*ca.Agent]
+		out.Agent = &agent
+	}
+	out.ExplicitPassword = exportAPISecret(ca.ExplicitPassword, refs.PamProviders)
+	out.AuthCertificate, out.AuthCertificatePassword = nil, nil
+	if ca.AuthCertificate != nil {
+		out.AuthCertificate = &exportStoreSecret{Value: exportSecretPlaceholder}
+		out.AuthCertificatePassword = &exportStoreSecret{Value: exportSecretPlaceholder}
+	}
+	return out
+}
+
+// certificateAuthorityRequest builds the request to create or update an exported certificate authority on the
+// target, resolving the names it refers to.
+func certificateAuthorityRequest(
+	ca exportCertificateAuthority,
+	refs storeReferences,
+) (keyfactor.ModelsCertificateAuthoritiesCertificateAuthorityRequest, error) {
+	var req keyfactor.ModelsCertificateAuthoritiesCertificateAuthorityRequest
+	if err := convertViaJSON(ca, &req); err != nil {
+		return req, err
+	}
+	req.AdditionalProperties = nil
+	if ca.Agent != nil && *ca.Agent != "" {
+		agentId, ok := referenceID(refs.Agents, *ca.Agent)
+		if !ok {
+			return req, fmt.Errorf("orchestrator %q isn't registered on the target", *ca.Agent)
+		}
+		req.Agent = &agentId
+	}
+	var err error
+	if req.ExplicitPassword, err = importAPISecret(ca.ExplicitPassword, refs.PamProviders); err != nil {
+		return req, err
+	}
+	if req.AuthCertificate, err = importAPISecret(ca.AuthCertificate, refs.PamProviders); err != nil {
+		return req, err
+	}
+	if req.AuthCertificatePassword, err = importAPISecret(ca.AuthCertificatePassword, refs.PamProviders); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// exportExpirationAlert is an expiration alert that refers to its collection by name.
+type exportExpirationAlert struct {
+	DisplayName            string                                                                 `json:"DisplayName"`
+	Subject                string                                                                 `json:"Subject"`
+	Message                string                                                                 `json:"Message"`
+	ExpirationWarningDays  int32                                                                  `json:"ExpirationWarningDays"`
+	CollectionName         string                                                                 `json:"CollectionName,omitempty"`
+	RegisteredEventHandler *keyfactor.KeyfactorApiModelsEventHandlerRegisteredEventHandlerRequest `json:"RegisteredEventHandler,omitempty"`
+	Recipients             []string                                                               `json:"Recipients,omitempty"`
+	EventHandlerParameters []keyfactor.KeyfactorApiModelsEventHandlerEventHandlerParameterRequest `json:"EventHandlerParameters,omitempty"`
+}
+
+// exportTemplateAlert is an issued, denied or pending cert alert. It refers to its template by display name, which is
+// how the alert API identifies templates.
+type exportTemplateAlert struct {
+	DisplayName            string                                                                 `json:"DisplayName"`
+	Subject                string                                                                 `json:"Subject"`
+	Message                string                                                                 `json:"Message"`
+	TemplateDisplayName    string                                                                 `json:"TemplateDisplayName,omitempty"`
+	RegisteredEventHandler *keyfactor.KeyfactorApiModelsEventHandlerRegisteredEventHandlerRequest `json:"RegisteredEventHandler,omitempty"`
+	Recipients             []string                                                               `json:"Recipients,omitempty"`
+	EventHandlerParameters []keyfactor.KeyfactorApiModelsEventHandlerEventHandlerParameterRequest `json:"EventHandlerParameters,omitempty"`
+}
+
+// exportReportSchedule is a schedule of a built-in report that refers to its collection by name.
+type exportReportSchedule struct {
+	SendReport        *bool                                                 `json:"SendReport,omitempty"`
+	SaveReport        *bool                                                 `json:"SaveReport,omitempty"`
+	SaveReportPath    *string                                               `json:"SaveReportPath,omitempty"`
+	ReportFormat      *string                                               `json:"ReportFormat,omitempty"`
+	KeyfactorSchedule *keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule `json:"KeyfactorSchedule,omitempty"`
+	CollectionName    string                                                `json:"CollectionName,omitempty"`
+	EmailRecipients   []string                                              `json:"EmailRecipients,omitempty"`
+	RuntimeParameters *map[string]string                                    `json:"RuntimeParameters,omitempty"`
+}
+
+// resolveReference returns the target ID of the object a reference names, or nil when the reference is empty.
+func resolveReference(names map[int32]string, label string, name string) (*int32, error) {
+	if name == "" {
+		return nil, nil
+	}
+	id, ok := referenceID(names, name)
+	if !ok {
+		return nil, fmt.Errorf("%s %q doesn't exist on the target", label, name)
+	}
+	return &id, nil
+}
+
+// exportExpirationAlertOf converts an expiration alert to its exported form, referring to its collection by name.
+func exportExpirationAlertOf(
+	alert keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertDefinitionResponse,
+) (exportExpirationAlert, error) {
+	var out exportExpirationAlert
+	if err := convertViaJSON(alert, &out); err != nil {
+		return out, err
+	}
+	if alert.CertificateQuery != nil {
+		out.CollectionName = alert.CertificateQuery.GetName()
+	}
+	return out, nil
+}
+
+// exportTemplateAlertOf converts an issued, denied or pending cert alert, whose definitions share their fields, to
+// its exported form.
+func exportTemplateAlertOf(alert interface{}) (exportTemplateAlert, error) {
+	var out exportTemplateAlert
+	if err := convertViaJSON(alert, &out); err != nil {
+		return out, err
+	}
+	var definition struct {
+		Template *struct {
+			DisplayName string `json:"DisplayName"`
+		} `json:"Template"`
+	}
+	if err := convertViaJSON(alert, &definition); err != nil {
+		return out, err
+	}
+	if definition.Template != nil {
+		out.TemplateDisplayName = definition.Template.DisplayName
+	}
+	return out, nil
+}
+
+// expirationAlertRequest converts an exported expiration alert into a create or update request of the alert API,
+// with the ID of its collection on the target.
+func expirationAlertRequest(alert exportExpirationAlert, collections map[int32]string, req interface{}) error {
+	collectionId, err := resolveReference(collections, "collection", alert.CollectionName)
+	if err != nil {
+		return err
+	}
+	state := importStateOf(alert)
+	delete(state, "CollectionName")
+	if collectionId != nil {
+		state["CertificateQueryId"] = *collectionId
+	}
+	return convertViaJSON(state, req)
+}
+
+// templateAlertRequest converts an exported issued, denied or pending cert alert into a create or update request of
+// the alert API, with the ID of its template on the target.
+func templateAlertRequest(alert exportTemplateAlert, templates map[int32]string, req interface{}) error {
+	templateId, err := resolveReference(templates, "certificate template", alert.TemplateDisplayName)
+	if err != nil {
+		return err
+	}
+	state := importStateOf(alert)
+	delete(state, "TemplateDisplayName")
+	if templateId != nil {
+		state["TemplateId"] = *templateId
+	}
+	return convertViaJSON(state, req)
+}
+
+// exportReportOf converts a built-in report to its exported form. Report parameters are identified by name, and
+// schedules refer to their collection by name.
+func exportReportOf(report keyfactor.ModelsReport, collections map[int32]string) (exportModelsReport, error) {
+	var out exportModelsReport
+	if err := convertViaJSON(report, &out); err != nil {
+		return out, err
+	}
+	for i := range out.ReportParameter {
+		out.ReportParameter[i].Id = nil
+	}
+	out.Schedules = nil
+	for _, schedule := range report.Schedules {
+		var exported exportReportSchedule
+		if err := convertViaJSON(schedule, &exported); err != nil {
+			return out, err
+		}
+		if schedule.CertificateCollectionId != nil {
+			exported.CollectionName = collections[*schedule.CertificateCollectionId]
+		}
+		out.Schedules = append(out.Schedules, exported)
+	}
+	return out, nil
+}
+
+// listCollectionNames returns the names of the collections of an instance by ID.
+func listCollectionNames(kfClient *keyfactor.APIClient) (map[int32]string, error) {
+	collections, err := listCertificateCollections(kfClient, "")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int32]string)
+	for _, collection := range collections {
+		names[collection.GetId()] = collection.GetName()
+	}
+	return names, nil
+}
+
+// listTemplateSummaries lists the certificate templates of an instance without their enrollment settings.
+func listTemplateSummaries(kfClient *keyfactor.APIClient) ([]keyfactor.ModelsTemplateCollectionRetrievalResponse, error) {
+	templates, httpResp, reqErr := kfClient.TemplateApi.TemplateGetTemplates(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Execute()
+	if reqErr != nil {
+		return nil, returnHttpErr(httpResp, reqErr)
+	}
+	return templates, nil
+}
+
+// listTemplateDisplayNames returns the display names of the certificate templates of an instance by ID.
+func listTemplateDisplayNames(kfClient *keyfactor.APIClient) (map[int32]string, error) {
+	templates, err := listTemplateSummaries(kfClient)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int32]string)
+	for _, template := range templates {
+		names[template.GetId()] = template.GetDisplayName()
+	}
+	return names, nil
+}
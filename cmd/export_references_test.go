@@ -0,0 +1,291 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPamParam(id int32, name string, dataType int32, instanceLevel bool) keyfactor.CSSCMSDataModelModelsProviderTypeParam {
+	return keyfactor.CSSCMSDataModelModelsProviderTypeParam{
+		Id:            &id,
+		Name:          &name,
+		DataType:      &dataType,
+		InstanceLevel: &instanceLevel,
+	}
+}
+
+func Test_ExportPamProvider(t *testing.T) {
+	host, password, secretId := "https://vault", "hunter2", "42"
+	hostParam := testPamParam(1, "Host", 1, false)
+	passwordParam := testPamParam(2, "Password", pamParamDataTypeSecret, false)
+	secretIdParam := testPamParam(3, "SecretId", 1, true)
+	typeName := "Delinea-SecretServer"
+	provider := keyfactor.CSSCMSDataModelModelsProvider{
+		Name:         "Vault",
+		ProviderType: keyfactor.CSSCMSDataModelModelsProviderType{Name: &typeName},
+		ProviderTypeParamValues: []keyfactor.CSSCMSDataModelModelsPamProviderTypeParamValue{
+			{Value: &host, ProviderTypeParam: &hostParam},
+			{Value: &password, ProviderTypeParam: &passwordParam},
+			{Value: &secretId, ProviderTypeParam: &secretIdParam},
+		},
+		AdditionalProperties: map[string]interface{}{"Remote": true},
+	}
+
+	exported := exportPamProviderOf(provider)
+	assert.Equal(
+		t, exportPamProvider{
+			Name:         "Vault",
+			ProviderType: typeName,
+			Remote:       true,
+			Parameters:   map[string]string{"Host": host, "Password": exportSecretPlaceholder},
+		}, exported,
+	)
+
+	// the target type has other IDs, and returns its parameters as Parameters
+	typeId := "guid"
+	targetType := keyfactor.CSSCMSDataModelModelsProviderType{
+		Id:   &typeId,
+		Name: &typeName,
+		AdditionalProperties: map[string]interface{}{
+			"Parameters": []interface{}{
+				map[string]interface{}{"Id": 11.0, "Name": "Host", "DataType": 1.0, "InstanceLevel": false},
+				map[string]interface{}{"Id": 12.0, "Name": "Password", "DataType": 2.0, "InstanceLevel": false},
+			},
+		},
+	}
+	req, err := pamProviderRequest(exported, targetType)
+	assert.NoError(t, err)
+	assert.Equal(t, &typeId, req.ProviderType.Id)
+	assert.Len(t, req.ProviderTypeParamValues, 1)
+	assert.Equal(t, int32(11), req.ProviderTypeParamValues[0].ProviderTypeParam.GetId())
+	assert.Equal(t, host, req.ProviderTypeParamValues[0].GetValue())
+
+	exported.Parameters["Unknown"] = "x"
+	_, err = pamProviderRequest(exported, targetType)
+	assert.EqualError(t, err, `PAM provider type "Delinea-SecretServer" has no parameter "Unknown"`)
+}
+
+func Test_CertificateStoreRequest(t *testing.T) {
+	source := storeReferences{
+		StoreTypes:   map[int]string{5: "K8SSecret"},
+		Containers:   map[int]string{2: "Clusters"},
+		Agents:       map[string]string{"agent-a": "orchestrator.example.com"},
+		PamProviders: map[int]string{7: "Vault"},
+	}
+	store := api.GetCertificateStoreResponse{
+		Id:            "store-a",
+		ContainerId:   2,
+		ClientMachine: "cluster1",
+		StorePath:     "ns/secret",
+		CertStoreType: 5,
+		Approved:      true,
+		AgentId:       "agent-a",
+		Properties: map[string]interface{}{
+			"KubeNamespace": "ns",
+			"ServerUsername": map[string]interface{}{
+				"IsManaged":  true,
+				"ProviderId": 7.0,
+				"ProviderTypeParameterValues": []interface{}{
+					map[string]interface{}{"Value": "42", "ProviderTypeParam": map[string]interface{}{"Name": "SecretId"}},
+				},
+			},
+			"ServerPassword": map[string]interface{}{"IsManaged": false, "Value": "token"},
+		},
+	}
+
+	exported := exportCertificateStoreOf(store, source)
+	assert.Equal(t, "cluster1/ns/secret (K8SSecret)", storeKey(exported))
+	assert.Equal(t, "Clusters", exported.ContainerName)
+	assert.Equal(t, "orchestrator.example.com", exported.Agent)
+	assert.Equal(
+		t,
+		exportStoreSecret{PamProvider: "Vault", Parameters: map[string]string{"SecretId": "42"}},
+		exported.Properties["ServerUsername"],
+	)
+	assert.Equal(t, exportStoreSecret{Value: exportSecretPlaceholder}, exported.Properties["ServerPassword"])
+	assert.Nil(t, exported.Password)
+
+	// the target has other IDs, and the export is read back from JSON
+	target := storeReferences{
+		StoreTypes:   map[int]string{9: "K8SSecret"},
+		Containers:   map[int]string{4: "Clusters"},
+		Agents:       map[string]string{"agent-b": "orchestrator.example.com"},
+		PamProviders: map[int]string{3: "Vault"},
+	}
+	var read exportCertificateStore
+	assert.NoError(t, convertViaJSON(exported, &read))
+	req, err := certificateStoreRequest(read, target, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, req.CertStoreType)
+	assert.Equal(t, 4, *req.ContainerId)
+	assert.Equal(t, "agent-b", req.AgentId)
+	assert.Equal(t, "ns", req.Properties["KubeNamespace"])
+	assert.Equal(
+		t,
+		map[string]interface{}{"Value": map[string]interface{}{"Provider": 3, "Parameters": map[string]string{"SecretId": "42"}}},
+		req.Properties["ServerUsername"],
+	)
+	assert.Equal(
+		t,
+		map[string]interface{}{"Value": map[string]interface{}{"SecretValue": nil}},
+		req.Properties["ServerPassword"],
+	)
+
+	// placeholders keep the current secret of an existing store
+	req, err = certificateStoreRequest(read, target, store.Properties)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string]interface{}{"Value": map[string]interface{}{"SecretValue": "token"}},
+		req.Properties["ServerPassword"],
+	)
+
+	delete(target.Containers, 4)
+	_, err = certificateStoreRequest(read, target, nil)
+	assert.EqualError(t, err, `certificate store container "Clusters" doesn't exist on the target`)
+	delete(target.PamProviders, 3)
+	read.ContainerName = ""
+	_, err = certificateStoreRequest(read, target, nil)
+	assert.EqualError(t, err, `PAM provider "Vault" doesn't exist on the target`)
+}
+
+func Test_ExportStoreType(t *testing.T) {
+	properties := []api.StoreTypePropertyDefinition{{StoreTypeID: 5, Name: "KubeNamespace"}}
+	storeType := api.CertificateStoreType{ShortName: "K8SSecret", StoreType: 5, Properties: &properties}
+
+	exported := exportStoreTypeOf(storeType)
+	assert.Equal(t, 0, exported.StoreType)
+	assert.Equal(t, 0, (*exported.Properties)[0].StoreTypeID)
+	assert.Equal(t, 5, properties[0].StoreTypeID)
+}
+
+func Test_TemplateUpdateRequest(t *testing.T) {
+	name, regex, sourceId, metadataId := "WebServer", "^.*\\.example\\.com$", int32(12), int32(4)
+	subject, defaultValue := "CN", "ops"
+	fieldName, fieldId := "Environment", int32(30)
+	template := keyfactor.ModelsTemplateRetrievalResponse{
+		Id:           &sourceId,
+		TemplateName: &name,
+		EnrollmentFields: []keyfactor.ModelsTemplateRetrievalResponseTemplateEnrollmentFieldModel{
+			{Id: &fieldId, Name: &fieldName, Options: []string{"dev", "prod"}},
+		},
+		MetadataFields: []keyfactor.ModelsTemplateRetrievalResponseTemplateMetadataFieldModel{
+			{MetadataId: &metadataId, DefaultValue: &defaultValue},
+		},
+		TemplateRegexes: []keyfactor.ModelsTemplateRetrievalResponseTemplateRegexModel{
+			{TemplateId: &sourceId, SubjectPart: &subject, Regex: &regex},
+		},
+	}
+
+	exported := exportTemplateOf(template, map[int32]string{metadataId: "Owner"})
+	assert.Equal(t, "WebServer", exported.TemplateName)
+	assert.Equal(t, []exportTemplateMetadataField{{MetadataField: "Owner", DefaultValue: &defaultValue}}, exported.MetadataFields)
+	assert.Nil(t, exported.TemplateRegexes[0].TemplateId)
+	assert.Nil(t, exported.EnrollmentFields[0].Id)
+
+	targetId, targetMetadataId, targetFieldId, linkId := int32(40), int32(8), int32(77), int32(5)
+	current := keyfactor.ModelsTemplateRetrievalResponse{
+		Id:           &targetId,
+		TemplateName: &name,
+		EnrollmentFields: []keyfactor.ModelsTemplateRetrievalResponseTemplateEnrollmentFieldModel{
+			{Id: &targetFieldId, Name: &fieldName},
+		},
+		MetadataFields: []keyfactor.ModelsTemplateRetrievalResponseTemplateMetadataFieldModel{
+			{Id: &linkId, MetadataId: &targetMetadataId},
+		},
+	}
+	req, err := templateUpdateRequest(exported, current, map[int32]string{targetMetadataId: "Owner"})
+	assert.NoError(t, err)
+	assert.Equal(t, targetId, req.GetId())
+	assert.Nil(t, req.AdditionalProperties)
+	assert.Equal(t, targetFieldId, req.EnrollmentFields[0].GetId())
+	assert.Equal(t, targetId, req.TemplateRegexes[0].GetTemplateId())
+	assert.Equal(t, targetMetadataId, req.MetadataFields[0].GetMetadataId())
+	assert.Equal(t, linkId, req.MetadataFields[0].GetId())
+	assert.Equal(t, defaultValue, req.MetadataFields[0].GetDefaultValue())
+
+	_, err = templateUpdateRequest(exported, current, map[int32]string{})
+	assert.EqualError(t, err, `metadata field "Owner" doesn't exist on the target`)
+}
+
+func Test_CertificateAuthorityRequest(t *testing.T) {
+	host, logicalName, agent, user, password := "ca.example.com", "Issuing CA", "agent-a", "svc", "hunter2"
+	ca := keyfactor.ModelsCertificateAuthoritiesCertificateAuthorityResponse{
+		HostName:         &host,
+		LogicalName:      &logicalName,
+		Agent:            &agent,
+		ExplicitUser:     &user,
+		ExplicitPassword: &keyfactor.ModelsKeyfactorAPISecret{SecretValue: &password},
+	}
+	exported := exportCertificateAuthorityOf(ca, storeReferences{Agents: map[string]string{agent: "orchestrator"}})
+	assert.Equal(t, "ca.example.com\\Issuing CA", caKey(exported.HostName, exported.LogicalName))
+	assert.Equal(t, "orchestrator", *exported.Agent)
+	assert.Equal(t, &exportStoreSecret{Value: exportSecretPlaceholder}, exported.ExplicitPassword)
+	assert.Nil(t, exported.AuthCertificate)
+
+	req, err := certificateAuthorityRequest(exported, storeReferences{Agents: map[string]string{"agent-b": "orchestrator"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-b", req.GetAgent())
+	assert.Equal(t, user, req.GetExplicitUser())
+	assert.Nil(t, req.ExplicitPassword)
+	assert.Nil(t, req.AdditionalProperties)
+
+	_, err = certificateAuthorityRequest(exported, storeReferences{})
+	assert.EqualError(t, err, `orchestrator "orchestrator" isn't registered on the target`)
+}
+
+func Test_AlertReferences(t *testing.T) {
+	name, templateName, templateId := "Issued", "Web Server", int32(7)
+	issued := keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertDefinitionResponse{
+		Id:          &templateId,
+		DisplayName: &name,
+		Template:    &keyfactor.KeyfactorApiModelsAlertsAlertTemplateAlertTemplateResponse{Id: &templateId, DisplayName: &templateName},
+	}
+	exported, err := exportTemplateAlertOf(issued)
+	assert.NoError(t, err)
+	assert.Equal(t, exportTemplateAlert{DisplayName: "Issued", TemplateDisplayName: "Web Server"}, exported)
+
+	var req keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest
+	assert.NoError(t, templateAlertRequest(exported, map[int32]string{12: "Web Server"}, &req))
+	assert.Equal(t, int32(12), req.GetTemplateId())
+	assert.Equal(t, "Issued", req.DisplayName)
+	err = templateAlertRequest(exported, map[int32]string{}, &req)
+	assert.EqualError(t, err, `certificate template "Web Server" doesn't exist on the target`)
+
+	collection, days := "PKI-Web", int32(30)
+	expiration := keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertDefinitionResponse{
+		DisplayName:           &name,
+		ExpirationWarningDays: &days,
+		CertificateQuery:      &keyfactor.KeyfactorApiModelsAlertsAlertCertificateQueryAlertCertificateQueryResponse{Name: &collection},
+	}
+	exportedExpiration, err := exportExpirationAlertOf(expiration)
+	assert.NoError(t, err)
+	assert.Equal(t, "PKI-Web", exportedExpiration.CollectionName)
+
+	var update keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertUpdateRequest
+	assert.NoError(t, expirationAlertRequest(exportedExpiration, map[int32]string{3: "PKI-Web"}, &update))
+	assert.Equal(t, int32(3), update.GetCertificateQueryId())
+	assert.Equal(t, days, update.ExpirationWarningDays)
+
+	exportedExpiration.CollectionName = ""
+	update = keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertUpdateRequest{}
+	assert.NoError(t, expirationAlertRequest(exportedExpiration, nil, &update))
+	assert.Nil(t, update.CertificateQueryId)
+}
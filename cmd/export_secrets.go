@@ -0,0 +1,450 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Encrypted values are written as ENC[<base64 of nonce and sealed value>], so the other fields of an export stay
+// readable. The key that encrypts them is written to the export encrypted with age, once for the recipients and once
+// for the passphrase, so age-keygen identities can decrypt it and age -d can read it.
+const (
+	exportEncryptedPrefix = "ENC["
+	exportEncryptedSuffix = "]"
+	exportPassphraseEnv   = "KFUTIL_EXPORT_PASSPHRASE"
+)
+
+// exportScryptLogN is the scrypt work factor of passphrases, the one age uses.
+var exportScryptLogN = 18
+
+// exportSecretFields lists the fields of each kind that hold secrets or recipients, as paths of JSON keys. * stands
+// for every key of a map, and lists are walked element by element. The secrets of stores, PAM providers and CAs
+// aren't listed, they are always exported as placeholders.
+var exportSecretFields = map[string][]string{
+	"expiration_alert":    {"Recipients", "EventHandlerParameters.DefaultValue"},
+	"issued_alert":        {"Recipients", "EventHandlerParameters.DefaultValue"},
+	"denied_alert":        {"Recipients", "EventHandlerParameters.DefaultValue"},
+	"pending_alert":       {"Recipients", "EventHandlerParameters.DefaultValue"},
+	"workflow_definition": {"Steps.ConfigurationParameters.*.*"},
+	"built_in_report":     {"Schedules.EmailRecipients"},
+	"custom_report":       {"CustomURL"},
+}
+
+// exportEncryption holds the key of the encrypted secrets of an export, each as an armored age file.
+type exportEncryption struct {
+	// Recipients is the key encrypted to the age recipients given to the export.
+	Recipients string `json:"recipients,omitempty" yaml:"recipients,omitempty"`
+	// Passphrase is the key encrypted with the export passphrase.
+	Passphrase string `json:"passphrase,omitempty" yaml:"passphrase,omitempty"`
+
+	secretKey []byte
+}
+
+// newExportEncryption makes a new key for the secrets of an export and encrypts it to the age recipients and with
+// the passphrase. Either may be empty, but not both.
+func newExportEncryption(recipients []string, passphrase string) (*exportEncryption, error) {
+	if len(recipients) == 0 && passphrase == "" {
+		return nil, fmt.Errorf("a passphrase or recipient is required to encrypt secrets")
+	}
+	enc := &exportEncryption{secretKey: make([]byte, chacha20poly1305.KeySize)}
+	if _, err := rand.Read(enc.secretKey); err != nil {
+		return nil, err
+	}
+	if len(recipients) > 0 {
+		var parsed []age.Recipient
+		for _, recipient := range recipients {
+			r, err := age.ParseX25519Recipient(recipient)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient %q", recipient)
+			}
+			parsed = append(parsed, r)
+		}
+		var err error
+		if enc.Recipients, err = wrapExportKey(enc.secretKey, parsed...); err != nil {
+			return nil, err
+		}
+	}
+	if passphrase != "" {
+		// age only allows a passphrase as the single recipient of a file
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		r.SetWorkFactor(exportScryptLogN)
+		if enc.Passphrase, err = wrapExportKey(enc.secretKey, r); err != nil {
+			return nil, err
+		}
+	}
+	return enc, nil
+}
+
+// wrapExportKey encrypts the key of the secrets of an export to age recipients, as an armored age file.
+func wrapExportKey(key []byte, recipients ...age.Recipient) (string, error) {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write(key); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	if err = armored.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func unwrapExportKey(wrapped string, identities ...age.Identity) ([]byte, error) {
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(wrapped)), identities...)
+	if err != nil {
+		return nil, err
+	}
+	key, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("invalid key length %d", len(key))
+	}
+	return key, nil
+}
+
+// exportSecretAD returns the associated data of an encrypted value, which binds it to the field and the object it
+// was exported from, so a value copied to another field or object doesn't decrypt.
+func exportSecretAD(kind string, key string, path string) []byte {
+	return []byte(kind + "\x00" + key + "\x00" + path)
+}
+
+// encryptSecrets encrypts the secret fields of every object of an export in place, and records the encrypted key in
+// the export.
+func encryptSecrets(out *outJson, enc *exportEncryption) error {
+	aead, err := chacha20poly1305.NewX(enc.secretKey)
+	if err != nil {
+		return err
+	}
+
+	raw := importStateOf(out)
+	for _, kind := range exportKinds {
+		keyed := kind.objects(*out)
+		objects, _ := raw[kind.Field].([]interface{})
+		for i := range objects {
+			encrypt := func(path string, value string) (string, error) {
+				if value == "" || value == exportSecretPlaceholder || isEncryptedSecret(value) {
+					return value, nil
+				}
+				nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+				if _, rErr := rand.Read(nonce); rErr != nil {
+					return "", rErr
+				}
+				sealed := aead.Seal(nonce, nonce, []byte(value), exportSecretAD(kind.Kind, keyed[i].Key, path))
+				return exportEncryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + exportEncryptedSuffix, nil
+			}
+			for _, path := range exportSecretFields[kind.Kind] {
+				if objects[i], err = walkSecretField(objects[i], strings.Split(path, "."), "", encrypt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	var encrypted outJson
+	if err := convertViaJSON(raw, &encrypted); err != nil {
+		return err
+	}
+	encrypted.Encryption = enc
+	*out = encrypted
+	return nil
+}
+
+// walkSecretField replaces the string values found at a path of JSON keys, passing the path of each value in the
+// form walkAllStrings uses.
+func walkSecretField(
+	value interface{},
+	path []string,
+	at string,
+	replace func(path string, value string) (string, error),
+) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			if v[i], err = walkSecretField(v[i], path, fmt.Sprintf("%s[%d]", at, i), replace); err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		if len(path) == 0 {
+			return replace(at, v)
+		}
+	case map[string]interface{}:
+		if len(path) == 0 {
+			break
+		}
+		for key := range v {
+			if path[0] == "*" || path[0] == key {
+				field := key
+				if at != "" {
+					field = at + "." + key
+				}
+				if v[key], err = walkSecretField(v[key], path[1:], field, replace); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return value, nil
+}
+
+func isEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, exportEncryptedPrefix) && strings.HasSuffix(value, exportEncryptedSuffix)
+}
+
+// hasEncryptedSecrets reports whether an exported object holds encrypted values.
+func hasEncryptedSecrets(obj interface{}) bool {
+	found := false
+	_, _ = walkAllStrings(importStateOf(obj), "", func(_ string, value string) (string, error) {
+		found = found || isEncryptedSecret(value)
+		return value, nil
+	})
+	return found
+}
+
+// walkAllStrings replaces every string value of a JSON value, passing the path of the value to replace.
+func walkAllStrings(
+	value interface{},
+	path string,
+	replace func(path string, value string) (string, error),
+) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case string:
+		return replace(path, v)
+	case []interface{}:
+		for i := range v {
+			if v[i], err = walkAllStrings(v[i], fmt.Sprintf("%s[%d]", path, i), replace); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			if v[key], err = walkAllStrings(v[key], field, replace); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
+
+// exportSecretKeys decrypts the keys of encrypted exports with the age identities and passphrase given to an import.
+// The passphrase is only asked for when a key can't be decrypted with the identities.
+type exportSecretKeys struct {
+	Identities []age.Identity
+	Passphrase func() (string, error)
+
+	passphrase age.Identity
+	secretKeys map[string][]byte
+}
+
+// readAgeIdentities reads the age X25519 identities of identity files, which hold one identity per line and may hold
+// comments.
+func readAgeIdentities(paths []string) ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed, pErr := age.ParseIdentities(f)
+		f.Close()
+		if pErr != nil {
+			return nil, fmt.Errorf("%s holds an invalid age identity", path)
+		}
+		identities = append(identities, parsed...)
+	}
+	return identities, nil
+}
+
+// secretKey decrypts the key of the secrets of an encrypted export.
+func (keys *exportSecretKeys) secretKey(enc *exportEncryption) ([]byte, error) {
+	// exports written together share their key
+	id := enc.Recipients + enc.Passphrase
+	if key, ok := keys.secretKeys[id]; ok {
+		return key, nil
+	}
+
+	if enc.Recipients != "" && len(keys.Identities) > 0 {
+		if key, err := unwrapExportKey(enc.Recipients, keys.Identities...); err == nil {
+			return keys.remember(id, key), nil
+		}
+	}
+	if enc.Passphrase != "" && keys.Passphrase != nil {
+		if keys.passphrase == nil {
+			passphrase, err := keys.Passphrase()
+			if err != nil {
+				return nil, err
+			}
+			identity, err := age.NewScryptIdentity(passphrase)
+			if err != nil {
+				return nil, err
+			}
+			keys.passphrase = identity
+		}
+		if key, err := unwrapExportKey(enc.Passphrase, keys.passphrase); err == nil {
+			return keys.remember(id, key), nil
+		}
+	}
+	return nil, fmt.Errorf("none of the given identities or passphrase can decrypt the secrets of the export")
+}
+
+func (keys *exportSecretKeys) remember(id string, key []byte) []byte {
+	if keys.secretKeys == nil {
+		keys.secretKeys = make(map[string][]byte)
+	}
+	keys.secretKeys[id] = key
+	return key
+}
+
+// decrypt replaces the encrypted values of an exported object of a kind, in its JSON form, by their plain values.
+// The key is only decrypted when the object holds encrypted values.
+func (keys *exportSecretKeys) decrypt(enc *exportEncryption, kind exportKind, obj interface{}) error {
+	var aead cipher.AEAD
+	var objKey string
+	_, err := walkAllStrings(obj, "", func(path string, value string) (string, error) {
+		if !isEncryptedSecret(value) {
+			return value, nil
+		}
+		if aead == nil {
+			secretKey, err := keys.secretKey(enc)
+			if err != nil {
+				return "", err
+			}
+			if aead, err = chacha20poly1305.NewX(secretKey); err != nil {
+				return "", err
+			}
+			if objKey, err = kind.keyOf(obj); err != nil {
+				return "", err
+			}
+		}
+		plain, err := openSecret(aead, value, exportSecretAD(kind.Kind, objKey, path))
+		if err != nil {
+			return "", fmt.Errorf("unable to decrypt %s: %s", path, err)
+		}
+		return plain, nil
+	})
+	return err
+}
+
+func openSecret(aead cipher.AEAD, value string, ad []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value[len(exportEncryptedPrefix) : len(value)-len(exportEncryptedSuffix)])
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], ad)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// promptSecretPlaceholders asks for the values of the secrets that were exported as placeholders, for the objects
+// of the selected kinds. Placeholders are kept when no value is given.
+func promptSecretPlaceholders(out *outJson, selected func(flag string) bool, prompt func(name string) string) error {
+	raw := importStateOf(out)
+	for _, kind := range exportKinds {
+		if !selected(kind.Flag) {
+			continue
+		}
+		keyed := kind.objects(*out)
+		objects, _ := raw[kind.Field].([]interface{})
+		for i := range objects {
+			var err error
+			objects[i], err = walkAllStrings(objects[i], "", func(path string, value string) (string, error) {
+				if value != exportSecretPlaceholder {
+					return value, nil
+				}
+				if given := prompt(fmt.Sprintf("%s of %s %q", path, kind.Label, keyed[i].Key)); given != "" {
+					return given, nil
+				}
+				return value, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	var prompted outJson
+	if err := convertViaJSON(raw, &prompted); err != nil {
+		return err
+	}
+	*out = prompted
+	return nil
+}
+
+// exportPassphrase returns the passphrase of encrypted exports from the environment, or asks for it.
+func exportPassphrase() (string, error) {
+	if passphrase := os.Getenv(exportPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase := promptForInteractivePassword("export passphrase", "")
+	if passphrase == "" {
+		return "", fmt.Errorf("no export passphrase given, set %s or enter one", exportPassphraseEnv)
+	}
+	return passphrase, nil
+}
+
+// decryptExportObject decrypts an object of a kind read from an export when it holds encrypted values and keys are
+// given, returning its JSON.
+func decryptExportObject(keys *exportSecretKeys, enc *exportEncryption, kind exportKind, spec []byte) ([]byte, error) {
+	if keys == nil || enc == nil || !bytes.Contains(spec, []byte(exportEncryptedPrefix)) {
+		return spec, nil
+	}
+	var obj interface{}
+	if err := json.Unmarshal(spec, &obj); err != nil {
+		return nil, err
+	}
+	if err := keys.decrypt(enc, kind, obj); err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAgeIdentity returns a new age X25519 identity and its recipient.
+func testAgeIdentity(t *testing.T) (*age.X25519Identity, string) {
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	return identity, identity.Recipient().String()
+}
+
+func Test_ExportSecretsRoundTrip(t *testing.T) {
+	logN := exportScryptLogN
+	exportScryptLogN = 10
+	defer func() { exportScryptLogN = logN }()
+
+	identity, recipient := testAgeIdentity(t)
+	_, otherRecipient := testAgeIdentity(t)
+	out := outJson{
+		SchemaVersion:    exportSchemaVersion,
+		ExpirationAlerts: []exportExpirationAlert{{DisplayName: "Soon", Recipients: []string{"ops@example.com", ""}}},
+		MetadataFields:   []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest{{Name: "Owner"}},
+		CustomReports: []keyfactor.ModelsCustomReportCreationRequest{
+			{DisplayName: "Audit", CustomURL: "https://reports.example.com/audit?token=hunter2"},
+		},
+		Stores: []exportCertificateStore{
+			{
+				StoreType:     "K8SSecret",
+				ClientMachine: "cluster1",
+				StorePath:     "ns/secret",
+				Properties: map[string]interface{}{
+					"ServerPassword": map[string]interface{}{"Value": exportSecretPlaceholder},
+					"KubeNamespace":  "ns",
+				},
+			},
+		},
+	}
+	enc, err := newExportEncryption([]string{recipient, otherRecipient}, "correct horse")
+	assert.NoError(t, err)
+	assert.Contains(t, enc.Recipients, "-----BEGIN AGE ENCRYPTED FILE-----")
+	assert.Contains(t, enc.Passphrase, "-----BEGIN AGE ENCRYPTED FILE-----")
+	assert.NoError(t, encryptSecrets(&out, enc))
+
+	assert.Equal(t, "Soon", out.ExpirationAlerts[0].DisplayName)
+	assert.True(t, isEncryptedSecret(out.ExpirationAlerts[0].Recipients[0]))
+	assert.Equal(t, "", out.ExpirationAlerts[0].Recipients[1])
+	assert.True(t, isEncryptedSecret(out.CustomReports[0].CustomURL))
+	properties := out.Stores[0].Properties
+	assert.Equal(t, exportSecretPlaceholder, properties["ServerPassword"].(map[string]interface{})["Value"])
+	assert.Equal(t, "ns", properties["KubeNamespace"])
+
+	file := filepath.Join(t.TempDir(), "export.json")
+	data, err := json.Marshal(out)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(file, data, 0600))
+
+	read, err := readExport(file, &exportSecretKeys{Identities: []age.Identity{identity}})
+	assert.NoError(t, err)
+	assert.Nil(t, read.Encryption)
+	assert.Equal(t, []string{"ops@example.com", ""}, read.ExpirationAlerts[0].Recipients)
+	assert.Equal(t, "https://reports.example.com/audit?token=hunter2", read.CustomReports[0].CustomURL)
+
+	asked := 0
+	passphrase := func() (string, error) {
+		asked++
+		return "correct horse", nil
+	}
+	read, err = readExport(file, &exportSecretKeys{Passphrase: passphrase})
+	assert.NoError(t, err)
+	assert.Equal(t, "ops@example.com", read.ExpirationAlerts[0].Recipients[0])
+	assert.Equal(t, 1, asked)
+
+	wrong := func() (string, error) { return "wrong", nil }
+	_, err = readExport(file, &exportSecretKeys{Passphrase: wrong})
+	assert.ErrorContains(t, err, "none of the given identities or passphrase can decrypt the secrets of the export")
+
+	read, err = readExport(file, nil)
+	assert.NoError(t, err)
+	assert.True(t, isEncryptedSecret(read.ExpirationAlerts[0].Recipients[0]))
+
+	// in a directory export only the files of objects with encrypted values carry the wrapped key
+	dir := t.TempDir()
+	all := func(string) bool { return true }
+	assert.NoError(t, exportToDir(out, dir, exportDirFormatYAML, all, nil))
+	alert, err := os.ReadFile(filepath.Join(dir, "expiration-alerts", "Soon.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(alert), "encryption:\n  recipients: |\n    -----BEGIN AGE ENCRYPTED FILE-----\n")
+	field, err := os.ReadFile(filepath.Join(dir, "metadata-fields", "Owner.yaml"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(field), "encryption")
+
+	read, err = readExport(dir, &exportSecretKeys{Identities: []age.Identity{identity}})
+	assert.NoError(t, err)
+	assert.Equal(t, "ops@example.com", read.ExpirationAlerts[0].Recipients[0])
+	assert.Equal(t, "https://reports.example.com/audit?token=hunter2", read.CustomReports[0].CustomURL)
+
+	_, err = newExportEncryption(nil, "")
+	assert.EqualError(t, err, "a passphrase or recipient is required to encrypt secrets")
+	_, err = newExportEncryption([]string{"age1invalid"}, "")
+	assert.EqualError(t, err, `invalid age recipient "age1invalid"`)
+}
+
+func Test_ExportSecretsBoundToField(t *testing.T) {
+	identity, recipient := testAgeIdentity(t)
+	out := outJson{
+		SchemaVersion: exportSchemaVersion,
+		ExpirationAlerts: []exportExpirationAlert{
+			{DisplayName: "Ops", Recipients: []string{"ops@example.com"}},
+			{DisplayName: "Sec", Recipients: []string{"sec@example.com"}},
+		},
+	}
+	enc, err := newExportEncryption([]string{recipient}, "")
+	assert.NoError(t, err)
+	assert.NoError(t, encryptSecrets(&out, enc))
+
+	// a value moved to another object doesn't decrypt
+	alerts := out.ExpirationAlerts
+	alerts[0].Recipients, alerts[1].Recipients = alerts[1].Recipients, alerts[0].Recipients
+	file := filepath.Join(t.TempDir(), "export.json")
+	data, err := json.Marshal(out)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(file, data, 0600))
+	_, err = readExport(file, &exportSecretKeys{Identities: []age.Identity{identity}})
+	assert.ErrorContains(t, err, "unable to decrypt Recipients[0]")
+}
+
+func Test_ReadAgeIdentities(t *testing.T) {
+	identity, _ := testAgeIdentity(t)
+	path := filepath.Join(t.TempDir(), "key.txt")
+	content := "# created: 2024-01-01T00:00:00Z\n# public key: age1...\n" + identity.String() + "\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	identities, err := readAgeIdentities([]string{path})
+	assert.NoError(t, err)
+	assert.Len(t, identities, 1)
+	assert.Equal(t, identity.String(), identities[0].(*age.X25519Identity).String())
+
+	assert.NoError(t, os.WriteFile(path, []byte("not a key\n"), 0600))
+	_, err = readAgeIdentities([]string{path})
+	assert.EqualError(t, err, path+" holds an invalid age identity")
+}
+
+func Test_PromptSecretPlaceholders(t *testing.T) {
+	out := outJson{
+		PamProviders: []exportPamProvider{
+			{Name: "Vault", Parameters: map[string]string{"Host": "vault", "Token": exportSecretPlaceholder}},
+		},
+		Stores: []exportCertificateStore{
+			{StoreType: "PEM", ClientMachine: "web1", StorePath: "/certs", Password: &exportStoreSecret{Value: exportSecretPlaceholder}},
+		},
+	}
+	var asked []string
+	prompt := func(name string) string {
+		asked = append(asked, name)
+		if strings.HasPrefix(name, "Parameters.Token") {
+			return "s.token"
+		}
+		return ""
+	}
+	selected := func(flag string) bool { return flag == "pam-providers" || flag == "stores" }
+
+	assert.NoError(t, promptSecretPlaceholders(&out, selected, prompt))
+	assert.Equal(
+		t,
+		[]string{`Parameters.Token of PAM provider "Vault"`, `Password.Value of certificate store "web1//certs (PEM)"`},
+		asked,
+	)
+	assert.Equal(t, "s.token", out.PamProviders[0].Parameters["Token"])
+	assert.Equal(t, exportSecretPlaceholder, out.Stores[0].Password.Value)
+}
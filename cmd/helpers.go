@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -181,6 +182,26 @@ func getCurrentTime(f string) string {
 	}
 }
 
+// parseDayDuration parses a duration that may also be given in days or weeks, e.g. 30d or 2w, as well as any value
+// accepted by time.ParseDuration.
+func parseDayDuration(value string) (time.Duration, error) {
+	v := strings.TrimSpace(strings.ToLower(value))
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(v, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q, use a number of days (30d), weeks (2w) or hours (72h)", value)
+	}
+	return d, nil
+}
+
 func informDebug(debugFlag bool) {
 	debugModeEnabled := checkDebug(debugFlag)
 	if debugModeEnabled {
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
 	"github.com/Keyfactor/keyfactor-go-client/v3/api"
@@ -27,38 +29,65 @@ import (
 	"github.com/spf13/cobra"
 )
 
-type Body struct {
-	ErrorCode string
-	Message   string
-}
-
-func parseError(error io.ReadCloser) string {
-	log.Debug().Msgf("%s: parseError", DebugFuncEnter)
-
-	log.Debug().Msg("Reading error body")
-	bytes, ioErr := io.ReadAll(error)
-	if ioErr != nil {
-		fmt.Printf("Error: %s\n", ioErr)
-		log.Error().Err(ioErr).Send()
-		return ioErr.Error()
-	}
-	var newError Body
-	jErr := json.Unmarshal(bytes, &newError)
-	if jErr != nil {
-		fmt.Printf("Error: %s\n", jErr)
-		log.Error().Err(jErr).Send()
-		return jErr.Error()
-	}
-	log.Debug().Msgf("%s: parseError", DebugFuncExit)
-	return newError.Message
-}
-
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Keyfactor instance import utilities.",
-	Long:  `A collection of APIs and utilities for importing Keyfactor instance data.`,
+	Long: `A collection of APIs and utilities for importing Keyfactor instance data.
+
+Objects are matched with the target instance by name. New objects are created, objects that already exist with the
+same settings are skipped, and --on-conflict decides what happens to objects that exist with different settings:
+skip leaves them alone, overwrite updates them, rename creates the imported object under a new name and fail stops
+the import before anything is changed. Built-in reports and certificate templates always exist and are updated
+whenever they differ, security roles only have their identities updated. Template updates apply the enrollment fields, metadata field
+settings, regexes, defaults and policy of the exported template.
+
+Store types are imported first, then containers and PAM providers, then the certificate stores that refer to them by
+name. Certificate stores are matched by client machine, store path and store type, certificate authorities by host
+and logical name. Containers can't be created through the API and must already exist on the target, as must the
+orchestrators of stores and CAs. Secrets that were exported as placeholders are left empty on new objects and
+unchanged on existing ones.
+
+Objects refer to each other by name rather than by the IDs of the exporting instance: alerts to their collection or
+certificate template, workflow definitions to their template, templates to their metadata fields. Dependencies are
+imported before the objects that use them, and an object whose dependency neither exists on the target nor is part
+of the import is reported as an error in the plan and left out.
+
+Security roles are exported with the identities they are assigned to, AD users and groups as DOMAIN\name and OAuth
+clients by client ID. Identities that don't exist on the target are created before the roles are assigned to them.
+Use --map-identities with a CSV file of source,target account names to translate identities between environments,
+for example CORP\PKI Admins,LAB\PKI Admins. Names are matched regardless of case, identities that aren't listed are
+kept as they are and an empty target leaves the identity out.
+
+Use --file to read a single JSON file written by 'kfutil export --file', or --dir to read a directory written by
+'kfutil export --dir'. Exports written by a newer kfutil are refused, older ones are migrated to the current schema
+version when they are read.
+
+Use --include and --exclude to import only some of the exported objects, for example the alerts and reports of one
+team. Each takes [<kind>=]<pattern> and may be repeated. The kind is an entity flag such as collections or a folder
+of a directory export such as custom-reports, and applies the filter to every kind when left out. Patterns match
+whole names and are globs, or regular expressions when enclosed in slashes, and a leading ! turns a filter around.
+An object is imported when it matches an include filter of its kind, if there are any, and no exclude filter. An
+entity flag also takes an optional pattern of its own, --collections 'PKI-*' is short for --collections --include
+'collections=PKI-*'. Filters match names only, objects can't be selected by tag or other fields.
+
+Secrets encrypted by 'kfutil export --encrypt-secrets' are decrypted with the age identities of --identity, or with
+the passphrase of the KFUTIL_EXPORT_PASSPHRASE environment variable, which is asked for when it isn't set. Use
+--prompt-secrets to enter the secrets that were exported as placeholders, those left empty keep their placeholder.
+
+Use --dry-run to print the plan, with the changed fields of existing objects, without changing anything. A summary is
+printed at the end, use --format json to get the plan and results as JSON.`,
+	Example: `kfutil import --file export.json --all --dry-run
+kfutil import --file export.json --collections --metadata --on-conflict overwrite
+kfutil import --file export.json --store-types --containers --pam-providers --stores
+kfutil import --file export.json --metadata --templates --dry-run
+kfutil import --dir ./kf-config --all --on-conflict overwrite
+kfutil import --dir ./kf-config --security-roles --map-identities identities.csv --dry-run
+kfutil import --dir ./kf-config --all --include 'expiration-alerts=PKI-*' --include 'custom-reports=PKI-*'
+kfutil import --dir ./kf-config --collections 'PKI-*' --expiration-alerts 'PKI-*' --dry-run`,
+	Args: exportEntityArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Debug().Msgf("%s: importCmd", DebugFuncEnter)
+		cmd.SilenceUsage = true
 		isExperimental := true
 
 		informDebug(debugFlag)
@@ -67,39 +96,63 @@ var importCmd = &cobra.Command{
 			return debugErr
 		}
 
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+		if !slices.Contains(importConflictModes, onConflict) {
+			return fmt.Errorf(
+				"invalid --on-conflict value %q, must be one of %s",
+				onConflict,
+				strings.Join(importConflictModes, ", "),
+			)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		filters, fErr := exportFiltersOf(cmd)
+		if fErr != nil {
+			return fErr
+		}
+		identityFiles, _ := cmd.Flags().GetStringArray("identity")
+		identities, iErr := readAgeIdentities(identityFiles)
+		if iErr != nil {
+			return iErr
+		}
+		promptSecrets, _ := cmd.Flags().GetBool("prompt-secrets")
+
 		log.Info().Msg("Running import...")
 
 		exportPath := cmd.Flag("file").Value.String()
-		log.Debug().Str("exportPath", exportPath).Msg("exportPath")
-
+		if dir := cmd.Flag("dir").Value.String(); dir != "" {
+			exportPath = dir
+		}
 		log.Debug().Str("exportPath", exportPath).
-			Msg("Reading exported file")
+			Msg("Reading export")
 
-		jsonFile, oErr := os.Open(exportPath)
-		if oErr != nil {
-			fmt.Printf("Error opening exported file: %s\n", oErr)
-			//log.Fatalf("Error: %s", oErr)
+		keys := &exportSecretKeys{Identities: identities, Passphrase: exportPassphrase}
+		out, rErr := readExport(exportPath, keys)
+		if rErr != nil {
 			log.Error().
 				Str("exportPath", exportPath).
-				Err(oErr).
+				Err(rErr).
 				Send()
+			return fmt.Errorf("error reading export: %s", rErr)
 		}
-		defer jsonFile.Close()
-		var out outJson
-		bJson, ioErr := io.ReadAll(jsonFile)
-		if ioErr != nil {
-			fmt.Printf("Error reading exported file: %s\n", ioErr)
-			//log.Fatalf("Error: %s", ioErr)
-			log.Error().Err(ioErr).Send()
-			return ioErr
-		}
-		jErr := json.Unmarshal(bJson, &out)
-		if jErr != nil {
-			fmt.Printf("Error reading exported file: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send()
-			return jErr
+		filterExport(&out, filters)
+		if mapPath, _ := cmd.Flags().GetString("map-identities"); mapPath != "" {
+			mapping, mErr := readIdentityMap(mapPath)
+			if mErr != nil {
+				return mErr
+			}
+			out.SecurityRoles = mapRoleIdentities(out.SecurityRoles, mapping)
 		}
+
+		selected := func(flag string) bool {
+			return cmd.Flag("all").Value.String() == "true" || cmd.Flag(flag).Value.String() == "true"
+		}
+		if promptSecrets {
+			prompt := func(name string) string { return promptForInteractivePassword(name, "") }
+			if pErr := promptSecretPlaceholders(&out, selected, prompt); pErr != nil {
+				return pErr
+			}
+		}
+
 		log.Debug().Msgf("%s: initGenClient", DebugFuncCall)
 		kfClient, clientErr := initGenClient(false)
 		log.Debug().Msgf("%s: initClient", DebugFuncExit)
@@ -113,231 +166,566 @@ var importCmd = &cobra.Command{
 			return oldClientErr
 		}
 
-		if cmd.Flag("all").Value.String() == "true" {
-			log.Debug().Msgf("%s: importCollections", DebugFuncCall)
-			importCollections(out.Collections, kfClient)
-			log.Debug().Msgf("%s: importMetadataFields", DebugFuncCall)
-			importMetadataFields(out.MetadataFields, kfClient)
-
-			log.Debug().Msgf("%s: importIssuedCertAlerts", DebugFuncCall)
-			importIssuedCertAlerts(out.IssuedCertAlerts, kfClient)
-
-			log.Debug().Msgf("%s: importDeniedCertAlerts", DebugFuncCall)
-			importDeniedCertAlerts(out.DeniedCertAlerts, kfClient)
+		log.Debug().Msgf("%s: planImport", DebugFuncCall)
+		entities := importEntities(out, selected, kfClient, oldkfClient)
+		plan := planImport(entities, onConflict, newImportTargets(kfClient, oldkfClient))
+		conflicts := summarizeImport(plan).Conflict
 
-			log.Debug().Msgf("%s: importPendingCertAlerts", DebugFuncCall)
-			importPendingCertAlerts(out.PendingCertAlerts, kfClient)
-
-			log.Debug().Msgf("%s: importNetworks", DebugFuncCall)
-			importNetworks(out.Networks, kfClient)
-
-			log.Debug().Msgf("%s: importWorkflowDefinitions", DebugFuncCall)
-			importWorkflowDefinitions(out.WorkflowDefinitions, kfClient)
-
-			log.Debug().Msgf("%s: importBuiltInReports", DebugFuncCall)
-			importBuiltInReports(out.BuiltInReports, kfClient)
-
-			log.Debug().Msgf("%s: importCustomReports", DebugFuncCall)
-			importCustomReports(out.CustomReports, kfClient)
-
-			log.Debug().Msgf("%s: importSecurityRoles", DebugFuncCall)
-			importSecurityRoles(out.SecurityRoles, oldkfClient)
-		} else {
-			if len(out.Collections) != 0 && cmd.Flag("collections").Value.String() == "true" {
-				log.Debug().Msgf("%s: importCollections", DebugFuncCall)
-				importCollections(out.Collections, kfClient)
-			}
-			if len(out.MetadataFields) != 0 && cmd.Flag("metadata").Value.String() == "true" {
-				log.Debug().Msgf("%s: importMetadataFields", DebugFuncCall)
-				importMetadataFields(out.MetadataFields, kfClient)
-			}
-			if len(out.IssuedCertAlerts) != 0 && cmd.Flag("issued-alerts").Value.String() == "true" {
-				log.Debug().Msgf("%s: importIssuedCertAlerts", DebugFuncCall)
-				importIssuedCertAlerts(out.IssuedCertAlerts, kfClient)
-			}
-			if len(out.DeniedCertAlerts) != 0 && cmd.Flag("denied-alerts").Value.String() == "true" {
-				log.Debug().Msgf("%s: importDeniedCertAlerts", DebugFuncCall)
-				importDeniedCertAlerts(out.DeniedCertAlerts, kfClient)
-			}
-			if len(out.PendingCertAlerts) != 0 && cmd.Flag("pending-alerts").Value.String() == "true" {
-				log.Debug().Msgf("%s: importPendingCertAlerts", DebugFuncCall)
-				importPendingCertAlerts(out.PendingCertAlerts, kfClient)
-			}
-			if len(out.Networks) != 0 && cmd.Flag("networks").Value.String() == "true" {
-				log.Debug().Msgf("%s: importNetworks", DebugFuncCall)
-				importNetworks(out.Networks, kfClient)
-			}
-			if len(out.WorkflowDefinitions) != 0 && cmd.Flag("workflow-definitions").Value.String() == "true" {
-				log.Debug().Msgf("%s: importWorkflowDefinitions", DebugFuncCall)
-				importWorkflowDefinitions(out.WorkflowDefinitions, kfClient)
-			}
-			if len(out.BuiltInReports) != 0 && cmd.Flag("reports").Value.String() == "true" {
-				log.Debug().Msgf("%s: importBuiltInReports", DebugFuncCall)
-				importBuiltInReports(out.BuiltInReports, kfClient)
-			}
-			if len(out.CustomReports) != 0 && cmd.Flag("reports").Value.String() == "true" {
-				log.Debug().Msgf("%s: importCustomReports", DebugFuncCall)
-				importCustomReports(out.CustomReports, kfClient)
+		var w io.Writer = os.Stdout
+		if outputFormat == "json" {
+			w = nil
+		}
+		if dryRun || conflicts > 0 {
+			if w != nil {
+				printImportPlan(w, plan)
 			}
-			if len(out.SecurityRoles) != 0 && cmd.Flag("security-roles").Value.String() == "true" {
-				log.Debug().Msgf("%s: importSecurityRoles", DebugFuncCall)
-				importSecurityRoles(out.SecurityRoles, oldkfClient)
+		} else {
+			log.Debug().Msgf("%s: applyImportPlan", DebugFuncCall)
+			applyImportPlan(plan, w)
+		}
+
+		report := importReport{DryRun: dryRun, OnConflict: onConflict, Objects: plan, Summary: summarizeImport(plan)}
+		if outputFormat == "json" {
+			mOut, mErr := json.MarshalIndent(report, "", "  ")
+			if mErr != nil {
+				return mErr
 			}
+			outputResult(string(mOut), outputFormat)
+		} else {
+			printImportSummary(os.Stdout, report.Summary)
 		}
+
 		log.Debug().Msgf("%s: importCmd", DebugFuncExit)
+		if conflicts > 0 {
+			return fmt.Errorf("%d objects already exist with different settings, nothing was imported", conflicts)
+		}
+		if report.Summary.Failed > 0 {
+			return fmt.Errorf("%d objects failed to import", report.Summary.Failed)
+		}
 		return nil
 	},
 }
 
-func importCollections(
+// newImportTargets looks up the natural keys of the objects that exist on the target, listing each kind once.
+func newImportTargets(kfClient *keyfactor.APIClient, oldkfClient *api.Client) importTargets {
+	listed := make(map[string]map[string]bool)
+	storeRefs := lazyStoreReferences(kfClient, oldkfClient)
+	return func(kind string, name string) (bool, error) {
+		if _, ok := listed[kind]; !ok {
+			names, err := listImportTargets(kind, kfClient, storeRefs)
+			if err != nil {
+				return false, err
+			}
+			listed[kind] = names
+		}
+		return listed[kind][name], nil
+	}
+}
+
+// listImportTargets returns the natural keys of the objects of one kind that exist on the target.
+func listImportTargets(
+	kind string,
+	kfClient *keyfactor.APIClient,
+	storeRefs func() (storeReferences, error),
+) (map[string]bool, error) {
+	switch kind {
+	case "collection":
+		names, err := listCollectionNames(kfClient)
+		return importNameSet(names), err
+	case "metadata_field":
+		names, err := listMetadataFieldNames(kfClient)
+		return importNameSet(names), err
+	case "template", importReferenceTemplateDisplayName:
+		templates, err := listTemplateSummaries(kfClient)
+		names := make(map[string]bool)
+		for _, template := range templates {
+			if kind == "template" {
+				names[template.GetTemplateName()] = true
+			} else {
+				names[template.GetDisplayName()] = true
+			}
+		}
+		return names, err
+	}
+	refs, err := storeRefs()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "store_type":
+		return importNameSet(refs.StoreTypes), nil
+	case "container":
+		return importNameSet(refs.Containers), nil
+	case "orchestrator":
+		return importNameSet(refs.Agents), nil
+	case "pam_provider":
+		return importNameSet(refs.PamProviders), nil
+	}
+	return nil, fmt.Errorf("unknown reference kind %q", kind)
+}
+
+func importNameSet[K comparable](names map[K]string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// importEntities describes the exported entities selected by the import flags, in the order they are imported. Objects
+// are imported after the objects they refer to, so that the references of an import can be resolved on the target.
+func importEntities(
+	out outJson,
+	selected func(flag string) bool,
+	kfClient *keyfactor.APIClient,
+	oldkfClient *api.Client,
+) []importEntity {
+	var entities []importEntity
+	if selected("collections") {
+		entities = append(entities, collectionImportEntity(out.Collections, kfClient))
+	}
+	if selected("metadata") {
+		entities = append(entities, metadataFieldImportEntity(out.MetadataFields, kfClient))
+	}
+	// alerts refer to collections and templates, reports to collections
+	if selected("expiration-alerts") {
+		entities = append(entities, expirationAlertImportEntity(out.ExpirationAlerts, kfClient))
+	}
+	if selected("issued-alerts") {
+		entities = append(entities, issuedAlertImportEntity(out.IssuedCertAlerts, kfClient))
+	}
+	if selected("denied-alerts") {
+		entities = append(entities, deniedAlertImportEntity(out.DeniedCertAlerts, kfClient))
+	}
+	if selected("pending-alerts") {
+		entities = append(entities, pendingAlertImportEntity(out.PendingCertAlerts, kfClient))
+	}
+	if selected("networks") {
+		entities = append(entities, networkImportEntity(out.Networks, kfClient))
+	}
+	if selected("workflow-definitions") {
+		entities = append(entities, workflowDefinitionImportEntity(out.WorkflowDefinitions, kfClient))
+	}
+	if selected("reports") {
+		entities = append(entities, builtInReportImportEntity(out.BuiltInReports, kfClient))
+		entities = append(entities, customReportImportEntity(out.CustomReports, kfClient))
+	}
+	if selected("security-roles") {
+		// roles are assigned to identities, which are created first
+		entities = append(entities, securityIdentityImportEntity(out.SecurityRoles, oldkfClient))
+		entities = append(entities, securityRoleImportEntity(out.SecurityRoles, kfClient, oldkfClient))
+	}
+	// stores refer to store types, containers and PAM providers, which are imported first
+	if selected("store-types") {
+		entities = append(entities, storeTypeImportEntity(out.StoreTypes, oldkfClient))
+	}
+	if selected("containers") {
+		entities = append(entities, containerImportEntity(out.Containers, oldkfClient))
+	}
+	if selected("pam-providers") {
+		entities = append(entities, pamProviderImportEntity(out.PamProviders, kfClient))
+	}
+	if selected("stores") {
+		entities = append(entities, storeImportEntity(out.Stores, kfClient, oldkfClient))
+	}
+	if selected("cas") {
+		entities = append(entities, caImportEntity(out.CertificateAuthorities, kfClient, oldkfClient))
+	}
+	// templates refer to metadata fields
+	if selected("templates") {
+		entities = append(entities, templateImportEntity(out.Templates, kfClient))
+	}
+	return entities
+}
+
+func collectionImportEntity(
 	collections []keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest,
 	kfClient *keyfactor.APIClient,
-) {
+) importEntity {
+	entity := importEntity{Kind: "collection", Label: "collection"}
 	for _, collection := range collections {
+		entity.Objects = append(entity.Objects, importObject{Name: collection.Name, Body: collection})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		collections, err := listCertificateCollections(kfClient, "")
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, collection := range collections {
+			// the query is exported from Content
+			state := importStateOf(collection)
+			state["Query"] = state["Content"]
+			existing[collection.GetName()] = importExisting{Object: &collection, State: state}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		collection := obj.Body.(keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest)
+		collection.Name = name
 		_, httpResp, reqErr := kfClient.CertificateCollectionApi.
 			CertificateCollectionCreateCollection(context.Background()).
 			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
 			Request(collection).
 			XKeyfactorApiVersion(XKeyfactorApiVersion).
 			Execute()
-		name, jmErr := json.Marshal(collection.Name)
-		if jmErr != nil {
-			fmt.Printf("Error: %s\n", jmErr)
-			//log.Fatalf("Error: %s", jmErr)
-			log.Error().Err(jmErr).Send()
-		}
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create collection %s - %s%s\n",
-				ColorRed,
-				string(name),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-		} else {
-			n, jnErr := json.Marshal(collection.Name)
-			if jnErr != nil {
-				fmt.Printf("Error: %s\n", jnErr)
-				//log.Fatalf("Error: %s", jnErr)
-				log.Error().Err(jnErr).Send()
-			}
-			fmt.Println("Added", string(n), "to collections")
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
 		}
+		return nil
 	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		var collection keyfactor.KeyfactorApiModelsCertificateCollectionsCertificateCollectionUpdateRequest
+		if err := convertViaJSON(obj.Body, &collection); err != nil {
+			return err
+		}
+		collection.Id = existing.Object.(*keyfactor.ModelsCertificateQuery).GetId()
+		_, httpResp, reqErr := kfClient.CertificateCollectionApi.
+			CertificateCollectionUpdateCollection(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Request(collection).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
-func importMetadataFields(
+func metadataFieldImportEntity(
 	metadataFields []keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest,
 	kfClient *keyfactor.APIClient,
-) {
+) importEntity {
+	entity := importEntity{Kind: "metadata_field", Label: "metadata field"}
 	for _, metadata := range metadataFields {
+		entity.Objects = append(entity.Objects, importObject{Name: metadata.Name, Body: metadata})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		fields, err := listMetadataFields(kfClient)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, field := range fields {
+			existing[field.GetName()] = importExisting{Object: &field, State: importStateOf(field)}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		metadata := obj.Body.(keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest)
+		metadata.Name = name
 		_, httpResp, reqErr := kfClient.MetadataFieldApi.MetadataFieldCreateMetadataField(context.Background()).
 			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
 			MetadataFieldType(metadata).
 			XKeyfactorApiVersion(XKeyfactorApiVersion).
 			Execute()
-		n, jmErr := json.Marshal(metadata.Name)
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		var metadata keyfactor.KeyfactorApiModelsMetadataFieldMetadataFieldUpdateRequest
+		if err := convertViaJSON(obj.Body, &metadata); err != nil {
+			return err
+		}
+		metadata.Id = existing.Object.(*keyfactor.ModelsMetadataFieldTypeModel).GetId()
+		_, httpResp, reqErr := kfClient.MetadataFieldApi.MetadataFieldUpdateMetadataField(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			MetadataFieldType(metadata).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
+}
 
+func expirationAlertImportEntity(alerts []exportExpirationAlert, kfClient *keyfactor.APIClient) importEntity {
+	entity := importEntity{Kind: "expiration_alert", Label: "expiration alert"}
+	entity.References = func(obj importObject) []importReference {
+		alert := obj.Body.(exportExpirationAlert)
+		return []importReference{{Kind: "collection", Label: "collection", Name: alert.CollectionName}}
+	}
+	for _, alert := range alerts {
+		entity.Objects = append(entity.Objects, importObject{Name: alert.DisplayName, Body: alert})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		alerts, httpResp, reqErr := kfClient.ExpirationAlertApi.ExpirationAlertGetExpirationAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
 		if reqErr != nil {
-			if jmErr != nil {
-				fmt.Printf("Error: %s\n", jmErr)
-				//log.Fatalf("Error: %s", jmErr)
-				log.Error().Err(jmErr).Send()
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, alert := range alerts {
+			exported, err := exportExpirationAlertOf(alert)
+			if err != nil {
+				return nil, err
 			}
-			log.Error().Err(reqErr).Send()
-			fmt.Printf(
-				"%s Error! Unable to create metadata field type %s - %s%s\n",
-				ColorRed,
-				string(n),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-		} else {
-			log.Info().Msgf("Added %s to metadata field types.", string(n))
-			fmt.Println("Added", string(n), "to metadata field types.")
+			existing[alert.GetDisplayName()] = importExisting{Object: &alert, State: importStateOf(exported)}
 		}
+		return existing, nil
 	}
+	collections := lazyNames(func() (map[int32]string, error) { return listCollectionNames(kfClient) })
+	entity.Create = func(obj importObject, name string) error {
+		targetCollections, cErr := collections()
+		if cErr != nil {
+			return cErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertCreationRequest
+		if err := expirationAlertRequest(obj.Body.(exportExpirationAlert), targetCollections, &alert); err != nil {
+			return err
+		}
+		alert.DisplayName = name
+		_, httpResp, reqErr := kfClient.ExpirationAlertApi.ExpirationAlertAddExpirationAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		targetCollections, cErr := collections()
+		if cErr != nil {
+			return cErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertUpdateRequest
+		if err := expirationAlertRequest(obj.Body.(exportExpirationAlert), targetCollections, &alert); err != nil {
+			return err
+		}
+		alert.Id = existing.Object.(*keyfactor.KeyfactorApiModelsAlertsExpirationExpirationAlertDefinitionResponse).Id
+		_, httpResp, reqErr := kfClient.ExpirationAlertApi.ExpirationAlertEditExpirationAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
-func importIssuedCertAlerts(
-	alerts []keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest,
-	kfClient *keyfactor.APIClient,
-) {
+// importReferenceTemplateDisplayName is the kind of reference of alerts, which identify templates by display name
+// rather than by template name.
+const importReferenceTemplateDisplayName = "template_display"
+
+// templateAlertReferences lists the template of an issued, denied or pending cert alert.
+func templateAlertReferences(obj importObject) []importReference {
+	alert := obj.Body.(exportTemplateAlert)
+	return []importReference{
+		{Kind: importReferenceTemplateDisplayName, Label: "certificate template", Name: alert.TemplateDisplayName},
+	}
+}
+
+func issuedAlertImportEntity(alerts []exportTemplateAlert, kfClient *keyfactor.APIClient) importEntity {
+	entity := importEntity{Kind: "issued_alert", Label: "issued cert alert", References: templateAlertReferences}
 	for _, alert := range alerts {
+		entity.Objects = append(entity.Objects, importObject{Name: alert.DisplayName, Body: alert})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		alerts, httpResp, reqErr := kfClient.IssuedAlertApi.IssuedAlertGetIssuedAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, alert := range alerts {
+			exported, err := exportTemplateAlertOf(alert)
+			if err != nil {
+				return nil, err
+			}
+			existing[alert.GetDisplayName()] = importExisting{Object: &alert, State: importStateOf(exported)}
+		}
+		return existing, nil
+	}
+	templates := lazyNames(func() (map[int32]string, error) { return listTemplateDisplayNames(kfClient) })
+	entity.Create = func(obj importObject, name string) error {
+		targetTemplates, tErr := templates()
+		if tErr != nil {
+			return tErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertCreationRequest
+		if err := templateAlertRequest(obj.Body.(exportTemplateAlert), targetTemplates, &alert); err != nil {
+			return err
+		}
+		alert.DisplayName = name
 		_, httpResp, reqErr := kfClient.IssuedAlertApi.IssuedAlertAddIssuedAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
-		name, _ := json.Marshal(alert.DisplayName)
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create issued cert alert %s - %s%s\n",
-				ColorRed,
-				string(name),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-		} else {
-			fmt.Println("Added", string(name), "to issued cert alerts.")
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
 		}
+		return nil
 	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		targetTemplates, tErr := templates()
+		if tErr != nil {
+			return tErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertUpdateRequest
+		if err := templateAlertRequest(obj.Body.(exportTemplateAlert), targetTemplates, &alert); err != nil {
+			return err
+		}
+		alert.Id = existing.Object.(*keyfactor.KeyfactorApiModelsAlertsIssuedIssuedAlertDefinitionResponse).Id
+		_, httpResp, reqErr := kfClient.IssuedAlertApi.IssuedAlertEditIssuedAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
-func importDeniedCertAlerts(
-	alerts []keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertCreationRequest,
-	kfClient *keyfactor.APIClient,
-) {
+func deniedAlertImportEntity(alerts []exportTemplateAlert, kfClient *keyfactor.APIClient) importEntity {
+	entity := importEntity{Kind: "denied_alert", Label: "denied cert alert", References: templateAlertReferences}
 	for _, alert := range alerts {
+		entity.Objects = append(entity.Objects, importObject{Name: alert.DisplayName, Body: alert})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		alerts, httpResp, reqErr := kfClient.DeniedAlertApi.DeniedAlertGetDeniedAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, alert := range alerts {
+			exported, err := exportTemplateAlertOf(alert)
+			if err != nil {
+				return nil, err
+			}
+			existing[alert.GetDisplayName()] = importExisting{Object: &alert, State: importStateOf(exported)}
+		}
+		return existing, nil
+	}
+	templates := lazyNames(func() (map[int32]string, error) { return listTemplateDisplayNames(kfClient) })
+	entity.Create = func(obj importObject, name string) error {
+		targetTemplates, tErr := templates()
+		if tErr != nil {
+			return tErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertCreationRequest
+		if err := templateAlertRequest(obj.Body.(exportTemplateAlert), targetTemplates, &alert); err != nil {
+			return err
+		}
+		alert.DisplayName = name
 		_, httpResp, reqErr := kfClient.DeniedAlertApi.DeniedAlertAddDeniedAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
-		name, _ := json.Marshal(alert.DisplayName)
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create denied cert alert %s - %s%s\n",
-				ColorRed,
-				string(name),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-		} else {
-			fmt.Println("Added", string(name), "to denied cert alerts.")
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
 		}
+		return nil
 	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		targetTemplates, tErr := templates()
+		if tErr != nil {
+			return tErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertUpdateRequest
+		if err := templateAlertRequest(obj.Body.(exportTemplateAlert), targetTemplates, &alert); err != nil {
+			return err
+		}
+		alert.Id = existing.Object.(*keyfactor.KeyfactorApiModelsAlertsDeniedDeniedAlertDefinitionResponse).Id
+		_, httpResp, reqErr := kfClient.DeniedAlertApi.DeniedAlertEditDeniedAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
-func importPendingCertAlerts(
-	alerts []keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertCreationRequest,
-	kfClient *keyfactor.APIClient,
-) {
+func pendingAlertImportEntity(alerts []exportTemplateAlert, kfClient *keyfactor.APIClient) importEntity {
+	entity := importEntity{Kind: "pending_alert", Label: "pending cert alert", References: templateAlertReferences}
 	for _, alert := range alerts {
+		entity.Objects = append(entity.Objects, importObject{Name: alert.DisplayName, Body: alert})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		alerts, httpResp, reqErr := kfClient.PendingAlertApi.PendingAlertGetPendingAlerts(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, alert := range alerts {
+			exported, err := exportTemplateAlertOf(alert)
+			if err != nil {
+				return nil, err
+			}
+			existing[alert.GetDisplayName()] = importExisting{Object: &alert, State: importStateOf(exported)}
+		}
+		return existing, nil
+	}
+	templates := lazyNames(func() (map[int32]string, error) { return listTemplateDisplayNames(kfClient) })
+	entity.Create = func(obj importObject, name string) error {
+		targetTemplates, tErr := templates()
+		if tErr != nil {
+			return tErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertCreationRequest
+		if err := templateAlertRequest(obj.Body.(exportTemplateAlert), targetTemplates, &alert); err != nil {
+			return err
+		}
+		alert.DisplayName = name
 		_, httpResp, reqErr := kfClient.PendingAlertApi.PendingAlertAddPendingAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
-		name, _ := json.Marshal(alert.DisplayName)
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create pending cert alert %s - %s%s\n",
-				ColorRed,
-				string(name),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-		} else {
-			fmt.Println("Added", string(name), "to pending cert alerts.")
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		targetTemplates, tErr := templates()
+		if tErr != nil {
+			return tErr
+		}
+		var alert keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertUpdateRequest
+		if err := templateAlertRequest(obj.Body.(exportTemplateAlert), targetTemplates, &alert); err != nil {
+			return err
 		}
+		alert.Id = existing.Object.(*keyfactor.KeyfactorApiModelsAlertsPendingPendingAlertDefinitionResponse).Id
+		_, httpResp, reqErr := kfClient.PendingAlertApi.PendingAlertEditPendingAlert(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Req(alert).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
 	}
+	return entity
 }
 
-func importNetworks(networks []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest, kfClient *keyfactor.APIClient) {
+func networkImportEntity(
+	networks []keyfactor.KeyfactorApiModelsSslCreateNetworkRequest,
+	kfClient *keyfactor.APIClient,
+) importEntity {
+	entity := importEntity{Kind: "ssl_network", Label: "SSL network"}
 	for _, network := range networks {
+		entity.Objects = append(entity.Objects, importObject{Name: network.Name, Body: network})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		networks, httpResp, reqErr := kfClient.SslApi.SslGetNetworks(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, network := range networks {
+			existing[network.GetName()] = importExisting{Object: &network, State: importStateOf(network)}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		network := obj.Body.(keyfactor.KeyfactorApiModelsSslCreateNetworkRequest)
+		network.Name = name
 		_, httpResp, reqErr := kfClient.SslApi.SslCreateNetwork(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Network(network).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
-		name, _ := json.Marshal(network.Name)
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create SSL network %s - %s%s\n",
-				ColorRed,
-				string(name),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-		} else {
-			fmt.Println("Added", string(name), "to SSL networks.")
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
 		}
+		return nil
 	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		var network keyfactor.KeyfactorApiModelsSslUpdateNetworkRequest
+		if err := convertViaJSON(obj.Body, &network); err != nil {
+			return err
+		}
+		network.NetworkId = existing.Object.(*keyfactor.KeyfactorApiModelsSslNetworkQueryResponse).GetNetworkId()
+		_, httpResp, reqErr := kfClient.SslApi.SslUpdateNetwork(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Network(network).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
 // identify matching templates between instances by name, then return the template Id of the matching template in the import instance
@@ -358,190 +746,737 @@ func findMatchingTemplates(
 	return nil
 }
 
-func importWorkflowDefinitions(
+func workflowDefinitionImportEntity(
 	workflowDefs []exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest,
 	kfClient *keyfactor.APIClient,
-) {
+) importEntity {
+	// only the description of an existing definition can be updated, its steps are not exported
+	entity := importEntity{Kind: "workflow_definition", Label: "workflow definition", Fields: []string{"Description"}}
+	entity.References = func(obj importObject) []importReference {
+		workflowDef := obj.Body.(exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest)
+		return []importReference{{Kind: "template", Label: "certificate template", Name: stringValue(workflowDef.KeyName)}}
+	}
 	for _, workflowDef := range workflowDefs {
-		wJson, _ := json.Marshal(workflowDef)
+		entity.Objects = append(entity.Objects, importObject{Name: stringValue(workflowDef.DisplayName), Body: workflowDef})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		workflowDefs, httpResp, reqErr := kfClient.WorkflowDefinitionApi.
+			WorkflowDefinitionQuery(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, workflowDef := range workflowDefs {
+			// the query doesn't return descriptions
+			definition, dResp, dErr := kfClient.WorkflowDefinitionApi.
+				WorkflowDefinitionGet(context.Background(), workflowDef.GetId()).
+				XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+				XKeyfactorApiVersion(XKeyfactorApiVersion).
+				Execute()
+			if dErr != nil {
+				return nil, returnHttpErr(dResp, dErr)
+			}
+			existing[workflowDef.GetDisplayName()] = importExisting{Object: definition, State: importStateOf(definition)}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		workflowDef := obj.Body.(exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest)
 		var workflowDefReq keyfactor.KeyfactorApiModelsWorkflowsDefinitionCreateRequest
-		jErr := json.Unmarshal(wJson, &workflowDefReq)
-		if jErr != nil {
-			fmt.Printf("Error: %s\n", jErr)
-			//log.Fatalf("Error: %s", jErr)
-			log.Error().Err(jErr).Send()
+		if err := convertViaJSON(workflowDef, &workflowDefReq); err != nil {
+			return err
 		}
 		newTemplateId := findMatchingTemplates(workflowDef, kfClient)
 		if newTemplateId != nil {
 			workflowDefReq.Key = newTemplateId
+		} else if stringValue(workflowDef.KeyName) != "" {
+			return fmt.Errorf("certificate template %q doesn't exist on the target", *workflowDef.KeyName)
 		}
-		_, httpResp, reqErr := kfClient.WorkflowDefinitionApi. // todo: Why is the object not being used?
-									WorkflowDefinitionCreateNewDefinition(context.Background()).
-									XKeyfactorRequestedWith(XKeyfactorRequestedWith).
-									Request(workflowDefReq).
-									XKeyfactorApiVersion(XKeyfactorApiVersion).
-									Execute()
-		name, jmErr := json.Marshal(workflowDef.DisplayName)
-		if jmErr != nil {
-			fmt.Printf("Error: %s\n", jmErr)
-			//log.Fatalf("Error: %s", jmErr)
-			log.Error().Err(jmErr).Send()
-			return
-		}
-
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create workflow definition %s - %s%s\n",
-				ColorRed,
-				string(name),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-			log.Error().Err(reqErr).Send()
-		} else {
-			fmt.Println("Added", string(name), "to workflow definitions.")
-			log.Info().Msgf("Added %s to workflow definitions.", string(name))
+		workflowDefReq.DisplayName = &name
+		_, httpResp, reqErr := kfClient.WorkflowDefinitionApi.
+			WorkflowDefinitionCreateNewDefinition(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Request(workflowDefReq).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
 		}
+		return nil
 	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		workflowDef := obj.Body.(exportKeyfactorAPIModelsWorkflowsDefinitionCreateRequest)
+		definition := existing.Object.(*keyfactor.KeyfactorApiModelsWorkflowsDefinitionResponse)
+		_, httpResp, reqErr := kfClient.WorkflowDefinitionApi.
+			WorkflowDefinitionUpdateExistingDefinition(context.Background(), definition.GetId()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Request(
+				keyfactor.KeyfactorApiModelsWorkflowsDefinitionUpdateRequest{
+					DisplayName: workflowDef.DisplayName,
+					Description: workflowDef.Description,
+				},
+			).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
-// check for built-in report discrepancies between instances, return the report id of reports that need to be updated in import instance
-func checkBuiltInReportDiffs(exportedReport exportModelsReport, kfClient *keyfactor.APIClient) *int32 {
-	importInstanceReports, _, _ := kfClient.ReportsApi.ReportsQueryReports(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
-	//check if built in report was modified from default in exported instance; if modified, update built-in report in new instance
-	for _, report := range importInstanceReports {
-		importInstDispNameJson, _ := json.Marshal(report.DisplayName)
-		exportInstDispNameJson, _ := json.Marshal(exportedReport.DisplayName)
-		importInstInNavJson, _ := json.Marshal(report.InNavigator)
-		exportInstInNavJson, _ := json.Marshal(exportedReport.InNavigator)
-		importInstFavJson, _ := json.Marshal(report.Favorite)
-		exportInstFavJson, _ := json.Marshal(exportedReport.Favorite)
-		importInstRemDupJson, _ := json.Marshal(report.RemoveDuplicates)
-		exportInstRemDupJson, _ := json.Marshal(exportedReport.RemoveDuplicates)
-		var usesCollectionBool = "false"
-		if string(importInstDispNameJson) == string(exportInstDispNameJson) {
-			if (string(importInstFavJson) != string(exportInstFavJson)) || (string(importInstInNavJson) != string(exportInstInNavJson)) || (string(importInstRemDupJson) != string(exportInstRemDupJson)) {
-				usesCollectionJson, _ := json.Marshal(exportedReport.UsesCollection)
-				if string(usesCollectionJson) == usesCollectionBool {
-					return report.Id
-				}
-			}
+// built-in reports always exist, only their navigator, favorite and duplicate settings are imported, and only for
+// reports that don't use a collection
+func builtInReportImportEntity(reports []exportModelsReport, kfClient *keyfactor.APIClient) importEntity {
+	entity := importEntity{
+		Kind:       "built_in_report",
+		Label:      "built-in report",
+		Fields:     []string{"InNavigator", "Favorite", "RemoveDuplicates"},
+		UpdateOnly: true,
+	}
+	for _, report := range reports {
+		obj := importObject{Name: stringValue(report.DisplayName), Body: report}
+		if report.UsesCollection == nil || *report.UsesCollection {
+			obj.Skip = "uses a collection"
 		}
+		entity.Objects = append(entity.Objects, obj)
 	}
-	return nil
+	entity.Existing = func() (map[string]importExisting, error) {
+		reports, httpResp, reqErr := kfClient.ReportsApi.ReportsQueryReports(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, report := range reports {
+			existing[report.GetDisplayName()] = importExisting{Object: &report, State: importStateOf(report)}
+		}
+		return existing, nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		var reportReq keyfactor.ModelsReportRequestModel
+		if err := convertViaJSON(obj.Body, &reportReq); err != nil {
+			return err
+		}
+		reportReq.Id = existing.Object.(*keyfactor.ModelsReport).Id
+		_, httpResp, reqErr := kfClient.ReportsApi.
+			ReportsUpdateReport(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Request(reportReq).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
-// only imports built in reports where UsesCollections is false
-func importBuiltInReports(reports []exportModelsReport, kfClient *keyfactor.APIClient) {
+func customReportImportEntity(
+	reports []keyfactor.ModelsCustomReportCreationRequest,
+	kfClient *keyfactor.APIClient,
+) importEntity {
+	entity := importEntity{Kind: "custom_report", Label: "custom report"}
 	for _, report := range reports {
-		newReportId := checkBuiltInReportDiffs(report, kfClient)
-		if newReportId != nil {
-			rJson, _ := json.Marshal(report)
-			var reportReq keyfactor.ModelsReportRequestModel
-			jErr := json.Unmarshal(rJson, &reportReq)
-			if jErr != nil {
-				fmt.Printf("Error: %s\n", jErr)
-				//log.Fatalf("Error: %s", jErr)
-				log.Error().Err(jErr).Send()
+		entity.Objects = append(entity.Objects, importObject{Name: report.DisplayName, Body: report})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		reports, httpResp, reqErr := kfClient.ReportsApi.ReportsQueryCustomReports(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return nil, returnHttpErr(httpResp, reqErr)
+		}
+		existing := make(map[string]importExisting)
+		for _, report := range reports {
+			existing[report.GetDisplayName()] = importExisting{Object: &report, State: importStateOf(report)}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		report := obj.Body.(keyfactor.ModelsCustomReportCreationRequest)
+		report.DisplayName = name
+		_, httpResp, reqErr := kfClient.ReportsApi.ReportsCreateCustomReport(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Request(report).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		var report keyfactor.ModelsCustomReportUpdateRequest
+		if err := convertViaJSON(obj.Body, &report); err != nil {
+			return err
+		}
+		report.Id = existing.Object.(*keyfactor.ModelsCustomReport).GetId()
+		_, httpResp, reqErr := kfClient.ReportsApi.ReportsUpdateCustomReport(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Request(report).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
+}
+
+// securityRoleImportEntity creates the roles and assigns them to their identities. Only the identities of an existing
+// role are compared and updated, because its permissions can't be changed through the API.
+func securityRoleImportEntity(
+	roles []exportSecurityRole,
+	kfClient *keyfactor.APIClient,
+	oldkfClient *api.Client,
+) importEntity {
+	entity := importEntity{Kind: "security_role", Label: "security role", Fields: []string{"Identities"}}
+	for _, role := range roles {
+		entity.Objects = append(entity.Objects, importObject{Name: role.Name, Body: role})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		roles, err := oldkfClient.GetSecurityRoles()
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, role := range roles {
+			identities, iErr := listRoleIdentityNames(kfClient, role.Id)
+			if iErr != nil {
+				return nil, iErr
 			}
-			reportReq.Id = newReportId
-			_, httpResp, reqErr := kfClient.ReportsApi. //todo: Why is the object not being used?
-									ReportsUpdateReport(context.Background()).
-									XKeyfactorRequestedWith(XKeyfactorRequestedWith).
-									Request(reportReq).
-									XKeyfactorApiVersion(XKeyfactorApiVersion).
-									Execute()
-			name, jmErr := json.Marshal(report.DisplayName)
-			if jmErr != nil {
-				fmt.Printf("Error: %s\n", jmErr)
-				//log.Fatalf("Error: %s", jmErr)
-				log.Error().Err(jmErr).Send()
-				return
+			exported, eErr := exportSecurityRoleOf(role, identities)
+			if eErr != nil {
+				return nil, eErr
 			}
-			if reqErr != nil {
-				fmt.Printf(
-					"%s Error! Unable to update built-in report %s - %s%s\n",
-					ColorRed,
-					string(name),
-					parseError(httpResp.Body),
-					ColorWhite,
-				)
-				log.Error().Err(reqErr).Send()
-			} else {
-				fmt.Println("Updated", string(name), "in built-in reports.")
-				log.Info().Msgf("Updated %s in built-in reports.", string(name))
+			existing[role.Name] = importExisting{Object: &role, State: importStateOf(exported)}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		role := obj.Body.(exportSecurityRole)
+		created, err := oldkfClient.CreateSecurityRole(
+			&api.CreateSecurityRoleArg{
+				Name:        name,
+				Description: role.Description,
+				Enabled:     role.Enabled,
+				Private:     role.Private,
+				Permissions: role.Permissions,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if len(role.Identities) == 0 {
+			return nil
+		}
+		return assignRoleIdentities(kfClient, oldkfClient, created.Id, role.Identities)
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		role := obj.Body.(exportSecurityRole)
+		id := existing.Object.(*api.GetSecurityRolesResponse).Id
+		return assignRoleIdentities(kfClient, oldkfClient, id, role.Identities)
+	}
+	return entity
+}
+
+func storeTypeImportEntity(storeTypes []api.CertificateStoreType, kfClient *api.Client) importEntity {
+	entity := importEntity{Kind: "store_type", Label: "certificate store type"}
+	for _, storeType := range storeTypes {
+		entity.Objects = append(entity.Objects, importObject{Name: storeType.ShortName, Body: storeType})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		storeTypes, err := kfClient.ListCertificateStoreTypes()
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, storeType := range *storeTypes {
+			existing[storeType.ShortName] = importExisting{
+				Object: &storeType,
+				State:  importStateOf(exportStoreTypeOf(storeType)),
+			}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		storeType := obj.Body.(api.CertificateStoreType)
+		if name != storeType.ShortName {
+			storeType.Name, storeType.ShortName = name, name
+		}
+		_, err := kfClient.CreateStoreType(&storeType)
+		return err
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		storeType := obj.Body.(api.CertificateStoreType)
+		storeType.StoreType = existing.Object.(*api.CertificateStoreType).StoreType
+		_, err := kfClient.UpdateStoreType(&storeType)
+		return err
+	}
+	return entity
+}
+
+// containers can't be created or updated through the API, existing ones are only compared
+func containerImportEntity(containers []exportCertificateStoreContainer, kfClient *api.Client) importEntity {
+	entity := importEntity{Kind: "container", Label: "certificate store container"}
+	for _, container := range containers {
+		entity.Objects = append(entity.Objects, importObject{Name: container.Name, Body: container})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		storeTypes, tErr := listStoreTypeNames(kfClient)
+		if tErr != nil {
+			return nil, tErr
+		}
+		containers, err := kfClient.GetStoreContainers()
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, container := range *containers {
+			state := exportCertificateStoreContainer{
+				Name:               container.Name,
+				StoreType:          storeTypes[container.CertStoreType],
+				OverwriteSchedules: container.OverwriteSchedules,
+				Schedule:           container.Schedule,
 			}
+			existing[container.Name] = importExisting{Object: &container, State: importStateOf(state)}
 		}
+		return existing, nil
 	}
+	return entity
 }
 
-func importCustomReports(reports []keyfactor.ModelsCustomReportCreationRequest, kfClient *keyfactor.APIClient) {
-	for _, report := range reports {
-		_, httpResp, reqErr := kfClient.ReportsApi.ReportsCreateCustomReport(context.Background()).XKeyfactorRequestedWith(XKeyfactorRequestedWith).Request(report).XKeyfactorApiVersion(XKeyfactorApiVersion).Execute()
-		name, _ := json.Marshal(report.DisplayName)
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create custom report %s - %s%s\n",
-				ColorRed,
-				string(name),
-				parseError(httpResp.Body),
-				ColorWhite,
-			)
-		} else {
-			fmt.Println("Added", string(name), "to custom reports.")
+// findPamProviderType returns the PAM provider type with the given name on the target.
+func findPamProviderType(kfClient *keyfactor.APIClient, name string) (keyfactor.CSSCMSDataModelModelsProviderType, error) {
+	providerTypes, httpResp, reqErr := kfClient.PAMProviderApi.PAMProviderGetPamProviderTypes(context.Background()).
+		XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+		XKeyfactorApiVersion(XKeyfactorApiVersion).
+		Execute()
+	if reqErr != nil {
+		return keyfactor.CSSCMSDataModelModelsProviderType{}, returnHttpErr(httpResp, reqErr)
+	}
+	for _, providerType := range providerTypes {
+		if providerType.GetName() == name {
+			return providerType, nil
 		}
 	}
+	return keyfactor.CSSCMSDataModelModelsProviderType{}, fmt.Errorf("PAM provider type %q doesn't exist on the target", name)
 }
 
-func importSecurityRoles(roles []api.CreateSecurityRoleArg, kfClient *api.Client) {
-	for _, role := range roles {
-		_, reqErr := kfClient.CreateSecurityRole(&role)
-		name, _ := json.Marshal(role.Name)
-		if reqErr != nil {
-			fmt.Printf(
-				"%s Error! Unable to create security role %s - %s%s\n",
-				ColorRed,
-				string(name),
-				reqErr,
-				ColorWhite,
+func pamProviderImportEntity(providers []exportPamProvider, kfClient *keyfactor.APIClient) importEntity {
+	entity := importEntity{Kind: "pam_provider", Label: "PAM provider"}
+	for _, provider := range providers {
+		entity.Objects = append(entity.Objects, importObject{Name: provider.Name, Body: provider})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		providers, err := listPamProviders(kfClient)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, provider := range providers {
+			existing[provider.Name] = importExisting{Object: &provider, State: importStateOf(exportPamProviderOf(provider))}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		provider := obj.Body.(exportPamProvider)
+		providerType, tErr := findPamProviderType(kfClient, provider.ProviderType)
+		if tErr != nil {
+			return tErr
+		}
+		req, err := pamProviderRequest(provider, providerType)
+		if err != nil {
+			return err
+		}
+		req.Name = name
+		_, httpResp, reqErr := kfClient.PAMProviderApi.PAMProviderCreatePamProvider(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Provider(req).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		provider := obj.Body.(exportPamProvider)
+		current := existing.Object.(*keyfactor.CSSCMSDataModelModelsProvider)
+		providerType, tErr := findPamProviderType(kfClient, provider.ProviderType)
+		if tErr != nil {
+			return tErr
+		}
+		req, err := pamProviderRequest(provider, providerType)
+		if err != nil {
+			return err
+		}
+		// keep the secrets that were not exported and the instance level values of the stores using the provider
+		values := slices.Clone(current.ProviderTypeParamValues)
+		for _, value := range req.ProviderTypeParamValues {
+			i := slices.IndexFunc(
+				values, func(v keyfactor.CSSCMSDataModelModelsPamProviderTypeParamValue) bool {
+					return v.ProviderTypeParam != nil && !v.ProviderTypeParam.GetInstanceLevel() &&
+						v.ProviderTypeParam.GetName() == value.ProviderTypeParam.GetName()
+				},
 			)
-		} else {
-			fmt.Println("Added", string(name), "to security roles.")
+			if i < 0 {
+				values = append(values, value)
+				continue
+			}
+			values[i].Value = value.Value
 		}
+		req.Id = current.Id
+		req.ProviderTypeParamValues = values
+		_, httpResp, reqErr := kfClient.PAMProviderApi.PAMProviderUpdatePamProvider(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Provider(req).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
 	}
+	return entity
+}
+
+// lazyNames looks up the names of the target when they are first needed to write an object, after the objects they
+// belong to were created.
+func lazyNames(list func() (map[int32]string, error)) func() (map[int32]string, error) {
+	var names map[int32]string
+	return func() (map[int32]string, error) {
+		if names == nil {
+			loaded, err := list()
+			if err != nil {
+				return nil, err
+			}
+			names = loaded
+		}
+		return names, nil
+	}
+}
+
+// lazyStoreReferences looks up the references of the target when they are first needed to write an object, after
+// the store types and PAM providers of the import were created.
+func lazyStoreReferences(kfClient *keyfactor.APIClient, oldkfClient *api.Client) func() (storeReferences, error) {
+	var refs *storeReferences
+	return func() (storeReferences, error) {
+		if refs == nil {
+			loaded, err := loadStoreReferences(kfClient, oldkfClient)
+			if err != nil {
+				return loaded, err
+			}
+			refs = &loaded
+		}
+		return *refs, nil
+	}
+}
+
+func storeImportEntity(
+	stores []exportCertificateStore,
+	kfClient *keyfactor.APIClient,
+	oldkfClient *api.Client,
+) importEntity {
+	entity := importEntity{Kind: "store", Label: "certificate store", NoRename: true}
+	entity.References = func(obj importObject) []importReference {
+		store := obj.Body.(exportCertificateStore)
+		refs := []importReference{
+			{Kind: "store_type", Label: "certificate store type", Name: store.StoreType},
+			{Kind: "container", Label: "certificate store container", Name: store.ContainerName},
+			{Kind: "orchestrator", Label: "orchestrator", Name: store.Agent},
+		}
+		secrets := []*exportStoreSecret{store.Password}
+		names := make([]string, 0, len(store.Properties))
+		for name := range store.Properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			// secret properties are the only ones with object values
+			var secret exportStoreSecret
+			if convertViaJSON(store.Properties[name], &secret) == nil {
+				secrets = append(secrets, &secret)
+			}
+		}
+		return append(refs, pamProviderReferences(secrets...)...)
+	}
+	for _, store := range stores {
+		entity.Objects = append(entity.Objects, importObject{Name: storeKey(store), Body: store})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		refs, refErr := loadStoreReferences(kfClient, oldkfClient)
+		if refErr != nil {
+			return nil, refErr
+		}
+		stores, err := listCertificateStores(oldkfClient)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, store := range stores {
+			exported := exportCertificateStoreOf(store, refs)
+			existing[storeKey(exported)] = importExisting{Object: &store, State: importStateOf(exported)}
+		}
+		return existing, nil
+	}
+	targetRefs := lazyStoreReferences(kfClient, oldkfClient)
+	entity.Create = func(obj importObject, name string) error {
+		target, refErr := targetRefs()
+		if refErr != nil {
+			return refErr
+		}
+		req, err := certificateStoreRequest(obj.Body.(exportCertificateStore), target, nil)
+		if err != nil {
+			return err
+		}
+		_, err = oldkfClient.CreateStore(&req)
+		return err
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		target, refErr := targetRefs()
+		if refErr != nil {
+			return refErr
+		}
+		current := existing.Object.(*api.GetCertificateStoreResponse)
+		properties := current.Properties
+		if properties == nil {
+			properties = unmarshalPropertiesString(current.PropertiesString)
+		}
+		req, err := certificateStoreRequest(obj.Body.(exportCertificateStore), target, properties)
+		if err != nil {
+			return err
+		}
+		update := api.UpdateStoreFctArgs{
+			Id:                      current.Id,
+			ContainerId:             req.ContainerId,
+			ClientMachine:           req.ClientMachine,
+			StorePath:               req.StorePath,
+			CertStoreInventoryJobId: &current.CertStoreInventoryJobId,
+			CertStoreType:           req.CertStoreType,
+			Approved:                req.Approved,
+			CreateIfMissing:         req.CreateIfMissing,
+			Properties:              req.Properties,
+			AgentId:                 req.AgentId,
+			AgentAssigned:           req.AgentAssigned,
+			InventorySchedule:       req.InventorySchedule,
+		}
+		// the password is left unchanged when omitted
+		if req.Password != nil {
+			if pErr := convertViaJSON(req.Password, &update.Password); pErr != nil {
+				return pErr
+			}
+		}
+		_, err = oldkfClient.UpdateStore(&update)
+		return err
+	}
+	return entity
+}
+
+// pamProviderReferences lists the PAM providers that the given secrets are stored in.
+func pamProviderReferences(secrets ...*exportStoreSecret) []importReference {
+	var refs []importReference
+	for _, secret := range secrets {
+		if secret != nil {
+			refs = append(refs, importReference{Kind: "pam_provider", Label: "PAM provider", Name: secret.PamProvider})
+		}
+	}
+	return refs
+}
+
+// certificate authorities are identified by host and logical name, so they can't be renamed
+func caImportEntity(
+	cas []exportCertificateAuthority,
+	kfClient *keyfactor.APIClient,
+	oldkfClient *api.Client,
+) importEntity {
+	entity := importEntity{Kind: "ca", Label: "certificate authority", NoRename: true}
+	entity.References = func(obj importObject) []importReference {
+		ca := obj.Body.(exportCertificateAuthority)
+		refs := []importReference{{Kind: "orchestrator", Label: "orchestrator", Name: stringValue(ca.Agent)}}
+		return append(
+			refs,
+			pamProviderReferences(ca.ExplicitPassword, ca.AuthCertificate, ca.AuthCertificatePassword)...,
+		)
+	}
+	for _, ca := range cas {
+		entity.Objects = append(entity.Objects, importObject{Name: caKey(ca.HostName, ca.LogicalName), Body: ca})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		refs, refErr := loadStoreReferences(kfClient, oldkfClient)
+		if refErr != nil {
+			return nil, refErr
+		}
+		cas, err := listCertificateAuthorities(kfClient)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, ca := range cas {
+			existing[caKey(ca.HostName, ca.LogicalName)] = importExisting{
+				Object: &ca,
+				State:  importStateOf(exportCertificateAuthorityOf(ca, refs)),
+			}
+		}
+		return existing, nil
+	}
+	targetRefs := lazyStoreReferences(kfClient, oldkfClient)
+	entity.Create = func(obj importObject, name string) error {
+		target, refErr := targetRefs()
+		if refErr != nil {
+			return refErr
+		}
+		req, err := certificateAuthorityRequest(obj.Body.(exportCertificateAuthority), target)
+		if err != nil {
+			return err
+		}
+		_, httpResp, reqErr := kfClient.CertificateAuthorityApi.CertificateAuthorityCreateCA(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Ca(req).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		target, refErr := targetRefs()
+		if refErr != nil {
+			return refErr
+		}
+		req, err := certificateAuthorityRequest(obj.Body.(exportCertificateAuthority), target)
+		if err != nil {
+			return err
+		}
+		req.Id = existing.Object.(*keyfactor.ModelsCertificateAuthoritiesCertificateAuthorityResponse).Id
+		_, httpResp, reqErr := kfClient.CertificateAuthorityApi.CertificateAuthorityUpdateCA(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Ca(req).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
+}
+
+// templates come from the CAs, so they always exist and are updated whenever they differ
+func templateImportEntity(templates []exportTemplate, kfClient *keyfactor.APIClient) importEntity {
+	entity := importEntity{Kind: "template", Label: "certificate template", UpdateOnly: true}
+	entity.References = func(obj importObject) []importReference {
+		var refs []importReference
+		for _, field := range obj.Body.(exportTemplate).MetadataFields {
+			refs = append(refs, importReference{Kind: "metadata_field", Label: "metadata field", Name: field.MetadataField})
+		}
+		return refs
+	}
+	for _, template := range templates {
+		entity.Objects = append(entity.Objects, importObject{Name: template.TemplateName, Body: template})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		metadataNames, mErr := listMetadataFieldNames(kfClient)
+		if mErr != nil {
+			return nil, mErr
+		}
+		templates, err := listTemplates(kfClient)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]importExisting)
+		for _, template := range templates {
+			existing[template.GetTemplateName()] = importExisting{
+				Object: &template,
+				State:  importStateOf(exportTemplateOf(template, metadataNames)),
+			}
+		}
+		return existing, nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		// metadata fields of the same import were created after the plan was made
+		metadataNames, mErr := listMetadataFieldNames(kfClient)
+		if mErr != nil {
+			return mErr
+		}
+		current := existing.Object.(*keyfactor.ModelsTemplateRetrievalResponse)
+		req, err := templateUpdateRequest(obj.Body.(exportTemplate), *current, metadataNames)
+		if err != nil {
+			return err
+		}
+		_, httpResp, reqErr := kfClient.TemplateApi.TemplateUpdateTemplate(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			Template(req).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			Execute()
+		if reqErr != nil {
+			return returnHttpErr(httpResp, reqErr)
+		}
+		return nil
+	}
+	return entity
 }
 
 func init() {
 	RootCmd.AddCommand(importCmd)
 
 	importCmd.Flags().StringVarP(&exportPath, "file", "f", "", "path to JSON file containing exported data")
-	importCmd.MarkFlagRequired("file")
+	importCmd.Flags().StringVar(&exportDir, "dir", "", "path to a directory containing exported data")
+	importCmd.MarkFlagsOneRequired("file", "dir")
+	importCmd.MarkFlagsMutuallyExclusive("file", "dir")
 
 	importCmd.Flags().BoolVarP(&fAll, "all", "a", false, "import all importable data to JSON file")
 	importCmd.Flags().Lookup("all").NoOptDefVal = "true"
 
-	importCmd.Flags().BoolVarP(&fCollections, "collections", "c", false, "import collections to JSON file")
-	importCmd.Flags().Lookup("collections").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(&fMetadata, "metadata", "m", false, "import metadata to JSON file")
-	importCmd.Flags().Lookup("metadata").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(&fIssuedAlerts, "issued-alerts", "i", false, "import issued cert alerts to JSON file")
-	importCmd.Flags().Lookup("issued-alerts").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(&fDeniedAlerts, "denied-alerts", "d", false, "import denied cert alerts to JSON file")
-	importCmd.Flags().Lookup("denied-alerts").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(&fPendingAlerts, "pending-alerts", "p", false, "import pending cert alerts to JSON file")
-	importCmd.Flags().Lookup("pending-alerts").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(&fNetworks, "networks", "n", false, "import SSL networks to JSON file")
-	importCmd.Flags().Lookup("networks").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(
+	addExportEntityFlag(importCmd, &fCollections, "collections", "c", "import collections to JSON file")
+	addExportEntityFlag(importCmd, &fMetadata, "metadata", "m", "import metadata to JSON file")
+	addExportEntityFlag(
+		importCmd,
+		&fExpirationAlerts,
+		"expiration-alerts",
+		"e",
+		"import expiration cert alerts from JSON file",
+	)
+	addExportEntityFlag(importCmd, &fIssuedAlerts, "issued-alerts", "i", "import issued cert alerts to JSON file")
+	addExportEntityFlag(importCmd, &fDeniedAlerts, "denied-alerts", "d", "import denied cert alerts to JSON file")
+	addExportEntityFlag(importCmd, &fPendingAlerts, "pending-alerts", "p", "import pending cert alerts to JSON file")
+	addExportEntityFlag(importCmd, &fNetworks, "networks", "n", "import SSL networks to JSON file")
+	addExportEntityFlag(
+		importCmd,
 		&fWorkflowDefinitions,
 		"workflow-definitions",
 		"w",
-		false,
 		"import workflow definitions to JSON file",
 	)
-	importCmd.Flags().Lookup("workflow-definitions").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(&fReports, "reports", "r", false, "import reports to JSON file")
-	importCmd.Flags().Lookup("reports").NoOptDefVal = "true"
-	importCmd.Flags().BoolVarP(&fSecurityRoles, "security-roles", "s", false, "import security roles to JSON file")
-	importCmd.Flags().Lookup("security-roles").NoOptDefVal = "true"
+	addExportEntityFlag(importCmd, &fReports, "reports", "r", "import reports to JSON file")
+	addExportEntityFlag(importCmd, &fSecurityRoles, "security-roles", "s", "import security roles to JSON file")
+	addExportEntityFlag(importCmd, &fStoreTypes, "store-types", "", "import certificate store types from JSON file")
+	addExportEntityFlag(importCmd, &fContainers, "containers", "", "import certificate store containers from JSON file")
+	addExportEntityFlag(importCmd, &fPamProviders, "pam-providers", "", "import PAM providers from JSON file")
+	addExportEntityFlag(importCmd, &fStores, "stores", "", "import certificate stores from JSON file")
+	addExportEntityFlag(importCmd, &fTemplates, "templates", "", "import certificate template settings from JSON file")
+	addExportEntityFlag(importCmd, &fCAs, "cas", "", "import certificate authorities from JSON file")
+
+	importCmd.Flags().String(
+		"on-conflict",
+		importConflictSkip,
+		fmt.Sprintf(
+			"what to do with objects that already exist with different settings: %s",
+			strings.Join(importConflictModes, ", "),
+		),
+	)
+	importCmd.Flags().Bool("dry-run", false, "print the import plan without changing anything")
+	addExportFilterFlags(importCmd, "import")
+	importCmd.Flags().StringArray(
+		"identity",
+		nil,
+		"age identity file to decrypt the secrets of an encrypted export with, may be repeated",
+	)
+	importCmd.Flags().String(
+		"map-identities",
+		"",
+		"CSV file of source,target account names to translate the identities of security roles with",
+	)
+	importCmd.Flags().Bool(
+		"prompt-secrets",
+		false,
+		"ask for the values of secrets that were exported as placeholders",
+	)
 }
@@ -0,0 +1,491 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// How an import handles objects that already exist on the target with different settings.
+const (
+	importConflictSkip      = "skip"
+	importConflictOverwrite = "overwrite"
+	importConflictRename    = "rename"
+	importConflictFail      = "fail"
+)
+
+var importConflictModes = []string{importConflictSkip, importConflictOverwrite, importConflictRename, importConflictFail}
+
+// Planned import actions.
+const (
+	importActionCreate   = "create"
+	importActionUpdate   = "update"
+	importActionSkip     = "skip"
+	importActionConflict = "conflict"
+	importActionError    = "error"
+)
+
+// Results of applying a planned action.
+const (
+	importResultDone   = "done"
+	importResultFailed = "failed"
+)
+
+// importIgnoredFields are never compared, at any depth, because they identify an object on its own instance only.
+var importIgnoredFields = map[string]bool{"Id": true, "CopyFromId": true}
+
+// importUnorderedFields are the list fields whose order carries no meaning, such as permissions and recipients. They
+// match when they hold the same items in any order, other lists, like the steps of a workflow, are compared in order.
+var importUnorderedFields = map[string]bool{
+	"AcceptedScheduleFormats": true,
+	"AllowedRequesters":       true,
+	"EmailRecipients":         true,
+	"EnrollmentFields":        true,
+	"EventHandlerParameters":  true,
+	"Identities":              true,
+	"Permissions":             true,
+	"Recipients":              true,
+	"Tags":                    true,
+	"TemplateDefaults":        true,
+	"TemplateRegexes":         true,
+}
+
+// importEntity describes how one kind of exported object is matched against the target instance and written to it.
+type importEntity struct {
+	// Kind identifies the entity in machine-readable output and Label in messages.
+	Kind    string
+	Label   string
+	Objects []importObject
+	// Existing lists the objects of this kind on the target, keyed by natural key.
+	Existing func() (map[string]importExisting, error)
+	// Create creates the object under the given name, which differs from the exported one when renaming. It is nil
+	// when the entity can't be created through the API.
+	Create func(obj importObject, name string) error
+	// Update makes an existing object match the exported one. It is nil when the entity can't be updated.
+	Update func(obj importObject, existing importExisting) error
+	// Fields limits the compared fields to those an update can change. All exported fields are compared when empty.
+	Fields []string
+	// UpdateOnly entities always exist on the target, so they are never created or renamed.
+	UpdateOnly bool
+	// NoRename entities are identified by their settings rather than a name they can be given.
+	NoRename bool
+	// References lists the objects of other kinds that an object refers to by natural key.
+	References func(obj importObject) []importReference
+}
+
+// importReference is the natural key of an object that an imported object depends on.
+type importReference struct {
+	Kind  string
+	Label string
+	Name  string
+}
+
+// importTargets reports whether an object of the given kind and natural key exists on the target.
+type importTargets func(kind string, name string) (bool, error)
+
+// importObject is an exported object to import.
+type importObject struct {
+	Name string
+	Body interface{}
+	// Skip is the reason the object is never imported, if any.
+	Skip string
+}
+
+// importExisting is an object found on the target, with its settings in the same shape as the exported objects.
+type importExisting struct {
+	// Object is a pointer to the API model of the object.
+	Object interface{}
+	State  map[string]interface{}
+}
+
+type importFieldDiff struct {
+	Field   string      `json:"field"`
+	Current interface{} `json:"current"`
+	Desired interface{} `json:"desired"`
+}
+
+type importPlanItem struct {
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	Action     string            `json:"action"`
+	TargetName string            `json:"target_name,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Diffs      []importFieldDiff `json:"diffs,omitempty"`
+	Status     string            `json:"status,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	entity   *importEntity
+	object   importObject
+	existing importExisting
+}
+
+type importSummary struct {
+	Create   int `json:"create"`
+	Update   int `json:"update"`
+	Skip     int `json:"skip"`
+	Conflict int `json:"conflict"`
+	Failed   int `json:"failed"`
+}
+
+type importReport struct {
+	DryRun     bool             `json:"dry_run"`
+	OnConflict string           `json:"on_conflict"`
+	Objects    []importPlanItem `json:"objects"`
+	Summary    importSummary    `json:"summary"`
+}
+
+// importStateOf returns an object's JSON fields as a map, so objects of different models can be compared.
+func importStateOf(v interface{}) map[string]interface{} {
+	state := make(map[string]interface{})
+	b, err := json.Marshal(v)
+	if err != nil {
+		return state
+	}
+	_ = json.Unmarshal(b, &state)
+	return state
+}
+
+// convertViaJSON copies the fields of one API model into another with the same JSON field names.
+func convertViaJSON(src interface{}, dst interface{}) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// importValuesMatch reports whether the current value has every setting of the desired value. Nested objects only
+// have the desired fields compared, because responses carry more fields than requests, and a missing current value
+// matches an empty desired one.
+func importValuesMatch(desired interface{}, current interface{}) bool {
+	if current == nil {
+		return importValueEmpty(desired)
+	}
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		c, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range d {
+			if importIgnoredFields[k] {
+				continue
+			}
+			if !importFieldValuesMatch(k, v, c[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		c, ok := current.([]interface{})
+		if !ok || len(c) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !importValuesMatch(d[i], c[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(desired, current)
+	}
+}
+
+// importFieldValuesMatch is importValuesMatch for the value of a named field, which compares the lists of
+// importUnorderedFields regardless of order.
+func importFieldValuesMatch(field string, desired interface{}, current interface{}) bool {
+	d, ok := desired.([]interface{})
+	if !ok || !importUnorderedFields[field] || current == nil {
+		return importValuesMatch(desired, current)
+	}
+	c, ok := current.([]interface{})
+	if !ok || len(c) != len(d) {
+		return false
+	}
+	used := make([]bool, len(c))
+	for _, item := range d {
+		found := false
+		for i := range c {
+			if !used[i] && importValuesMatch(item, c[i]) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func importValueEmpty(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case bool:
+		return !t
+	case float64:
+		return t == 0
+	case []interface{}:
+		return len(t) == 0
+	case map[string]interface{}:
+		return len(t) == 0
+	}
+	return false
+}
+
+// diffImportObject lists the fields of the desired object that differ from the current state.
+func diffImportObject(desired interface{}, current map[string]interface{}, fields []string) []importFieldDiff {
+	want := importStateOf(desired)
+	if len(fields) == 0 {
+		for field := range want {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+	}
+	var diffs []importFieldDiff
+	for _, field := range fields {
+		if importIgnoredFields[field] {
+			continue
+		}
+		if !importFieldValuesMatch(field, want[field], current[field]) {
+			diffs = append(diffs, importFieldDiff{Field: field, Current: current[field], Desired: want[field]})
+		}
+	}
+	return diffs
+}
+
+// importRename returns the first free name of the form "<name>_<n>".
+func importRename(name string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%d", name, n)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// planImport decides what to do with every exported object by comparing it with the target. Entities are planned in
+// order, so an object that is written can only refer to objects that exist on the target or are created before it.
+func planImport(entities []importEntity, onConflict string, targets importTargets) []importPlanItem {
+	var plan []importPlanItem
+	created := make(map[importReference]bool)
+	for i := range entities {
+		entity := &entities[i]
+		if len(entity.Objects) == 0 {
+			continue
+		}
+		existing, err := entity.Existing()
+		taken := make(map[string]bool)
+		for name := range existing {
+			taken[name] = true
+		}
+		for _, obj := range entity.Objects {
+			item := importPlanItem{Kind: entity.Kind, Name: obj.Name, entity: entity, object: obj}
+			current, exists := existing[obj.Name]
+			switch {
+			case err != nil:
+				item.Action = importActionError
+				item.Error = fmt.Sprintf("unable to list existing %ss: %s", entity.Label, err)
+			case obj.Skip != "":
+				item.Action, item.Reason = importActionSkip, obj.Skip
+			case !exists && entity.UpdateOnly:
+				item.Action, item.Reason = importActionSkip, "not present on the target"
+			case !exists && entity.Create == nil:
+				item.Action, item.Reason = importActionSkip, fmt.Sprintf("%ss can't be created through the API", entity.Label)
+			case !exists:
+				item.Action = importActionCreate
+				taken[obj.Name] = true
+			default:
+				item.existing = current
+				item.Diffs = diffImportObject(obj.Body, current.State, entity.Fields)
+				switch {
+				case len(item.Diffs) == 0:
+					item.Action, item.Reason = importActionSkip, "unchanged"
+				case entity.UpdateOnly:
+					item.Action = importActionUpdate
+				case onConflict == importConflictOverwrite && entity.Update == nil:
+					item.Action, item.Reason = importActionSkip, fmt.Sprintf("existing %ss can't be updated", entity.Label)
+				case onConflict == importConflictOverwrite:
+					item.Action = importActionUpdate
+				case onConflict == importConflictRename && (entity.NoRename || entity.Create == nil):
+					item.Action, item.Reason = importActionSkip, "already exists and can't be renamed"
+				case onConflict == importConflictRename:
+					item.Action, item.TargetName = importActionCreate, importRename(obj.Name, taken)
+					taken[item.TargetName] = true
+				case onConflict == importConflictFail:
+					item.Action, item.Reason = importActionConflict, "already exists with different settings"
+				default:
+					item.Action, item.Reason = importActionSkip, "already exists"
+				}
+			}
+			if item.Action == importActionCreate || item.Action == importActionUpdate {
+				if missing := missingImportReference(entity, obj, created, targets); missing != "" {
+					item.Action, item.Error = importActionError, missing
+				}
+			}
+			if item.Action == importActionCreate && item.TargetName == "" {
+				created[importReference{Kind: entity.Kind, Name: obj.Name}] = true
+			}
+			plan = append(plan, item)
+		}
+	}
+	return plan
+}
+
+// missingImportReference describes the first object the given object refers to that neither exists on the target nor
+// is created by the import, if any.
+func missingImportReference(
+	entity *importEntity,
+	obj importObject,
+	created map[importReference]bool,
+	targets importTargets,
+) string {
+	if entity.References == nil {
+		return ""
+	}
+	for _, ref := range entity.References(obj) {
+		if ref.Name == "" || created[importReference{Kind: ref.Kind, Name: ref.Name}] {
+			continue
+		}
+		exists, err := targets(ref.Kind, ref.Name)
+		if err != nil {
+			return fmt.Sprintf("unable to list existing %ss: %s", ref.Label, err)
+		}
+		if !exists {
+			return fmt.Sprintf("%s %q doesn't exist on the target and isn't imported", ref.Label, ref.Name)
+		}
+	}
+	return ""
+}
+
+// applyImportPlan creates and updates the planned objects, recording and printing the result of each.
+func applyImportPlan(plan []importPlanItem, w io.Writer) {
+	for i := range plan {
+		item := &plan[i]
+		var err error
+		switch item.Action {
+		case importActionCreate:
+			name := item.Name
+			if item.TargetName != "" {
+				name = item.TargetName
+			}
+			err = item.entity.Create(item.object, name)
+		case importActionUpdate:
+			err = item.entity.Update(item.object, item.existing)
+		}
+		if item.Action == importActionCreate || item.Action == importActionUpdate {
+			item.Status = importResultDone
+			if err != nil {
+				item.Status, item.Error = importResultFailed, err.Error()
+			}
+		}
+		if w != nil {
+			printImportResult(w, *item)
+		}
+	}
+}
+
+func summarizeImport(plan []importPlanItem) importSummary {
+	var summary importSummary
+	for _, item := range plan {
+		if item.Status == importResultFailed || item.Action == importActionError {
+			summary.Failed++
+			continue
+		}
+		switch item.Action {
+		case importActionCreate:
+			summary.Create++
+		case importActionUpdate:
+			summary.Update++
+		case importActionSkip:
+			summary.Skip++
+		case importActionConflict:
+			summary.Conflict++
+		}
+	}
+	return summary
+}
+
+func importItemLabel(item importPlanItem) string {
+	return fmt.Sprintf("%s %q", item.entity.Label, item.Name)
+}
+
+func importItemNote(item importPlanItem) string {
+	switch {
+	case item.TargetName != "":
+		return fmt.Sprintf(" as %q", item.TargetName)
+	case item.Reason != "":
+		return fmt.Sprintf(" (%s)", item.Reason)
+	case item.Error != "":
+		return fmt.Sprintf(" - %s", item.Error)
+	}
+	return ""
+}
+
+// printImportPlan prints what an import would do, with the changed fields of existing objects.
+func printImportPlan(w io.Writer, plan []importPlanItem) {
+	for _, item := range plan {
+		fmt.Fprintf(w, "%-9s %s%s\n", item.Action, importItemLabel(item), importItemNote(item))
+		for _, d := range item.Diffs {
+			current, _ := json.Marshal(d.Current)
+			desired, _ := json.Marshal(d.Desired)
+			fmt.Fprintf(w, "          %s: %s -> %s\n", d.Field, current, desired)
+		}
+	}
+}
+
+func printImportResult(w io.Writer, item importPlanItem) {
+	label := importItemLabel(item)
+	switch {
+	case item.Action == importActionError:
+		fmt.Fprintf(w, "%s Error! Unable to import %s - %s%s\n", ColorRed, label, item.Error, ColorWhite)
+	case item.Status == importResultFailed:
+		fmt.Fprintf(w, "%s Error! Unable to %s %s - %s%s\n", ColorRed, item.Action, label, item.Error, ColorWhite)
+	case item.Action == importActionCreate:
+		fmt.Fprintf(w, "Created %s%s\n", label, importItemNote(item))
+	case item.Action == importActionUpdate:
+		fmt.Fprintf(w, "Updated %s\n", label)
+	default:
+		fmt.Fprintf(w, "Skipped %s%s\n", label, importItemNote(item))
+	}
+}
+
+func printImportSummary(w io.Writer, summary importSummary) {
+	fmt.Fprintf(
+		w,
+		"Summary: create=%d update=%d skip=%d conflict=%d failed=%d\n",
+		summary.Create,
+		summary.Update,
+		summary.Skip,
+		summary.Conflict,
+		summary.Failed,
+	)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testImportObject struct {
+	Id          int      `json:"Id,omitempty"`
+	Name        string   `json:"Name"`
+	Description string   `json:"Description"`
+	Tags        []string `json:"Tags,omitempty"`
+}
+
+// testImportEntity returns an entity whose target holds the given objects and which records the changes made.
+func testImportEntity(target map[string]testImportObject, objects ...testImportObject) (*importEntity, *[]string) {
+	var changes []string
+	entity := &importEntity{Kind: "thing", Label: "thing"}
+	for _, obj := range objects {
+		entity.Objects = append(entity.Objects, importObject{Name: obj.Name, Body: obj})
+	}
+	entity.Existing = func() (map[string]importExisting, error) {
+		existing := make(map[string]importExisting)
+		for name, obj := range target {
+			existing[name] = importExisting{Object: &obj, State: importStateOf(obj)}
+		}
+		return existing, nil
+	}
+	entity.Create = func(obj importObject, name string) error {
+		if name == "broken" {
+			return fmt.Errorf("server error")
+		}
+		changes = append(changes, "create "+name)
+		return nil
+	}
+	entity.Update = func(obj importObject, existing importExisting) error {
+		changes = append(changes, fmt.Sprintf("update %s(%d)", obj.Name, existing.Object.(*testImportObject).Id))
+		return nil
+	}
+	return entity, &changes
+}
+
+func Test_DiffImportObject(t *testing.T) {
+	current := importStateOf(testImportObject{Id: 7, Name: "a", Description: "old"})
+	current["Extra"] = map[string]interface{}{"Id": 3.0, "Name": "x", "Other": true}
+
+	diffs := diffImportObject(testImportObject{Id: 1, Name: "a", Description: "new"}, current, nil)
+	assert.Equal(t, []importFieldDiff{{Field: "Description", Current: "old", Desired: "new"}}, diffs)
+
+	diffs = diffImportObject(testImportObject{Name: "a", Description: "new"}, current, []string{"Name"})
+	assert.Empty(t, diffs)
+
+	assert.True(t, importValuesMatch(map[string]interface{}{"Id": 9.0, "Name": "x"}, current["Extra"]))
+	assert.False(t, importValuesMatch(map[string]interface{}{"Name": "y"}, current["Extra"]))
+	assert.True(t, importValuesMatch("", nil))
+	assert.True(t, importValuesMatch([]interface{}{}, nil))
+	assert.False(t, importValuesMatch([]interface{}{"a"}, []interface{}{"a", "b"}))
+
+	assert.True(t, importFieldValuesMatch("Permissions", []interface{}{"b", "a"}, []interface{}{"a", "b"}))
+	assert.False(t, importFieldValuesMatch("Permissions", []interface{}{"a", "a"}, []interface{}{"a", "b"}))
+	assert.False(t, importFieldValuesMatch("Steps", []interface{}{"b", "a"}, []interface{}{"a", "b"}))
+	assert.True(
+		t,
+		importValuesMatch(
+			map[string]interface{}{"Recipients": []interface{}{"y@example.com", "x@example.com"}},
+			map[string]interface{}{"Recipients": []interface{}{"x@example.com", "y@example.com"}, "Id": 3.0},
+		),
+	)
+}
+
+func Test_PlanImport(t *testing.T) {
+	target := map[string]testImportObject{
+		"same":      {Id: 1, Name: "same", Description: "d"},
+		"changed":   {Id: 2, Name: "changed", Description: "old"},
+		"changed_2": {Id: 3, Name: "changed_2", Description: "taken"},
+	}
+	objects := []testImportObject{
+		{Name: "new", Description: "d"},
+		{Name: "same", Description: "d"},
+		{Name: "changed", Description: "new"},
+	}
+
+	actions := func(plan []importPlanItem) []string {
+		var out []string
+		for _, item := range plan {
+			out = append(out, fmt.Sprintf("%s %s %s", item.Action, item.Name, item.TargetName))
+		}
+		return out
+	}
+
+	entity, _ := testImportEntity(target, objects...)
+	plan := planImport([]importEntity{*entity}, importConflictSkip, nil)
+	assert.Equal(t, []string{"create new ", "skip same ", "skip changed "}, actions(plan))
+	assert.Equal(t, "unchanged", plan[1].Reason)
+	assert.Len(t, plan[2].Diffs, 1)
+
+	plan = planImport([]importEntity{*entity}, importConflictOverwrite, nil)
+	assert.Equal(t, []string{"create new ", "skip same ", "update changed "}, actions(plan))
+
+	plan = planImport([]importEntity{*entity}, importConflictRename, nil)
+	assert.Equal(t, []string{"create new ", "skip same ", "create changed changed_3"}, actions(plan))
+
+	plan = planImport([]importEntity{*entity}, importConflictFail, nil)
+	assert.Equal(t, []string{"create new ", "skip same ", "conflict changed "}, actions(plan))
+	assert.Equal(t, 1, summarizeImport(plan).Conflict)
+
+	noUpdate := *entity
+	noUpdate.Update = nil
+	plan = planImport([]importEntity{noUpdate}, importConflictOverwrite, nil)
+	assert.Equal(t, "skip", plan[2].Action)
+
+	updateOnly := *entity
+	updateOnly.UpdateOnly = true
+	plan = planImport([]importEntity{updateOnly}, importConflictSkip, nil)
+	assert.Equal(t, []string{"skip new ", "skip same ", "update changed "}, actions(plan))
+
+	noCreate := *entity
+	noCreate.Create = nil
+	noCreate.NoRename = true
+	plan = planImport([]importEntity{noCreate}, importConflictRename, nil)
+	assert.Equal(t, []string{"skip new ", "skip same ", "skip changed "}, actions(plan))
+	assert.Equal(t, "things can't be created through the API", plan[0].Reason)
+	assert.Equal(t, "already exists and can't be renamed", plan[2].Reason)
+
+	failing := *entity
+	failing.Existing = func() (map[string]importExisting, error) { return nil, fmt.Errorf("forbidden") }
+	plan = planImport([]importEntity{failing}, importConflictSkip, nil)
+	assert.Equal(t, importActionError, plan[0].Action)
+	assert.Equal(t, 3, summarizeImport(plan).Failed)
+}
+
+func Test_PlanImportReferences(t *testing.T) {
+	fields, _ := testImportEntity(nil, testImportObject{Name: "Owner"})
+	fields.Kind = "metadata_field"
+	templates, _ := testImportEntity(
+		nil,
+		testImportObject{Name: "Web", Tags: []string{"Owner"}},
+		testImportObject{Name: "Mail", Tags: []string{"Team"}},
+		testImportObject{Name: "Vpn", Tags: []string{"Cost Center"}},
+	)
+	templates.References = func(obj importObject) []importReference {
+		var refs []importReference
+		for _, tag := range obj.Body.(testImportObject).Tags {
+			refs = append(refs, importReference{Kind: "metadata_field", Label: "metadata field", Name: tag})
+		}
+		return refs
+	}
+	targets := func(kind string, name string) (bool, error) {
+		if name == "Cost Center" {
+			return false, fmt.Errorf("forbidden")
+		}
+		return kind == "metadata_field" && name == "Team", nil
+	}
+
+	// a dependency created earlier in the import counts as existing
+	plan := planImport([]importEntity{*fields, *templates}, importConflictSkip, targets)
+	assert.Equal(t, importActionCreate, plan[1].Action)
+	assert.Equal(t, importActionCreate, plan[2].Action)
+	assert.Equal(t, importActionError, plan[3].Action)
+	assert.Equal(t, "unable to list existing metadata fields: forbidden", plan[3].Error)
+
+	plan = planImport([]importEntity{*templates}, importConflictSkip, targets)
+	assert.Equal(t, importActionError, plan[0].Action)
+	assert.Equal(t, `metadata field "Owner" doesn't exist on the target and isn't imported`, plan[0].Error)
+	assert.Equal(t, importActionCreate, plan[1].Action)
+	assert.Equal(t, 2, summarizeImport(plan).Failed)
+}
+
+func Test_ApplyImportPlan(t *testing.T) {
+	target := map[string]testImportObject{"changed": {Id: 2, Name: "changed", Description: "old"}}
+	entity, changes := testImportEntity(
+		target,
+		testImportObject{Name: "new"},
+		testImportObject{Name: "broken"},
+		testImportObject{Name: "changed", Description: "new"},
+	)
+	plan := planImport([]importEntity{*entity}, importConflictOverwrite, nil)
+
+	var dry bytes.Buffer
+	printImportPlan(&dry, plan)
+	assert.Contains(t, dry.String(), `update    thing "changed"`)
+	assert.Contains(t, dry.String(), `Description: "old" -> "new"`)
+	assert.Empty(t, *changes)
+
+	var out bytes.Buffer
+	applyImportPlan(plan, &out)
+	assert.Equal(t, []string{"create new", "update changed(2)"}, *changes)
+	assert.Equal(t, importResultFailed, plan[1].Status)
+	assert.Equal(t, "server error", plan[1].Error)
+	assert.Equal(t, importSummary{Create: 1, Update: 1, Failed: 1}, summarizeImport(plan))
+	assert.Contains(t, out.String(), `Created thing "new"`)
+	assert.Contains(t, out.String(), `Unable to create thing "broken" - server error`)
+}
@@ -15,9 +15,14 @@
 package cmd
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/Keyfactor/keyfactor-go-client/v3/api"
 	"github.com/spf13/cobra"
@@ -36,7 +41,7 @@ var inventoryClearCmd = &cobra.Command{
 	SuggestFor:             nil,
 	Short:                  "Clears the certificate store inventory of ALL certificates.",
 	GroupID:                "",
-	Long:                   `Clears the certificate store inventory of ALL certificates.`,
+	Long:                   "Clears the certificate store inventory of ALL certificates. A snapshot of the selected stores' inventory is written first unless --no-backup is set.",
 	Example:                "",
 	ValidArgs:              nil,
 	ValidArgsFunction:      nil,
@@ -50,7 +55,9 @@ var inventoryClearCmd = &cobra.Command{
 	PersistentPreRunE:      nil,
 	PreRun:                 nil,
 	PreRunE:                nil,
-	Run: func(cmd *cobra.Command, args []string) {
+	Run:                    nil,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
 		isExperimental := true
 
 		_, expErr := isExperimentalFeatureEnabled(expEnabled, isExperimental)
@@ -63,6 +70,10 @@ var inventoryClearCmd = &cobra.Command{
 		log.Println("Debug mode enabled: ", debugModeEnabled)
 		force, _ := cmd.Flags().GetBool("force")
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		noBackup, _ := cmd.Flags().GetBool("no-backup")
+		backupPath, _ := cmd.Flags().GetString("backup-file")
 
 		storeID, _ := cmd.Flags().GetStringSlice("sid")
 		machineName, _ := cmd.Flags().GetStringSlice("client")
@@ -74,50 +85,30 @@ var inventoryClearCmd = &cobra.Command{
 
 		if storeID == nil && machineName == nil && storeType == nil && containerType == nil && !allStores {
 			fmt.Println("You must specify at least one of the following options: --sid, --client, --store-type, --container, --all")
-			return
+			return nil
 		}
 
-		sIdMap := make(map[string]bool)
-		for _, sId := range storeID {
-			sIdMap[sId] = true
-		}
-		mNameMap := make(map[string]bool)
-		for _, mName := range machineName {
-			mNameMap[mName] = true
+		tracker, tErr := newInventoryJobTracker(wait && !dryRun)
+		if tErr != nil {
+			return tErr
 		}
-		sTypeMap := make(map[string]bool)
-		for _, sType := range storeType {
-			sTypeMap[sType] = true
-		}
-		cTypeMap := make(map[string]bool)
-		for _, cType := range containerType {
-			cTypeMap[cType] = true
+		scheduleErrs := 0
+
+		filteredStores, fErr := selectInventoryStores(kfClient, storeID, machineName, storeType, containerType, allStores)
+		if fErr != nil {
+			fmt.Printf("Error listing certificate stores: %s\n", fErr)
+			log.Fatal(fErr)
 		}
-		var filteredStores []api.GetCertificateStoreResponse
 
-		sTypeLookup := make(map[string]bool)
-		if !allStores {
-			params := make(map[string]interface{})
-			allStoresResponse, _ := kfClient.ListCertificateStores(&params) //nil
-			for _, store := range *allStoresResponse {
-				sTypeName, stErr := kfClient.GetCertificateStoreTypeById(store.CertStoreType)
-				sTypeLookup[sTypeName.ShortName] = true
-				if stErr != nil {
-					fmt.Printf("Error getting store type name for store type id %d: %s\n", store.CertStoreType, stErr)
-					log.Fatal(stErr)
-				}
-				if sIdMap[store.Id] || mNameMap[store.ClientMachine] || sTypeMap[sTypeName.ShortName] || cTypeMap[store.ContainerName] {
-					filteredStores = append(filteredStores, store)
-				}
+		if !dryRun && !noBackup && len(filteredStores) > 0 {
+			if backupPath == "" {
+				backupPath = defaultSnapshotFileName()
 			}
-		} else {
-			params := make(map[string]interface{})
-			allStoresResp, fErr := kfClient.ListCertificateStores(&params)
-			if fErr != nil {
-				fmt.Printf("Error listing certificate stores: %s\n", fErr)
-				log.Fatal(fErr)
+			if _, sErr := writeInventorySnapshot(kfClient, filteredStores, backupPath); sErr != nil {
+				fmt.Printf("Error creating inventory snapshot, no inventory was cleared: %s\n", sErr)
+				return sErr
 			}
-			filteredStores = *allStoresResp
+			fmt.Printf("Inventory snapshot written to %s. Use 'inventory restore --from %s' to undo.\n", backupPath, backupPath)
 		}
 
 		for _, store := range filteredStores {
@@ -141,7 +132,8 @@ var inventoryClearCmd = &cobra.Command{
 				fmt.Scanln(&answer)
 				if answer != "y" {
 					fmt.Println("Aborting")
-					return
+					// jobs already scheduled for earlier stores are still waited on and reported
+					return finishInventoryJobs(tracker, timeout, scheduleErrs)
 				}
 			}
 
@@ -165,7 +157,7 @@ var inventoryClearCmd = &cobra.Command{
 						InventorySchedule: schedule,
 					}
 					if !dryRun {
-						_, err := kfClient.RemoveCertificateFromStores(&removeReq)
+						jobIds, err := kfClient.RemoveCertificateFromStores(&removeReq)
 						if err != nil {
 							fmt.Printf(
 								"Error removing certificate %s(%d) from store %s: %s\n",
@@ -175,8 +167,18 @@ var inventoryClearCmd = &cobra.Command{
 								err,
 							)
 							log.Printf("[ERROR] %s", err)
+							scheduleErrs++
 							continue
 						}
+						if tracker != nil {
+							tracker.track(
+								jobIds,
+								store.Id,
+								store.ClientMachine,
+								store.StorePath,
+								fmt.Sprintf("remove %s(%d)", cert.Thumbprint, cert.Id),
+							)
+						}
 					} else {
 						fmt.Printf(
 							"Dry run: Would have removed certificate %s(%d) from store %s\n",
@@ -190,8 +192,8 @@ var inventoryClearCmd = &cobra.Command{
 			}
 			fmt.Println("Inventory cleared")
 		}
+		return finishInventoryJobs(tracker, timeout, scheduleErrs)
 	},
-	RunE:                       nil,
 	PostRun:                    nil,
 	PostRunE:                   nil,
 	PersistentPostRun:          nil,
@@ -216,8 +218,14 @@ var inventoryAddCmd = &cobra.Command{
 specified by thumbprint, Keyfactor command certificate ID, or subject name. The store(s) to add the certificate(s) to can be
 specified by Keyfactor command store ID, client machine name, store type, or container type. At least one or more stores
 and one or more certificates must be specified. If multiple stores and/or certificates are specified, the command will
-attempt to add all the certificate(s) meeting the specified criteria to all stores meeting the specified criteria.`,
-	Run: func(cmd *cobra.Command, args []string) {
+attempt to add all the certificate(s) meeting the specified criteria to all stores meeting the specified criteria.
+The alias and private key options are validated against the PrivateKeyAllowed and CustomAliasAllowed settings of each
+target store's type before any job is scheduled. As before these options existed, entries with the same alias are
+overwritten and private keys are included, protected by a generated password, for every store whose type allows them.
+Use --overwrite=false or --include-private-key=false to opt out. Use --wait to wait for the scheduled orchestrator jobs
+to complete and report their results.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
 		isExperimental := true
 
 		_, expErr := isExperimentalFeatureEnabled(expEnabled, isExperimental)
@@ -230,6 +238,8 @@ attempt to add all the certificate(s) meeting the specified criteria to all stor
 		log.Println("Debug mode enabled: ", debugModeEnabled)
 		force, _ := cmd.Flags().GetBool("force")
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
 
 		storeIDs, _ := cmd.Flags().GetStringSlice("sid")
 		thumbprints, _ := cmd.Flags().GetStringSlice("thumbprint")
@@ -239,6 +249,8 @@ attempt to add all the certificate(s) meeting the specified criteria to all stor
 		storeTypes, _ := cmd.Flags().GetStringSlice("store-type")
 		containerType, _ := cmd.Flags().GetStringSlice("container")
 		allStores, _ := cmd.Flags().GetBool("all-stores")
+		alias, _ := cmd.Flags().GetString("alias")
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
 
 		if !allStores && (len(storeIDs) == 0 && len(machineNames) == 0 && len(storeTypes) == 0 && len(containerType) == 0) {
 			fmt.Println("At least one store parameter must be specified: [sid, client, store-type, container]. Or specify --all-stores.")
@@ -254,110 +266,38 @@ attempt to add all the certificate(s) meeting the specified criteria to all stor
 
 		if storeIDs == nil && machineNames == nil && storeTypes == nil && containerType == nil && !allStores {
 			fmt.Println("You must specify at least one of the following options: --sid, --client, --store-type, --container, --all")
-			return
+			return nil
 		}
 
-		sIdMap := make(map[string]bool)
-		for _, sId := range storeIDs {
-			sIdMap[sId] = true
-		}
-		mNameMap := make(map[string]bool)
-		for _, mName := range machineNames {
-			mNameMap[mName] = true
+		tracker, tErr := newInventoryJobTracker(wait && !dryRun)
+		if tErr != nil {
+			return tErr
 		}
-		sTypeMap := make(map[string]bool)
-		for _, sType := range storeTypes {
-			sTypeMap[sType] = true
+		scheduleErrs := 0
+
+		filteredCerts := findCertificates(kfClient, subjects, thumbprints, certIDs)
+
+		if alias != "" && len(filteredCerts) > 1 {
+			return fmt.Errorf("--alias can only be used when adding a single certificate, %d certificates matched", len(filteredCerts))
 		}
-		cTypeMap := make(map[string]bool)
-		for _, cType := range containerType {
-			cTypeMap[cType] = true
+
+		filteredStores, fErr := selectInventoryStores(kfClient, storeIDs, machineNames, storeTypes, containerType, allStores)
+		if fErr != nil {
+			fmt.Printf("Error listing certificate stores: %s\n", fErr)
+			log.Fatal(fErr)
 		}
-		var filteredStores []api.GetCertificateStoreResponse
-		var filteredCerts []api.GetCertificateResponse
 
-		for _, cn := range subjects {
-			cert, err := kfClient.ListCertificates(
-				map[string]string{
-					"subject": cn,
-				},
-			)
-			if err != nil {
-				fmt.Printf("Unable to find certificate with subject: %s\n", cn)
-				continue
-			}
-			filteredCerts = append(filteredCerts, cert...)
-		}
-		for _, thumbprint := range thumbprints {
-			cert, err := kfClient.ListCertificates(
-				map[string]string{
-					"thumbprint": thumbprint,
-				},
-			)
-			if err != nil {
-				fmt.Printf("Unable to find certificate with thumbprint: %s\n", thumbprint)
-				continue
-			}
-			filteredCerts = append(filteredCerts, cert...)
-		}
-		for _, certID := range certIDs {
-			cert, err := kfClient.ListCertificates(
-				map[string]string{
-					"id": certID,
-				},
-			)
-			if err != nil {
-				fmt.Printf("Unable to find certificate with ID: %s\n", certID)
-				continue
-			}
-			filteredCerts = append(filteredCerts, cert...)
-		}
-
-		sTypeLookup := make(map[string]bool)
-		if !allStores {
-			params := make(map[string]interface{})
-			allStoresResponse, _ := kfClient.ListCertificateStores(&params)
-			for _, store := range *allStoresResponse {
-				sTypeName, stErr := kfClient.GetCertificateStoreTypeById(store.CertStoreType)
-				sTypeLookup[sTypeName.ShortName] = true
-				if stErr != nil {
-					fmt.Printf("Error getting store type name for store type id %d: %s", store.CertStoreType, stErr)
-				}
-				if sIdMap[store.Id] || mNameMap[store.ClientMachine] || sTypeMap[sTypeName.ShortName] || cTypeMap[store.ContainerName] {
-					filteredStores = append(filteredStores, store)
-				}
-			}
-		} else {
-			params := make(map[string]interface{})
-			allStoresResp, fErr := kfClient.ListCertificateStores(&params)
-			if fErr != nil {
-				fmt.Printf("Error getting listing certificate stores: %s", fErr)
-				log.Fatal(fErr)
-			}
-			filteredStores = *allStoresResp
+		includePrivateKey, keyByDefault, password, pErr := privateKeyOptionsOf(cmd)
+		if pErr != nil {
+			return pErr
+		}
+		storeAliases, vErr := validateInventoryAddOptions(kfClient, filteredStores, alias, includePrivateKey, keyByDefault)
+		if vErr != nil {
+			return vErr
 		}
 
 		for _, store := range filteredStores {
-			schedule := &api.InventorySchedule{
-				Immediate: boolToPointer(true),
-			}
 			for _, cert := range filteredCerts {
-				st := api.CertificateStore{
-					//TODO: This conversion is weird. Should be able to use the store directly.
-					CertificateStoreId: store.Id,
-					Alias:              cert.Thumbprint,
-					Overwrite:          true,
-					EntryPassword:      nil,
-					PfxPassword:        "",
-					IncludePrivateKey:  true,
-				}
-				var stores []api.CertificateStore
-				stores = append(stores, st)
-				addReq := api.AddCertificateToStore{
-					CertificateId:     cert.Id,
-					CertificateStores: &stores,
-					InventorySchedule: schedule,
-				}
 				if !dryRun {
 					if !force {
 						fmt.Printf(
@@ -371,19 +311,31 @@ attempt to add all the certificate(s) meeting the specified criteria to all stor
 						fmt.Scanln(&answer)
 						if answer != "y" {
 							fmt.Println("Aborting")
-							return
+							// jobs already scheduled for earlier stores are still waited on and reported
+							return finishInventoryJobs(tracker, timeout, scheduleErrs)
 						}
 					}
-					_, err := kfClient.AddCertificateToStores(&addReq)
+					_, err := scheduleCertificateAdd(
+						kfClient,
+						tracker,
+						store,
+						cert.Id,
+						cert.Thumbprint,
+						storeAliases.aliasFor(store.Id, cert.Thumbprint),
+						overwrite,
+						storeAliases.includePrivateKeyFor(store.Id, includePrivateKey),
+						password,
+					)
 					if err != nil {
 						fmt.Printf(
 							"Error adding certificate %s(%d) to store %s: %s\n",
 							cert.IssuedCN,
 							cert.Id,
-							st.CertificateStoreId,
+							store.Id,
 							err,
 						)
 						log.Printf("[ERROR]  %s", err)
+						scheduleErrs++
 						continue
 					}
 				} else {
@@ -391,22 +343,24 @@ attempt to add all the certificate(s) meeting the specified criteria to all stor
 						"Dry run: Would have added certificate %s(%d) from store %s",
 						cert.IssuedDN,
 						cert.Id,
-						st.CertificateStoreId,
+						store.Id,
 					)
 				}
 			}
 
 		}
 		fmt.Println("Inventory updated successfully")
+		return finishInventoryJobs(tracker, timeout, scheduleErrs)
 	},
 }
 
 var inventoryRemoveCmd = &cobra.Command{
 	Use:   "remove",
 	Short: "Removes a certificate from the certificate store inventory.",
-	Long:  `Removes a certificate from the certificate store inventory.`,
-	Run: func(cmd *cobra.Command, args []string) {
-
+	Long: `Removes a certificate from the certificate store inventory.
+Use --wait to wait for the scheduled orchestrator jobs to complete and report their results.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
 		isExperimental := true
 
 		_, expErr := isExperimentalFeatureEnabled(expEnabled, isExperimental)
@@ -419,6 +373,8 @@ var inventoryRemoveCmd = &cobra.Command{
 		log.Println("Debug mode enabled: ", debugModeEnabled)
 		force, _ := cmd.Flags().GetBool("force")
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
 
 		storeIDs, _ := cmd.Flags().GetStringSlice("sid")
 		thumbprints, _ := cmd.Flags().GetStringSlice("thumbprint")
@@ -443,88 +399,21 @@ var inventoryRemoveCmd = &cobra.Command{
 
 		if storeIDs == nil && machineNames == nil && storeTypes == nil && containerType == nil && !allStores {
 			fmt.Println("You must specify at least one of the following options: --sid, --client, --store-type, --container, --all")
-			return
+			return nil
 		}
 
-		sIdMap := make(map[string]bool)
-		for _, sId := range storeIDs {
-			sIdMap[sId] = true
-		}
-		mNameMap := make(map[string]bool)
-		for _, mName := range machineNames {
-			mNameMap[mName] = true
+		tracker, tErr := newInventoryJobTracker(wait && !dryRun)
+		if tErr != nil {
+			return tErr
 		}
-		sTypeMap := make(map[string]bool)
-		for _, sType := range storeTypes {
-			sTypeMap[sType] = true
-		}
-		cTypeMap := make(map[string]bool)
-		for _, cType := range containerType {
-			cTypeMap[cType] = true
-		}
-		var filteredStores []api.GetCertificateStoreResponse
-		var filteredCerts []api.GetCertificateResponse
+		scheduleErrs := 0
 
-		for _, cn := range subjects {
-			cert, err := kfClient.ListCertificates(
-				map[string]string{
-					"subject": cn,
-				},
-			)
-			if err != nil {
-				fmt.Printf("Unable to find certificate with subject: %s\n", cn)
-				continue
-			}
-			filteredCerts = append(filteredCerts, cert...)
-		}
-		for _, thumbprint := range thumbprints {
-			cert, err := kfClient.ListCertificates(
-				map[string]string{
-					"thumbprint": thumbprint,
-				},
-			)
-			if err != nil {
-				fmt.Printf("Unable to find certificate with thumbprint: %s\n", thumbprint)
-				continue
-			}
-			filteredCerts = append(filteredCerts, cert...)
-		}
-		for _, certID := range certIDs {
-			cert, err := kfClient.ListCertificates(
-				map[string]string{
-					"id": certID,
-				},
-			)
-			if err != nil {
-				fmt.Printf("Unable to find certificate with ID: %s\n", certID)
-				continue
-			}
-			filteredCerts = append(filteredCerts, cert...)
-		}
-
-		sTypeLookup := make(map[string]bool)
-		if !allStores {
-			params := make(map[string]interface{})
-			allStoresResponse, _ := kfClient.ListCertificateStores(&params)
-			for _, store := range *allStoresResponse {
-				sTypeName, stErr := kfClient.GetCertificateStoreTypeById(store.CertStoreType)
-				sTypeLookup[sTypeName.ShortName] = true
-				if stErr != nil {
-					fmt.Printf("Error getting store type name for store type id %d: %s\n", store.CertStoreType, stErr)
-					log.Fatal(stErr)
-				}
-				if sIdMap[store.Id] || mNameMap[store.ClientMachine] || sTypeMap[sTypeName.ShortName] || cTypeMap[store.ContainerName] {
-					filteredStores = append(filteredStores, store)
-				}
-			}
-		} else {
-			params := make(map[string]interface{})
-			allStoresResp, fErr := kfClient.ListCertificateStores(&params)
-			if fErr != nil {
-				fmt.Printf("Error listing certificate stores: %s\n", fErr)
-				log.Fatal(fErr)
-			}
-			filteredStores = *allStoresResp
+		filteredCerts := findCertificates(kfClient, subjects, thumbprints, certIDs)
+
+		filteredStores, fErr := selectInventoryStores(kfClient, storeIDs, machineNames, storeTypes, containerType, allStores)
+		if fErr != nil {
+			fmt.Printf("Error listing certificate stores: %s\n", fErr)
+			log.Fatal(fErr)
 		}
 
 		for _, store := range filteredStores {
@@ -560,10 +449,11 @@ var inventoryRemoveCmd = &cobra.Command{
 						fmt.Scanln(&answer)
 						if answer != "y" {
 							fmt.Println("Aborting")
-							return
+							// jobs already scheduled for earlier stores are still waited on and reported
+							return finishInventoryJobs(tracker, timeout, scheduleErrs)
 						}
 					}
-					_, err := kfClient.RemoveCertificateFromStores(&removeReq)
+					jobIds, err := kfClient.RemoveCertificateFromStores(&removeReq)
 					if err != nil {
 						fmt.Printf(
 							"Error removing certificate %s to store %s: %s\n",
@@ -572,8 +462,18 @@ var inventoryRemoveCmd = &cobra.Command{
 							err,
 						)
 						log.Printf("[ERROR] %s", err)
+						scheduleErrs++
 						continue
 					}
+					if tracker != nil {
+						tracker.track(
+							jobIds,
+							store.Id,
+							store.ClientMachine,
+							store.StorePath,
+							fmt.Sprintf("remove %s(%d)", cert.Thumbprint, cert.Id),
+						)
+					}
 				} else {
 					fmt.Printf(
 						"Dry run: Would have removed certificate %s from store %s\n",
@@ -585,6 +485,7 @@ var inventoryRemoveCmd = &cobra.Command{
 
 		}
 		fmt.Println("Inventory updated successfully")
+		return finishInventoryJobs(tracker, timeout, scheduleErrs)
 	},
 }
 
@@ -724,6 +625,7 @@ func init() {
 	storesCmd.AddCommand(inventoryCmd)
 
 	inventoryCmd.AddCommand(inventoryClearCmd)
+	addJobWaitFlags(inventoryClearCmd)
 	inventoryClearCmd.Flags().StringSliceVar(
 		&ids,
 		"sid",
@@ -761,8 +663,19 @@ func init() {
 		false,
 		"Do not remove inventory, only show what would be removed.",
 	)
+	inventoryClearCmd.Flags().Bool(
+		"no-backup",
+		false,
+		"Do not snapshot the store inventory before clearing it.",
+	)
+	inventoryClearCmd.Flags().String(
+		"backup-file",
+		"",
+		"Path to write the inventory snapshot to. Defaults to inventory-snapshot-<unix time>.json",
+	)
 
 	inventoryCmd.AddCommand(inventoryAddCmd)
+	addJobWaitFlags(inventoryAddCmd)
 	inventoryAddCmd.Flags().StringSliceVar(
 		&ids,
 		"sid",
@@ -813,8 +726,20 @@ func init() {
 		"Force addition of inventory without prompting for confirmation.",
 	)
 	inventoryAddCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Do not add inventory, only show what would be added.")
+	inventoryAddCmd.Flags().String(
+		"alias",
+		"",
+		"Alias to add the certificate to the store(s) with. Defaults to the certificate thumbprint when the store type allows custom aliases.",
+	)
+	inventoryAddCmd.Flags().Bool(
+		"overwrite",
+		true,
+		"Overwrite an existing certificate with the same alias in the store(s).",
+	)
+	addPrivateKeyFlags(inventoryAddCmd)
 
 	inventoryCmd.AddCommand(inventoryRemoveCmd)
+	addJobWaitFlags(inventoryRemoveCmd)
 	inventoryRemoveCmd.Flags().StringSliceVar(
 		&ids,
 		"sid",
@@ -903,3 +828,354 @@ func init() {
 	)
 
 }
+
+// newInventoryJobTracker returns a job tracker when waiting on scheduled jobs is requested, otherwise nil.
+func newInventoryJobTracker(wait bool) (*jobTracker, error) {
+	if !wait {
+		return nil, nil
+	}
+	sdkClient, err := initGenClient(false)
+	if err != nil {
+		return nil, err
+	}
+	return newJobTracker(sdkClient), nil
+}
+
+// finishInventoryJobs waits on any tracked jobs and returns an error if scheduling or any job failed.
+func finishInventoryJobs(tracker *jobTracker, timeout time.Duration, scheduleErrs int) error {
+	var jobErr error
+	if tracker != nil {
+		jobErr = waitForJobs(tracker, timeout)
+	}
+	if scheduleErrs > 0 {
+		schedErr := fmt.Errorf("%d inventory job(s) could not be scheduled", scheduleErrs)
+		if jobErr != nil {
+			return fmt.Errorf("%s; %s", schedErr, jobErr)
+		}
+		return schedErr
+	}
+	return jobErr
+}
+
+// scheduleCertificateAdd schedules an immediate job adding a certificate to a store and returns the scheduled job IDs.
+// The job is tracked when a tracker is given.
+func scheduleCertificateAdd(
+	kfClient *api.Client,
+	tracker *jobTracker,
+	store api.GetCertificateStoreResponse,
+	certId int,
+	thumbprint string,
+	alias string,
+	overwrite bool,
+	includePrivateKey bool,
+	pfxPassword string,
+) ([]string, error) {
+	stores := []api.CertificateStore{
+		{
+			CertificateStoreId: store.Id,
+			Alias:              alias,
+			Overwrite:          overwrite,
+			EntryPassword:      nil,
+			PfxPassword:        pfxPassword,
+			IncludePrivateKey:  includePrivateKey,
+		},
+	}
+	addReq := api.AddCertificateToStore{
+		CertificateId:     certId,
+		CertificateStores: &stores,
+		InventorySchedule: &api.InventorySchedule{Immediate: boolToPointer(true)},
+	}
+	jobIds, err := kfClient.AddCertificateToStores(&addReq)
+	if err != nil {
+		return nil, err
+	}
+	if tracker != nil {
+		tracker.track(
+			jobIds,
+			store.Id,
+			store.ClientMachine,
+			store.StorePath,
+			fmt.Sprintf("add %s(%d)", thumbprint, certId),
+		)
+	}
+	return jobIds, nil
+}
+
+// scheduleCertificateRemove schedules an immediate job removing a certificate from a store by alias and returns the
+// scheduled job IDs. The job is tracked when a tracker is given.
+func scheduleCertificateRemove(
+	kfClient *api.Client,
+	tracker *jobTracker,
+	store api.GetCertificateStoreResponse,
+	certId int,
+	thumbprint string,
+	alias string,
+) ([]string, error) {
+	removeReq := api.RemoveCertificateFromStore{
+		CertificateId: certId,
+		CertificateStores: &[]api.CertificateStore{
+			{
+				CertificateStoreId: store.Id,
+				Alias:              alias,
+			},
+		},
+		InventorySchedule: &api.InventorySchedule{Immediate: boolToPointer(true)},
+	}
+	jobIds, err := kfClient.RemoveCertificateFromStores(&removeReq)
+	if err != nil {
+		return nil, err
+	}
+	if tracker != nil {
+		tracker.track(
+			jobIds,
+			store.Id,
+			store.ClientMachine,
+			store.StorePath,
+			fmt.Sprintf("remove %s(%d)", thumbprint, certId),
+		)
+	}
+	return jobIds, nil
+}
+
+// selectInventoryStores returns the certificate stores matching any of the given store IDs, client machines,
+// store type short names or container names. When all is set every certificate store is returned.
+func selectInventoryStores(
+	kfClient *api.Client,
+	storeIDs []string,
+	clientMachines []string,
+	storeTypes []string,
+	containers []string,
+	all bool,
+) ([]api.GetCertificateStoreResponse, error) {
+	params := make(map[string]interface{})
+	allStoresResp, err := kfClient.ListCertificateStores(&params)
+	if err != nil {
+		return nil, err
+	}
+	if allStoresResp == nil {
+		return nil, nil
+	}
+	if all {
+		return *allStoresResp, nil
+	}
+
+	sIdMap := make(map[string]bool)
+	for _, sId := range storeIDs {
+		sIdMap[sId] = true
+	}
+	mNameMap := make(map[string]bool)
+	for _, mName := range clientMachines {
+		mNameMap[mName] = true
+	}
+	sTypeMap := make(map[string]bool)
+	for _, sType := range storeTypes {
+		sTypeMap[sType] = true
+	}
+	cTypeMap := make(map[string]bool)
+	for _, cType := range containers {
+		cTypeMap[cType] = true
+	}
+
+	sTypeNames := make(map[int]string)
+	var filteredStores []api.GetCertificateStoreResponse
+	for _, store := range *allStoresResp {
+		sTypeName, ok := sTypeNames[store.CertStoreType]
+		if !ok && len(sTypeMap) > 0 {
+			sType, stErr := kfClient.GetCertificateStoreTypeById(store.CertStoreType)
+			if stErr != nil {
+				return nil, fmt.Errorf("unable to get store type name for store type id %d: %s", store.CertStoreType, stErr)
+			}
+			sTypeName = sType.ShortName
+			sTypeNames[store.CertStoreType] = sTypeName
+		}
+		if sIdMap[store.Id] || mNameMap[store.ClientMachine] || sTypeMap[sTypeName] || cTypeMap[store.ContainerName] {
+			filteredStores = append(filteredStores, store)
+		}
+	}
+	return filteredStores, nil
+}
+
+// Values of the PrivateKeyAllowed and CustomAliasAllowed store type settings.
+const (
+	storeTypeSettingForbidden = "Forbidden"
+	storeTypeSettingRequired  = "Required"
+)
+
+// storeAliasPolicy holds the alias to use for each store after validation against its store type, and the stores
+// that get a certificate without its private key because their type forbids one.
+type storeAliasPolicy struct {
+	alias        string
+	forbidden    map[string]bool
+	noPrivateKey map[string]bool
+}
+
+// aliasFor returns the alias to add a certificate to the given store with.
+func (p storeAliasPolicy) aliasFor(storeId string, thumbprint string) string {
+	if p.forbidden[storeId] {
+		return ""
+	}
+	if p.alias != "" {
+		return p.alias
+	}
+	return thumbprint
+}
+
+// check records the alias and private key policy of a store's type and returns the reasons the store can't accept a
+// certificate with the given options.
+func (p storeAliasPolicy) check(
+	store api.GetCertificateStoreResponse,
+	sType *api.CertificateStoreType,
+	includePrivateKey bool,
+	keyByDefault bool,
+) []string {
+	var problems []string
+	storeName := fmt.Sprintf("%s (%s:%s, %s)", store.Id, store.ClientMachine, store.StorePath, sType.ShortName)
+
+	switch sType.PrivateKeyAllowed {
+	case storeTypeSettingRequired:
+		if !includePrivateKey {
+			problems = append(problems, fmt.Sprintf("%s requires a private key, use --include-private-key", storeName))
+		}
+	case storeTypeSettingForbidden:
+		if includePrivateKey && keyByDefault {
+			p.noPrivateKey[store.Id] = true
+		} else if includePrivateKey {
+			problems = append(problems, fmt.Sprintf("%s does not allow private keys", storeName))
+		}
+	}
+
+	// a Required custom alias is satisfied by aliasFor, which falls back to the thumbprint
+	switch sType.CustomAliasAllowed {
+	case storeTypeSettingForbidden:
+		if p.alias != "" {
+			problems = append(problems, fmt.Sprintf("%s does not allow custom aliases", storeName))
+		}
+		p.forbidden[store.Id] = true
+	}
+	return problems
+}
+
+// includePrivateKeyFor reports whether a certificate is added to the given store with its private key.
+func (p storeAliasPolicy) includePrivateKeyFor(storeId string, includePrivateKey bool) bool {
+	return includePrivateKey && !p.noPrivateKey[storeId]
+}
+
+// addPrivateKeyFlags registers the flags controlling whether added certificates are delivered with their private key
+// and the password protecting it.
+func addPrivateKeyFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool(
+		"include-private-key",
+		true,
+		"Include the certificate's private key, for the stores whose type allows one unless set explicitly. When set explicitly, requires one of --pfx-password, --pfx-password-env or --generate-pfx-password.",
+	)
+	cmd.Flags().String(
+		"pfx-password",
+		"",
+		"Password used to protect the private key when it is delivered to the orchestrator.",
+	)
+	cmd.Flags().String(
+		"pfx-password-env",
+		"",
+		"Name of an environment variable holding the password used to protect the private key.",
+	)
+	cmd.Flags().Bool(
+		"generate-pfx-password",
+		false,
+		"Generate a random password to protect the private key when it is delivered to the orchestrator.",
+	)
+	cmd.MarkFlagsMutuallyExclusive("pfx-password", "pfx-password-env", "generate-pfx-password")
+}
+
+// privateKeyOptionsOf reads the flags registered by addPrivateKeyFlags. It returns whether private keys are included,
+// whether that is only the default, and the password protecting them. A password is generated when private keys are
+// included by default and no password is given.
+func privateKeyOptionsOf(cmd *cobra.Command) (bool, bool, string, error) {
+	includePrivateKey, _ := cmd.Flags().GetBool("include-private-key")
+	pfxPassword, _ := cmd.Flags().GetString("pfx-password")
+	pfxPasswordEnv, _ := cmd.Flags().GetString("pfx-password-env")
+	generatePfxPassword, _ := cmd.Flags().GetBool("generate-pfx-password")
+
+	// private keys are included by default, as they were before --include-private-key existed
+	keyByDefault := !cmd.Flags().Changed("include-private-key")
+	if keyByDefault && includePrivateKey && pfxPassword == "" && pfxPasswordEnv == "" {
+		generatePfxPassword = true
+	}
+	password, err := resolvePfxPassword(includePrivateKey, pfxPassword, pfxPasswordEnv, generatePfxPassword)
+	return includePrivateKey, keyByDefault, password, err
+}
+
+// resolvePfxPassword returns the password used to protect the private key in transit to the orchestrator.
+func resolvePfxPassword(includePrivateKey bool, password string, passwordEnv string, generate bool) (string, error) {
+	if !includePrivateKey {
+		if password != "" || passwordEnv != "" || generate {
+			return "", fmt.Errorf("a PFX password can only be used with --include-private-key")
+		}
+		return "", nil
+	}
+	switch {
+	case password != "":
+		return password, nil
+	case passwordEnv != "":
+		v, ok := os.LookupEnv(passwordEnv)
+		if !ok || v == "" {
+			return "", fmt.Errorf("environment variable %s is not set", passwordEnv)
+		}
+		return v, nil
+	case generate:
+		return generateRandomPassword(32)
+	default:
+		return "", fmt.Errorf("--include-private-key requires one of --pfx-password, --pfx-password-env or --generate-pfx-password")
+	}
+}
+
+// generateRandomPassword returns a random alphanumeric password of the given length.
+func generateRandomPassword(length int) (string, error) {
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// rand.Int draws uniformly, so every character is equally likely
+	size := big.NewInt(int64(len(charset)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b[i] = charset[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// validateInventoryAddOptions checks the alias and private key options against the PrivateKeyAllowed and
+// CustomAliasAllowed settings of every target store's type. All violations are reported together so that no
+// jobs are scheduled unless every store can accept the certificate. When keyByDefault is set the private key is
+// included without being asked for, and stores whose type forbids private keys get the certificate without it.
+func validateInventoryAddOptions(
+	kfClient *api.Client,
+	stores []api.GetCertificateStoreResponse,
+	alias string,
+	includePrivateKey bool,
+	keyByDefault bool,
+) (storeAliasPolicy, error) {
+	policy := storeAliasPolicy{alias: alias, forbidden: make(map[string]bool), noPrivateKey: make(map[string]bool)}
+	storeTypes := make(map[int]*api.CertificateStoreType)
+	var problems []string
+	for _, store := range stores {
+		sType, ok := storeTypes[store.CertStoreType]
+		if !ok {
+			var err error
+			sType, err = kfClient.GetCertificateStoreTypeById(store.CertStoreType)
+			if err != nil {
+				return policy, fmt.Errorf("unable to get store type %d of store %s: %s", store.CertStoreType, store.Id, err)
+			}
+			storeTypes[store.CertStoreType] = sType
+		}
+		problems = append(problems, policy.check(store, sType, includePrivateKey, keyByDefault)...)
+	}
+	if len(problems) > 0 {
+		return policy, fmt.Errorf(
+			"the certificate(s) cannot be added to %d store(s):\n  %s",
+			len(problems),
+			strings.Join(problems, "\n  "),
+		)
+	}
+	return policy, nil
+}
@@ -0,0 +1,547 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// inventoryRow is a single (store, alias, certificate) row of a flattened inventory export.
+type inventoryRow struct {
+	StoreId       string `json:"store_id"`
+	ClientMachine string `json:"client_machine"`
+	StorePath     string `json:"store_path"`
+	Alias         string `json:"alias"`
+	CertificateId int    `json:"certificate_id"`
+	Thumbprint    string `json:"thumbprint"`
+	Subject       string `json:"subject"`
+	Issuer        string `json:"issuer"`
+	NotAfter      string `json:"not_after"`
+	KeyType       string `json:"key_type"`
+}
+
+var inventoryExportHeader = []string{
+	"StoreId",
+	"ClientMachine",
+	"StorePath",
+	"Alias",
+	"CertificateId",
+	"Thumbprint",
+	"Subject",
+	"Issuer",
+	"NotAfter",
+	"KeyType",
+}
+
+func (r inventoryRow) csvRecord() []string {
+	return []string{
+		r.StoreId,
+		r.ClientMachine,
+		r.StorePath,
+		r.Alias,
+		fmt.Sprintf("%d", r.CertificateId),
+		r.Thumbprint,
+		r.Subject,
+		r.Issuer,
+		r.NotAfter,
+		r.KeyType,
+	}
+}
+
+// inventoryDiffEntry describes how a single alias differs between two inventories.
+type inventoryDiffEntry struct {
+	Alias       string `json:"alias"`
+	Change      string `json:"change"`
+	ThumbprintA string `json:"thumbprint_a,omitempty"`
+	ThumbprintB string `json:"thumbprint_b,omitempty"`
+	SubjectA    string `json:"subject_a,omitempty"`
+	SubjectB    string `json:"subject_b,omitempty"`
+}
+
+const (
+	inventoryDiffMissing   = "missing"
+	inventoryDiffExtra     = "extra"
+	inventoryDiffDifferent = "different"
+)
+
+var inventoryExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the inventory of one or more certificate stores as flat CSV or JSON rows.",
+	Long: `Exports the inventory of one or more certificate stores as flat CSV or JSON rows. Each row holds the store,
+alias, certificate ID, thumbprint, subject, issuer, expiration and key type of a single inventory entry.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := true
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		storeIDs, _ := cmd.Flags().GetStringSlice("sid")
+		clientMachines, _ := cmd.Flags().GetStringSlice("client")
+		storeTypes, _ := cmd.Flags().GetStringSlice("store-type")
+		containers, _ := cmd.Flags().GetStringSlice("container")
+		allStores, _ := cmd.Flags().GetBool("all")
+		outPath, _ := cmd.Flags().GetString("out")
+		fileFormat, _ := cmd.Flags().GetString("file-format")
+
+		if !allStores && len(storeIDs) == 0 && len(clientMachines) == 0 && len(storeTypes) == 0 && len(containers) == 0 {
+			return fmt.Errorf("at least one store parameter must be specified: [sid, client, store-type, container], or --all")
+		}
+		fileFormat = exportFileFormat(fileFormat, outPath)
+		if fileFormat != "csv" && fileFormat != "json" {
+			return fmt.Errorf("unsupported file format %q, must be one of: csv, json", fileFormat)
+		}
+
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			return cErr
+		}
+		sdkClient, sErr := initGenClient(false)
+		if sErr != nil {
+			return sErr
+		}
+
+		stores, fErr := selectInventoryStores(kfClient, storeIDs, clientMachines, storeTypes, containers, allStores)
+		if fErr != nil {
+			return fErr
+		}
+		rows, rErr := getInventoryRows(kfClient, sdkClient, stores)
+		if rErr != nil {
+			return rErr
+		}
+
+		var out io.Writer = os.Stdout
+		if outPath != "" {
+			f, err := os.Create(outPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		if wErr := writeInventoryRows(out, rows, fileFormat); wErr != nil {
+			return wErr
+		}
+		if outPath != "" {
+			fmt.Printf("Exported %d inventory row(s) from %d store(s) to %s\n", len(rows), len(stores), outPath)
+		}
+		return nil
+	},
+}
+
+var inventoryDiffCmd = &cobra.Command{
+	Use:   "diff <storeA> <storeB>",
+	Short: "Compares the inventory of two certificate stores, or a store and an export file.",
+	Long: `Compares the inventory of two certificate stores, or a store and an export file, alias by alias. Each argument
+is either a Keyfactor Command certificate store ID or the path to a file written by 'inventory export'. Certificates
+present in A but not in B are reported as missing, certificates present in B but not in A as extra, and aliases that
+hold a different certificate in each as different.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := true
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		exportStore, _ := cmd.Flags().GetString("export-store")
+		exitCode, _ := cmd.Flags().GetBool("exit-code")
+
+		var (
+			kfClient  *api.Client
+			sdkClient *keyfactor.APIClient
+		)
+		load := func(source string) ([]inventoryRow, error) {
+			if _, err := os.Stat(source); err == nil {
+				return loadInventoryRows(source, exportStore)
+			}
+			if kfClient == nil {
+				var cErr error
+				if kfClient, cErr = initClient(false); cErr != nil {
+					return nil, cErr
+				}
+				if sdkClient, cErr = initGenClient(false); cErr != nil {
+					return nil, cErr
+				}
+			}
+			store, err := kfClient.GetCertificateStoreByID(source)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get certificate store %s: %s", source, err)
+			}
+			return getInventoryRows(kfClient, sdkClient, []api.GetCertificateStoreResponse{*store})
+		}
+
+		rowsA, aErr := load(args[0])
+		if aErr != nil {
+			return aErr
+		}
+		rowsB, bErr := load(args[1])
+		if bErr != nil {
+			return bErr
+		}
+
+		diff := diffInventoryRows(rowsA, rowsB)
+		printInventoryDiff(args[0], args[1], diff, outputFormat)
+		if exitCode && len(diff) > 0 {
+			return fmt.Errorf("%d difference(s) found", len(diff))
+		}
+		return nil
+	},
+}
+
+// getInventoryRows flattens the inventory of the given stores, enriching each certificate with its subject,
+// issuer, expiration and key type from Keyfactor Command.
+func getInventoryRows(
+	kfClient *api.Client,
+	sdkClient *keyfactor.APIClient,
+	stores []api.GetCertificateStoreResponse,
+) ([]inventoryRow, error) {
+	var rows []inventoryRow
+	certIds := make(map[int]bool)
+	for _, store := range stores {
+		inv, err := kfClient.GetCertStoreInventory(store.Id)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get inventory of certificate store %s: %s", store.Id, err)
+		}
+		if inv == nil {
+			continue
+		}
+		for _, item := range *inv {
+			if len(item.Certificates) == 0 {
+				continue
+			}
+			leaf := item.Certificates[0]
+			rows = append(
+				rows, inventoryRow{
+					StoreId:       store.Id,
+					ClientMachine: store.ClientMachine,
+					StorePath:     store.StorePath,
+					Alias:         item.Name,
+					CertificateId: leaf.Id,
+					Thumbprint:    strings.ToUpper(leaf.Thumbprint),
+					Subject:       leaf.IssuedDN,
+					Issuer:        leaf.IssuerDN,
+				},
+			)
+			certIds[leaf.Id] = true
+		}
+	}
+
+	details, dErr := getCertificatesById(sdkClient, certIds, false)
+	if dErr != nil {
+		log.Error().Err(dErr).Msg("unable to look up certificate details")
+		return nil, dErr
+	}
+	for i, row := range rows {
+		cert, ok := details[row.CertificateId]
+		if !ok {
+			continue
+		}
+		if row.Subject == "" {
+			rows[i].Subject = nullableString(cert.IssuedDN)
+		}
+		if row.Issuer == "" {
+			rows[i].Issuer = nullableString(cert.IssuerDN)
+		}
+		if cert.NotAfter != nil {
+			rows[i].NotAfter = cert.NotAfter.UTC().Format(time.RFC3339)
+		}
+		rows[i].KeyType = cert.GetKeyTypeString()
+	}
+	return rows, nil
+}
+
+// exportFileFormat returns the export file format, inferring it from the output file extension when not set.
+func exportFileFormat(format string, outPath string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	if strings.EqualFold(filepath.Ext(outPath), ".json") {
+		return "json"
+	}
+	return "csv"
+}
+
+func writeInventoryRows(w io.Writer, rows []inventoryRow, format string) error {
+	if format == "json" {
+		if rows == nil {
+			rows = []inventoryRow{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(inventoryExportHeader); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(row.csvRecord()); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// loadInventoryRows reads a file written by 'inventory export'. When the file holds more than one store, storeId
+// selects the store to use.
+func loadInventoryRows(path string, storeId string) ([]inventoryRow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []inventoryRow
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if jErr := json.Unmarshal(data, &rows); jErr != nil {
+			return nil, fmt.Errorf("unable to parse inventory export %s: %s", path, jErr)
+		}
+	} else {
+		records, cErr := csv.NewReader(strings.NewReader(stripAllBOMs(string(data)))).ReadAll()
+		if cErr != nil {
+			return nil, fmt.Errorf("unable to parse inventory export %s: %s", path, cErr)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("inventory export %s is empty", path)
+		}
+		columns := make(map[string]int)
+		for i, name := range records[0] {
+			columns[name] = i
+		}
+		for _, required := range []string{"StoreId", "Alias", "Thumbprint"} {
+			if _, ok := columns[required]; !ok {
+				return nil, fmt.Errorf("inventory export %s is missing the %s column", path, required)
+			}
+		}
+		get := func(record []string, name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		for _, record := range records[1:] {
+			var certId int
+			fmt.Sscanf(get(record, "CertificateId"), "%d", &certId)
+			rows = append(
+				rows, inventoryRow{
+					StoreId:       get(record, "StoreId"),
+					ClientMachine: get(record, "ClientMachine"),
+					StorePath:     get(record, "StorePath"),
+					Alias:         get(record, "Alias"),
+					CertificateId: certId,
+					Thumbprint:    strings.ToUpper(get(record, "Thumbprint")),
+					Subject:       get(record, "Subject"),
+					Issuer:        get(record, "Issuer"),
+					NotAfter:      get(record, "NotAfter"),
+					KeyType:       get(record, "KeyType"),
+				},
+			)
+		}
+	}
+
+	storeIds := make(map[string]bool)
+	for _, row := range rows {
+		storeIds[row.StoreId] = true
+	}
+	if storeId == "" {
+		if len(storeIds) > 1 {
+			return nil, fmt.Errorf(
+				"inventory export %s contains %d stores, use --export-store to select one",
+				path,
+				len(storeIds),
+			)
+		}
+		return rows, nil
+	}
+	var filtered []inventoryRow
+	for _, row := range rows {
+		if row.StoreId == storeId {
+			filtered = append(filtered, row)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("inventory export %s has no rows for store %s", path, storeId)
+	}
+	return filtered, nil
+}
+
+// diffInventoryRows compares two inventories alias by alias, treating A as the reference.
+func diffInventoryRows(a []inventoryRow, b []inventoryRow) []inventoryDiffEntry {
+	byAliasA := make(map[string]inventoryRow)
+	for _, row := range a {
+		byAliasA[row.Alias] = row
+	}
+	byAliasB := make(map[string]inventoryRow)
+	for _, row := range b {
+		byAliasB[row.Alias] = row
+	}
+
+	var diff []inventoryDiffEntry
+	for alias, rowA := range byAliasA {
+		rowB, ok := byAliasB[alias]
+		switch {
+		case !ok:
+			diff = append(
+				diff, inventoryDiffEntry{
+					Alias:       alias,
+					Change:      inventoryDiffMissing,
+					ThumbprintA: rowA.Thumbprint,
+					SubjectA:    rowA.Subject,
+				},
+			)
+		case !strings.EqualFold(rowA.Thumbprint, rowB.Thumbprint):
+			diff = append(
+				diff, inventoryDiffEntry{
+					Alias:       alias,
+					Change:      inventoryDiffDifferent,
+					ThumbprintA: rowA.Thumbprint,
+					ThumbprintB: rowB.Thumbprint,
+					SubjectA:    rowA.Subject,
+					SubjectB:    rowB.Subject,
+				},
+			)
+		}
+	}
+	for alias, rowB := range byAliasB {
+		if _, ok := byAliasA[alias]; !ok {
+			diff = append(
+				diff, inventoryDiffEntry{
+					Alias:       alias,
+					Change:      inventoryDiffExtra,
+					ThumbprintB: rowB.Thumbprint,
+					SubjectB:    rowB.Subject,
+				},
+			)
+		}
+	}
+	sort.Slice(
+		diff, func(i, j int) bool {
+			if diff[i].Alias != diff[j].Alias {
+				return diff[i].Alias < diff[j].Alias
+			}
+			return diff[i].Change < diff[j].Change
+		},
+	)
+	return diff
+}
+
+func printInventoryDiff(nameA string, nameB string, diff []inventoryDiffEntry, format string) {
+	if format == "json" {
+		if diff == nil {
+			diff = []inventoryDiffEntry{}
+		}
+		out, _ := json.MarshalIndent(diff, "", "  ")
+		outputResult(string(out), format)
+		return
+	}
+	if len(diff) == 0 {
+		fmt.Printf("No differences between %s and %s\n", nameA, nameB)
+		return
+	}
+	fmt.Printf("A: %s\nB: %s\n\n", nameA, nameB)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANGE\tALIAS\tTHUMBPRINT A\tTHUMBPRINT B\tSUBJECT")
+	for _, d := range diff {
+		subject := d.SubjectA
+		if subject == "" {
+			subject = d.SubjectB
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Change, d.Alias, d.ThumbprintA, d.ThumbprintB, subject)
+	}
+	w.Flush()
+}
+
+func init() {
+	var (
+		ids        []string
+		clients    []string
+		types      []string
+		containers []string
+		all        bool
+		outPath    string
+		fileFormat string
+	)
+
+	inventoryCmd.AddCommand(inventoryExportCmd)
+	inventoryExportCmd.Flags().StringSliceVar(
+		&ids,
+		"sid",
+		[]string{},
+		"The Keyfactor Command ID of the certificate store(s) to export.",
+	)
+	inventoryExportCmd.Flags().StringSliceVar(
+		&clients,
+		"client",
+		[]string{},
+		"Export the inventory of stores of specific client machine(s).",
+	)
+	inventoryExportCmd.Flags().StringSliceVar(
+		&types,
+		"store-type",
+		[]string{},
+		"Export the inventory of stores of specific store type(s).",
+	)
+	inventoryExportCmd.Flags().StringSliceVar(
+		&containers,
+		"container",
+		[]string{},
+		"Export the inventory of stores of specific container type(s).",
+	)
+	inventoryExportCmd.Flags().BoolVar(&all, "all", false, "Export the inventory of all certificate stores.")
+	inventoryExportCmd.Flags().StringVarP(
+		&outPath,
+		"out",
+		"o",
+		"",
+		"Path to write the export to. Defaults to stdout.",
+	)
+	inventoryExportCmd.Flags().StringVar(
+		&fileFormat,
+		"file-format",
+		"",
+		"Export file format, csv or json. Defaults to the --out file extension, or csv.",
+	)
+
+	inventoryCmd.AddCommand(inventoryDiffCmd)
+	inventoryDiffCmd.Flags().String(
+		"export-store",
+		"",
+		"Store ID to compare when an export file holds more than one store.",
+	)
+	inventoryDiffCmd.Flags().Bool(
+		"exit-code",
+		false,
+		"Exit with a non-zero exit code when differences are found.",
+	)
+}
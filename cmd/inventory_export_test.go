@@ -0,0 +1,70 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiffInventoryRows(t *testing.T) {
+	a := []inventoryRow{
+		{Alias: "same", Thumbprint: "AAAA"},
+		{Alias: "changed", Thumbprint: "BBBB"},
+		{Alias: "only-a", Thumbprint: "CCCC"},
+	}
+	b := []inventoryRow{
+		{Alias: "same", Thumbprint: "aaaa"},
+		{Alias: "changed", Thumbprint: "DDDD"},
+		{Alias: "only-b", Thumbprint: "EEEE"},
+	}
+
+	diff := diffInventoryRows(a, b)
+	assert.Len(t, diff, 3)
+	assert.Equal(t, inventoryDiffEntry{Alias: "changed", Change: inventoryDiffDifferent, ThumbprintA: "BBBB", ThumbprintB: "DDDD"}, diff[0])
+	assert.Equal(t, inventoryDiffEntry{Alias: "only-a", Change: inventoryDiffMissing, ThumbprintA: "CCCC"}, diff[1])
+	assert.Equal(t, inventoryDiffEntry{Alias: "only-b", Change: inventoryDiffExtra, ThumbprintB: "EEEE"}, diff[2])
+
+	assert.Empty(t, diffInventoryRows(a, a))
+}
+
+func Test_InventoryRowsRoundTrip(t *testing.T) {
+	rows := []inventoryRow{
+		{StoreId: "store-1", Alias: "web", CertificateId: 1, Thumbprint: "AAAA", Subject: "CN=web, O=Example"},
+		{StoreId: "store-2", Alias: "web", CertificateId: 2, Thumbprint: "BBBB", Subject: "CN=web"},
+	}
+
+	for _, format := range []string{"csv", "json"} {
+		path := filepath.Join(t.TempDir(), "export."+format)
+		f, err := os.Create(path)
+		assert.NoError(t, err)
+		assert.NoError(t, writeInventoryRows(f, rows, format))
+		f.Close()
+
+		_, err = loadInventoryRows(path, "")
+		assert.Error(t, err, "multi-store exports require a store selection")
+
+		loaded, lErr := loadInventoryRows(path, "store-1")
+		assert.NoError(t, lErr)
+		assert.Equal(t, rows[:1], loaded)
+	}
+
+	assert.Equal(t, "json", exportFileFormat("", "out.JSON"))
+	assert.Equal(t, "csv", exportFileFormat("", ""))
+	assert.Equal(t, "json", exportFileFormat("JSON", "out.csv"))
+}
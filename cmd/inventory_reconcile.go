@@ -0,0 +1,637 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// inventoryManifest is the desired state of one or more certificate store inventories.
+type inventoryManifest struct {
+	Purge  bool                 `yaml:"purge"`
+	Stores []manifestStoreEntry `yaml:"stores"`
+}
+
+// manifestStoreEntry selects certificate stores by ID or selector and lists the certificates they must contain.
+type manifestStoreEntry struct {
+	Id           string                 `yaml:"id"`
+	Selector     *manifestStoreSelector `yaml:"selector"`
+	Purge        *bool                  `yaml:"purge"`
+	Certificates []manifestCertificate  `yaml:"certificates"`
+}
+
+type manifestStoreSelector struct {
+	ClientMachines []string `yaml:"clientMachines"`
+	StoreTypes     []string `yaml:"storeTypes"`
+	Containers     []string `yaml:"containers"`
+}
+
+// manifestCertificate selects one or more certificates by thumbprint, ID, collection or query.
+type manifestCertificate struct {
+	Thumbprint        string                 `yaml:"thumbprint"`
+	Id                int                    `yaml:"id"`
+	Collection        string                 `yaml:"collection"`
+	Query             string                 `yaml:"query"`
+	Alias             string                 `yaml:"alias"`
+	Overwrite         bool                   `yaml:"overwrite"`
+	IncludePrivateKey *bool                  `yaml:"includePrivateKey"`
+	PfxPassword       *passwordSource        `yaml:"pfxPassword"`
+	EntryParameters   map[string]interface{} `yaml:"entryParameters"`
+}
+
+// passwordSource describes where to read a password from. Exactly one field should be set.
+type passwordSource struct {
+	Value string `yaml:"value"`
+	Env   string `yaml:"env"`
+	File  string `yaml:"file"`
+}
+
+func (p *passwordSource) resolve() (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	switch {
+	case p.Env != "":
+		v, ok := os.LookupEnv(p.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", p.Env)
+		}
+		return v, nil
+	case p.File != "":
+		data, err := os.ReadFile(p.File)
+		if err != nil {
+			return "", fmt.Errorf("unable to read password file %s: %s", p.File, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return p.Value, nil
+	}
+}
+
+type reconcileActionType string
+
+const (
+	reconcileAdd      reconcileActionType = "add"
+	reconcileRemove   reconcileActionType = "remove"
+	reconcileConflict reconcileActionType = "conflict"
+)
+
+// reconcileAction is a single add or remove job required to bring a store to its desired state.
+type reconcileAction struct {
+	Type              reconcileActionType
+	Store             api.GetCertificateStoreResponse
+	CertificateId     int
+	Thumbprint        string
+	Alias             string
+	Overwrite         bool
+	IncludePrivateKey bool
+	PfxPassword       string
+	EntryParameters   map[string]interface{}
+	Reason            string
+}
+
+// desiredCertificate is a resolved certificate that must be present in a store. Policy holds the result of validating
+// its alias and private key options against the store types of the stores it must be present in.
+type desiredCertificate struct {
+	Id                int
+	Thumbprint        string
+	Alias             string
+	Overwrite         bool
+	IncludePrivateKey bool
+	KeyByDefault      bool
+	PfxPassword       string
+	EntryParameters   map[string]interface{}
+	Policy            storeAliasPolicy
+}
+
+// aliasIn returns the alias the certificate is added to the given store with, which defaults to the thumbprint like
+// 'inventory add' does unless the store type forbids custom aliases.
+func (d desiredCertificate) aliasIn(storeId string) string {
+	policy := d.Policy
+	policy.alias = d.Alias
+	return policy.aliasFor(storeId, strings.ToUpper(d.Thumbprint))
+}
+
+var inventoryReconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Reconciles certificate store inventories with a desired-state manifest.",
+	Long: `Reconciles certificate store inventories with a desired-state manifest. The manifest lists certificate stores,
+by ID or selector, and the certificates each store must contain, by thumbprint, ID, collection or query. Certificates
+missing from a store are added and, when purge is enabled, certificates not listed in the manifest are removed. A
+certificate whose alias conflicts with a desired certificate is never removed. Certificates are added with their
+private key, protected by a generated password, for every store whose type allows one unless includePrivateKey is set.
+includePrivateKey: true requires a pfxPassword and fails for stores whose type forbids private keys. A plan of the
+required changes is printed before any jobs are scheduled.
+
+Example manifest:
+
+  purge: false
+  stores:
+    - id: 00000000-0000-0000-0000-000000000000
+      certificates:
+        - thumbprint: 0123456789ABCDEF0123456789ABCDEF01234567
+          alias: web
+          overwrite: true
+          pfxPassword:
+            env: WEB_PFX_PASSWORD
+    - selector:
+        storeTypes: [K8SSecret]
+        clientMachines: [cluster-1]
+      purge: true
+      certificates:
+        - collection: Trusted Roots
+          includePrivateKey: false
+        - query: IssuedCN -eq "example.com"
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := true
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		manifestPath, _ := cmd.Flags().GetString("file")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		manifest, mErr := loadInventoryManifest(manifestPath)
+		if mErr != nil {
+			return mErr
+		}
+
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			return cErr
+		}
+		sdkClient, sErr := initGenClient(false)
+		if sErr != nil {
+			return sErr
+		}
+
+		actions, pErr := planInventoryReconcile(kfClient, sdkClient, manifest)
+		if pErr != nil {
+			return pErr
+		}
+
+		changes := printReconcilePlan(actions)
+		if changes == 0 {
+			fmt.Println("All certificate stores match the manifest. Nothing to do.")
+			return nil
+		}
+		if dryRun {
+			return nil
+		}
+		if !force && !promptForInteractiveYesNo(fmt.Sprintf("Apply %d change(s)?", changes)) {
+			fmt.Println("Aborting")
+			return nil
+		}
+
+		tracker, tErr := newInventoryJobTracker(wait)
+		if tErr != nil {
+			return tErr
+		}
+		scheduleErrs := applyReconcileActions(kfClient, tracker, actions)
+		return finishInventoryJobs(tracker, timeout, scheduleErrs)
+	},
+}
+
+func loadInventoryManifest(path string) (*inventoryManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifest %s: %s", path, err)
+	}
+	var manifest inventoryManifest
+	if yErr := yaml.Unmarshal(data, &manifest); yErr != nil {
+		return nil, fmt.Errorf("unable to parse manifest %s: %s", path, yErr)
+	}
+	for i, entry := range manifest.Stores {
+		if entry.Id == "" && entry.Selector == nil {
+			return nil, fmt.Errorf("manifest store entry %d must specify an id or a selector", i+1)
+		}
+		for j, cert := range entry.Certificates {
+			selectors := 0
+			for _, set := range []bool{cert.Thumbprint != "", cert.Id != 0, cert.Collection != "", cert.Query != ""} {
+				if set {
+					selectors++
+				}
+			}
+			if selectors != 1 {
+				return nil, fmt.Errorf(
+					"manifest store entry %d certificate %d must specify exactly one of thumbprint, id, collection or query",
+					i+1,
+					j+1,
+				)
+			}
+		}
+	}
+	return &manifest, nil
+}
+
+// planInventoryReconcile resolves the stores and certificates in the manifest and computes the actions needed to
+// bring every store to its desired state.
+func planInventoryReconcile(
+	kfClient *api.Client,
+	sdkClient *keyfactor.APIClient,
+	manifest *inventoryManifest,
+) ([]reconcileAction, error) {
+	var actions []reconcileAction
+	planned := make(map[string]bool)
+	for _, entry := range manifest.Stores {
+		stores, sErr := resolveManifestStores(kfClient, entry)
+		if sErr != nil {
+			return nil, sErr
+		}
+		if len(stores) == 0 {
+			fmt.Printf("Warning: no certificate stores matched manifest entry %s\n", describeManifestStore(entry))
+			continue
+		}
+
+		var desired []desiredCertificate
+		for _, certSpec := range entry.Certificates {
+			certs, cErr := resolveManifestCertificates(kfClient, sdkClient, certSpec)
+			if cErr != nil {
+				return nil, cErr
+			}
+			policy, vErr := validateInventoryAddOptions(
+				kfClient,
+				stores,
+				certSpec.Alias,
+				certs[0].IncludePrivateKey,
+				certs[0].KeyByDefault,
+			)
+			if vErr != nil {
+				return nil, fmt.Errorf("manifest entry %s: %s", describeManifestStore(entry), vErr)
+			}
+			for i := range certs {
+				certs[i].Policy = policy
+			}
+			desired = append(desired, certs...)
+		}
+
+		purge := manifest.Purge
+		if entry.Purge != nil {
+			purge = *entry.Purge
+		}
+
+		for _, store := range stores {
+			if planned[store.Id] {
+				return nil, fmt.Errorf("certificate store %s is matched by more than one manifest entry", store.Id)
+			}
+			planned[store.Id] = true
+			inv, iErr := kfClient.GetCertStoreInventory(store.Id)
+			if iErr != nil {
+				return nil, fmt.Errorf("unable to get inventory of certificate store %s: %s", store.Id, iErr)
+			}
+			actions = append(actions, planStoreReconcile(store, inv, desired, purge)...)
+		}
+	}
+	return actions, nil
+}
+
+// planStoreReconcile compares a store's inventory with its desired certificates.
+func planStoreReconcile(
+	store api.GetCertificateStoreResponse,
+	inventory *[]api.CertStoreInventory,
+	desired []desiredCertificate,
+	purge bool,
+) []reconcileAction {
+	type entry struct {
+		alias  string
+		certId int
+		thumb  string
+	}
+	var current []entry
+	byThumb := make(map[string]entry)
+	byAlias := make(map[string]entry)
+	if inventory != nil {
+		for _, item := range *inventory {
+			if len(item.Certificates) == 0 {
+				continue
+			}
+			e := entry{
+				alias:  item.Name,
+				certId: item.Certificates[0].Id,
+				thumb:  strings.ToUpper(item.Certificates[0].Thumbprint),
+			}
+			current = append(current, e)
+			byThumb[e.thumb] = e
+			byAlias[e.alias] = e
+		}
+	}
+
+	var actions []reconcileAction
+	wanted := make(map[string]bool)
+	for _, d := range desired {
+		thumb := strings.ToUpper(d.Thumbprint)
+		if wanted[thumb] {
+			continue
+		}
+		wanted[thumb] = true
+		action := reconcileAction{
+			Type:              reconcileAdd,
+			Store:             store,
+			CertificateId:     d.Id,
+			Thumbprint:        thumb,
+			Alias:             d.aliasIn(store.Id),
+			Overwrite:         d.Overwrite,
+			IncludePrivateKey: d.Policy.includePrivateKeyFor(store.Id, d.IncludePrivateKey),
+			PfxPassword:       d.PfxPassword,
+			EntryParameters:   d.EntryParameters,
+		}
+		if existing, ok := byThumb[thumb]; ok && (d.Alias == "" || existing.alias == d.Alias) {
+			continue
+		}
+		if d.Alias != "" {
+			if existing, ok := byAlias[d.Alias]; ok && existing.thumb != thumb {
+				if !d.Overwrite {
+					action.Type = reconcileConflict
+					action.Reason = fmt.Sprintf("alias is in use by %s and overwrite is not set", existing.thumb)
+				} else {
+					action.Reason = fmt.Sprintf("replaces %s", existing.thumb)
+				}
+				// the certificate under a conflicted alias stays until the conflict is resolved, a replaced one
+				// is removed by the add itself
+				wanted[existing.thumb] = true
+			}
+		}
+		actions = append(actions, action)
+	}
+
+	if purge {
+		for _, e := range current {
+			if wanted[e.thumb] {
+				continue
+			}
+			actions = append(
+				actions, reconcileAction{
+					Type:          reconcileRemove,
+					Store:         store,
+					CertificateId: e.certId,
+					Thumbprint:    e.thumb,
+					Alias:         e.alias,
+					Reason:        "not listed in manifest",
+				},
+			)
+		}
+	}
+	return actions
+}
+
+func resolveManifestStores(kfClient *api.Client, entry manifestStoreEntry) ([]api.GetCertificateStoreResponse, error) {
+	if entry.Id != "" {
+		store, err := kfClient.GetCertificateStoreByID(entry.Id)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get certificate store %s: %s", entry.Id, err)
+		}
+		return []api.GetCertificateStoreResponse{*store}, nil
+	}
+	return selectInventoryStores(
+		kfClient,
+		nil,
+		entry.Selector.ClientMachines,
+		entry.Selector.StoreTypes,
+		entry.Selector.Containers,
+		false,
+	)
+}
+
+func describeManifestStore(entry manifestStoreEntry) string {
+	if entry.Id != "" {
+		return entry.Id
+	}
+	return fmt.Sprintf(
+		"selector(clientMachines=%v, storeTypes=%v, containers=%v)",
+		entry.Selector.ClientMachines,
+		entry.Selector.StoreTypes,
+		entry.Selector.Containers,
+	)
+}
+
+// resolveManifestCertificates looks up the certificates selected by a manifest certificate entry.
+func resolveManifestCertificates(
+	kfClient *api.Client,
+	sdkClient *keyfactor.APIClient,
+	spec manifestCertificate,
+) ([]desiredCertificate, error) {
+	var (
+		query        string
+		collectionId int32
+		description  string
+	)
+	switch {
+	case spec.Thumbprint != "":
+		query = fmt.Sprintf("Thumbprint -eq \"%s\"", spec.Thumbprint)
+		description = fmt.Sprintf("thumbprint %s", spec.Thumbprint)
+	case spec.Id != 0:
+		query = fmt.Sprintf("CertId -eq %d", spec.Id)
+		description = fmt.Sprintf("ID %d", spec.Id)
+	case spec.Collection != "":
+		id, cErr := resolveCollectionId(sdkClient, spec.Collection)
+		if cErr != nil {
+			return nil, cErr
+		}
+		collectionId = id
+		description = fmt.Sprintf("collection %s", spec.Collection)
+	default:
+		query = spec.Query
+		description = fmt.Sprintf("query %q", spec.Query)
+	}
+
+	certs, err := queryCertificates(sdkClient, certificateQuery{Query: query, CollectionId: collectionId})
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up certificates by %s: %s", description, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found by %s", description)
+	}
+	if spec.Alias != "" && len(certs) > 1 {
+		return nil, fmt.Errorf("alias %q can only be used with a single certificate, %s matched %d", spec.Alias, description, len(certs))
+	}
+
+	password, pErr := spec.PfxPassword.resolve()
+	if pErr != nil {
+		return nil, pErr
+	}
+	// without includePrivateKey, keys are included for the stores whose type allows them, like inventory add does
+	keyByDefault := spec.IncludePrivateKey == nil
+	includePrivateKey := keyByDefault || *spec.IncludePrivateKey
+	if includePrivateKey && password == "" {
+		if !keyByDefault {
+			return nil, fmt.Errorf("certificates selected by %s include their private key but have no pfxPassword", description)
+		}
+		password, pErr = generateRandomPassword(32)
+		if pErr != nil {
+			return nil, pErr
+		}
+	}
+
+	var desired []desiredCertificate
+	for _, cert := range certs {
+		desired = append(
+			desired, desiredCertificate{
+				Id:                int(cert.GetId()),
+				Thumbprint:        cert.GetThumbprint(),
+				Alias:             spec.Alias,
+				Overwrite:         spec.Overwrite,
+				IncludePrivateKey: includePrivateKey,
+				KeyByDefault:      keyByDefault,
+				PfxPassword:       password,
+				EntryParameters:   spec.EntryParameters,
+			},
+		)
+	}
+	return desired, nil
+}
+
+// printReconcilePlan prints the plan grouped by store and returns the number of changes to apply.
+func printReconcilePlan(actions []reconcileAction) int {
+	changes := 0
+	lastStore := ""
+	for _, action := range actions {
+		if action.Store.Id != lastStore {
+			fmt.Printf("\nStore %s (%s:%s)\n", action.Store.Id, action.Store.ClientMachine, action.Store.StorePath)
+			lastStore = action.Store.Id
+		}
+		alias := action.Alias
+		if alias == "" {
+			alias = "<default>"
+		}
+		line := fmt.Sprintf("%s (%d) as %s", action.Thumbprint, action.CertificateId, alias)
+		if action.Reason != "" {
+			line = fmt.Sprintf("%s: %s", line, action.Reason)
+		}
+		switch action.Type {
+		case reconcileAdd:
+			changes++
+			fmt.Printf("  + add %s\n", line)
+		case reconcileRemove:
+			changes++
+			fmt.Printf("  - remove %s\n", line)
+		case reconcileConflict:
+			fmt.Printf("  ! skip %s\n", line)
+		}
+	}
+	fmt.Println()
+	return changes
+}
+
+// applyReconcileActions schedules the add and remove jobs in the plan and returns the number that failed to schedule.
+func applyReconcileActions(kfClient *api.Client, tracker *jobTracker, actions []reconcileAction) int {
+	scheduleErrs := 0
+	for _, action := range actions {
+		if action.Type == reconcileConflict {
+			continue
+		}
+		st := api.CertificateStore{
+			CertificateStoreId: action.Store.Id,
+			Alias:              action.Alias,
+			JobFields:          action.EntryParameters,
+			Overwrite:          action.Overwrite,
+			PfxPassword:        action.PfxPassword,
+			IncludePrivateKey:  action.IncludePrivateKey,
+		}
+		schedule := &api.InventorySchedule{
+			Immediate: boolToPointer(true),
+		}
+
+		var (
+			jobIds []string
+			err    error
+		)
+		if action.Type == reconcileAdd {
+			jobIds, err = kfClient.AddCertificateToStores(
+				&api.AddCertificateToStore{
+					CertificateId:     action.CertificateId,
+					CertificateStores: &[]api.CertificateStore{st},
+					InventorySchedule: schedule,
+				},
+			)
+		} else {
+			jobIds, err = kfClient.RemoveCertificateFromStores(
+				&api.RemoveCertificateFromStore{
+					CertificateId:     action.CertificateId,
+					CertificateStores: &[]api.CertificateStore{st},
+					InventorySchedule: schedule,
+				},
+			)
+		}
+		if err != nil {
+			fmt.Printf(
+				"Error scheduling %s of certificate %s(%d) on store %s: %s\n",
+				action.Type,
+				action.Thumbprint,
+				action.CertificateId,
+				action.Store.Id,
+				err,
+			)
+			log.Error().Err(err).Str("store", action.Store.Id).Msg("unable to schedule reconcile job")
+			scheduleErrs++
+			continue
+		}
+		if tracker != nil {
+			tracker.track(
+				jobIds,
+				action.Store.Id,
+				action.Store.ClientMachine,
+				action.Store.StorePath,
+				fmt.Sprintf("%s %s(%d)", action.Type, action.Thumbprint, action.CertificateId),
+			)
+		}
+	}
+	return scheduleErrs
+}
+
+func init() {
+	var (
+		manifestPath string
+		force        bool
+		dryRun       bool
+	)
+
+	inventoryCmd.AddCommand(inventoryReconcileCmd)
+	inventoryReconcileCmd.Flags().StringVarP(
+		&manifestPath,
+		"file",
+		"f",
+		"",
+		"Path to the desired-state manifest (YAML).",
+	)
+	inventoryReconcileCmd.Flags().BoolVar(
+		&force,
+		"force",
+		false,
+		"Apply the plan without prompting for confirmation.",
+	)
+	inventoryReconcileCmd.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"Only print the plan, do not schedule any jobs.",
+	)
+	addJobWaitFlags(inventoryReconcileCmd)
+	inventoryReconcileCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PlanStoreReconcile(t *testing.T) {
+	store := api.GetCertificateStoreResponse{Id: "store-1"}
+	inventory := []api.CertStoreInventory{
+		{Name: "keep", Certificates: []api.InventoriedCertificate{{Id: 1, Thumbprint: "aaaa"}}},
+		{Name: "web", Certificates: []api.InventoriedCertificate{{Id: 2, Thumbprint: "bbbb"}}},
+		{Name: "db", Certificates: []api.InventoriedCertificate{{Id: 3, Thumbprint: "cccc"}}},
+		{Name: "stale", Certificates: []api.InventoriedCertificate{{Id: 4, Thumbprint: "dddd"}}},
+	}
+	desired := []desiredCertificate{
+		{Id: 1, Thumbprint: "AAAA"},
+		{Id: 5, Thumbprint: "EEEE", Alias: "web", Overwrite: true},
+		{Id: 6, Thumbprint: "FFFF", Alias: "db"},
+		{Id: 7, Thumbprint: "1111"},
+	}
+
+	actions := planStoreReconcile(store, &inventory, desired, false)
+	assert.Len(t, actions, 3)
+	assert.Equal(t, reconcileAdd, actions[0].Type)
+	assert.Equal(t, "web", actions[0].Alias)
+	assert.True(t, actions[0].Overwrite)
+	assert.Equal(t, reconcileConflict, actions[1].Type)
+	assert.Equal(t, "db", actions[1].Alias)
+	assert.Equal(t, reconcileAdd, actions[2].Type)
+	assert.Equal(t, 7, actions[2].CertificateId)
+
+	actions = planStoreReconcile(store, &inventory, desired, true)
+	var removed []string
+	for _, a := range actions {
+		if a.Type == reconcileRemove {
+			removed = append(removed, a.Alias)
+		}
+	}
+	assert.ElementsMatch(t, []string{"stale"}, removed)
+
+	desired[0].Policy = storeAliasPolicy{noPrivateKey: map[string]bool{"store-1": true}}
+	desired[0].Thumbprint = "9999"
+	desired[0].IncludePrivateKey = true
+	desired[1].IncludePrivateKey = true
+	actions = planStoreReconcile(store, &inventory, desired[:2], false)
+	assert.False(t, actions[0].IncludePrivateKey)
+	assert.True(t, actions[1].IncludePrivateKey)
+	assert.Equal(t, "9999", actions[0].Alias)
+	assert.Equal(t, "web", actions[1].Alias)
+}
+
+func Test_ReconcileStoreAliasPolicy(t *testing.T) {
+	store := api.GetCertificateStoreResponse{Id: "store-1"}
+	policy := storeAliasPolicy{forbidden: make(map[string]bool), noPrivateKey: make(map[string]bool)}
+	required := &api.CertificateStoreType{ShortName: "PEM", CustomAliasAllowed: "Required", PrivateKeyAllowed: "Optional"}
+	assert.Empty(t, policy.check(store, required, true, true))
+
+	// without an alias in the manifest, a store type requiring one gets the thumbprint
+	d := desiredCertificate{Id: 1, Thumbprint: "abcd", IncludePrivateKey: true, Policy: policy}
+	actions := planStoreReconcile(store, nil, []desiredCertificate{d}, false)
+	assert.Equal(t, "ABCD", actions[0].Alias)
+	assert.True(t, actions[0].IncludePrivateKey)
+
+	forbidden := &api.CertificateStoreType{ShortName: "IIS", CustomAliasAllowed: "Forbidden", PrivateKeyAllowed: "Forbidden"}
+	assert.Empty(t, policy.check(store, forbidden, true, true))
+	d.Policy = policy
+	actions = planStoreReconcile(store, nil, []desiredCertificate{d}, false)
+	assert.Empty(t, actions[0].Alias)
+	assert.False(t, actions[0].IncludePrivateKey)
+
+	policy.alias = "web"
+	assert.Equal(
+		t,
+		[]string{"store-1 (:, IIS) does not allow custom aliases"},
+		policy.check(store, forbidden, true, true),
+	)
+}
+
+func Test_LoadInventoryManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.yaml")
+	assert.NoError(
+		t, os.WriteFile(
+			valid, []byte(`purge: true
+stores:
+  - id: store-1
+    certificates:
+      - thumbprint: AAAA
+        alias: web
+        pfxPassword:
+          env: TEST_PFX_PASSWORD
+  - selector:
+      storeTypes: [PEM]
+    purge: false
+    certificates:
+      - query: IssuedCN -eq "example.com"
+`), 0600,
+		),
+	)
+	manifest, err := loadInventoryManifest(valid)
+	assert.NoError(t, err)
+	assert.True(t, manifest.Purge)
+	assert.Len(t, manifest.Stores, 2)
+	assert.Equal(t, "TEST_PFX_PASSWORD", manifest.Stores[0].Certificates[0].PfxPassword.Env)
+	assert.False(t, *manifest.Stores[1].Purge)
+
+	t.Setenv("TEST_PFX_PASSWORD", "secret")
+	password, pErr := manifest.Stores[0].Certificates[0].PfxPassword.resolve()
+	assert.NoError(t, pErr)
+	assert.Equal(t, "secret", password)
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	assert.NoError(
+		t, os.WriteFile(
+			invalid, []byte(`stores:
+  - id: store-1
+    certificates:
+      - thumbprint: AAAA
+        id: 12
+`), 0600,
+		),
+	)
+	_, err = loadInventoryManifest(invalid)
+	assert.Error(t, err)
+}
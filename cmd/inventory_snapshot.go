@@ -0,0 +1,510 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const inventorySnapshotVersion = 1
+
+// inventorySnapshot is the on-disk representation of the inventory of one or more certificate stores.
+type inventorySnapshot struct {
+	Version   int             `json:"version"`
+	CreatedAt string          `json:"created_at"`
+	Stores    []storeSnapshot `json:"stores"`
+}
+
+type storeSnapshot struct {
+	StoreId       string          `json:"store_id"`
+	ClientMachine string          `json:"client_machine"`
+	StorePath     string          `json:"store_path"`
+	StoreType     int             `json:"store_type"`
+	ContainerName string          `json:"container_name,omitempty"`
+	Entries       []snapshotEntry `json:"entries"`
+}
+
+// snapshotEntry is a single inventory item of a store. Certificates holds the entry's certificate
+// followed by any chain certificates reported by the orchestrator.
+type snapshotEntry struct {
+	Alias        string                 `json:"alias"`
+	Certificates []snapshotCertificate  `json:"certificates"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type snapshotCertificate struct {
+	Id         int    `json:"id"`
+	Thumbprint string `json:"thumbprint"`
+	IssuedDN   string `json:"issued_dn"`
+}
+
+// leaf returns the certificate the inventory entry was created for.
+func (e snapshotEntry) leaf() (snapshotCertificate, bool) {
+	if len(e.Certificates) == 0 {
+		return snapshotCertificate{}, false
+	}
+	return e.Certificates[0], true
+}
+
+// restoreAction is a single add job required to bring a store back to its snapshot.
+type restoreAction struct {
+	Store        storeSnapshot
+	Entry        snapshotEntry
+	Certificate  snapshotCertificate
+	Overwrite    bool
+	CurrentThumb string
+}
+
+var inventorySnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Saves the inventory of one or more certificate stores to a local JSON file.",
+	Long: `Saves the inventory of one or more certificate stores to a local JSON file. The snapshot records the alias,
+certificate IDs, thumbprints and entry parameters of every inventory item and can be used with 'inventory restore'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := true
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		storeIDs, _ := cmd.Flags().GetStringSlice("sid")
+		clientMachines, _ := cmd.Flags().GetStringSlice("client")
+		storeTypes, _ := cmd.Flags().GetStringSlice("store-type")
+		containers, _ := cmd.Flags().GetStringSlice("container")
+		allStores, _ := cmd.Flags().GetBool("all")
+		outPath, _ := cmd.Flags().GetString("out")
+
+		if !allStores && len(storeIDs) == 0 && len(clientMachines) == 0 && len(storeTypes) == 0 && len(containers) == 0 {
+			return fmt.Errorf("at least one store parameter must be specified: [sid, client, store-type, container], or --all")
+		}
+
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			return cErr
+		}
+
+		stores, sErr := selectInventoryStores(kfClient, storeIDs, clientMachines, storeTypes, containers, allStores)
+		if sErr != nil {
+			return sErr
+		}
+		if len(stores) == 0 {
+			fmt.Println("No certificate stores matched the specified criteria.")
+			return nil
+		}
+
+		if outPath == "" {
+			outPath = defaultSnapshotFileName()
+		}
+		snapshot, err := writeInventorySnapshot(kfClient, stores, outPath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Inventory snapshot of %d store(s) written to %s\n", len(snapshot.Stores), outPath)
+		return nil
+	},
+}
+
+var inventoryRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restores certificate store inventory from a snapshot file.",
+	Long: `Restores certificate store inventory from a snapshot file created by 'inventory snapshot' or by 'inventory clear'.
+The current inventory of each store in the snapshot is compared to the snapshot and add jobs are scheduled for every
+entry that is missing or has a different certificate. A preview of the changes is shown before any jobs are scheduled.
+Entries are restored with their private key, protected by a generated password, for every store whose type allows
+one, and the private key options are validated against each store's type like 'inventory add' does. Use
+--include-private-key=false to restore the certificates without their keys.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		isExperimental := true
+
+		informDebug(debugFlag)
+		if expErr := warnExperimentalFeature(expEnabled, isExperimental); expErr != nil {
+			return expErr
+		}
+
+		fromPath, _ := cmd.Flags().GetString("from")
+		storeIDs, _ := cmd.Flags().GetStringSlice("sid")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		snapshot, lErr := loadInventorySnapshot(fromPath)
+		if lErr != nil {
+			return lErr
+		}
+
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			return cErr
+		}
+
+		sIdMap := make(map[string]bool)
+		for _, sId := range storeIDs {
+			sIdMap[sId] = true
+		}
+
+		var actions []restoreAction
+		for _, store := range snapshot.Stores {
+			if len(sIdMap) > 0 && !sIdMap[store.StoreId] {
+				continue
+			}
+			current, iErr := kfClient.GetCertStoreInventory(store.StoreId)
+			if iErr != nil {
+				log.Error().Err(iErr).Str("store", store.StoreId).Msg("unable to get current store inventory")
+				return fmt.Errorf("unable to get inventory of certificate store %s: %s", store.StoreId, iErr)
+			}
+			actions = append(actions, planInventoryRestore(store, current)...)
+		}
+
+		if len(actions) == 0 {
+			fmt.Println("All certificate stores already match the snapshot. Nothing to restore.")
+			return nil
+		}
+
+		includePrivateKey, keyByDefault, password, pErr := privateKeyOptionsOf(cmd)
+		if pErr != nil {
+			return pErr
+		}
+		// aliases come from the snapshot, stores whose type forbids custom aliases name the entries themselves
+		storeAliases, vErr := validateInventoryAddOptions(
+			kfClient,
+			restoreStores(actions),
+			"",
+			includePrivateKey,
+			keyByDefault,
+		)
+		if vErr != nil {
+			return vErr
+		}
+
+		printRestorePlan(actions)
+		if dryRun {
+			return nil
+		}
+		if !force && !promptForInteractiveYesNo(fmt.Sprintf("Schedule %d add job(s)?", len(actions))) {
+			fmt.Println("Aborting")
+			return nil
+		}
+
+		tracker, tErr := newInventoryJobTracker(wait)
+		if tErr != nil {
+			return tErr
+		}
+		scheduleErrs := 0
+		for _, action := range actions {
+			addReq := api.AddCertificateToStore{
+				CertificateId: action.Certificate.Id,
+				CertificateStores: &[]api.CertificateStore{
+					{
+						CertificateStoreId: action.Store.StoreId,
+						Alias:              storeAliases.aliasFor(action.Store.StoreId, action.Entry.Alias),
+						JobFields:          action.Entry.Parameters,
+						Overwrite:          action.Overwrite,
+						PfxPassword:        password,
+						IncludePrivateKey:  storeAliases.includePrivateKeyFor(action.Store.StoreId, includePrivateKey),
+					},
+				},
+				InventorySchedule: &api.InventorySchedule{
+					Immediate: boolToPointer(true),
+				},
+			}
+			jobIds, err := kfClient.AddCertificateToStores(&addReq)
+			if err != nil {
+				fmt.Printf(
+					"Error adding certificate %s(%d) to store %s as %q: %s\n",
+					action.Certificate.Thumbprint,
+					action.Certificate.Id,
+					action.Store.StoreId,
+					action.Entry.Alias,
+					err,
+				)
+				log.Error().Err(err).Str("store", action.Store.StoreId).Msg("unable to schedule restore job")
+				scheduleErrs++
+				continue
+			}
+			if tracker != nil {
+				tracker.track(
+					jobIds,
+					action.Store.StoreId,
+					action.Store.ClientMachine,
+					action.Store.StorePath,
+					fmt.Sprintf("restore %s as %q", action.Certificate.Thumbprint, action.Entry.Alias),
+				)
+			}
+		}
+		fmt.Printf("Scheduled %d of %d restore job(s)\n", len(actions)-scheduleErrs, len(actions))
+		return finishInventoryJobs(tracker, timeout, scheduleErrs)
+	},
+}
+
+// restoreStores returns the stores the restore actions add certificates to.
+func restoreStores(actions []restoreAction) []api.GetCertificateStoreResponse {
+	var stores []api.GetCertificateStoreResponse
+	seen := make(map[string]bool)
+	for _, action := range actions {
+		if seen[action.Store.StoreId] {
+			continue
+		}
+		seen[action.Store.StoreId] = true
+		stores = append(
+			stores, api.GetCertificateStoreResponse{
+				Id:            action.Store.StoreId,
+				ClientMachine: action.Store.ClientMachine,
+				StorePath:     action.Store.StorePath,
+				CertStoreType: action.Store.StoreType,
+			},
+		)
+	}
+	return stores
+}
+
+func defaultSnapshotFileName() string {
+	return fmt.Sprintf("inventory-snapshot-%s.json", getCurrentTime("unix"))
+}
+
+// buildInventorySnapshot reads the current inventory of each store.
+func buildInventorySnapshot(kfClient *api.Client, stores []api.GetCertificateStoreResponse) (*inventorySnapshot, error) {
+	snapshot := &inventorySnapshot{
+		Version:   inventorySnapshotVersion,
+		CreatedAt: getCurrentTime(""),
+	}
+	for _, store := range stores {
+		log.Debug().Str("store", store.Id).Msg(fmt.Sprintf("%s GetCertStoreInventory", DebugFuncCall))
+		inv, err := kfClient.GetCertStoreInventory(store.Id)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get inventory of certificate store %s: %s", store.Id, err)
+		}
+		sSnap := storeSnapshot{
+			StoreId:       store.Id,
+			ClientMachine: store.ClientMachine,
+			StorePath:     store.StorePath,
+			StoreType:     store.CertStoreType,
+			ContainerName: store.ContainerName,
+			Entries:       []snapshotEntry{},
+		}
+		if inv != nil {
+			for _, item := range *inv {
+				entry := snapshotEntry{
+					Alias:      item.Name,
+					Parameters: item.Parameters,
+				}
+				for _, cert := range item.Certificates {
+					entry.Certificates = append(
+						entry.Certificates, snapshotCertificate{
+							Id:         cert.Id,
+							Thumbprint: cert.Thumbprint,
+							IssuedDN:   cert.IssuedDN,
+						},
+					)
+				}
+				sSnap.Entries = append(sSnap.Entries, entry)
+			}
+		}
+		snapshot.Stores = append(snapshot.Stores, sSnap)
+	}
+	return snapshot, nil
+}
+
+// writeInventorySnapshot snapshots the given stores and writes the result to path.
+func writeInventorySnapshot(
+	kfClient *api.Client,
+	stores []api.GetCertificateStoreResponse,
+	path string,
+) (*inventorySnapshot, error) {
+	snapshot, err := buildInventorySnapshot(kfClient, stores)
+	if err != nil {
+		return nil, err
+	}
+	data, mErr := json.MarshalIndent(snapshot, "", "  ")
+	if mErr != nil {
+		return nil, mErr
+	}
+	if wErr := os.WriteFile(path, data, 0600); wErr != nil {
+		return nil, fmt.Errorf("unable to write inventory snapshot to %s: %s", path, wErr)
+	}
+	return snapshot, nil
+}
+
+func loadInventorySnapshot(path string) (*inventorySnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read inventory snapshot %s: %s", path, err)
+	}
+	var snapshot inventorySnapshot
+	if jErr := json.Unmarshal(data, &snapshot); jErr != nil {
+		return nil, fmt.Errorf("unable to parse inventory snapshot %s: %s", path, jErr)
+	}
+	if snapshot.Version > inventorySnapshotVersion {
+		return nil, fmt.Errorf(
+			"inventory snapshot %s has version %d, this version of kfutil supports up to version %d",
+			path,
+			snapshot.Version,
+			inventorySnapshotVersion,
+		)
+	}
+	return &snapshot, nil
+}
+
+// planInventoryRestore compares a store snapshot to the store's current inventory and returns the add jobs
+// needed to restore every entry that is missing or holds a different certificate.
+func planInventoryRestore(store storeSnapshot, current *[]api.CertStoreInventory) []restoreAction {
+	currentThumbs := make(map[string]string)
+	if current != nil {
+		for _, item := range *current {
+			if len(item.Certificates) > 0 {
+				currentThumbs[item.Name] = strings.ToUpper(item.Certificates[0].Thumbprint)
+			} else {
+				currentThumbs[item.Name] = ""
+			}
+		}
+	}
+
+	var actions []restoreAction
+	for _, entry := range store.Entries {
+		leaf, ok := entry.leaf()
+		if !ok {
+			continue
+		}
+		thumb, exists := currentThumbs[entry.Alias]
+		if exists && thumb == strings.ToUpper(leaf.Thumbprint) {
+			continue
+		}
+		actions = append(
+			actions, restoreAction{
+				Store:        store,
+				Entry:        entry,
+				Certificate:  leaf,
+				Overwrite:    exists,
+				CurrentThumb: thumb,
+			},
+		)
+	}
+	sort.SliceStable(
+		actions, func(i, j int) bool {
+			return actions[i].Entry.Alias < actions[j].Entry.Alias
+		},
+	)
+	return actions
+}
+
+func printRestorePlan(actions []restoreAction) {
+	lastStore := ""
+	for _, action := range actions {
+		if action.Store.StoreId != lastStore {
+			fmt.Printf(
+				"\nStore %s (%s:%s)\n",
+				action.Store.StoreId,
+				action.Store.ClientMachine,
+				action.Store.StorePath,
+			)
+			lastStore = action.Store.StoreId
+		}
+		if action.Overwrite {
+			fmt.Printf(
+				"  ~ %s: %s -> %s (%d)\n",
+				action.Entry.Alias,
+				action.CurrentThumb,
+				action.Certificate.Thumbprint,
+				action.Certificate.Id,
+			)
+			continue
+		}
+		fmt.Printf("  + %s: %s (%d)\n", action.Entry.Alias, action.Certificate.Thumbprint, action.Certificate.Id)
+	}
+	fmt.Println()
+}
+
+func init() {
+	var (
+		ids        []string
+		clients    []string
+		types      []string
+		containers []string
+		all        bool
+		outPath    string
+		fromPath   string
+		force      bool
+		dryRun     bool
+	)
+
+	inventoryCmd.AddCommand(inventorySnapshotCmd)
+	inventorySnapshotCmd.Flags().StringSliceVar(
+		&ids,
+		"sid",
+		[]string{},
+		"The Keyfactor Command ID of the certificate store(s) to snapshot.",
+	)
+	inventorySnapshotCmd.Flags().StringSliceVar(
+		&clients,
+		"client",
+		[]string{},
+		"Snapshot the inventory of stores of specific client machine(s).",
+	)
+	inventorySnapshotCmd.Flags().StringSliceVar(
+		&types,
+		"store-type",
+		[]string{},
+		"Snapshot the inventory of stores of specific store type(s).",
+	)
+	inventorySnapshotCmd.Flags().StringSliceVar(
+		&containers,
+		"container",
+		[]string{},
+		"Snapshot the inventory of stores of specific container type(s).",
+	)
+	inventorySnapshotCmd.Flags().BoolVar(&all, "all", false, "Snapshot the inventory of all certificate stores.")
+	inventorySnapshotCmd.Flags().StringVarP(
+		&outPath,
+		"out",
+		"o",
+		"",
+		"Path to write the snapshot to. Defaults to inventory-snapshot-<unix time>.json",
+	)
+
+	inventoryCmd.AddCommand(inventoryRestoreCmd)
+	inventoryRestoreCmd.Flags().StringVar(&fromPath, "from", "", "Path to the inventory snapshot file to restore.")
+	inventoryRestoreCmd.Flags().StringSliceVar(
+		&ids,
+		"sid",
+		[]string{},
+		"Only restore the certificate store(s) with the given Keyfactor Command ID(s).",
+	)
+	inventoryRestoreCmd.Flags().BoolVar(
+		&force,
+		"force",
+		false,
+		"Schedule the restore jobs without prompting for confirmation.",
+	)
+	inventoryRestoreCmd.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"Only show the changes that would be made to restore the snapshot.",
+	)
+	addJobWaitFlags(inventoryRestoreCmd)
+	addPrivateKeyFlags(inventoryRestoreCmd)
+	inventoryRestoreCmd.MarkFlagRequired("from")
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PlanInventoryRestore(t *testing.T) {
+	store := storeSnapshot{
+		StoreId:   "store-1",
+		StoreType: 5,
+		Entries: []snapshotEntry{
+			{Alias: "unchanged", Certificates: []snapshotCertificate{{Id: 1, Thumbprint: "aaaa"}}},
+			{Alias: "replaced", Certificates: []snapshotCertificate{{Id: 2, Thumbprint: "bbbb"}}},
+			{Alias: "missing", Certificates: []snapshotCertificate{{Id: 3, Thumbprint: "cccc"}}},
+			{Alias: "empty"},
+		},
+	}
+	current := []api.CertStoreInventory{
+		{Name: "unchanged", Certificates: []api.InventoriedCertificate{{Id: 1, Thumbprint: "AAAA"}}},
+		{Name: "replaced", Certificates: []api.InventoriedCertificate{{Id: 9, Thumbprint: "ZZZZ"}}},
+	}
+
+	actions := planInventoryRestore(store, &current)
+	assert.Len(t, actions, 2)
+	assert.Equal(t, "missing", actions[0].Entry.Alias)
+	assert.False(t, actions[0].Overwrite)
+	assert.Equal(t, 3, actions[0].Certificate.Id)
+	assert.Equal(t, "replaced", actions[1].Entry.Alias)
+	assert.True(t, actions[1].Overwrite)
+	assert.Equal(t, "ZZZZ", actions[1].CurrentThumb)
+
+	stores := restoreStores(actions)
+	assert.Len(t, stores, 1)
+	assert.Equal(t, "store-1", stores[0].Id)
+	assert.Equal(t, 5, stores[0].CertStoreType)
+}
+
+func Test_LoadInventorySnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	data, _ := json.Marshal(inventorySnapshot{Version: inventorySnapshotVersion, Stores: []storeSnapshot{{StoreId: "s"}}})
+	assert.NoError(t, os.WriteFile(valid, data, 0600))
+	snapshot, err := loadInventorySnapshot(valid)
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.Stores, 1)
+
+	future := filepath.Join(dir, "future.json")
+	data, _ = json.Marshal(inventorySnapshot{Version: inventorySnapshotVersion + 1})
+	assert.NoError(t, os.WriteFile(future, data, 0600))
+	_, err = loadInventorySnapshot(future)
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ResolvePfxPassword(t *testing.T) {
+	password, err := resolvePfxPassword(false, "", "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, password)
+
+	_, err = resolvePfxPassword(false, "secret", "", false)
+	assert.Error(t, err)
+
+	_, err = resolvePfxPassword(true, "", "", false)
+	assert.Error(t, err)
+
+	password, err = resolvePfxPassword(true, "secret", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", password)
+
+	t.Setenv("KFUTIL_TEST_PFX_PASSWORD", "from-env")
+	password, err = resolvePfxPassword(true, "", "KFUTIL_TEST_PFX_PASSWORD", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", password)
+
+	_, err = resolvePfxPassword(true, "", "KFUTIL_TEST_PFX_PASSWORD_UNSET", false)
+	assert.Error(t, err)
+
+	password, err = resolvePfxPassword(true, "", "", true)
+	assert.NoError(t, err)
+	assert.Len(t, password, 32)
+}
+
+func Test_StoreAliasPolicy(t *testing.T) {
+	policy := storeAliasPolicy{forbidden: map[string]bool{"no-alias": true}}
+	assert.Equal(t, "AAAA", policy.aliasFor("store", "AAAA"))
+	assert.Empty(t, policy.aliasFor("no-alias", "AAAA"))
+
+	policy.alias = "web"
+	assert.Equal(t, "web", policy.aliasFor("store", "AAAA"))
+
+	policy.noPrivateKey = map[string]bool{"no-key": true}
+	assert.True(t, policy.includePrivateKeyFor("store", true))
+	assert.False(t, policy.includePrivateKeyFor("no-key", true))
+	assert.False(t, policy.includePrivateKeyFor("store", false))
+}
+
+func Test_GenerateRandomPassword(t *testing.T) {
+	password, err := generateRandomPassword(32)
+	assert.NoError(t, err)
+	assert.Len(t, password, 32)
+	assert.Regexp(t, `^[a-zA-Z0-9]+$`, password)
+
+	// every character is drawn, about 100 times each
+	password, err = generateRandomPassword(6200)
+	assert.NoError(t, err)
+	seen := make(map[rune]bool)
+	for _, r := range password {
+		seen[r] = true
+	}
+	assert.Len(t, seen, 62)
+}
@@ -0,0 +1,318 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// Orchestrator job history result codes as reported by Keyfactor Command.
+const (
+	jobResultUnknown int32 = 0
+	jobResultSuccess int32 = 1
+	jobResultWarning int32 = 2
+	jobResultFailure int32 = 3
+)
+
+const (
+	jobStatusPending  = "Pending"
+	jobStatusSuccess  = "Success"
+	jobStatusWarning  = "Warning"
+	jobStatusFailure  = "Failure"
+	jobStatusTimedOut = "TimedOut"
+)
+
+const (
+	defaultJobWaitTimeout  = 10 * time.Minute
+	defaultJobPollInterval = 5 * time.Second
+	jobHistoryQueryChunk   = 20
+)
+
+// trackedJob is a single orchestrator management job scheduled by kfutil.
+type trackedJob struct {
+	JobId         string `json:"job_id"`
+	StoreId       string `json:"store_id"`
+	ClientMachine string `json:"client_machine"`
+	StorePath     string `json:"store_path"`
+	Description   string `json:"description"`
+	Status        string `json:"status"`
+	Message       string `json:"message,omitempty"`
+}
+
+func (j *trackedJob) done() bool {
+	return j.Status != jobStatusPending
+}
+
+// jobTracker polls the orchestrator job history for a set of scheduled jobs until they
+// all complete or a timeout is reached.
+type jobTracker struct {
+	client       *keyfactor.APIClient
+	jobs         []*trackedJob
+	byId         map[string]*trackedJob
+	pollInterval time.Duration
+}
+
+// jobSummary is the result of waiting on a jobTracker.
+type jobSummary struct {
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Warnings  int           `json:"warnings"`
+	Failed    int           `json:"failed"`
+	TimedOut  int           `json:"timed_out"`
+	Jobs      []*trackedJob `json:"jobs"`
+}
+
+func newJobTracker(client *keyfactor.APIClient) *jobTracker {
+	return &jobTracker{
+		client:       client,
+		byId:         make(map[string]*trackedJob),
+		pollInterval: defaultJobPollInterval,
+	}
+}
+
+// track registers the job IDs returned by a management job request.
+func (t *jobTracker) track(jobIds []string, storeId, clientMachine, storePath, description string) {
+	for _, id := range jobIds {
+		if id == "" {
+			continue
+		}
+		if _, exists := t.byId[strings.ToLower(id)]; exists {
+			continue
+		}
+		job := &trackedJob{
+			JobId:         id,
+			StoreId:       storeId,
+			ClientMachine: clientMachine,
+			StorePath:     storePath,
+			Description:   description,
+			Status:        jobStatusPending,
+		}
+		t.jobs = append(t.jobs, job)
+		t.byId[strings.ToLower(id)] = job
+	}
+}
+
+func (t *jobTracker) pending() []*trackedJob {
+	var pending []*trackedJob
+	for _, job := range t.jobs {
+		if !job.done() {
+			pending = append(pending, job)
+		}
+	}
+	return pending
+}
+
+// wait polls job history until every tracked job has completed or the timeout elapses.
+func (t *jobTracker) wait(timeout time.Duration) jobSummary {
+	log.Debug().Int("jobs", len(t.jobs)).
+		Str("timeout", timeout.String()).
+		Msg(fmt.Sprintf("%s jobTracker.wait", DebugFuncEnter))
+
+	deadline := time.Now().Add(timeout)
+	total := len(t.jobs)
+	for {
+		pending := t.pending()
+		if len(pending) == 0 {
+			break
+		}
+		if err := t.poll(pending); err != nil {
+			log.Error().Err(err).Msg("unable to poll orchestrator job history")
+			fmt.Fprintf(os.Stderr, "Warning: unable to poll job history: %s\n", err)
+		}
+		remaining := len(t.pending())
+		fmt.Fprintf(os.Stderr, "Waiting for orchestrator jobs: %d/%d complete\n", total-remaining, total)
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			for _, job := range t.pending() {
+				job.Status = jobStatusTimedOut
+				job.Message = fmt.Sprintf("job did not complete within %s", timeout)
+			}
+			break
+		}
+		time.Sleep(t.pollInterval)
+	}
+
+	summary := t.summary()
+	log.Debug().Interface("summary", summary).
+		Msg(fmt.Sprintf("%s jobTracker.wait", DebugFuncExit))
+	return summary
+}
+
+// poll looks up the job history of the given jobs, OR-ing job IDs together in chunks to
+// keep the query string a reasonable length.
+func (t *jobTracker) poll(jobs []*trackedJob) error {
+	for start := 0; start < len(jobs); start += jobHistoryQueryChunk {
+		end := start + jobHistoryQueryChunk
+		if end > len(jobs) {
+			end = len(jobs)
+		}
+		var clauses []string
+		for _, job := range jobs[start:end] {
+			clauses = append(clauses, fmt.Sprintf("JobId -eq \"%s\"", job.JobId))
+		}
+		query := strings.Join(clauses, " OR ")
+
+		log.Debug().Str("query", query).
+			Msg(fmt.Sprintf("%s OrchestratorJobGetJobHistory", DebugFuncCall))
+		history, httpResp, err := t.client.OrchestratorJobApi.OrchestratorJobGetJobHistory(context.Background()).
+			XKeyfactorRequestedWith(XKeyfactorRequestedWith).
+			XKeyfactorApiVersion(XKeyfactorApiVersion).
+			PqQueryString(query).
+			PqReturnLimit(int32(len(clauses) * 5)).
+			Execute()
+		if err != nil {
+			return returnHttpErr(httpResp, err)
+		}
+		t.update(history)
+	}
+	return nil
+}
+
+// update applies job history records to the tracked jobs. When a job has several history
+// records the most recent one wins.
+func (t *jobTracker) update(history []keyfactor.KeyfactorApiModelsCertificateStoresJobHistoryResponse) {
+	latest := make(map[string]keyfactor.KeyfactorApiModelsCertificateStoresJobHistoryResponse)
+	for _, h := range history {
+		if h.JobId == nil {
+			continue
+		}
+		id := strings.ToLower(*h.JobId)
+		prev, ok := latest[id]
+		if !ok || h.GetJobHistoryId() > prev.GetJobHistoryId() {
+			latest[id] = h
+		}
+	}
+
+	for id, h := range latest {
+		job, ok := t.byId[id]
+		if !ok || job.done() {
+			continue
+		}
+		if h.OperationEnd == nil && h.GetResult() == jobResultUnknown {
+			continue
+		}
+		job.Message = strings.TrimSpace(h.GetMessage())
+		switch h.GetResult() {
+		case jobResultSuccess:
+			job.Status = jobStatusSuccess
+		case jobResultWarning:
+			job.Status = jobStatusWarning
+		case jobResultFailure:
+			job.Status = jobStatusFailure
+		default:
+			job.Status = jobStatusFailure
+			if job.Message == "" {
+				job.Message = "job completed with an unknown result"
+			}
+		}
+	}
+}
+
+func (t *jobTracker) summary() jobSummary {
+	summary := jobSummary{Total: len(t.jobs), Jobs: t.jobs}
+	for _, job := range t.jobs {
+		switch job.Status {
+		case jobStatusSuccess:
+			summary.Succeeded++
+		case jobStatusWarning:
+			summary.Warnings++
+		case jobStatusFailure:
+			summary.Failed++
+		case jobStatusTimedOut:
+			summary.TimedOut++
+		}
+	}
+	return summary
+}
+
+// err returns a non-nil error when any job failed or did not complete in time.
+func (s jobSummary) err() error {
+	if s.Failed == 0 && s.TimedOut == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d orchestrator job(s) failed and %d timed out", s.Failed, s.Total, s.TimedOut)
+}
+
+// printJobSummary writes the job summary as a table, or as JSON when the json output format is selected.
+func printJobSummary(summary jobSummary, format string) {
+	if format == "json" {
+		out, _ := json.MarshalIndent(summary, "", "  ")
+		outputResult(string(out), format)
+		return
+	}
+
+	fmt.Printf(
+		"\nJobs: %d total, %d succeeded, %d warning(s), %d failed, %d timed out\n",
+		summary.Total,
+		summary.Succeeded,
+		summary.Warnings,
+		summary.Failed,
+		summary.TimedOut,
+	)
+	if summary.Total == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tJOB ID\tSTORE\tDESCRIPTION\tMESSAGE")
+	for _, job := range summary.Jobs {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			job.Status,
+			job.JobId,
+			fmt.Sprintf("%s:%s", job.ClientMachine, job.StorePath),
+			job.Description,
+			strings.ReplaceAll(job.Message, "\n", " "),
+		)
+	}
+	w.Flush()
+}
+
+// waitForJobs waits on all tracked jobs, prints a summary and returns an error reflecting the job outcome.
+func waitForJobs(tracker *jobTracker, timeout time.Duration) error {
+	if len(tracker.jobs) == 0 {
+		fmt.Println("No orchestrator jobs were scheduled.")
+		return nil
+	}
+	summary := tracker.wait(timeout)
+	printJobSummary(summary, outputFormat)
+	return summary.err()
+}
+
+// addJobWaitFlags registers the --wait and --timeout flags used to track scheduled orchestrator jobs.
+func addJobWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool(
+		"wait",
+		false,
+		"Wait for the scheduled orchestrator job(s) to complete and report their results.",
+	)
+	cmd.Flags().Duration(
+		"timeout",
+		defaultJobWaitTimeout,
+		"Maximum time to wait for orchestrator job(s) to complete when --wait is set.",
+	)
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/v2/api/keyfactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func jobHistoryRecord(historyId int64, jobId string, result int32, message string) keyfactor.KeyfactorApiModelsCertificateStoresJobHistoryResponse {
+	end := time.Now()
+	return keyfactor.KeyfactorApiModelsCertificateStoresJobHistoryResponse{
+		JobHistoryId: &historyId,
+		JobId:        &jobId,
+		Result:       &result,
+		Message:      &message,
+		OperationEnd: &end,
+	}
+}
+
+func Test_JobTrackerUpdate(t *testing.T) {
+	tracker := newJobTracker(nil)
+	tracker.track([]string{"AAA", "bbb", "ccc", "ddd"}, "store-1", "host", "/path", "add")
+	// duplicate job IDs are ignored
+	tracker.track([]string{"aaa"}, "store-1", "host", "/path", "add")
+	assert.Len(t, tracker.jobs, 4)
+
+	tracker.update(
+		[]keyfactor.KeyfactorApiModelsCertificateStoresJobHistoryResponse{
+			jobHistoryRecord(1, "aaa", jobResultFailure, "first attempt failed"),
+			jobHistoryRecord(2, "aaa", jobResultSuccess, ""),
+			jobHistoryRecord(3, "BBB", jobResultWarning, "certificate already present"),
+			jobHistoryRecord(4, "ccc", jobResultFailure, "access denied"),
+		},
+	)
+
+	assert.Equal(t, jobStatusSuccess, tracker.byId["aaa"].Status)
+	assert.Equal(t, jobStatusWarning, tracker.byId["bbb"].Status)
+	assert.Equal(t, jobStatusFailure, tracker.byId["ccc"].Status)
+	assert.Equal(t, "access denied", tracker.byId["ccc"].Message)
+	assert.Equal(t, jobStatusPending, tracker.byId["ddd"].Status)
+	assert.Len(t, tracker.pending(), 1)
+
+	summary := tracker.summary()
+	assert.Equal(t, 4, summary.Total)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 1, summary.Warnings)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Error(t, summary.err())
+}
+
+func Test_JobSummaryErr(t *testing.T) {
+	assert.NoError(t, jobSummary{Total: 2, Succeeded: 1, Warnings: 1}.err())
+	assert.Error(t, jobSummary{Total: 1, TimedOut: 1}.err())
+	assert.NoError(t, finishInventoryJobs(nil, time.Second, 0))
+	assert.Error(t, finishInventoryJobs(nil, time.Second, 1))
+}
@@ -172,14 +172,7 @@ func generateAuditReport(
 	actions := make(map[string][]ROTAction)
 
 	for _, cert := range addCerts {
-		certLookupReq := api.GetCertificateContextArgs{
-			IncludeMetadata:  boolToPointer(true),
-			IncludeLocations: boolToPointer(true),
-			CollectionId:     nil,
-			Thumbprint:       cert,
-			Id:               0,
-		}
-		certLookup, err := kfClient.GetCertificateContext(&certLookupReq)
+		certLookup, err := getCertificateByThumbprint(kfClient, cert)
 		if err != nil {
 			fmt.Printf("[ERROR] looking up certificate %s: %s\n", cert, err)
 			log.Printf("[ERROR] looking up cert: %s\n%v", cert, err)
@@ -256,14 +249,7 @@ func generateAuditReport(
 		}
 	}
 	for _, cert := range removeCerts {
-		certLookupReq := api.GetCertificateContextArgs{
-			IncludeMetadata:  boolToPointer(true),
-			IncludeLocations: boolToPointer(true),
-			CollectionId:     nil,
-			Thumbprint:       cert,
-			Id:               0,
-		}
-		certLookup, err := kfClient.GetCertificateContext(&certLookupReq)
+		certLookup, err := getCertificateByThumbprint(kfClient, cert)
 		if err != nil {
 			log.Printf("[ERROR] looking up cert: %s", err)
 			continue
@@ -1083,14 +1069,7 @@ the utility will first generate an audit report and then execute the add/remove
 
 					if cid == -1 && tp != "" {
 						log.Debug().Msg("creating lookup by thumbprint request")
-						certLookupReq := api.GetCertificateContextArgs{
-							IncludeMetadata:  boolToPointer(true),
-							IncludeLocations: boolToPointer(true),
-							CollectionId:     nil,
-							Thumbprint:       tp,
-							Id:               0,
-						}
-						certLookup, certLookupErr := kfClient.GetCertificateContext(&certLookupReq)
+						certLookup, certLookupErr := getCertificateByThumbprint(kfClient, tp)
 						if certLookupErr != nil {
 							outputError(certLookupErr, true, outputFormat)
 							log.Error().Err(certLookupErr).Str("thumbprint", tp).Msg("failed looking up cert")
@@ -1611,24 +1590,12 @@ the utility will first generate an audit report and then execute the add/remove
 					Int("collections", collections).
 					Msg("processing collections")
 				for _, c := range collection {
-					q := make(map[string]string)
-					q["collection"] = c
-					log.Debug().Str("collection", c).Msg("calling ListCertificateStores")
-					certsResp, scErr := kfClient.ListCertificates(q)
+					certsResp, scErr := listCertificatesBy(kfClient, certLookupCollection, c)
 					if scErr != nil {
 						log.Error().Err(scErr).Str("collection", c).Msg("failed to list certificates by collection")
 						outputError(scErr, true, format)
 						return scErr
 					}
-					if certsResp == nil {
-						invalidRespErr := fmt.Errorf(
-							"invalid response from Keyfactor Command when listing certificates by collection '%s'",
-							c,
-						)
-						outputError(invalidRespErr, true, format)
-						log.Error().Err(invalidRespErr).Str("collection", c).Msg("invalid response")
-						return invalidRespErr
-					}
 					for _, cert := range certsResp {
 						if !rowLookup[cert.Thumbprint] {
 							lineData := []string{
@@ -1660,28 +1627,12 @@ the utility will first generate an audit report and then execute the add/remove
 					Int("subjectNames", cns).
 					Msg("processing subject-names")
 				for _, s := range subjectName {
-					q := make(map[string]string)
-					q["subject"] = s
-
-					log.Debug().Str("subjectName", s).Msg("calling ListCertificates")
-					certsResp, scErr := kfClient.ListCertificates(q)
+					certsResp, scErr := listCertificatesBy(kfClient, certLookupSubject, s)
 					if scErr != nil {
 						log.Error().Err(scErr).Str("subjectName", s).Msg("failed to list certificates by subject name")
 						outputError(scErr, true, format)
 						return scErr
 					}
-					if certsResp == nil {
-						invalidRespErr := fmt.Errorf(
-							"invalid response returned from Keyfactor Command when calling ListCertificates by subject name '%s'",
-							s,
-						)
-						log.Error().
-							Err(invalidRespErr).
-							Str("subjectName", s).
-							Send()
-						outputError(invalidRespErr, true, format)
-						return invalidRespErr
-					}
 
 					log.Debug().
 						Str("subjectName", s).
@@ -709,8 +709,55 @@ func init() {
 	storesTypeCreateCmd.Flags().BoolVarP(&createAll, "all", "a", false, "Create all store types.")
 
 	// UPDATE command
-	// storeTypesCmd.AddCommand(storesTypeUpdateCmd)
-	// storesTypeUpdateCmd.Flags().StringVarP(&storeTypeName, "name", "n", "", "Name of the certificate store type to get.")
+	storeTypesCmd.AddCommand(storesTypeUpdateCmd)
+	storesTypeUpdateCmd.Flags().StringVarP(
+		&storeTypeName,
+		"name",
+		"n",
+		"",
+		"Short name of the certificate store type to update.",
+	)
+	storesTypeUpdateCmd.MarkFlagRequired("name")
+	storesTypeUpdateCmd.Flags().StringP(
+		"from-file",
+		"f",
+		"",
+		"Path to a JSON file or integration manifest containing the new certificate store type definition.",
+	)
+	storesTypeUpdateCmd.Flags().Bool(
+		"from-template",
+		false,
+		"Update the store type to the store type template of the same name.",
+	)
+	storesTypeUpdateCmd.MarkFlagsMutuallyExclusive("from-file", "from-template")
+	storesTypeUpdateCmd.Flags().StringP(
+		FlagGitRef,
+		"b",
+		"main",
+		"The git branch or tag to reference when pulling store-types from the internet.",
+	)
+	storesTypeUpdateCmd.Flags().StringP(
+		FlagGitRepo,
+		"r",
+		DefaultGitRepo,
+		"The repository to pull store-types definitions from.",
+	)
+	storesTypeUpdateCmd.Flags().StringArray(
+		"set",
+		nil,
+		"Set a field of the store type, as <field>=<value>. May be repeated.",
+	)
+	storesTypeUpdateCmd.Flags().BoolP(
+		"dry-run",
+		"t",
+		false,
+		"Print the changes to the store type without updating it.",
+	)
+	storesTypeUpdateCmd.Flags().Bool(
+		"force",
+		false,
+		"Update the store type without confirmation even when the changes may break existing stores.",
+	)
 
 	// DELETE command
 	var deleteAll bool
@@ -0,0 +1,462 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// storeTypeKeyedLists are the lists of a store type whose items are matched by name when store types are compared.
+var storeTypeKeyedLists = map[string]bool{"Properties": true, "EntryParameters": true}
+
+var storesTypeUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update a certificate store type in Keyfactor.",
+	Long: `Update a certificate store type in Keyfactor.
+
+The new definition of the store type is read from --from-file, a store type JSON file or an integration manifest, or
+from the store type template of the same name with --from-template, or starts from the current definition. --set
+changes single fields on top of it and may be repeated, for example --set PrivateKeyAllowed=Required,
+--set Properties.ServerUseSsl.DefaultValue=true or --set SupportedOperations.Discovery=false. Properties and entry
+parameters are addressed by name.
+
+The changed fields of the store type, its properties, entry parameters and supported operations are printed before
+anything is changed. Changes that break the existing certificate stores of the type, such as a new required property
+without a default value, a removed property or a disabled operation, are printed as warnings and must be confirmed,
+or allowed with --force when prompts are disabled. Use --dry-run to only print the changes.`,
+	Example: `kfutil store-types update --name K8SSecret --from-template --dry-run
+kfutil store-types update --name PEM --from-file pem.json
+kfutil store-types update --name IISU --set Properties.ServerUseSsl.DefaultValue=true --set SupportedOperations.Discovery=true`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		// Specific flags
+		storeTypeName, _ := cmd.Flags().GetString("name")
+		fromFile, _ := cmd.Flags().GetString("from-file")
+		fromTemplate, _ := cmd.Flags().GetBool("from-template")
+		gitRef, _ := cmd.Flags().GetString(FlagGitRef)
+		gitRepo, _ := cmd.Flags().GetString(FlagGitRepo)
+		settings, _ := cmd.Flags().GetStringArray("set")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+
+		// Debug + expEnabled checks
+		isExperimental := false
+		debugErr := warnExperimentalFeature(expEnabled, isExperimental)
+		if debugErr != nil {
+			return debugErr
+		}
+		informDebug(debugFlag)
+
+		log.Debug().Str("storeType", storeTypeName).
+			Str("fromFile", fromFile).
+			Bool("fromTemplate", fromTemplate).
+			Strs("settings", settings).
+			Bool("dryRun", dryRun).
+			Msg("update command flags")
+
+		// Authenticate
+		kfClient, cErr := initClient(false)
+		if cErr != nil {
+			log.Error().Err(cErr).Msg("unable to authenticate")
+			return cErr
+		}
+
+		// CLI Logic
+		current, err := kfClient.GetCertificateStoreType(storeTypeName)
+		if err != nil {
+			log.Error().Err(err).Str("storeType", storeTypeName).Msg("unable to get certificate store type")
+			return err
+		}
+
+		desired := *current
+		switch {
+		case fromFile != "":
+			desired, err = readStoreTypeFile(fromFile, current.ShortName)
+		case fromTemplate:
+			desired, err = readStoreTypeTemplate(current.ShortName, gitRef, gitRepo)
+		}
+		if err != nil {
+			return err
+		}
+		if sErr := applyStoreTypeSettings(&desired, settings); sErr != nil {
+			return sErr
+		}
+		desired = storeTypeUpdateOf(desired, *current)
+
+		diffs := diffStoreTypes(*current, desired)
+		if len(diffs) == 0 {
+			outputResult(fmt.Sprintf("Certificate store type %s is up to date", current.ShortName), outputFormat)
+			return nil
+		}
+
+		stores := 0
+		warnings := storeTypeBreakingChanges(*current, desired)
+		if len(warnings) > 0 {
+			stores, err = countStoresOfType(kfClient, current.StoreType)
+			if err != nil {
+				log.Error().Err(err).Msg("unable to list certificate stores")
+				return err
+			}
+		}
+		printStoreTypeDiff(os.Stdout, current.ShortName, diffs)
+		if stores > 0 {
+			fmt.Printf("\nWARNING: %d certificate stores of type %s may break:\n", stores, current.ShortName)
+			for _, w := range warnings {
+				fmt.Printf("  - %s\n", w)
+			}
+		}
+		if dryRun {
+			return nil
+		}
+
+		if stores > 0 && !force {
+			if noPrompt {
+				return fmt.Errorf("the update may break existing certificate stores, use --force to update anyway")
+			}
+			confirmed := false
+			prompt := &survey.Confirm{Message: fmt.Sprintf("Update certificate store type %s?", current.ShortName)}
+			if pErr := survey.AskOne(prompt, &confirmed); pErr != nil {
+				return pErr
+			}
+			if !confirmed {
+				return fmt.Errorf("update of certificate store type %s cancelled", current.ShortName)
+			}
+		}
+
+		log.Debug().Str("storeType", current.ShortName).Msg("Calling API to update certificate store type")
+		if _, uErr := kfClient.UpdateStoreType(&desired); uErr != nil {
+			log.Error().Err(uErr).Str("storeType", current.ShortName).Msg("unable to update certificate store type")
+			return uErr
+		}
+		outputResult(fmt.Sprintf("Certificate store type %s updated", current.ShortName), outputFormat)
+		return nil
+	},
+}
+
+// readStoreTypeFile reads the definition of a store type from a store type JSON file, or from an integration manifest
+// that defines several.
+func readStoreTypeFile(filename string, shortName string) (api.CertificateStoreType, error) {
+	var sType api.CertificateStoreType
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return sType, err
+	}
+	if jErr := json.Unmarshal(data, &sType); jErr == nil && sType.ShortName != "" {
+		if !strings.EqualFold(sType.ShortName, shortName) {
+			return sType, fmt.Errorf("%s defines store type %q, not %q", filename, sType.ShortName, shortName)
+		}
+		return sType, nil
+	}
+
+	log.Debug().Str("filename", filename).Msg("Decoding JSON file as integration manifest")
+	var manifest IntegrationManifest
+	if mErr := json.Unmarshal(data, &manifest); mErr != nil {
+		return sType, fmt.Errorf("%s is neither a store type nor an integration manifest: %s", filename, mErr)
+	}
+	for _, st := range manifest.About.Orchestrator.StoreTypes {
+		if strings.EqualFold(st.ShortName, shortName) {
+			return st, nil
+		}
+	}
+	return sType, fmt.Errorf("%s doesn't define store type %q", filename, shortName)
+}
+
+// readStoreTypeTemplate returns the store type template of the given name.
+func readStoreTypeTemplate(shortName string, gitRef string, gitRepo string) (api.CertificateStoreType, error) {
+	var sType api.CertificateStoreType
+	templates, err := readStoreTypesConfig("", gitRef, gitRepo, offline)
+	if err != nil {
+		return sType, err
+	}
+	for name, template := range templates {
+		if strings.EqualFold(name, shortName) {
+			err = convertViaJSON(template, &sType)
+			return sType, err
+		}
+	}
+	return sType, fmt.Errorf("there is no store type template %q in %s@%s", shortName, gitRepo, gitRef)
+}
+
+// applyStoreTypeSettings sets the fields given by --set, as <field>=<value> where the field is a dotted path such as
+// PrivateKeyAllowed, SupportedOperations.Discovery or Properties.<name>.Required. Values are read as JSON, and as
+// text when they aren't valid JSON or the field holds text.
+func applyStoreTypeSettings(sType *api.CertificateStoreType, settings []string) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	state := importStateOf(sType)
+	// fields left out of the JSON when empty can be set too
+	t := reflect.TypeOf(*sType)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if _, ok := state[name]; !ok && name != "" && name != "-" {
+			zero := reflect.Zero(t.Field(i).Type).Interface()
+			if t.Field(i).Type.Kind() == reflect.Pointer {
+				zero = nil
+			}
+			state[name] = zero
+		}
+	}
+	for _, setting := range settings {
+		path, value, found := strings.Cut(setting, "=")
+		if !found || path == "" {
+			return fmt.Errorf("invalid setting %q, expected <field>=<value>", setting)
+		}
+		if err := setStoreTypeField(state, strings.Split(path, "."), value); err != nil {
+			return fmt.Errorf("unable to set %s: %s", path, err)
+		}
+	}
+	return convertViaJSON(state, sType)
+}
+
+func setStoreTypeField(node interface{}, path []string, value string) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		key := path[0]
+		if _, ok := n[key]; !ok {
+			key = ""
+			for k := range n {
+				if strings.EqualFold(k, path[0]) {
+					key = k
+				}
+			}
+			if key == "" {
+				return fmt.Errorf("unknown field %q", path[0])
+			}
+		}
+		if len(path) > 1 {
+			return setStoreTypeField(n[key], path[1:], value)
+		}
+		var parsed interface{}
+		if _, isText := n[key].(string); isText || json.Unmarshal([]byte(value), &parsed) != nil {
+			parsed = value
+		}
+		n[key] = parsed
+		return nil
+	case []interface{}:
+		for _, item := range n {
+			if m, ok := item.(map[string]interface{}); ok && strings.EqualFold(fmt.Sprint(m["Name"]), path[0]) {
+				if len(path) == 1 {
+					return fmt.Errorf("%q is a list item, set one of its fields", path[0])
+				}
+				return setStoreTypeField(m, path[1:], value)
+			}
+		}
+		return fmt.Errorf("no item named %q, use --from-file to add items", path[0])
+	}
+	return fmt.Errorf("%q isn't a field", path[0])
+}
+
+// storeTypeUpdateOf returns the definition of a store type to update the current one with, under the current name and
+// ID.
+func storeTypeUpdateOf(desired api.CertificateStoreType, current api.CertificateStoreType) api.CertificateStoreType {
+	desired = exportStoreTypeOf(desired)
+	desired.StoreType = current.StoreType
+	desired.ShortName = current.ShortName
+	if desired.Properties != nil {
+		for i := range *desired.Properties {
+			(*desired.Properties)[i].StoreTypeID = current.StoreType
+		}
+	}
+	if desired.EntryParameters != nil {
+		for i := range *desired.EntryParameters {
+			(*desired.EntryParameters)[i].StoreTypeId = current.StoreType
+		}
+	}
+	return desired
+}
+
+// storeTypeStateOf returns the fields of a store type with its properties and entry parameters keyed by name.
+func storeTypeStateOf(sType api.CertificateStoreType) map[string]interface{} {
+	state := importStateOf(exportStoreTypeOf(sType))
+	delete(state, "StoreType")
+	for field := range storeTypeKeyedLists {
+		items, _ := state[field].([]interface{})
+		keyed := make(map[string]interface{})
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok {
+				keyed[fmt.Sprint(m["Name"])] = m
+			}
+		}
+		state[field] = keyed
+	}
+	return state
+}
+
+// diffStoreTypes returns the fields that differ between two store types, by dotted path in sorted order. Added and
+// removed properties and entry parameters are reported as a whole.
+func diffStoreTypes(current api.CertificateStoreType, desired api.CertificateStoreType) []importFieldDiff {
+	var diffs []importFieldDiff
+	diffStoreTypeFields("", storeTypeStateOf(current), storeTypeStateOf(desired), &diffs)
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs
+}
+
+func diffStoreTypeFields(prefix string, current, desired map[string]interface{}, diffs *[]importFieldDiff) {
+	keys := make(map[string]bool)
+	for k := range current {
+		keys[k] = true
+	}
+	for k := range desired {
+		keys[k] = true
+	}
+	for k := range keys {
+		c, cOk := current[k].(map[string]interface{})
+		d, dOk := desired[k].(map[string]interface{})
+		if cOk && dOk {
+			diffStoreTypeFields(prefix+k+".", c, d, diffs)
+			continue
+		}
+		if !reflect.DeepEqual(current[k], desired[k]) {
+			*diffs = append(*diffs, importFieldDiff{Field: prefix + k, Current: current[k], Desired: desired[k]})
+		}
+	}
+}
+
+// storeTypeBreakingChanges describes the changes to a store type that break the certificate stores of the type.
+func storeTypeBreakingChanges(current api.CertificateStoreType, desired api.CertificateStoreType) []string {
+	var warnings []string
+	currentProps := make(map[string]api.StoreTypePropertyDefinition)
+	if current.Properties != nil {
+		for _, p := range *current.Properties {
+			currentProps[p.Name] = p
+		}
+	}
+	desiredProps := make(map[string]bool)
+	if desired.Properties != nil {
+		for _, p := range *desired.Properties {
+			desiredProps[p.Name] = true
+			c, exists := currentProps[p.Name]
+			noDefault := p.DefaultValue == nil || fmt.Sprint(p.DefaultValue) == ""
+			switch {
+			case !exists && p.Required && noDefault:
+				warnings = append(warnings, fmt.Sprintf("new property %s is required and has no default value", p.Name))
+			case exists && p.Required && !c.Required && noDefault:
+				warnings = append(warnings, fmt.Sprintf("property %s becomes required and has no default value", p.Name))
+			case exists && p.Type != c.Type:
+				warnings = append(warnings, fmt.Sprintf("property %s changes type from %s to %s", p.Name, c.Type, p.Type))
+			}
+		}
+	}
+	for _, name := range sortedKeys(currentProps) {
+		if !desiredProps[name] {
+			warnings = append(warnings, fmt.Sprintf("property %s is removed", name))
+		}
+	}
+
+	currentParams := make(map[string]api.EntryParameter)
+	if current.EntryParameters != nil {
+		for _, p := range *current.EntryParameters {
+			currentParams[p.Name] = p
+		}
+	}
+	desiredParams := make(map[string]bool)
+	if desired.EntryParameters != nil {
+		for _, p := range *desired.EntryParameters {
+			desiredParams[p.Name] = true
+			c, exists := currentParams[p.Name]
+			required := p.RequiredWhen.OnAdd || p.RequiredWhen.OnReenrollment
+			wasRequired := exists && (c.RequiredWhen.OnAdd || c.RequiredWhen.OnReenrollment)
+			switch {
+			case required && !wasRequired && p.DefaultValue == "":
+				warnings = append(
+					warnings,
+					fmt.Sprintf("entry parameter %s becomes required and has no default value", p.Name),
+				)
+			case exists && p.Type != c.Type:
+				warnings = append(
+					warnings,
+					fmt.Sprintf("entry parameter %s changes type from %s to %s", p.Name, c.Type, p.Type),
+				)
+			}
+		}
+	}
+	for _, name := range sortedKeys(currentParams) {
+		if !desiredParams[name] {
+			warnings = append(warnings, fmt.Sprintf("entry parameter %s is removed", name))
+		}
+	}
+
+	if current.SupportedOperations != nil {
+		var desiredOps api.SupportedOperations
+		if desired.SupportedOperations != nil {
+			desiredOps = *desired.SupportedOperations
+		}
+		currentOps, nextOps := importStateOf(*current.SupportedOperations), importStateOf(desiredOps)
+		for _, op := range sortedKeys(currentOps) {
+			if currentOps[op] == true && nextOps[op] != true {
+				warnings = append(warnings, fmt.Sprintf("supported operation %s is disabled", op))
+			}
+		}
+	}
+	if desired.PrivateKeyAllowed == "Required" && current.PrivateKeyAllowed != "Required" {
+		warnings = append(warnings, "private keys become required")
+	}
+	return warnings
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countStoresOfType returns the number of certificate stores of a store type.
+func countStoresOfType(kfClient *api.Client, storeTypeId int) (int, error) {
+	stores, err := kfClient.ListCertificateStores(nil)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	if stores != nil {
+		for _, store := range *stores {
+			if store.CertStoreType == storeTypeId {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// printStoreTypeDiff prints the changed fields of a store type, with added fields marked + and removed fields -.
+func printStoreTypeDiff(w io.Writer, shortName string, diffs []importFieldDiff) {
+	fmt.Fprintf(w, "Changes to certificate store type %s:\n", shortName)
+	for _, d := range diffs {
+		current, _ := json.Marshal(d.Current)
+		desired, _ := json.Marshal(d.Desired)
+		switch {
+		case d.Current == nil:
+			fmt.Fprintf(w, "  + %s: %s\n", d.Field, desired)
+		case d.Desired == nil:
+			fmt.Fprintf(w, "  - %s: %s\n", d.Field, current)
+		default:
+			fmt.Fprintf(w, "  ~ %s: %s -> %s\n", d.Field, current, desired)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Keyfactor
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client/v3/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStoreType() api.CertificateStoreType {
+	return api.CertificateStoreType{
+		Name:                "K8S Secret",
+		ShortName:           "K8SSecret",
+		StoreType:           42,
+		PrivateKeyAllowed:   "Optional",
+		SupportedOperations: &api.SupportedOperations{Add: true, Discovery: true, Remove: true},
+		Properties: &[]api.StoreTypePropertyDefinition{
+			{StoreTypeID: 42, Name: "KubeNamespace", DisplayName: "Namespace", Type: "String", DefaultValue: "default"},
+			{StoreTypeID: 42, Name: "SeparateChain", DisplayName: "Separate Chain", Type: "Bool", DefaultValue: "false"},
+		},
+		EntryParameters: &[]api.EntryParameter{
+			{StoreTypeId: 42, Name: "KeyName", DisplayName: "Key Name", Type: "String"},
+		},
+	}
+}
+
+func Test_ApplyStoreTypeSettings(t *testing.T) {
+	sType := testStoreType()
+	err := applyStoreTypeSettings(
+		&sType,
+		[]string{
+			"PrivateKeyAllowed=Required",
+			"SupportedOperations.Discovery=false",
+			"properties.kubenamespace.Required=true",
+			"Properties.SeparateChain.DefaultValue=true",
+			"EntryParameters.KeyName.RequiredWhen.OnAdd=true",
+			"StorePathValue=secrets",
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "Required", sType.PrivateKeyAllowed)
+	assert.False(t, sType.SupportedOperations.Discovery)
+	assert.True(t, (*sType.Properties)[0].Required)
+	assert.Equal(t, "true", (*sType.Properties)[1].DefaultValue)
+	assert.True(t, (*sType.EntryParameters)[0].RequiredWhen.OnAdd)
+	assert.Equal(t, "secrets", sType.StorePathValue)
+
+	err = applyStoreTypeSettings(&sType, []string{"Properties.Missing.Required=true"})
+	assert.EqualError(t, err, `unable to set Properties.Missing.Required: no item named "Missing", use --from-file to add items`)
+	err = applyStoreTypeSettings(&sType, []string{"PrivateKey=Required"})
+	assert.EqualError(t, err, `unable to set PrivateKey: unknown field "PrivateKey"`)
+	err = applyStoreTypeSettings(&sType, []string{"Properties"})
+	assert.EqualError(t, err, `invalid setting "Properties", expected <field>=<value>`)
+}
+
+func Test_DiffStoreTypes(t *testing.T) {
+	current := testStoreType()
+	desired := testStoreType()
+	desired.StoreType = 0
+	desired.SupportedOperations.Discovery = false
+	(*desired.Properties)[0].Required = true
+	*desired.Properties = append(
+		(*desired.Properties)[1:],
+		api.StoreTypePropertyDefinition{Name: "Token", Type: "Secret", Required: true},
+	)
+	*desired.EntryParameters = nil
+	desired.PrivateKeyAllowed = "Required"
+	desired = storeTypeUpdateOf(desired, current)
+	assert.Equal(t, 42, desired.StoreType)
+	assert.Equal(t, 42, (*desired.Properties)[1].StoreTypeID)
+
+	var fields []string
+	for _, diff := range diffStoreTypes(current, desired) {
+		fields = append(fields, diff.Field)
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"EntryParameters.KeyName",
+			"PrivateKeyAllowed",
+			"Properties.KubeNamespace",
+			"Properties.Token",
+			"SupportedOperations.Discovery",
+		},
+		fields,
+	)
+	assert.Empty(t, diffStoreTypes(current, storeTypeUpdateOf(testStoreType(), current)))
+
+	assert.Equal(
+		t,
+		[]string{
+			"new property Token is required and has no default value",
+			"property KubeNamespace is removed",
+			"entry parameter KeyName is removed",
+			"supported operation Discovery is disabled",
+			"private keys become required",
+		},
+		storeTypeBreakingChanges(current, desired),
+	)
+
+	var out bytes.Buffer
+	printStoreTypeDiff(&out, "K8SSecret", diffStoreTypes(current, desired)[3:])
+	assert.Equal(
+		t,
+		"Changes to certificate store type K8SSecret:\n"+
+			`  + Properties.Token: {"DefaultValue":null,"DependsOn":"","DisplayName":"","Name":"Token","Required":true,"StoreTypeId":0,"Type":"Secret"}`+"\n"+
+			"  ~ SupportedOperations.Discovery: true -> false\n",
+		out.String(),
+	)
+}
+
+func Test_ReadStoreTypeFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "store_type.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"Name": "PEM", "ShortName": "PEM", "PrivateKeyAllowed": "Optional"}`), 0600))
+	sType, err := readStoreTypeFile(file, "pem")
+	assert.NoError(t, err)
+	assert.Equal(t, "Optional", sType.PrivateKeyAllowed)
+	_, err = readStoreTypeFile(file, "JKS")
+	assert.EqualError(t, err, file+` defines store type "PEM", not "JKS"`)
+
+	manifest := filepath.Join(dir, "integration-manifest.json")
+	content := `{"about": {"orchestrator": {"store_types": [{"Name": "PEM", "ShortName": "PEM"}, {"Name": "JKS", "ShortName": "JKS"}]}}}`
+	assert.NoError(t, os.WriteFile(manifest, []byte(content), 0600))
+	sType, err = readStoreTypeFile(manifest, "JKS")
+	assert.NoError(t, err)
+	assert.Equal(t, "JKS", sType.Name)
+	_, err = readStoreTypeFile(manifest, "PKCS12")
+	assert.EqualError(t, err, manifest+` doesn't define store type "PKCS12"`)
+}
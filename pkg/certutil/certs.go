@@ -0,0 +1,225 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certutil contains helpers for parsing, ordering and encoding X.509 certificates.
+package certutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+const (
+	PEMTypeCertificate = "CERTIFICATE"
+	PEMTypePKCS7       = "PKCS7"
+)
+
+// ParseCertificates returns the certificates in data, which may be PEM (certificates or PKCS#7 blocks), DER, a DER
+// encoded PKCS#7 structure or any of those base64 encoded.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("no certificate data")
+	}
+	if bytes.Contains(trimmed, []byte("-----BEGIN")) {
+		return parsePEMCertificates(trimmed)
+	}
+	// DER is parsed untrimmed, its last bytes may well be whitespace characters
+	if certs, err := parseDERCertificates(data); err == nil {
+		return certs, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(stripWhitespace(trimmed)))
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized certificate encoding")
+	}
+	if bytes.Contains(decoded, []byte("-----BEGIN")) {
+		return parsePEMCertificates(decoded)
+	}
+	return parseDERCertificates(decoded)
+}
+
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case PEMTypeCertificate, "X509 CERTIFICATE", "TRUSTED CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		case PEMTypePKCS7, "CERTIFICATE CHAIN":
+			p7, err := ParsePKCS7(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, p7...)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in PEM data")
+	}
+	return certs, nil
+}
+
+func parseDERCertificates(der []byte) ([]*x509.Certificate, error) {
+	if IsPKCS7(der) {
+		return ParsePKCS7(der)
+	}
+	return x509.ParseCertificates(der)
+}
+
+func stripWhitespace(data []byte) []byte {
+	return bytes.Map(
+		func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, data,
+	)
+}
+
+// EncodePEM returns the certificates as concatenated PEM blocks.
+func EncodePEM(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&buf, &pem.Block{Type: PEMTypeCertificate, Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+// Thumbprint returns the upper case hex SHA-1 thumbprint of a certificate, as used by Keyfactor Command.
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// IsSelfSigned reports whether the certificate's subject and issuer are the same.
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer)
+}
+
+// OrderChain orders certificates from leaf to root by following issuer names. Certificates that are not part of the
+// chain starting at the leaf are appended in their original order. When rootFirst is set the result is reversed.
+func OrderChain(certs []*x509.Certificate, rootFirst bool) []*x509.Certificate {
+	if len(certs) < 2 {
+		return reverseIf(append([]*x509.Certificate(nil), certs...), rootFirst)
+	}
+
+	leaf := -1
+	for i, cert := range certs {
+		if !issuesAny(cert, certs) {
+			leaf = i
+			break
+		}
+	}
+	if leaf < 0 {
+		leaf = 0
+	}
+
+	used := make([]bool, len(certs))
+	ordered := []*x509.Certificate{certs[leaf]}
+	used[leaf] = true
+	for current := certs[leaf]; !IsSelfSigned(current); {
+		next := -1
+		for i, cert := range certs {
+			if !used[i] && bytes.Equal(cert.RawSubject, current.RawIssuer) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		used[next] = true
+		current = certs[next]
+		ordered = append(ordered, current)
+	}
+	for i, cert := range certs {
+		if !used[i] {
+			ordered = append(ordered, cert)
+		}
+	}
+	return reverseIf(ordered, rootFirst)
+}
+
+// SplitChains groups certificates into chains ordered from leaf to root, one for each certificate that doesn't issue
+// any of the others. Issuers are shared between chains, so a bundle of several leaves with a common intermediate yields
+// a chain for each leaf. Certificates that aren't reached from any leaf form chains of their own.
+func SplitChains(certs []*x509.Certificate) [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	used := make([]bool, len(certs))
+	for i, cert := range certs {
+		if issuesAny(cert, certs) {
+			continue
+		}
+		chain := []*x509.Certificate{cert}
+		used[i] = true
+		for current := cert; !IsSelfSigned(current) && len(chain) < len(certs); {
+			next := -1
+			for j, issuer := range certs {
+				if j != i && bytes.Equal(issuer.RawSubject, current.RawIssuer) {
+					next = j
+					break
+				}
+			}
+			if next < 0 {
+				break
+			}
+			used[next] = true
+			current = certs[next]
+			chain = append(chain, current)
+		}
+		chains = append(chains, chain)
+	}
+	for i, cert := range certs {
+		if !used[i] {
+			chains = append(chains, []*x509.Certificate{cert})
+		}
+	}
+	return chains
+}
+
+// issuesAny reports whether cert is the issuer of any other certificate in certs.
+func issuesAny(cert *x509.Certificate, certs []*x509.Certificate) bool {
+	for _, other := range certs {
+		if other != cert && !IsSelfSigned(other) && bytes.Equal(other.RawIssuer, cert.RawSubject) {
+			return true
+		}
+	}
+	return false
+}
+
+func reverseIf(certs []*x509.Certificate, reverse bool) []*x509.Certificate {
+	if reverse {
+		for i, j := 0, len(certs)-1; i < j; i, j = i+1, j-1 {
+			certs[i], certs[j] = certs[j], certs[i]
+		}
+	}
+	return certs
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testChain returns a leaf, intermediate and root certificate.
+func testChain(t *testing.T) []*x509.Certificate {
+	t.Helper()
+	var certs []*x509.Certificate
+	var parent *x509.Certificate
+	var parentKey *ecdsa.PrivateKey
+	for i, cn := range []string{"Test Root", "Test Intermediate", "test.example.com"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(i + 1)),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  i < 2,
+			BasicConstraintsValid: true,
+		}
+		signer, signerKey := tmpl, key
+		if parent != nil {
+			signer, signerKey = parent, parentKey
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+		assert.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+		certs = append([]*x509.Certificate{cert}, certs...)
+		parent, parentKey = cert, key
+	}
+	return certs
+}
+
+func Test_PKCS7RoundTrip(t *testing.T) {
+	chain := testChain(t)
+	der, err := EncodePKCS7(chain)
+	assert.NoError(t, err)
+	assert.True(t, IsPKCS7(der))
+	assert.False(t, IsPKCS7(chain[0].Raw))
+
+	certs, err := ParsePKCS7(der)
+	assert.NoError(t, err)
+	assert.Len(t, certs, 3)
+	for i := range chain {
+		assert.Equal(t, chain[i].Raw, certs[i].Raw)
+	}
+}
+
+func Test_ParseCertificates(t *testing.T) {
+	chain := testChain(t)
+	p7, _ := EncodePKCS7(chain)
+	p7PEM := pem.EncodeToMemory(&pem.Block{Type: PEMTypePKCS7, Bytes: p7})
+
+	cases := map[string][]byte{
+		"pem":        EncodePEM(chain),
+		"der":        chain[0].Raw,
+		"p7b":        p7,
+		"p7b pem":    p7PEM,
+		"base64 der": []byte(base64.StdEncoding.EncodeToString(chain[0].Raw)),
+		"base64 pem": []byte(base64.StdEncoding.EncodeToString(EncodePEM(chain))),
+	}
+	for name, data := range cases {
+		certs, err := ParseCertificates(data)
+		assert.NoError(t, err, name)
+		assert.NotEmpty(t, certs, name)
+		assert.Equal(t, chain[0].Raw, certs[0].Raw, name)
+	}
+
+	_, err := ParseCertificates([]byte("not a certificate"))
+	assert.Error(t, err)
+}
+
+func Test_ParseCertificatesDERTrailingWhitespace(t *testing.T) {
+	// Ed25519 signatures are deterministic, so the serial number below always gives a DER ending in a whitespace byte
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	var der []byte
+	for serial := int64(1); len(der) == 0 || !bytes.ContainsAny(der[len(der)-1:], " \t\n\r\v\f"); serial++ {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "der.example.com"},
+			NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		var err error
+		der, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+		assert.NoError(t, err)
+	}
+
+	certs, err := ParseCertificates(der)
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+}
+
+func Test_OrderChain(t *testing.T) {
+	chain := testChain(t)
+	leaf, intermediate, root := chain[0], chain[1], chain[2]
+
+	ordered := OrderChain([]*x509.Certificate{root, leaf, intermediate}, false)
+	assert.Equal(t, []*x509.Certificate{leaf, intermediate, root}, ordered)
+
+	ordered = OrderChain([]*x509.Certificate{intermediate, leaf, root}, true)
+	assert.Equal(t, []*x509.Certificate{root, intermediate, leaf}, ordered)
+
+	assert.True(t, IsSelfSigned(root))
+	assert.Len(t, Thumbprint(leaf), 40)
+}
+
+func Test_SplitChains(t *testing.T) {
+	chain := testChain(t)
+	leaf, intermediate, root := chain[0], chain[1], chain[2]
+	// issued by an intermediate with the same name
+	other := testChain(t)[0]
+
+	chains := SplitChains([]*x509.Certificate{root, leaf, other, intermediate})
+	assert.Equal(t, [][]*x509.Certificate{{leaf, intermediate, root}, {other, intermediate, root}}, chains)
+
+	chains = SplitChains([]*x509.Certificate{root})
+	assert.Equal(t, [][]*x509.Certificate{{root}}, chains)
+}
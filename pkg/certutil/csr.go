@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	PEMTypeCertificateRequest = "CERTIFICATE REQUEST"
+
+	KeyTypeRSA     = "rsa"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
+// KeyTypes lists the key algorithms supported by GenerateKey.
+var KeyTypes = []string{KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519}
+
+// SubjectAltNames holds the subject alternative names of a certificate request.
+type SubjectAltNames struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+}
+
+// ParseSubjectAltNames validates and converts SAN values given as strings.
+func ParseSubjectAltNames(dns []string, ips []string, emails []string, uris []string) (SubjectAltNames, error) {
+	sans := SubjectAltNames{DNSNames: dns, EmailAddresses: emails}
+	for _, v := range ips {
+		ip := net.ParseIP(strings.TrimSpace(v))
+		if ip == nil {
+			return sans, fmt.Errorf("invalid IP address %q", v)
+		}
+		sans.IPAddresses = append(sans.IPAddresses, ip)
+	}
+	for _, v := range uris {
+		u, err := url.Parse(strings.TrimSpace(v))
+		if err != nil || u.Scheme == "" {
+			return sans, fmt.Errorf("invalid URI %q", v)
+		}
+		sans.URIs = append(sans.URIs, u)
+	}
+	return sans, nil
+}
+
+// GenerateKey creates a private key. Size is the RSA modulus length or the ECDSA curve size (256, 384 or 521) and is
+// ignored for Ed25519. A size of 0 selects the default of 2048 bits for RSA and P-256 for ECDSA.
+func GenerateKey(keyType string, size int) (crypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case KeyTypeRSA:
+		if size == 0 {
+			size = 2048
+		}
+		if size < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return rsa.GenerateKey(rand.Reader, size)
+	case KeyTypeECDSA:
+		var curve elliptic.Curve
+		switch size {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA key size %d, must be 256, 384 or 521", size)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case KeyTypeEd25519:
+		if size != 0 {
+			return nil, fmt.Errorf("Ed25519 keys have a fixed size, a key size can't be given")
+		}
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported key type %q, must be one of %s", keyType, strings.Join(KeyTypes, ", "))
+	}
+}
+
+// CreateCSR returns a PEM encoded PKCS#10 certificate request signed by key.
+func CreateCSR(key crypto.Signer, subject pkix.Name, sans SubjectAltNames) ([]byte, error) {
+	der, err := x509.CreateCertificateRequest(
+		rand.Reader, &x509.CertificateRequest{
+			Subject:        subject,
+			DNSNames:       sans.DNSNames,
+			IPAddresses:    sans.IPAddresses,
+			EmailAddresses: sans.EmailAddresses,
+			URIs:           sans.URIs,
+		}, key,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create certificate request: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypeCertificateRequest, Bytes: der}), nil
+}
+
+// ParseCSR parses a PEM or DER encoded PKCS#10 certificate request and verifies its signature.
+func ParseCSR(data []byte) (*x509.CertificateRequest, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != PEMTypeCertificateRequest && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, fmt.Errorf("unexpected PEM block %q, expected a certificate request", block.Type)
+		}
+		der = block.Bytes
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate request: %s", err)
+	}
+	if sErr := csr.CheckSignature(); sErr != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %s", sErr)
+	}
+	return csr, nil
+}
+
+// EncodeCSRPEM returns the certificate request as a PEM block.
+func EncodeCSRPEM(csr *x509.CertificateRequest) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypeCertificateRequest, Bytes: csr.Raw})
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GenerateKey(t *testing.T) {
+	key, err := GenerateKey(KeyTypeECDSA, 384)
+	assert.NoError(t, err)
+	assert.Equal(t, 384, key.(*ecdsa.PrivateKey).Curve.Params().BitSize)
+
+	key, err = GenerateKey("Ed25519", 0)
+	assert.NoError(t, err)
+	assert.IsType(t, ed25519.PrivateKey{}, key)
+
+	_, err = GenerateKey(KeyTypeEd25519, 256)
+	assert.Error(t, err)
+	_, err = GenerateKey(KeyTypeRSA, 1024)
+	assert.Error(t, err)
+	_, err = GenerateKey(KeyTypeECDSA, 123)
+	assert.Error(t, err)
+	_, err = GenerateKey("dsa", 0)
+	assert.Error(t, err)
+}
+
+func Test_CreateCSR(t *testing.T) {
+	sans, err := ParseSubjectAltNames(
+		[]string{"www.example.com"},
+		[]string{"10.0.0.1", "::1"},
+		[]string{"admin@example.com"},
+		[]string{"spiffe://example.com/web"},
+	)
+	assert.NoError(t, err)
+
+	for _, keyType := range KeyTypes {
+		key, kErr := GenerateKey(keyType, 0)
+		assert.NoError(t, kErr)
+		data, cErr := CreateCSR(key, pkix.Name{CommonName: "www.example.com", Organization: []string{"Example"}}, sans)
+		assert.NoError(t, cErr, keyType)
+
+		csr, pErr := ParseCSR(data)
+		assert.NoError(t, pErr, keyType)
+		assert.Equal(t, "www.example.com", csr.Subject.CommonName)
+		assert.Equal(t, []string{"www.example.com"}, csr.DNSNames)
+		assert.Len(t, csr.IPAddresses, 2)
+		assert.Equal(t, "spiffe://example.com/web", csr.URIs[0].String())
+		if keyType == KeyTypeEd25519 {
+			assert.Equal(t, x509.PureEd25519, csr.SignatureAlgorithm)
+		}
+	}
+
+	_, err = ParseSubjectAltNames(nil, []string{"not-an-ip"}, nil, nil)
+	assert.Error(t, err)
+	_, err = ParseSubjectAltNames(nil, nil, nil, []string{"no-scheme"})
+	assert.Error(t, err)
+	_, err = ParseCSR([]byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+)
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Content Commitment"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                        "Any",
+	x509.ExtKeyUsageServerAuth:                 "Server Authentication",
+	x509.ExtKeyUsageClientAuth:                 "Client Authentication",
+	x509.ExtKeyUsageCodeSigning:                "Code Signing",
+	x509.ExtKeyUsageEmailProtection:            "Email Protection",
+	x509.ExtKeyUsageIPSECEndSystem:             "IPSec End System",
+	x509.ExtKeyUsageIPSECTunnel:                "IPSec Tunnel",
+	x509.ExtKeyUsageIPSECUser:                  "IPSec User",
+	x509.ExtKeyUsageTimeStamping:               "Time Stamping",
+	x509.ExtKeyUsageOCSPSigning:                "OCSP Signing",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto: "Microsoft Server Gated Crypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:  "Netscape Server Gated Crypto",
+}
+
+var extensionNames = map[string]string{
+	"2.5.29.14":               "Subject Key Identifier",
+	"2.5.29.15":               "Key Usage",
+	"2.5.29.17":               "Subject Alternative Name",
+	"2.5.29.18":               "Issuer Alternative Name",
+	"2.5.29.19":               "Basic Constraints",
+	"2.5.29.30":               "Name Constraints",
+	"2.5.29.31":               "CRL Distribution Points",
+	"2.5.29.32":               "Certificate Policies",
+	"2.5.29.35":               "Authority Key Identifier",
+	"2.5.29.37":               "Extended Key Usage",
+	"1.3.6.1.5.5.7.1.1":       "Authority Information Access",
+	"1.3.6.1.4.1.11129.2.4.2": "Signed Certificate Timestamps",
+	"1.3.6.1.4.1.311.20.2":    "Microsoft Certificate Template Name",
+	"1.3.6.1.4.1.311.21.7":    "Microsoft Certificate Template",
+	"1.3.6.1.4.1.311.21.10":   "Microsoft Application Policies",
+}
+
+// KeyDescription describes a public key by algorithm and size, such as "RSA 2048" or "ECDSA P-256".
+func KeyDescription(pub any) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+// KeyUsageNames returns the names of the key usages set.
+func KeyUsageNames(usage x509.KeyUsage) []string {
+	var names []string
+	for _, u := range keyUsageNames {
+		if usage&u.usage != 0 {
+			names = append(names, u.name)
+		}
+	}
+	return names
+}
+
+// ExtKeyUsageNames returns the names of the extended key usages, including unknown usages by OID.
+func ExtKeyUsageNames(cert *x509.Certificate) []string {
+	var names []string
+	for _, u := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[u]; ok {
+			names = append(names, name)
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
+
+// ExtensionName returns the name of a well known certificate extension, or its OID.
+func ExtensionName(oid string) string {
+	if name, ok := extensionNames[oid]; ok {
+		return name
+	}
+	return oid
+}
+
+// ChainOrderProblems checks that each certificate is issued by the one following it, as TLS servers and most stores
+// expect, and describes every place where it is not. The last certificate may be a root or an intermediate.
+func ChainOrderProblems(certs []*x509.Certificate) []string {
+	var problems []string
+	for i := 0; i+1 < len(certs); i++ {
+		if certs[i].CheckSignatureFrom(certs[i+1]) != nil {
+			problems = append(
+				problems,
+				fmt.Sprintf(
+					"certificate %d (%s) is not issued by certificate %d (%s)",
+					i+1,
+					certs[i].Subject,
+					i+2,
+					certs[i+1].Subject,
+				),
+			)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ChainOrderProblems(t *testing.T) {
+	chain := testChain(t)
+	assert.Empty(t, ChainOrderProblems(chain))
+	assert.Empty(t, ChainOrderProblems(chain[:2]))
+	assert.Len(t, ChainOrderProblems([]*x509.Certificate{chain[2], chain[1], chain[0]}), 2)
+	assert.Len(t, ChainOrderProblems([]*x509.Certificate{chain[0], chain[2]}), 1)
+}
+
+func Test_DescribeCertificate(t *testing.T) {
+	chain := testChain(t)
+	assert.Equal(t, "ECDSA P-256", KeyDescription(chain[0].PublicKey))
+	assert.Equal(
+		t,
+		[]string{"Digital Signature", "Certificate Sign"},
+		KeyUsageNames(x509.KeyUsageDigitalSignature|x509.KeyUsageCertSign),
+	)
+	assert.Equal(t, "Basic Constraints", ExtensionName("2.5.29.19"))
+	assert.Equal(t, "1.2.3.4", ExtensionName("1.2.3.4"))
+}
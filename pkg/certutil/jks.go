@@ -0,0 +1,179 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic   uint32 = 0xFEEDFEED
+	jceksMagic uint32 = 0xCECECECE
+
+	jksTagPrivateKey  = 1
+	jksTagTrustedCert = 2
+	jksTagSecretKey   = 3
+
+	// jksDigestWhitener is appended to the password when computing the keystore integrity digest.
+	jksDigestWhitener = "Mighty Aphrodite"
+)
+
+// JKSEntry is an entry of a Java keystore. Private keys are not decrypted, PrivateKey only reports that the entry
+// has one.
+type JKSEntry struct {
+	Alias        string
+	Created      time.Time
+	PrivateKey   bool
+	Certificates []*x509.Certificate
+}
+
+// IsJKS reports whether the data is a Java KeyStore (JKS or JCEKS) file.
+func IsJKS(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(data)
+	return magic == jksMagic || magic == jceksMagic
+}
+
+// ParseJKS returns the entries of a JKS or JCEKS keystore. When a password is given the keystore's integrity digest
+// is verified with it. JCEKS secret key entries are not supported.
+func ParseJKS(data []byte, password string) ([]JKSEntry, error) {
+	if !IsJKS(data) {
+		return nil, fmt.Errorf("not a Java keystore")
+	}
+	if len(data) < sha1.Size+12 {
+		return nil, fmt.Errorf("truncated Java keystore")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if password != "" {
+		h := sha1.New()
+		for _, r := range utf16.Encode([]rune(password)) {
+			h.Write([]byte{byte(r >> 8), byte(r)})
+		}
+		h.Write([]byte(jksDigestWhitener))
+		h.Write(body)
+		if !bytes.Equal(h.Sum(nil), digest) {
+			return nil, fmt.Errorf("keystore password is incorrect or the keystore has been tampered with")
+		}
+	}
+
+	r := &jksReader{data: body[4:]}
+	version := r.uint32()
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported Java keystore version %d", version)
+	}
+	count := r.uint32()
+	var entries []JKSEntry
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		entry := JKSEntry{Alias: r.utf()}
+		entry.Created = time.UnixMilli(int64(r.uint64())).UTC()
+		switch tag {
+		case jksTagPrivateKey:
+			entry.PrivateKey = true
+			r.bytes(int(r.uint32()))
+			chainLen := r.uint32()
+			for j := uint32(0); j < chainLen && r.err == nil; j++ {
+				entry.Certificates = append(entry.Certificates, r.certificate(version))
+			}
+		case jksTagTrustedCert:
+			entry.Certificates = append(entry.Certificates, r.certificate(version))
+		case jksTagSecretKey:
+			return nil, fmt.Errorf("entry %q is a secret key, which is not supported", entry.Alias)
+		default:
+			return nil, fmt.Errorf("unsupported Java keystore entry type %d", tag)
+		}
+		if r.err != nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid Java keystore: %s", r.err)
+	}
+	return entries, nil
+}
+
+// jksReader reads the big-endian fields of a Java keystore, recording the first error.
+type jksReader struct {
+	data []byte
+	err  error
+}
+
+func (r *jksReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = fmt.Errorf("unexpected end of data")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *jksReader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// utf reads a Java modified UTF-8 string, which is plain UTF-8 for the aliases and types found in keystores.
+func (r *jksReader) utf() string {
+	b := r.bytes(2)
+	if b == nil {
+		return ""
+	}
+	return string(r.bytes(int(binary.BigEndian.Uint16(b))))
+}
+
+func (r *jksReader) certificate(version uint32) *x509.Certificate {
+	if version == 2 {
+		if certType := r.utf(); r.err == nil && certType != "X.509" {
+			r.err = fmt.Errorf("unsupported certificate type %q", certType)
+			return nil
+		}
+	}
+	der := r.bytes(int(r.uint32()))
+	if r.err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		r.err = err
+		return nil
+	}
+	return cert
+}
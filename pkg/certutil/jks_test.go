@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testJKS builds a version 2 JKS keystore with a private key entry holding the chain and a trusted certificate entry
+// holding the root.
+func testJKS(chain []*x509.Certificate, password string) []byte {
+	var buf bytes.Buffer
+	u32 := func(v uint32) { binary.Write(&buf, binary.BigEndian, v) }
+	utf := func(s string) {
+		binary.Write(&buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	cert := func(c *x509.Certificate) {
+		utf("X.509")
+		u32(uint32(len(c.Raw)))
+		buf.Write(c.Raw)
+	}
+
+	u32(jksMagic)
+	u32(2)
+	u32(2)
+	u32(jksTagPrivateKey)
+	utf("server")
+	binary.Write(&buf, binary.BigEndian, uint64(1700000000000))
+	u32(4)
+	buf.Write([]byte{1, 2, 3, 4})
+	u32(uint32(len(chain)))
+	for _, c := range chain {
+		cert(c)
+	}
+	u32(jksTagTrustedCert)
+	utf("root")
+	binary.Write(&buf, binary.BigEndian, uint64(1700000000000))
+	cert(chain[len(chain)-1])
+
+	h := sha1.New()
+	for _, r := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(r >> 8), byte(r)})
+	}
+	h.Write([]byte(jksDigestWhitener))
+	h.Write(buf.Bytes())
+	return append(buf.Bytes(), h.Sum(nil)...)
+}
+
+func Test_ParseJKS(t *testing.T) {
+	chain := testChain(t)
+	data := testJKS(chain, "changeit")
+	assert.True(t, IsJKS(data))
+	assert.False(t, IsJKS(EncodePEM(chain)))
+
+	for _, password := range []string{"changeit", ""} {
+		entries, err := ParseJKS(data, password)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "server", entries[0].Alias)
+		assert.True(t, entries[0].PrivateKey)
+		assert.Len(t, entries[0].Certificates, 3)
+		assert.Equal(t, int64(1700000000), entries[0].Created.Unix())
+		assert.Equal(t, "root", entries[1].Alias)
+		assert.False(t, entries[1].PrivateKey)
+		assert.Equal(t, Thumbprint(chain[2]), Thumbprint(entries[1].Certificates[0]))
+	}
+
+	_, err := ParseJKS(data, "wrong")
+	assert.Error(t, err)
+	_, err = ParseJKS(data[:40], "")
+	assert.Error(t, err)
+}
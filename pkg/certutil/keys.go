@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// ParsePrivateKey returns the first private key in PEM data, or the key in DER data. PKCS#8, PKCS#1 RSA and SEC 1 EC
+// keys are supported. Encrypted PEM keys are not.
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case PEMTypePrivateKey, "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			return parseDERPrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, fmt.Errorf("encrypted private keys are not supported, decrypt the key or use a PKCS#12 file")
+		}
+	}
+	if len(rest) == len(data) {
+		return parseDERPrivateKey(data)
+	}
+	return nil, fmt.Errorf("no private key found")
+}
+
+func parseDERPrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported or invalid private key")
+}
+
+// KeyMatchesCertificate reports whether the private key belongs to the certificate's public key.
+func KeyMatchesCertificate(key crypto.PrivateKey, cert *x509.Certificate) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const PEMTypePrivateKey = "PRIVATE KEY"
+
+// DecodePKCS12 returns the private key, if any, and every certificate in a PKCS#12 (PFX) file, the certificate of
+// the key first. Files using PBES2 with AES and SHA-2, as written by OpenSSL 3 and Java, are read as well as legacy
+// 3DES and RC2 files.
+func DecodePKCS12(pfxData []byte, password string) (crypto.PrivateKey, []*x509.Certificate, error) {
+	key, cert, caCerts, err := pkcs12.DecodeChain(pfxData, password)
+	if err == nil {
+		return key, append([]*x509.Certificate{cert}, caCerts...), nil
+	}
+	// files without a key, such as trust stores, only hold certificates
+	certs, tErr := pkcs12.DecodeTrustStore(pfxData, password)
+	if tErr != nil || len(certs) == 0 {
+		return nil, nil, fmt.Errorf("unable to decode PKCS#12 data: %s", err)
+	}
+	return nil, certs, nil
+}
+
+// EncodePrivateKeyPEM returns the private key as a PEM encoded PKCS#8 block.
+func EncodePrivateKeyPEM(key crypto.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypePrivateKey, Bytes: der}), nil
+}
+
+// EncodePKCS12 returns a password protected PKCS#12 (PFX) file holding the private key, its certificate and any CA
+// certificates. Keys and certificates are encrypted with AES-256 and the file is protected with a SHA-256 HMAC, which
+// OpenSSL 1.1.1 and later, Java 12 and later and Windows Server 2019 and later can read.
+func EncodePKCS12(key crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, password string) (
+	[]byte,
+	error,
+) {
+	pfx, err := pkcs12.Modern.Encode(key, cert, caCerts, password)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKCS#12 data: %s", err)
+	}
+	return pfx, nil
+}
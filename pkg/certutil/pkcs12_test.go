@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DecodePKCS12(t *testing.T) {
+	// testdata/chain.pfx holds an EC key, its leaf certificate and the issuing root, protected with "changeit".
+	data, err := os.ReadFile("testdata/chain.pfx")
+	assert.NoError(t, err)
+
+	key, certs, err := DecodePKCS12(data, "changeit")
+	assert.NoError(t, err)
+	assert.IsType(t, &ecdsa.PrivateKey{}, key)
+	assert.Len(t, certs, 2)
+
+	ordered := OrderChain(certs, false)
+	assert.Equal(t, "pfx.example.com", ordered[0].Subject.CommonName)
+	assert.Equal(t, "PfxRoot", ordered[1].Subject.CommonName)
+
+	keyPEM, err := EncodePrivateKeyPEM(key)
+	assert.NoError(t, err)
+	assert.Contains(t, string(keyPEM), "BEGIN PRIVATE KEY")
+
+	_, _, err = DecodePKCS12(data, "wrong")
+	assert.Error(t, err)
+}
+
+func Test_DecodePKCS12Modern(t *testing.T) {
+	// testdata/modern.pfx was written by OpenSSL 3 with its defaults: PBES2 with AES-256-CBC and PBKDF2 with
+	// HMAC-SHA-256, and a SHA-256 MAC. It holds an RSA key, its leaf certificate and the issuing root, protected with
+	// "changeit".
+	data, err := os.ReadFile("testdata/modern.pfx")
+	assert.NoError(t, err)
+
+	key, certs, err := DecodePKCS12(data, "changeit")
+	assert.NoError(t, err)
+	assert.IsType(t, &rsa.PrivateKey{}, key)
+	assert.Len(t, certs, 2)
+	assert.Equal(t, "modern.example.com", certs[0].Subject.CommonName)
+	assert.Equal(t, "ModernRoot", certs[1].Subject.CommonName)
+	assert.True(t, KeyMatchesCertificate(key, certs[0]))
+
+	_, _, err = DecodePKCS12(data, "wrong")
+	assert.Error(t, err)
+}
+
+func Test_EncodePKCS12(t *testing.T) {
+	data, err := os.ReadFile("testdata/chain.pfx")
+	assert.NoError(t, err)
+	key, certs, err := DecodePKCS12(data, "changeit")
+	assert.NoError(t, err)
+	ordered := OrderChain(certs, false)
+
+	for _, password := range []string{"s3crét", ""} {
+		pfx, err := EncodePKCS12(key, ordered[0], ordered[1:], password)
+		assert.NoError(t, err)
+
+		decodedKey, decodedCerts, err := DecodePKCS12(pfx, password)
+		assert.NoError(t, err)
+		assert.True(t, key.(*ecdsa.PrivateKey).Equal(decodedKey))
+		assert.Len(t, decodedCerts, 2)
+		assert.Equal(t, Thumbprint(ordered[0]), Thumbprint(decodedCerts[0]))
+		assert.Equal(t, Thumbprint(ordered[1]), Thumbprint(decodedCerts[1]))
+
+		_, _, err = DecodePKCS12(pfx, "wrong")
+		assert.Error(t, err)
+	}
+}
+
+func Test_ParsePrivateKey(t *testing.T) {
+	data, err := os.ReadFile("testdata/chain.pfx")
+	assert.NoError(t, err)
+	key, certs, err := DecodePKCS12(data, "changeit")
+	assert.NoError(t, err)
+	ordered := OrderChain(certs, false)
+
+	keyPEM, err := EncodePrivateKeyPEM(key)
+	assert.NoError(t, err)
+	parsed, err := ParsePrivateKey(append(EncodePEM(ordered[:1]), keyPEM...))
+	assert.NoError(t, err)
+	assert.True(t, KeyMatchesCertificate(parsed, ordered[0]))
+	assert.False(t, KeyMatchesCertificate(parsed, ordered[1]))
+
+	_, err = ParsePrivateKey(EncodePEM(ordered))
+	assert.Error(t, err)
+}
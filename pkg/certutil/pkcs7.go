@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Keyfactor Command Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certutil
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// contentInfo is the outer PKCS#7 structure. Content holds the explicitly tagged [0] content.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+// signedData is the subset of a PKCS#7 SignedData structure needed for certificate bundles ("certs-only" .p7b).
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// IsPKCS7 reports whether the DER data looks like a PKCS#7 SignedData structure.
+func IsPKCS7(der []byte) bool {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return false
+	}
+	return ci.ContentType.Equal(oidSignedData)
+}
+
+// ParsePKCS7 returns the certificates contained in a DER encoded PKCS#7 SignedData structure. Signatures are not
+// verified.
+func ParsePKCS7(der []byte) ([]*x509.Certificate, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 structure: %s", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %s", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 signed data: %s", err)
+	}
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, nil
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate in PKCS#7 structure: %s", err)
+	}
+	return certs, nil
+}
+
+// EncodePKCS7 returns a DER encoded, unsigned PKCS#7 SignedData structure containing the given certificates.
+func EncodePKCS7(certs []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	inner, err := asn1.Marshal(
+		signedData{
+			Version:          1,
+			DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+			ContentInfo:      contentInfo{ContentType: oidData},
+			Certificates: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      raw,
+			},
+			SignerInfos: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(
+		contentInfo{
+			ContentType: oidSignedData,
+			Content: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      inner,
+			},
+		},
+	)
+}